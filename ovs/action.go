@@ -42,15 +42,27 @@ var (
 	// field set to empty strings.
 	errLoadSetFieldZero = errors.New("value and/or field for action load or set_field are empty")
 
+	// errMoveZero is returned when Move is called with src and/or dst set
+	// to empty strings.
+	errMoveZero = errors.New("src and/or dst for action move are empty")
+
 	// errResubmitPortInvalid is returned when ResubmitPort is given a port number that is
 	// invalid per the openflow spec.
 	errResubmitPortInvalid = errors.New("resubmit port must be between 0 and 65279 inclusive")
 
+	// errInvalidARPOperation is returned when an ARP operation code is
+	// larger than Open vSwitch can match or set.
+	errInvalidARPOperation = errors.New("ARP operation must be between 0 and 255")
+
 	// errTooManyDimensions is returned when the specified dimension exceeds the total dimension
 	// in a conjunction action.
 	errDimensionTooLarge = errors.New("dimension number exceeds total number of dimensions")
 )
 
+// maxARPOperation is the largest ARP operation code supported by Open
+// vSwitch, which only matches and sets the low 8 bits of the field.
+const maxARPOperation = 0xff
+
 // Action strings in lower case, as those are compared to the lower case letters
 // in parseAction().
 const (
@@ -62,6 +74,9 @@ const (
 	actionStripVLAN = "strip_vlan"
 )
 
+// actionSetQueue is the name of the action returned by SetQueue.
+const actionSetQueue = "set_queue"
+
 // An Action is a type which can be marshaled into an OpenFlow action. Actions can be
 // used with Flows to perform operations when the Flow matches an input packet.
 //
@@ -96,6 +111,8 @@ func (a *textAction) GoString() string {
 		return "ovs.Normal()"
 	case actionStripVLAN:
 		return "ovs.StripVLAN()"
+	case actionDecMPLSTTL:
+		return "ovs.DecMPLSTTL()"
 	default:
 		return fmt.Sprintf("// BUG(mdlayher): unimplemented OVS text action: %q", a.action)
 	}
@@ -349,6 +366,203 @@ func (a *modVLANVIDAction) GoString() string {
 	return fmt.Sprintf("ovs.ModVLANVID(%d)", a.vid)
 }
 
+// SetARPOperation sets the operation code of an ARP or RARP packet, such
+// as ARPOperationReply.
+func SetARPOperation(op uint16) Action {
+	return &setARPAction{
+		field: arpOp,
+		op:    op,
+	}
+}
+
+// SetARPSourceProtocolAddress sets the source protocol address (SPA) of an
+// ARP or RARP packet.
+func SetARPSourceProtocolAddress(ip net.IP) Action {
+	return &setARPAction{
+		field: arpSPA,
+		ip:    ip.To4(),
+	}
+}
+
+// SetARPTargetProtocolAddress sets the target protocol address (TPA) of an
+// ARP or RARP packet.
+func SetARPTargetProtocolAddress(ip net.IP) Action {
+	return &setARPAction{
+		field: arpTPA,
+		ip:    ip.To4(),
+	}
+}
+
+// SetARPSourceHardwareAddress sets the source hardware address (SHA) of an
+// ARP or RARP packet.
+func SetARPSourceHardwareAddress(addr net.HardwareAddr) Action {
+	return &setARPAction{
+		field: arpSHA,
+		addr:  addr,
+	}
+}
+
+// SetARPTargetHardwareAddress sets the target hardware address (THA) of an
+// ARP or RARP packet.
+func SetARPTargetHardwareAddress(addr net.HardwareAddr) Action {
+	return &setARPAction{
+		field: arpTHA,
+		addr:  addr,
+	}
+}
+
+// A setARPAction is an Action which is used by SetARP{Operation,
+// {Source,Target}{Protocol,Hardware}Address}.
+type setARPAction struct {
+	field string
+	op    uint16
+	ip    net.IP
+	addr  net.HardwareAddr
+}
+
+// MarshalText implements Action.
+func (a *setARPAction) MarshalText() ([]byte, error) {
+	v, err := a.value()
+	if err != nil {
+		return nil, err
+	}
+
+	return bprintf("set_field:%s->%s", v, a.field), nil
+}
+
+// value returns the textual form of the value a sets.
+func (a *setARPAction) value() (string, error) {
+	switch a.field {
+	case arpOp:
+		if a.op > maxARPOperation {
+			return "", errInvalidARPOperation
+		}
+
+		return strconv.Itoa(int(a.op)), nil
+	case arpSPA, arpTPA:
+		if a.ip == nil {
+			return "", errors.New("invalid IPv4 address for SetARP action")
+		}
+
+		return a.ip.String(), nil
+	}
+
+	if len(a.addr) != ethernetAddrLen {
+		return "", fmt.Errorf("hardware address must be %d octets, but got %d",
+			ethernetAddrLen, len(a.addr))
+	}
+
+	return a.addr.String(), nil
+}
+
+// GoString implements Action.
+func (a *setARPAction) GoString() string {
+	switch a.field {
+	case arpOp:
+		switch a.op {
+		case ARPOperationRequest:
+			return "ovs.SetARPOperation(ovs.ARPOperationRequest)"
+		case ARPOperationReply:
+			return "ovs.SetARPOperation(ovs.ARPOperationReply)"
+		}
+
+		return fmt.Sprintf("ovs.SetARPOperation(%d)", a.op)
+	case arpSPA:
+		return fmt.Sprintf("ovs.SetARPSourceProtocolAddress(%s)", ipv4GoString(a.ip))
+	case arpTPA:
+		return fmt.Sprintf("ovs.SetARPTargetProtocolAddress(%s)", ipv4GoString(a.ip))
+	case arpSHA:
+		return fmt.Sprintf("ovs.SetARPSourceHardwareAddress(%s)", hwAddrGoString(a.addr))
+	}
+
+	return fmt.Sprintf("ovs.SetARPTargetHardwareAddress(%s)", hwAddrGoString(a.addr))
+}
+
+// SetPacketMark sets the bits of the Linux packet mark, or skb->mark, of a
+// packet which are set in mask to value.  If mask is zero, the entire packet
+// mark is set to value.
+func SetPacketMark(value, mask uint32) Action {
+	return &setPacketMetadataAction{
+		field: pktMark,
+		value: uint64(value),
+		mask:  uint64(mask),
+		width: 32,
+	}
+}
+
+// SetMetadata sets the bits of the OpenFlow metadata of a packet which are
+// set in mask to value.  If mask is zero, the entire metadata is set to
+// value.  Unlike the WriteMetadata instruction, SetMetadata is applied
+// immediately and may be used anywhere in a list of actions.
+func SetMetadata(value, mask uint64) Action {
+	return &setPacketMetadataAction{
+		field: metadata,
+		value: value,
+		mask:  mask,
+		width: 64,
+	}
+}
+
+// A setPacketMetadataAction is an Action which is used by SetPacketMark and
+// SetMetadata.
+type setPacketMetadataAction struct {
+	field string
+	value uint64
+	mask  uint64
+	width uint
+}
+
+// MarshalText implements Action.
+func (a *setPacketMetadataAction) MarshalText() ([]byte, error) {
+	return bprintf("set_field:%s->%s", a.valueMask(), a.field), nil
+}
+
+// valueMask returns the textual form of the value a sets, and its mask if
+// only part of the field is set.
+func (a *setPacketMetadataAction) valueMask() string {
+	full := ^uint64(0) >> (64 - a.width)
+	if a.mask == 0 || a.mask&full == full {
+		return fmt.Sprintf("%#x", a.value)
+	}
+
+	return fmt.Sprintf("%#x/%#x", a.value, a.mask)
+}
+
+// GoString implements Action.
+func (a *setPacketMetadataAction) GoString() string {
+	switch a.field {
+	case pktMark:
+		return fmt.Sprintf("ovs.SetPacketMark(%#x, %#x)", a.value, a.mask)
+	}
+
+	return fmt.Sprintf("ovs.SetMetadata(%#x, %#x)", a.value, a.mask)
+}
+
+// SetQueue sets the queue used when a packet is output to a port, which Open
+// vSwitch maps to the Linux queueing priority, or skb->priority, of the
+// packet.  skb_priority itself is read-only, so SetQueue is the only way to
+// change it.
+func SetQueue(queue uint32) Action {
+	return &setQueueAction{
+		queue: queue,
+	}
+}
+
+// A setQueueAction is an Action which is used by SetQueue.
+type setQueueAction struct {
+	queue uint32
+}
+
+// MarshalText implements Action.
+func (a *setQueueAction) MarshalText() ([]byte, error) {
+	return bprintf("%s:%d", actionSetQueue, a.queue), nil
+}
+
+// GoString implements Action.
+func (a *setQueueAction) GoString() string {
+	return fmt.Sprintf("ovs.SetQueue(%d)", a.queue)
+}
+
 // Output outputs the packet to the specified switch port.  Use
 // InPortLocal to output the packet to the LOCAL port.  port must either
 // be a non-negative integer.
@@ -535,6 +749,36 @@ func (a *loadSetFieldAction) GoString() string {
 	return fmt.Sprintf("ovs.SetField(%q, %q)", a.value, a.field)
 }
 
+// Move copies the bits of the src field to the dst field, which must be of
+// the same width.  Fields may specify a bit range, as in "reg0[0..15]".
+// If either string is empty, an error is returned.
+func Move(src string, dst string) Action {
+	return &moveAction{
+		src: src,
+		dst: dst,
+	}
+}
+
+// A moveAction is an Action which is used by Move.
+type moveAction struct {
+	src string
+	dst string
+}
+
+// MarshalText implements Action.
+func (a *moveAction) MarshalText() ([]byte, error) {
+	if a.src == "" || a.dst == "" {
+		return nil, errMoveZero
+	}
+
+	return bprintf("move:%s->%s", a.src, a.dst), nil
+}
+
+// GoString implements Action.
+func (a *moveAction) GoString() string {
+	return fmt.Sprintf("ovs.Move(%q, %q)", a.src, a.dst)
+}
+
 // SetTunnel sets the tunnel id, e.g. VNI if vxlan is the tunnel protocol.
 func SetTunnel(tunnelID uint64) Action {
 	return &setTunnelAction{
@@ -157,6 +157,126 @@ func TestActionModDataLink(t *testing.T) {
 	}
 }
 
+func TestActionSetPacketMetadata(t *testing.T) {
+	var tests = []struct {
+		desc string
+		a    Action
+		out  string
+	}{
+		{
+			desc: "packet mark",
+			a:    SetPacketMark(0x10, 0),
+			out:  "set_field:0x10->pkt_mark",
+		},
+		{
+			desc: "masked packet mark",
+			a:    SetPacketMark(0x10, 0xf0),
+			out:  "set_field:0x10/0xf0->pkt_mark",
+		},
+		{
+			desc: "packet mark all ones mask",
+			a:    SetPacketMark(0x10, 0xffffffff),
+			out:  "set_field:0x10->pkt_mark",
+		},
+		{
+			desc: "set queue",
+			a:    SetQueue(2),
+			out:  "set_queue:2",
+		},
+		{
+			desc: "metadata",
+			a:    SetMetadata(0xdeadbeef00000000, 0),
+			out:  "set_field:0xdeadbeef00000000->metadata",
+		},
+		{
+			desc: "masked metadata",
+			a:    SetMetadata(0x1, 0xff),
+			out:  "set_field:0x1/0xff->metadata",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			action, err := tt.a.MarshalText()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if want, got := tt.out, string(action); want != got {
+				t.Fatalf("unexpected Action:\n- want: %q\n-  got: %q",
+					want, got)
+			}
+		})
+	}
+}
+
+func TestActionSetARP(t *testing.T) {
+	var tests = []struct {
+		desc    string
+		a       Action
+		out     string
+		invalid bool
+	}{
+		{
+			desc: "operation reply",
+			a:    SetARPOperation(ARPOperationReply),
+			out:  "set_field:2->arp_op",
+		},
+		{
+			desc:    "operation too large",
+			a:       SetARPOperation(256),
+			invalid: true,
+		},
+		{
+			desc: "source protocol address",
+			a:    SetARPSourceProtocolAddress(net.IPv4(192, 0, 2, 1)),
+			out:  "set_field:192.0.2.1->arp_spa",
+		},
+		{
+			desc:    "target protocol address IPv6",
+			a:       SetARPTargetProtocolAddress(net.ParseIP("2001:db8::1")),
+			invalid: true,
+		},
+		{
+			desc: "target protocol address",
+			a:    SetARPTargetProtocolAddress(net.IPv4(192, 0, 2, 2)),
+			out:  "set_field:192.0.2.2->arp_tpa",
+		},
+		{
+			desc: "source hardware address",
+			a:    SetARPSourceHardwareAddress(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}),
+			out:  "set_field:de:ad:be:ef:de:ad->arp_sha",
+		},
+		{
+			desc:    "target hardware address too short",
+			a:       SetARPTargetHardwareAddress(net.HardwareAddr{0xde}),
+			invalid: true,
+		},
+		{
+			desc: "target hardware address",
+			a:    SetARPTargetHardwareAddress(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0x00, 0x01}),
+			out:  "set_field:de:ad:be:ef:00:01->arp_tha",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			action, err := tt.a.MarshalText()
+			if err != nil && !tt.invalid {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err == nil && tt.invalid {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if want, got := tt.out, string(action); want != got {
+				t.Fatalf("unexpected Action:\n- want: %q\n-  got: %q",
+					want, got)
+			}
+		})
+	}
+}
+
 func TestActionModNetwork(t *testing.T) {
 	var tests = []struct {
 		desc    string
@@ -636,10 +756,38 @@ func TestActionGoString(t *testing.T) {
 			a: Load("0x2", "NXM_OF_ARP_OP[]"),
 			s: `ovs.Load("0x2", "NXM_OF_ARP_OP[]")`,
 		},
+		{
+			a: Move("reg0[0..15]", "reg1[16..31]"),
+			s: `ovs.Move("reg0[0..15]", "reg1[16..31]")`,
+		},
 		{
 			a: SetField("192.168.1.1", "arp_spa"),
 			s: `ovs.SetField("192.168.1.1", "arp_spa")`,
 		},
+		{
+			a: SetARPOperation(ARPOperationReply),
+			s: `ovs.SetARPOperation(ovs.ARPOperationReply)`,
+		},
+		{
+			a: SetARPSourceProtocolAddress(net.IPv4(192, 0, 2, 1)),
+			s: `ovs.SetARPSourceProtocolAddress(net.IPv4(192, 0, 2, 1))`,
+		},
+		{
+			a: SetARPTargetHardwareAddress(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}),
+			s: `ovs.SetARPTargetHardwareAddress(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad})`,
+		},
+		{
+			a: SetPacketMark(0x1, 0xff),
+			s: `ovs.SetPacketMark(0x1, 0xff)`,
+		},
+		{
+			a: SetQueue(2),
+			s: `ovs.SetQueue(2)`,
+		},
+		{
+			a: SetMetadata(0x1, 0),
+			s: `ovs.SetMetadata(0x1, 0x0)`,
+		},
 		{
 			a: SetTunnel(10),
 			s: `ovs.SetTunnel(0xa)`,
@@ -15,367 +15,336 @@
 package ovs
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
-	"io"
+	"math"
 	"net"
-	"regexp"
 	"strconv"
 	"strings"
 )
 
-// An actionParser is a parser for OVS flow actions.
-type actionParser struct {
-	r *bufio.Reader
-	s stack
-}
-
-// newActionParser creates a new actionParser which wraps the input
-// io.Reader.
-func newActionParser(r io.Reader) *actionParser {
-	return &actionParser{
-		r: bufio.NewReader(r),
-		s: make(stack, 0),
-	}
-}
-
-// eof is a sentinel rune for end of file.
-var eof = rune(0)
-
-// read reads a single rune from the wrapped io.Reader.  It returns eof
-// if no more runes are present.
-func (p *actionParser) read() rune {
-	ch, _, err := p.r.ReadRune()
-	if err != nil {
-		return eof
-	}
-	return ch
-}
-
-// Parse parses a slice of Actions using the wrapped io.Reader.  The raw
-// action strings are also returned for inspection if needed.
-func (p *actionParser) Parse() ([]Action, []string, error) {
-	var actions []Action
-	var raw []string
-
-	for {
-		a, r, err := p.parseAction()
-		if err != nil {
-			// No more actions remain
-			if err == io.EOF {
-				break
+// splitActions splits s into its comma-separated actions, and invokes fn
+// with each action in turn.  Commas within parentheses, such as those in
+// "ct(commit,table=1)", do not separate actions.  The strings passed to fn
+// are substrings of s, so no copies are made.
+func splitActions(s string, fn func(raw string) error) error {
+	var depth, start int
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+			continue
+		case ')':
+			// Track open and closing parentheses to ensure that they are
+			// appropriately matched.
+			if depth--; depth < 0 {
+				return fmt.Errorf("invalid action: %q", s[start:i+1])
 			}
-
-			return nil, nil, err
-		}
-
-		actions = append(actions, a)
-		raw = append(raw, r)
-	}
-
-	return actions, raw, nil
-}
-
-// parseAction parses a single Action and its raw text from the wrapped
-// io.Reader.
-func (p *actionParser) parseAction() (Action, string, error) {
-	// Track runes encountered
-	var buf bytes.Buffer
-
-	for {
-		ch := p.read()
-
-		// If comma encountered and no open parentheses, at end of this
-		// action string
-		if ch == ',' && p.s.len() == 0 {
-			break
-		}
-
-		// If EOF encountered, at end of string
-		if ch == eof {
-			// If no items in buffer, end of this action
-			if buf.Len() == 0 {
-				return nil, "", io.EOF
+			continue
+		case ',':
+			// If comma encountered and no open parentheses, at end of this
+			// action string.
+			if depth > 0 {
+				continue
 			}
-
-			// Parse action from buffer
-			break
+		default:
+			continue
 		}
 
-		// Track open and closing parentheses using a stack to ensure
-		// that they are appropriately matched
-		switch ch {
-		case '(':
-			p.s.push()
-		case ')':
-			p.s.pop()
+		if err := fn(s[start:i]); err != nil {
+			return err
 		}
+		start = i + 1
+	}
 
-		_, _ = buf.WriteRune(ch)
+	// Found an unmatched set of parentheses.
+	if depth > 0 {
+		return fmt.Errorf("invalid action: %q", s[start:])
 	}
 
-	// Found an unmatched set of parentheses
-	if p.s.len() > 0 {
-		return nil, "", fmt.Errorf("invalid action: %q", buf.String())
+	// Trailing action, if any.
+	if start < len(s) {
+		return fn(s[start:])
 	}
 
-	s := buf.String()
-	act, err := parseAction(s)
-	return act, s, err
+	return nil
 }
 
-// A stack is a basic stack with elements that have no value.
-type stack []struct{}
-
-// len returns the current length of the stack.
-func (s *stack) len() int {
-	return len(*s)
-}
+// parseActions parses the comma-separated actions in s, and appends them
+// to actions.
+func parseActions(s string, actions []Action) ([]Action, error) {
+	err := splitActions(s, func(raw string) error {
+		a, err := parseAction(raw)
+		if err != nil {
+			return err
+		}
 
-// push adds an element to the stack.
-func (s *stack) push() {
-	*s = append(*s, struct{}{})
-}
+		actions = append(actions, a)
+		return nil
+	})
 
-// pop removes an element from the stack.
-func (s *stack) pop() {
-	*s = (*s)[:s.len()-1]
+	return actions, err
 }
 
-var (
-	// resubmitRe is the regex used to match the resubmit action
-	// with port and table specified
-	resubmitRe = regexp.MustCompile(`resubmit\((\d*),(\d*)\)`)
-
-	// resubmitPortRe is the regex used to match the resubmit action
-	// when only a port is specified
-	resubmitPortRe = regexp.MustCompile(`resubmit:(\d+)`)
-
-	// ctRe is the regex used to match the ct action with its
-	// parameter list.
-	ctRe = regexp.MustCompile(`ct\((\S+)\)`)
-
-	// loadRe is the regex used to match the load action
-	// with its parameters.
-	loadRe = regexp.MustCompile(`load:(\S+)->(\S+)`)
-
-	// setFieldRe is the regex used to match the set_field action
-	// with its parameters.
-	setFieldRe = regexp.MustCompile(`set_field:(\S+)->(\S+)`)
-)
-
-// TODO(mdlayher): replace parsing regex with arguments parsers
-
 // parseAction creates an Action function from the input string.
 func parseAction(s string) (Action, error) {
 	// Simple actions which match a basic string
-	switch strings.ToLower(s) {
-	case actionDrop:
+	switch {
+	case strings.EqualFold(s, actionDrop):
 		return Drop(), nil
-	case actionFlood:
+	case strings.EqualFold(s, actionFlood):
 		return Flood(), nil
-	case actionInPort:
+	case strings.EqualFold(s, actionInPort):
 		return InPort(), nil
-	case actionLocal:
+	case strings.EqualFold(s, actionLocal):
 		return Local(), nil
-	case actionNormal:
+	case strings.EqualFold(s, actionNormal):
 		return Normal(), nil
-	case actionStripVLAN:
+	case strings.EqualFold(s, actionStripVLAN):
 		return StripVLAN(), nil
+	case strings.EqualFold(s, actionDecMPLSTTL):
+		return DecMPLSTTL(), nil
 	}
 
-	// ActionCT, with its arguments
-	if ss := ctRe.FindAllStringSubmatch(s, 1); len(ss) > 0 && len(ss[0]) == 2 {
-		// Results are:
-		//  - full string
-		//  - arguments list
-		return ConnectionTracking(ss[0][1]), nil
+	// OpenFlow 1.1+ instructions, which may contain other actions and so
+	// must be parsed before the patterns below.
+	if a, ok, err := parseInstruction(s); ok {
+		return a, err
 	}
 
-	// ActionModDataLinkDestination, with its hardware address.
-	if strings.HasPrefix(s, patModDataLinkDestination[:len(patModDataLinkDestination)-2]) {
-		var addr string
-		n, err := fmt.Sscanf(s, patModDataLinkDestination, &addr)
-		if err != nil {
-			return nil, err
-		}
-		if n > 0 {
-			mac, err := net.ParseMAC(addr)
-			if err != nil {
-				return nil, err
-			}
+	// Actions with arguments are recognized by their prefix, which is the
+	// name of the action followed by ':' or '('.
+	i := strings.IndexAny(s, ":(")
+	if i == -1 {
+		return nil, fmt.Errorf("no action matched for %q", s)
+	}
+	name, sep, arg := s[:i], s[i], s[i+1:]
 
-			return ModDataLinkDestination(mac), nil
+	// Arguments in parentheses must be closed.
+	if sep == '(' {
+		if !strings.HasSuffix(arg, ")") {
+			return nil, fmt.Errorf("no action matched for %q", s)
 		}
+		arg = arg[:len(arg)-1]
 	}
 
-	// ActionModDataLinkSource, with its hardware address.
-	if strings.HasPrefix(s, patModDataLinkSource[:len(patModDataLinkSource)-2]) {
-		var addr string
-		n, err := fmt.Sscanf(s, patModDataLinkSource, &addr)
-		if err != nil {
-			return nil, err
+	switch {
+	case name == "ct" && sep == '(':
+		// ActionCT, with its arguments
+		if arg == "" {
+			return nil, fmt.Errorf("no action matched for %q", s)
 		}
-		if n > 0 {
-			mac, err := net.ParseMAC(addr)
-			if err != nil {
-				return nil, err
-			}
 
-			return ModDataLinkSource(mac), nil
+		return ConnectionTracking(arg), nil
+	case name == "mod_dl_dst" && sep == ':':
+		// ActionModDataLinkDestination, with its hardware address.
+		mac, err := net.ParseMAC(arg)
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	// ActionModNetworkDestination, with it hardware address
-	if strings.HasPrefix(s, patModNetworkDestination[:len(patModNetworkDestination)-2]) {
-		var ip string
-		n, err := fmt.Sscanf(s, patModNetworkDestination, &ip)
+		return ModDataLinkDestination(mac), nil
+	case name == "mod_dl_src" && sep == ':':
+		// ActionModDataLinkSource, with its hardware address.
+		mac, err := net.ParseMAC(arg)
 		if err != nil {
 			return nil, err
 		}
-		if n > 0 {
-			ip4 := net.ParseIP(ip).To4()
-			if ip4 == nil {
-				return nil, fmt.Errorf("invalid IPv4 address: %s", ip)
-			}
 
-			return ModNetworkDestination(ip4), nil
+		return ModDataLinkSource(mac), nil
+	case name == "mod_nw_dst" && sep == ':':
+		// ActionModNetworkDestination, with its IPv4 address.
+		ip4 := net.ParseIP(arg).To4()
+		if ip4 == nil {
+			return nil, fmt.Errorf("invalid IPv4 address: %s", arg)
+		}
+
+		return ModNetworkDestination(ip4), nil
+	case name == "mod_nw_src" && sep == ':':
+		// ActionModNetworkSource, with its IPv4 address.
+		ip4 := net.ParseIP(arg).To4()
+		if ip4 == nil {
+			return nil, fmt.Errorf("invalid IPv4 address: %s", arg)
 		}
-	}
 
-	// ActionModNetworkSource, with it hardware address
-	if strings.HasPrefix(s, patModNetworkSource[:len(patModNetworkSource)-2]) {
-		var ip string
-		n, err := fmt.Sscanf(s, patModNetworkSource, &ip)
+		return ModNetworkSource(ip4), nil
+	case name == "mod_tp_dst" && sep == ':':
+		// ActionModTransportDestinationPort, with its port.
+		port, err := strconv.ParseUint(arg, 10, 16)
 		if err != nil {
 			return nil, err
 		}
-		if n > 0 {
-			ip4 := net.ParseIP(ip).To4()
-			if ip4 == nil {
-				return nil, fmt.Errorf("invalid IPv4 address: %s", ip)
-			}
 
-			return ModNetworkSource(ip4), nil
+		return ModTransportDestinationPort(uint16(port)), nil
+	case name == "mod_tp_src" && sep == ':':
+		// ActionModTransportSourcePort, with its port.
+		port, err := strconv.ParseUint(arg, 10, 16)
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	// ActionModTransportDestinationPort, with its port.
-	if strings.HasPrefix(s, patModTransportDestinationPort[:len(patModTransportDestinationPort)-2]) {
-		var port uint16
-		n, err := fmt.Sscanf(s, patModTransportDestinationPort, &port)
+		return ModTransportSourcePort(uint16(port)), nil
+	case name == "mod_vlan_vid" && sep == ':':
+		// ActionModVLANVID, with its VLAN ID
+		vlan, err := strconv.Atoi(arg)
 		if err != nil {
 			return nil, err
 		}
-		if n > 0 {
-			return ModTransportDestinationPort(port), nil
-		}
-	}
 
-	// ActionModTransportSourcePort, with its port.
-	if strings.HasPrefix(s, patModTransportSourcePort[:len(patModTransportSourcePort)-2]) {
-		var port uint16
-		n, err := fmt.Sscanf(s, patModTransportSourcePort, &port)
+		return ModVLANVID(vlan), nil
+	case name == "conjunction" && sep == '(':
+		// ActionConjunction, with it's id, dimension number, and dimension size
+		return parseConjunction(s, arg)
+	case name == "output" && sep == ':':
+		// ActionOutput, with its port number
+		port, err := strconv.Atoi(arg)
 		if err != nil {
 			return nil, err
 		}
-		if n > 0 {
-			return ModTransportSourcePort(port), nil
+
+		return Output(port), nil
+	case name == "resubmit" && sep == '(':
+		// ActionResubmit, with both port number and table number
+		j := strings.IndexByte(arg, ',')
+		if j == -1 {
+			return nil, fmt.Errorf("no action matched for %q", s)
 		}
-	}
 
-	// ActionModVLANVID, with its VLAN ID
-	if strings.HasPrefix(s, patModVLANVID[:len(patModVLANVID)-2]) {
-		var vlan int
-		n, err := fmt.Sscanf(s, patModVLANVID, &vlan)
+		port, err := parseOptionalUint(arg[:j])
 		if err != nil {
 			return nil, err
 		}
-		if n > 0 {
-			return ModVLANVID(vlan), nil
-		}
-	}
-
-	// ActionConjunction, with it's id, dimension number, and dimension size
-	if strings.HasPrefix(s, patConjunction[:len(patConjunction)-10]) {
-		var id, dimensionNumber, dimensionSize int
-		n, err := fmt.Sscanf(s, patConjunction, &id, &dimensionNumber, &dimensionSize)
+		table, err := parseOptionalUint(arg[j+1:])
 		if err != nil {
 			return nil, err
 		}
-		if n > 0 {
-			return Conjunction(id, dimensionNumber, dimensionSize), nil
+
+		return Resubmit(port, table), nil
+	case name == actionSetQueue && sep == ':':
+		queue, err := strconv.ParseUint(arg, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s action: %q", actionSetQueue, arg)
 		}
-	}
 
-	// ActionOutput, with its port number
-	if strings.HasPrefix(s, patOutput[:len(patOutput)-2]) {
-		var port int
-		n, err := fmt.Sscanf(s, patOutput, &port)
+		return SetQueue(uint32(queue)), nil
+	case name == "resubmit" && sep == ':':
+		// ActionResubmitPort, with only a port number
+		port, err := strconv.ParseUint(arg, 10, 31)
 		if err != nil {
 			return nil, err
 		}
-		if n > 0 {
-			return Output(port), nil
+
+		return ResubmitPort(int(port)), nil
+	case (name == actionPushMPLS || name == actionPopMPLS) && sep == ':',
+		name == actionSetMPLSLabel && sep == '(':
+		// MPLS label stack actions.
+		return parseMPLSAction(name, arg)
+	case name == actionEncap && sep == '(':
+		return parseEncap(arg)
+	case name == actionDecap && sep == '(':
+		return parseDecap(arg)
+	case name == "load" && sep == ':':
+		if value, field, ok := splitArrow(arg); ok {
+			return Load(value, field), nil
+		}
+	case name == "move" && sep == ':':
+		if src, dst, ok := splitArrow(arg); ok {
+			return Move(src, dst), nil
+		}
+	case name == "set_field" && sep == ':':
+		if value, field, ok := splitArrow(arg); ok {
+			return parseSetField(value, field), nil
 		}
 	}
 
-	// ActionResubmit, with both port number and table number
-	if ss := resubmitRe.FindAllStringSubmatch(s, 1); len(ss) > 0 && len(ss[0]) == 3 {
-		var (
-			port  int
-			table int
-
-			err error
-		)
-
-		// Results are:
-		//  - full string
-		//  - port in parenthesis
-		//  - table in parenthesis
+	return nil, fmt.Errorf("no action matched for %q", s)
+}
 
-		if s := ss[0][1]; s != "" {
-			port, err = strconv.Atoi(s)
-			if err != nil {
-				return nil, err
+// parseSetField parses the value and field of a set_field action.  Fields
+// with typed Actions, such as arp_op, produce those Actions, while values
+// which cannot be represented by them, such as masked ARP fields, produce a
+// SetField action.
+func parseSetField(value, field string) Action {
+	switch field {
+	case arpOp:
+		if op, err := strconv.ParseUint(value, 0, 8); err == nil {
+			return SetARPOperation(uint16(op))
+		}
+	case arpSPA, arpTPA:
+		if ip := net.ParseIP(value).To4(); ip != nil {
+			if field == arpSPA {
+				return SetARPSourceProtocolAddress(ip)
 			}
+
+			return SetARPTargetProtocolAddress(ip)
 		}
-		if s := ss[0][2]; s != "" {
-			table, err = strconv.Atoi(s)
-			if err != nil {
-				return nil, err
+	case arpSHA, arpTHA:
+		if mac, err := net.ParseMAC(value); err == nil && len(mac) == ethernetAddrLen {
+			if field == arpSHA {
+				return SetARPSourceHardwareAddress(mac)
 			}
+
+			return SetARPTargetHardwareAddress(mac)
+		}
+	case pktMark:
+		v, mask, err := parseMaskedUint64(value)
+		if err != nil || v > math.MaxUint32 || mask > math.MaxUint32 {
+			break
 		}
 
-		return Resubmit(port, table), nil
+		return SetPacketMark(uint32(v), uint32(mask))
+	case metadata:
+		if v, mask, err := parseMaskedUint64(value); err == nil {
+			return SetMetadata(v, mask)
+		}
 	}
 
-	// ActionResubmitPort, with only a port number
-	if ss := resubmitPortRe.FindAllStringSubmatch(s, 1); len(ss) > 0 && len(ss[0]) == 2 {
-		port, err := strconv.Atoi(ss[0][1])
-		if err != nil {
-			return nil, err
-		}
+	return SetField(value, field)
+}
 
-		return ResubmitPort(port), nil
+// parseConjunction parses the arguments of a conjunction action, such as
+// "1,2/3", from the action string s.
+func parseConjunction(s, arg string) (Action, error) {
+	i := strings.IndexByte(arg, ',')
+	j := strings.IndexByte(arg, '/')
+	if i == -1 || j < i {
+		return nil, fmt.Errorf("invalid conjunction action: %q", s)
 	}
 
-	if ss := loadRe.FindAllStringSubmatch(s, 2); len(ss) > 0 && len(ss[0]) == 3 {
-		// Results are:
-		//  - full string
-		//  - value
-		//  - field
-		return Load(ss[0][1], ss[0][2]), nil
+	id, err := strconv.Atoi(arg[:i])
+	if err != nil {
+		return nil, err
+	}
+	dimensionNumber, err := strconv.Atoi(arg[i+1 : j])
+	if err != nil {
+		return nil, err
+	}
+	dimensionSize, err := strconv.Atoi(arg[j+1:])
+	if err != nil {
+		return nil, err
 	}
 
-	if ss := setFieldRe.FindAllStringSubmatch(s, 2); len(ss) > 0 && len(ss[0]) == 3 {
-		// Results are:
-		//  - full string
-		//  - value
-		//  - field
-		return SetField(ss[0][1], ss[0][2]), nil
+	return Conjunction(id, dimensionNumber, dimensionSize), nil
+}
+
+// parseOptionalUint parses a decimal integer from s, or returns zero if s is
+// empty.
+func parseOptionalUint(s string) (int, error) {
+	if s == "" {
+		return 0, nil
 	}
 
-	return nil, fmt.Errorf("no action matched for %q", s)
+	v, err := strconv.ParseUint(s, 10, 31)
+	return int(v), err
+}
+
+// splitArrow splits the argument of a load, set_field, or move action, such
+// as "0x1->NXM_NX_REG0[]", into its value and field.  Both must be
+// non-empty.
+func splitArrow(arg string) (value, field string, ok bool) {
+	i := strings.LastIndex(arg, "->")
+	if i <= 0 || i+2 == len(arg) {
+		return "", "", false
+	}
+
+	return arg[:i], arg[i+2:], true
 }
@@ -21,7 +21,7 @@ import (
 	"testing"
 )
 
-func Test_actionParser(t *testing.T) {
+func Test_splitActions(t *testing.T) {
 	var tests = []struct {
 		name    string
 		in      string
@@ -33,6 +33,11 @@ func Test_actionParser(t *testing.T) {
 			in:      "strip_vlan,resubmit(",
 			invalid: true,
 		},
+		{
+			name:    "unmatched closing parenthesis",
+			in:      "strip_vlan,resubmit(,1))",
+			invalid: true,
+		},
 		{
 			name: "one action",
 			in:   "strip_vlan",
@@ -61,8 +66,11 @@ func Test_actionParser(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p := newActionParser(strings.NewReader(tt.in))
-			actions, raw, err := p.Parse()
+			var raw []string
+			err := splitActions(tt.in, func(s string) error {
+				raw = append(raw, s)
+				return nil
+			})
 			if err != nil {
 				if tt.invalid {
 					return
@@ -76,6 +84,11 @@ func Test_actionParser(t *testing.T) {
 					want, got)
 			}
 
+			actions, err := parseActions(tt.in, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
 			as, err := (&Flow{Actions: actions}).marshalActions()
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
@@ -269,6 +282,14 @@ func Test_parseAction(t *testing.T) {
 			s: "load:0x2->NXM_OF_ARP_OP[]",
 			a: Load("0x2", "NXM_OF_ARP_OP[]"),
 		},
+		{
+			s:       "move:NXM_NX_REG0[]->",
+			invalid: true,
+		},
+		{
+			s: "move:NXM_NX_REG0[0..15]->NXM_NX_REG1[16..31]",
+			a: Move("NXM_NX_REG0[0..15]", "NXM_NX_REG1[16..31]"),
+		},
 		{
 			s:       "set_field:->arp_spa",
 			invalid: true,
@@ -279,7 +300,60 @@ func Test_parseAction(t *testing.T) {
 		},
 		{
 			s: "set_field:192.168.1.1->arp_spa",
-			a: SetField("192.168.1.1", "arp_spa"),
+			a: SetARPSourceProtocolAddress(net.IPv4(192, 168, 1, 1)),
+		},
+		{
+			s: "set_field:192.168.1.2->arp_tpa",
+			a: SetARPTargetProtocolAddress(net.IPv4(192, 168, 1, 2)),
+		},
+		{
+			s: "set_field:2->arp_op",
+			a: SetARPOperation(ARPOperationReply),
+		},
+		{
+			s:     "set_field:0x1->arp_op",
+			final: "set_field:1->arp_op",
+			a:     SetARPOperation(ARPOperationRequest),
+		},
+		{
+			s: "set_field:de:ad:be:ef:de:ad->arp_sha",
+			a: SetARPSourceHardwareAddress(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}),
+		},
+		{
+			s: "set_field:de:ad:be:ef:de:ad->arp_tha",
+			a: SetARPTargetHardwareAddress(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}),
+		},
+		{
+			s: "set_field:0x10/0xf0->pkt_mark",
+			a: SetPacketMark(0x10, 0xf0),
+		},
+		{
+			desc: "skb_priority is not typed",
+			s:    "set_field:0x10001->skb_priority",
+			a:    SetField("0x10001", "skb_priority"),
+		},
+		{
+			s: "set_queue:2",
+			a: SetQueue(2),
+		},
+		{
+			s:       "set_queue:-1",
+			invalid: true,
+		},
+		{
+			s:     "set_field:0x1/0xffffffffffffffff->metadata",
+			final: "set_field:0x1->metadata",
+			a:     SetMetadata(0x1, 0xffffffffffffffff),
+		},
+		{
+			desc: "masked skb_priority",
+			s:    "set_field:0x1/0xff->skb_priority",
+			a:    SetField("0x1/0xff", "skb_priority"),
+		},
+		{
+			desc: "masked values are not typed",
+			s:    "set_field:0x1/0xff->arp_op",
+			a:    SetField("0x1/0xff", "arp_op"),
 		},
 		{
 			s: "conjunction(123,1/2)",
@@ -309,6 +383,11 @@ func Test_parseAction(t *testing.T) {
 				return
 			}
 
+			if tt.a != nil && !reflect.DeepEqual(tt.a, a) {
+				t.Fatalf("unexpected action:\n- want: %#v\n-  got: %#v",
+					tt.a, a)
+			}
+
 			s, err := a.MarshalText()
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
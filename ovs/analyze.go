@@ -0,0 +1,546 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A FlowIssueKind is a kind of problem found by AnalyzeFlows.
+type FlowIssueKind int
+
+// Kinds of problems found by AnalyzeFlows.
+const (
+	// FlowShadowed indicates that a flow can never match a packet, because
+	// every packet it matches is also matched by a higher priority flow.
+	FlowShadowed FlowIssueKind = iota
+
+	// FlowOverlapping indicates that a flow may match the same packets as
+	// another flow with the same priority, in which case the behavior of
+	// Open vSwitch is undefined.
+	FlowOverlapping
+
+	// FlowMissingTable indicates that a flow resubmits or sends packets to
+	// a table which contains no flows.
+	FlowMissingTable
+
+	// FlowUnused indicates that a flow has not matched any packets for
+	// longer than AnalyzeOptions.UnusedAge.
+	FlowUnused
+)
+
+// String returns the string representation of a FlowIssueKind.
+func (k FlowIssueKind) String() string {
+	switch k {
+	case FlowShadowed:
+		return "shadowed"
+	case FlowOverlapping:
+		return "overlapping"
+	case FlowMissingTable:
+		return "missing table"
+	case FlowUnused:
+		return "unused"
+	default:
+		return fmt.Sprintf("FlowIssueKind(%d)", int(k))
+	}
+}
+
+// A FlowIssue is a problem found by AnalyzeFlows.
+type FlowIssue struct {
+	// Kind specifies the kind of problem.
+	Kind FlowIssueKind
+
+	// Flow is the flow with the problem.
+	Flow *Flow
+
+	// Other is the flow which shadows or overlaps Flow, for FlowShadowed
+	// and FlowOverlapping issues.
+	Other *Flow
+
+	// Table is the table which contains no flows, for FlowMissingTable
+	// issues.
+	Table int
+
+	// Usage contains the counters of Flow, for FlowUnused issues.
+	Usage *FlowUsage
+}
+
+// String returns a human readable description of a FlowIssue.
+func (i FlowIssue) String() string {
+	f := flowIssueString(i.Flow)
+
+	switch i.Kind {
+	case FlowShadowed:
+		return fmt.Sprintf("%s: shadowed by %s", f, flowIssueString(i.Other))
+	case FlowOverlapping:
+		return fmt.Sprintf("%s: overlaps %s", f, flowIssueString(i.Other))
+	case FlowMissingTable:
+		return fmt.Sprintf("%s: table %d contains no flows", f, i.Table)
+	case FlowUnused:
+		return fmt.Sprintf("%s: no packets matched in %s", f, i.Usage.Duration)
+	default:
+		return fmt.Sprintf("%s: %s", f, i.Kind)
+	}
+}
+
+// flowIssueString returns the textual form of the matches of f.
+func flowIssueString(f *Flow) string {
+	if f == nil {
+		return "<nil>"
+	}
+
+	s, err := flowMatchKey(f)
+	if err != nil {
+		return fmt.Sprintf("<invalid flow: %v>", err)
+	}
+
+	return s
+}
+
+// AnalyzeOptions configures AnalyzeFlows.
+type AnalyzeOptions struct {
+	// Usage, if set, contains the counters of flows installed on a
+	// bridge, as returned by OpenFlowService.DumpFlowUsage.  Flows which
+	// have not matched any packets and are at least UnusedAge old are
+	// reported as FlowUnused.
+	Usage     []*FlowUsage
+	UnusedAge time.Duration
+}
+
+// AnalyzeFlows analyzes flows and reports flows which are shadowed by a
+// higher priority flow, flows which overlap another flow with the same
+// priority, and flows which refer to tables that contain no flows.  If
+// opts is not nil, flows in opts.Usage which are unused are also reported.
+//
+// A flow is only reported as shadowed if a single higher priority flow
+// matches every packet it matches.  Flows which only contain conjunction
+// actions are not checked for shadowing or overlap, because Open vSwitch
+// permits overlapping conjunctive matches.
+func AnalyzeFlows(flows []*Flow, opts *AnalyzeOptions) ([]FlowIssue, error) {
+	if opts == nil {
+		opts = &AnalyzeOptions{}
+	}
+
+	tables := make(map[int][]*analyzedFlow)
+	for _, f := range flows {
+		af, err := newAnalyzedFlow(f)
+		if err != nil {
+			return nil, err
+		}
+		if af == nil {
+			continue
+		}
+
+		tables[f.Table] = append(tables[f.Table], af)
+	}
+
+	ids := make([]int, 0, len(tables))
+	for id, t := range tables {
+		ids = append(ids, id)
+		sort.SliceStable(t, func(i, j int) bool {
+			return t[i].flow.Priority > t[j].flow.Priority
+		})
+	}
+	sort.Ints(ids)
+
+	var issues []FlowIssue
+	for _, id := range ids {
+		issues = append(issues, analyzeTable(tables[id])...)
+	}
+
+	populated := make(map[int]bool)
+	for _, f := range flows {
+		populated[f.Table] = true
+	}
+
+	for _, f := range flows {
+		for _, table := range flowTableReferences(f.Table, f.Actions) {
+			if populated[table] {
+				continue
+			}
+
+			issues = append(issues, FlowIssue{
+				Kind:  FlowMissingTable,
+				Flow:  f,
+				Table: table,
+			})
+		}
+	}
+
+	for _, u := range opts.Usage {
+		if u.PacketCount != 0 || u.Duration < opts.UnusedAge {
+			continue
+		}
+
+		issues = append(issues, FlowIssue{
+			Kind:  FlowUnused,
+			Flow:  u.Flow,
+			Usage: u,
+		})
+	}
+
+	return issues, nil
+}
+
+// analyzeTable finds shadowed and overlapping flows in a single table,
+// whose flows are sorted by descending priority.
+func analyzeTable(flows []*analyzedFlow) []FlowIssue {
+	var issues []FlowIssue
+	for i, a := range flows {
+		for _, b := range flows[:i] {
+			if b.flow.Priority > a.flow.Priority && b.covers(a) {
+				issues = append(issues, FlowIssue{
+					Kind:  FlowShadowed,
+					Flow:  a.flow,
+					Other: b.flow,
+				})
+				break
+			}
+		}
+
+		for _, b := range flows[i+1:] {
+			if b.flow.Priority != a.flow.Priority {
+				break
+			}
+
+			if a.overlaps(b) {
+				issues = append(issues, FlowIssue{
+					Kind:  FlowOverlapping,
+					Flow:  b.flow,
+					Other: a.flow,
+				})
+			}
+		}
+	}
+
+	return issues
+}
+
+// flowTableReferences returns the tables to which actions of a flow in table
+// send packets, including recirculation by ct actions.
+func flowTableReferences(table int, actions []Action) []int {
+	var tables []int
+	for _, ref := range tableReferences(table, actions) {
+		tables = append(tables, ref.table)
+	}
+
+	for _, a := range actions {
+		ct, ok := a.(*ctAction)
+		if !ok {
+			continue
+		}
+
+		if ss := ctTableRe.FindStringSubmatch(ct.args); ss != nil {
+			table, _ := strconv.Atoi(ss[1])
+			tables = append(tables, table)
+		}
+	}
+
+	return tables
+}
+
+// An analyzedFlow is a Flow whose matches are represented as a value and
+// mask for each field.
+type analyzedFlow struct {
+	flow   *Flow
+	fields map[string]ternary
+}
+
+// A ternary is a value and mask, where bits which are not set in the mask
+// are wildcarded.
+type ternary struct {
+	value []byte
+	mask  []byte
+}
+
+// newAnalyzedFlow creates an analyzedFlow from f.  It returns nil if f
+// only contains conjunction actions.
+func newAnalyzedFlow(f *Flow) (*analyzedFlow, error) {
+	conj := len(f.Actions) > 0
+	for _, a := range f.Actions {
+		if _, ok := a.(*conjunctionAction); !ok {
+			conj = false
+			break
+		}
+	}
+	if conj {
+		return nil, nil
+	}
+
+	af := &analyzedFlow{
+		flow:   f,
+		fields: make(map[string]ternary),
+	}
+
+	if f.Protocol != "" {
+		pc, ok := protocolContexts[f.Protocol]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errUnsupportedProtocol, f.Protocol)
+		}
+
+		af.fields[dlType] = exactUint64(uint64(pc.etherType))
+		if pc.ipProto >= 0 {
+			af.fields[nwProto] = exactUint64(uint64(pc.ipProto))
+		}
+	}
+
+	if f.InPort != 0 {
+		af.fields[inPort] = inPortTernary(f.InPort)
+	}
+
+	err := eachMatchField(f, func(field, value string) error {
+		return af.add(field, value)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return af, nil
+}
+
+// add adds a match of field against value to af.
+func (af *analyzedFlow) add(field, value string) error {
+	field = classifierField(field)
+
+	switch {
+	case field == inPort && value == portLOCAL:
+		af.fields[field] = inPortTernary(PortLOCAL)
+	case ipFields[field]:
+		_, ipn, err := parseIPNet(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s match: %v", field, err)
+		}
+
+		af.fields[field] = ternary{value: ipn.IP, mask: ipn.Mask}
+	case hwAddrFields[field]:
+		addr, mask, err := parseMaskedHardwareAddr(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s match: %v", field, err)
+		}
+
+		af.fields[field] = ternary{value: addr, mask: mask}
+	case isWideRegister(field):
+		family, n, _ := parseRegisterName(field)
+		v, mask, err := parseRegisterValue(family, value)
+		if err != nil {
+			return fmt.Errorf("invalid %s match: %v", field, err)
+		}
+
+		// Wide registers overlap the 32 bit registers they consist of, so
+		// they are compared as those registers.
+		for _, w := range registerWords(family, n, v, mask) {
+			reg := regFamily + strconv.Itoa(w.reg)
+
+			t, ok := af.fields[reg]
+			if !ok {
+				t = exactUint64(0)
+				binary.BigEndian.PutUint64(t.mask, 0)
+			}
+
+			cur := binary.BigEndian.Uint64(t.value)
+			curMask := binary.BigEndian.Uint64(t.mask)
+			binary.BigEndian.PutUint64(t.value, cur&^uint64(w.mask)|uint64(w.value))
+			binary.BigEndian.PutUint64(t.mask, curMask|uint64(w.mask))
+			af.fields[reg] = t
+		}
+	case field == ipFrag:
+		bits, ok := ipFragBits[IPFrag(value)]
+		if !ok {
+			return fmt.Errorf("invalid %s match: %q", ipFrag, value)
+		}
+
+		t := exactUint64(bits[0])
+		binary.BigEndian.PutUint64(t.mask, bits[1])
+		af.fields[field] = t
+	case flagFields[field]:
+		set, unset, err := parseFlagMatch(field, value)
+		if err != nil {
+			return fmt.Errorf("invalid %s match: %v", field, err)
+		}
+
+		// Each flag is treated as an individual one bit field.
+		for _, f := range set {
+			af.fields[field+"+"+f] = ternary{value: []byte{1}, mask: []byte{1}}
+		}
+		for _, f := range unset {
+			af.fields[field+"+"+f] = ternary{value: []byte{0}, mask: []byte{1}}
+		}
+	default:
+		v, mask, err := parseMaskedUint64(value)
+		if err != nil {
+			// Compare values which are not numeric exactly.
+			af.fields[field] = ternary{
+				value: []byte(value),
+				mask:  bytes.Repeat([]byte{0xff}, len(value)),
+			}
+			return nil
+		}
+		if !strings.Contains(value, "/") {
+			mask = ^uint64(0)
+
+			// Registers are 32 bits, as are the parts of wide registers
+			// which overlap them.
+			if family, _, ok := parseRegisterName(field); ok && family == regFamily {
+				mask = 1<<32 - 1
+			}
+		}
+
+		t := exactUint64(v)
+		binary.BigEndian.PutUint64(t.mask, mask)
+		af.fields[field] = t
+	}
+
+	return nil
+}
+
+// exactUint64 creates a ternary which matches v exactly.
+func exactUint64(v uint64) ternary {
+	t := ternary{
+		value: make([]byte, 8),
+		mask:  make([]byte, 8),
+	}
+	binary.BigEndian.PutUint64(t.value, v)
+	binary.BigEndian.PutUint64(t.mask, ^uint64(0))
+
+	return t
+}
+
+// inPortTernary creates a ternary which matches port exactly.
+func inPortTernary(port int) ternary {
+	return exactUint64(uint64(port))
+}
+
+// covers reports whether every packet matched by b is also matched by af.
+func (af *analyzedFlow) covers(b *analyzedFlow) bool {
+	for field, t := range af.fields {
+		bt, ok := b.fields[field]
+		if !ok {
+			// b wildcards this field entirely.
+			if isZero(t.mask) {
+				continue
+			}
+			return false
+		}
+
+		if len(t.value) != len(bt.value) {
+			return false
+		}
+
+		for i := range t.mask {
+			// b must match at least the bits matched by af, and the values
+			// of those bits must agree.
+			if t.mask[i]&^bt.mask[i] != 0 {
+				return false
+			}
+			if (t.value[i]^bt.value[i])&t.mask[i] != 0 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// overlaps reports whether a packet exists which is matched by both af
+// and b.
+func (af *analyzedFlow) overlaps(b *analyzedFlow) bool {
+	for field, t := range af.fields {
+		bt, ok := b.fields[field]
+		if !ok {
+			continue
+		}
+
+		if len(t.value) != len(bt.value) {
+			return false
+		}
+
+		for i := range t.mask {
+			if (t.value[i]^bt.value[i])&t.mask[i]&bt.mask[i] != 0 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// isZero reports whether every byte of b is zero.
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// A FlowUsage is a Flow and its counters, as reported by
+// 'ovs-ofctl dump-flows'.
+type FlowUsage struct {
+	Flow        *Flow
+	Duration    time.Duration
+	PacketCount uint64
+	ByteCount   uint64
+}
+
+// UnmarshalText unmarshals a FlowUsage from textual form as output by
+// 'ovs-ofctl dump-flows'.
+func (u *FlowUsage) UnmarshalText(b []byte) error {
+	f := new(Flow)
+	if err := f.UnmarshalText(b); err != nil {
+		return err
+	}
+
+	// Counters always precede the actions.
+	s := string(b)
+	if i := strings.Index(s, keyActions+"="); i != -1 {
+		s = s[:i]
+	}
+
+	*u = FlowUsage{Flow: f}
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' '
+	}) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		var err error
+		switch kv[0] {
+		case duration:
+			u.Duration, err = time.ParseDuration(kv[1])
+		case nPackets:
+			u.PacketCount, err = strconv.ParseUint(kv[1], 10, 64)
+		case nBytes:
+			u.ByteCount, err = strconv.ParseUint(kv[1], 10, 64)
+		}
+		if err != nil {
+			return &FlowError{
+				Str: field,
+				Err: err,
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeFlows(t *testing.T) {
+	var (
+		allowSubnet = &Flow{
+			Priority: 200,
+			Protocol: ProtocolIPv4,
+			Matches:  []Match{NetworkSource("192.0.2.0/24")},
+			Actions:  []Action{Normal()},
+		}
+		allowHost = &Flow{
+			Priority: 100,
+			Protocol: ProtocolTCPv4,
+			Matches: []Match{
+				NetworkSource("192.0.2.10"),
+				TransportDestinationPort(22),
+			},
+			Actions: []Action{Normal()},
+		}
+		allowOther = &Flow{
+			Priority: 100,
+			Protocol: ProtocolTCPv4,
+			Matches:  []Match{NetworkSource("198.51.100.0/24")},
+			Actions:  []Action{Resubmit(0, 1)},
+		}
+		allowHTTP = &Flow{
+			Priority: 100,
+			Protocol: ProtocolTCPv4,
+			Matches:  []Match{TransportDestinationPort(80)},
+			Actions:  []Action{ConnectionTracking("commit,table=2")},
+		}
+		allowHTTPS = &Flow{
+			Priority: 100,
+			Protocol: ProtocolTCPv4,
+			Matches:  []Match{TransportDestinationMaskedPort(0x01b8, 0xfff8)},
+			Actions:  []Action{Normal()},
+		}
+		conj1 = &Flow{
+			Priority: 100,
+			Protocol: ProtocolTCPv4,
+			Actions:  []Action{Conjunction(1, 1, 2)},
+		}
+		dropAll = &Flow{
+			Actions: []Action{Drop()},
+		}
+		tableOne = &Flow{
+			Table:    1,
+			Priority: 10,
+			Matches:  []Match{ConnectionTrackingState(SetState(CTStateNew))},
+			Actions:  []Action{GotoTable(3)},
+		}
+		tableOneShadowed = &Flow{
+			Table:    1,
+			Priority: 5,
+			Matches: []Match{
+				ConnectionTrackingState(SetState(CTStateNew), SetState(CTStateTracked)),
+			},
+			Actions: []Action{Drop()},
+		}
+		tableOneDisjoint = &Flow{
+			Table:    1,
+			Priority: 5,
+			Matches: []Match{
+				ConnectionTrackingState(UnsetState(CTStateNew)),
+			},
+			Actions: []Action{Drop()},
+		}
+	)
+
+	usage := []*FlowUsage{
+		{Flow: allowSubnet, Duration: 2 * time.Hour, PacketCount: 10},
+		{Flow: dropAll, Duration: 2 * time.Hour},
+		{Flow: tableOne, Duration: time.Minute},
+	}
+
+	issues, err := AnalyzeFlows([]*Flow{
+		allowSubnet, allowHost, allowOther, allowHTTP, allowHTTPS, conj1, dropAll,
+		tableOne, tableOneShadowed, tableOneDisjoint,
+	}, &AnalyzeOptions{
+		Usage:     usage,
+		UnusedAge: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("failed to analyze flows: %v", err)
+	}
+
+	want := []FlowIssue{
+		{Kind: FlowShadowed, Flow: allowHost, Other: allowSubnet},
+		{Kind: FlowOverlapping, Flow: allowHTTP, Other: allowOther},
+		{Kind: FlowOverlapping, Flow: allowHTTPS, Other: allowOther},
+		{Kind: FlowShadowed, Flow: tableOneShadowed, Other: tableOne},
+		{Kind: FlowMissingTable, Flow: allowHTTP, Table: 2},
+		{Kind: FlowMissingTable, Flow: tableOne, Table: 3},
+		{Kind: FlowUnused, Flow: dropAll, Usage: usage[1]},
+	}
+	if !reflect.DeepEqual(want, issues) {
+		t.Fatalf("unexpected issues:\n- want: %v\n-  got: %v", want, issues)
+	}
+}
+
+func TestFlowIssueString(t *testing.T) {
+	var tests = []struct {
+		i FlowIssue
+		s string
+	}{
+		{
+			i: FlowIssue{
+				Kind: FlowShadowed,
+				Flow: &Flow{
+					Priority: 10,
+					Protocol: ProtocolTCPv4,
+					Actions:  []Action{Drop()},
+				},
+				Other: &Flow{
+					Priority: 20,
+					Protocol: ProtocolIPv4,
+					Actions:  []Action{Drop()},
+				},
+			},
+			s: "priority=10,tcp,table=0: shadowed by priority=20,ip,table=0",
+		},
+		{
+			i: FlowIssue{
+				Kind:  FlowMissingTable,
+				Flow:  &Flow{Actions: []Action{Resubmit(0, 5)}},
+				Table: 5,
+			},
+			s: "priority=0,table=0: table 5 contains no flows",
+		},
+		{
+			i: FlowIssue{
+				Kind:  FlowUnused,
+				Flow:  &Flow{Actions: []Action{Drop()}},
+				Usage: &FlowUsage{Duration: time.Hour},
+			},
+			s: "priority=0,table=0: no packets matched in 1h0m0s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.i.Kind.String(), func(t *testing.T) {
+			if want, got := tt.s, tt.i.String(); want != got {
+				t.Fatalf("unexpected string:\n- want: %q\n-  got: %q", want, got)
+			}
+		})
+	}
+}
+
+func TestFlowUsageUnmarshalText(t *testing.T) {
+	var u FlowUsage
+	err := u.UnmarshalText([]byte(" cookie=0x0, duration=83229.846s, table=51, n_packets=3, n_bytes=234, priority=101,ct_state=+new+rel+trk,ip actions=ct(commit,table=65)"))
+	if err != nil {
+		t.Fatalf("failed to unmarshal usage: %v", err)
+	}
+
+	if want, got := 83229846*time.Millisecond, u.Duration; want != got {
+		t.Fatalf("unexpected duration:\n- want: %v\n-  got: %v", want, got)
+	}
+	if want, got := uint64(3), u.PacketCount; want != got {
+		t.Fatalf("unexpected packet count:\n- want: %v\n-  got: %v", want, got)
+	}
+	if want, got := uint64(234), u.ByteCount; want != got {
+		t.Fatalf("unexpected byte count:\n- want: %v\n-  got: %v", want, got)
+	}
+	if want, got := 51, u.Flow.Table; want != got {
+		t.Fatalf("unexpected table:\n- want: %v\n-  got: %v", want, got)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"context"
+)
+
+// An AppService is used in a Client to execute 'ovs-appctl' commands.
+type AppService struct {
+	// Wrapped Client for ExecFunc configuration.
+	c *Client
+}
+
+// Run executes an arbitrary 'ovs-appctl' command, such as
+// "ofproto/list", against ovs-vswitchd and returns its output.
+func (a *AppService) Run(command string, args ...string) ([]byte, error) {
+	return a.RunContext(context.Background(), command, args...)
+}
+
+// RunContext is the same as Run, but accepts a context.Context which can be
+// used to cancel the command or apply a deadline.
+func (a *AppService) RunContext(ctx context.Context, command string, args ...string) ([]byte, error) {
+	return a.exec(ctx, append([]string{command}, args...)...)
+}
+
+// exec executes an ExecFunc using 'ovs-appctl'.
+func (a *AppService) exec(ctx context.Context, args ...string) ([]byte, error) {
+	return a.c.exec(ctx, "ovs-appctl", append(a.c.instance.appctlFlags(), args...)...)
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClientAppRunOK(t *testing.T) {
+	want := "br0:\n  br0 65534/100: (internal)"
+
+	c := testClient([]OptionFunc{Timeout(1)}, func(cmd string, args ...string) ([]byte, error) {
+		if want, got := "ovs-appctl", cmd; want != got {
+			t.Fatalf("incorrect command:\n- want: %v\n-  got: %v",
+				want, got)
+		}
+
+		wantArgs := []string{"--timeout=1", "dpif/show"}
+		if want, got := wantArgs, args; !reflect.DeepEqual(want, got) {
+			t.Fatalf("incorrect arguments\n- want: %v\n-  got: %v",
+				want, got)
+		}
+
+		return []byte(want + "\n"), nil
+	})
+
+	out, err := c.App.Run("dpif/show")
+	if err != nil {
+		t.Fatalf("unexpected error for Client.App.Run: %v", err)
+	}
+
+	if got := string(out); want != got {
+		t.Fatalf("unexpected output:\n- want: %q\n-  got: %q",
+			want, got)
+	}
+}
@@ -0,0 +1,504 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultPriority is the priority Open vSwitch assigns to a flow which does
+// not specify one.  'ovs-ofctl dump-flows' omits the priority of such flows.
+const DefaultPriority = 32768
+
+// Canonical returns a copy of f in canonical form, so that flows which
+// Open vSwitch treats identically also have identical fields.  In canonical
+// form:
+//   - dl_type and nw_proto matches are folded into Protocol, so that
+//     "dl_type=0x0800" becomes "ip"
+//   - field aliases, such as "eth_src" and "tcp_dst", use their original
+//     names, such as "dl_src" and "tp_dst"
+//   - values are masked, CIDR blocks are normalized, and fully masked values
+//     are matched exactly, while fully wildcarded matches are removed
+//   - flags, such as those of ct_state, are sorted
+//   - matches are sorted and duplicate matches are removed
+//   - load actions of entire fields become set_field actions
+//
+// Matches which cannot be normalized are retained verbatim.  Actions are not
+// reordered, as their order is significant.
+func (f *Flow) Canonical() *Flow {
+	protocol, matches := canonicalMatches(f.Protocol, f.Matches)
+
+	return &Flow{
+		Priority:    f.Priority,
+		Protocol:    protocol,
+		InPort:      f.InPort,
+		Matches:     matches,
+		Table:       f.Table,
+		IdleTimeout: f.IdleTimeout,
+		Cookie:      f.Cookie,
+		Actions:     canonicalActions(f.Actions),
+	}
+}
+
+// Equal reports whether f and other are semantically equivalent, by
+// comparing their canonical forms.  See Canonical for details.
+func (f *Flow) Equal(other *Flow) bool {
+	if f == nil || other == nil {
+		return f == other
+	}
+
+	a, b := f.Canonical(), other.Canonical()
+
+	return a.Priority == b.Priority &&
+		a.Protocol == b.Protocol &&
+		a.InPort == b.InPort &&
+		a.Table == b.Table &&
+		a.IdleTimeout == b.IdleTimeout &&
+		a.Cookie == b.Cookie &&
+		matchesEqual(a.Matches, b.Matches) &&
+		actionsEqual(a.Actions, b.Actions)
+}
+
+// Canonical returns a copy of f in canonical form, so that MatchFlows which
+// match the same flows also have identical fields.  Matches are normalized
+// as described by Flow.Canonical.  In addition, Priority is cleared unless
+// Strict is set, and a CookieMask which matches Cookie exactly is cleared.
+func (f *MatchFlow) Canonical() *MatchFlow {
+	protocol, matches := canonicalMatches(f.Protocol, f.Matches)
+
+	c := &MatchFlow{
+		Strict:     f.Strict,
+		InPort:     f.InPort,
+		Priority:   f.Priority,
+		Protocol:   protocol,
+		Matches:    matches,
+		Table:      f.Table,
+		Cookie:     f.Cookie,
+		CookieMask: f.CookieMask,
+	}
+
+	// Priority is only used for strict matching.
+	if !c.Strict {
+		c.Priority = 0
+	}
+
+	// A cookie is only matched if it is set, and is matched exactly if its
+	// mask is unset.
+	if c.Cookie == 0 || c.CookieMask == ^uint64(0) {
+		c.CookieMask = 0
+	}
+
+	return c
+}
+
+// Equal reports whether f and other are semantically equivalent, by
+// comparing their canonical forms.  See Canonical for details.
+func (f *MatchFlow) Equal(other *MatchFlow) bool {
+	if f == nil || other == nil {
+		return f == other
+	}
+
+	a, b := f.Canonical(), other.Canonical()
+
+	return a.Strict == b.Strict &&
+		a.Priority == b.Priority &&
+		a.Protocol == b.Protocol &&
+		a.InPort == b.InPort &&
+		a.Table == b.Table &&
+		a.Cookie == b.Cookie &&
+		a.CookieMask == b.CookieMask &&
+		matchesEqual(a.Matches, b.Matches)
+}
+
+// matchesEqual reports whether a and b have identical textual forms.
+func matchesEqual(a, b []Match) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		ab, aerr := a[i].MarshalText()
+		bb, berr := b[i].MarshalText()
+		if aerr != nil || berr != nil || string(ab) != string(bb) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// canonicalWidths are the widths in bits of numeric fields which are
+// narrower than 64 bits.
+var canonicalWidths = map[string]uint{
+	arpOp:    16,
+	dlType:   16,
+	dlVLAN:   12,
+	vlanTCI:  16,
+	nwProto:  8,
+	nwTOS:    8,
+	nwECN:    2,
+	nwTTL:    8,
+	ipDSCP:   6,
+	icmpType: 8,
+	icmpCode: 8,
+	tpSRC:    16,
+	tpDST:    16,
+	ctZone:   16,
+	ctMark:   32,
+	conjID:   32,
+	pktMark:  32,
+
+	skbPriority: 32,
+	mplsLabel:   20,
+	mplsTC:      3,
+	mplsBOS:     1,
+	mplsTTL:     8,
+	nshSPI:      24,
+	nshSI:       8,
+	nshC1:       32,
+	nshC2:       32,
+	nshC3:       32,
+	nshC4:       32,
+}
+
+// canonicalDecimalFields are numeric fields whose exact values are parsed
+// as decimal integers.
+var canonicalDecimalFields = map[string]bool{
+	arpOp:    true,
+	dlVLAN:   true,
+	nwProto:  true,
+	nwTOS:    true,
+	nwECN:    true,
+	nwTTL:    true,
+	ipDSCP:   true,
+	icmpType: true,
+	icmpCode: true,
+	tpSRC:    true,
+	tpDST:    true,
+	ctZone:   true,
+	conjID:   true,
+
+	mplsLabel: true,
+	mplsTC:    true,
+	mplsBOS:   true,
+	mplsTTL:   true,
+	nshSI:     true,
+}
+
+// canonicalMatches returns the canonical Protocol and Matches equivalent to
+// protocol and matches.
+func canonicalMatches(protocol Protocol, matches []Match) (Protocol, []Match) {
+	pc, ok := protocolContexts[protocol]
+	if protocol == "" {
+		pc, ok = flowContext{ipProto: -1}, true
+	}
+
+	var fields [][2]string
+	err := eachMatchField(&Flow{Matches: matches}, func(field, value string) error {
+		field = classifierField(field)
+		value, ok := canonicalValue(field, value)
+		if !ok {
+			// Wildcarded entirely.
+			return nil
+		}
+
+		fields = append(fields, [2]string{field, value})
+		return nil
+	})
+	if err != nil {
+		// Matches which cannot be split into fields are retained verbatim.
+		return protocol, sortMatches(append([]Match(nil), matches...))
+	}
+
+	// Fold exact dl_type and nw_proto matches into the protocol, if it is
+	// understood.
+	if ok {
+		n := 0
+		for _, kv := range fields {
+			if !foldProtocolField(&pc, kv[0], kv[1]) {
+				fields[n] = kv
+				n++
+			}
+		}
+		fields = fields[:n]
+
+		protocol, fields = contextProtocol(pc, fields)
+	}
+
+	out := make([]Match, 0, len(fields))
+	for _, kv := range fields {
+		// Values which cannot be represented by a typed Match, such as
+		// addresses with non-contiguous masks, are retained verbatim.
+		m, err := parseMatch(kv[0], kv[1])
+		if err == nil {
+			_, err = m.MarshalText()
+		}
+		if err != nil {
+			m = RawMatch(kv[0] + "=" + kv[1])
+		}
+
+		out = append(out, m)
+	}
+
+	return protocol, sortMatches(out)
+}
+
+// foldProtocolField folds an exact dl_type or nw_proto match of field
+// against value into pc, and reports whether it was folded.  Conflicting
+// matches are not folded.
+func foldProtocolField(pc *flowContext, field, value string) bool {
+	switch field {
+	case dlType:
+		v, err := parseHexUint16(value)
+		if err != nil || (pc.etherType != 0 && pc.etherType != v) {
+			return false
+		}
+
+		pc.etherType = v
+		return true
+	case nwProto:
+		v, err := strconv.Atoi(value)
+		if err != nil || (pc.ipProto != -1 && pc.ipProto != v) {
+			return false
+		}
+
+		pc.ipProto = v
+		return true
+	}
+
+	return false
+}
+
+// contextProtocol returns the Protocol which implies the Ethernet type and
+// IP protocol of pc, along with fields and any matches which are required
+// in addition to the Protocol.
+func contextProtocol(pc flowContext, fields [][2]string) (Protocol, [][2]string) {
+	var protocol Protocol
+	if pc.etherType == 0 && pc.ipProto == -1 {
+		return protocol, fields
+	}
+
+	for p, c := range protocolContexts {
+		switch {
+		case c.etherType != pc.etherType:
+		case c.ipProto == pc.ipProto:
+			// Exact match; no additional matches are needed.
+			return p, fields
+		case c.ipProto == -1:
+			protocol = p
+		}
+	}
+
+	if protocol == "" && pc.etherType != 0 {
+		fields = append(fields, [2]string{dlType, fmt.Sprintf("0x%04x", pc.etherType)})
+	}
+	if pc.ipProto != -1 {
+		fields = append(fields, [2]string{nwProto, strconv.Itoa(pc.ipProto)})
+	}
+
+	return protocol, fields
+}
+
+// canonicalValue returns the canonical form of value for field.  It returns
+// false if the value matches any packet, so that the field can be omitted.
+// Values which cannot be parsed are returned unmodified.
+func canonicalValue(field, value string) (string, bool) {
+	switch {
+	case field == inPort:
+		return value, true
+	case ipFields[field]:
+		_, ipn, err := parseIPNet(value)
+		if err != nil {
+			return value, true
+		}
+
+		ones, bits := ipn.Mask.Size()
+		switch {
+		case bits == 0:
+			// Non-contiguous masks are written as an address.
+			return ipn.IP.String() + "/" + net.IP(ipn.Mask).String(), true
+		case ones == 0:
+			return "", false
+		case ones == bits:
+			return ipn.IP.String(), true
+		}
+
+		return ipn.String(), true
+	case hwAddrFields[field]:
+		addr, mask, err := parseMaskedHardwareAddr(value)
+		if err != nil {
+			return value, true
+		}
+
+		for i := range addr {
+			addr[i] &= mask[i]
+		}
+
+		switch {
+		case isZero(mask):
+			return "", false
+		case bytes.Count(mask, []byte{0xff}) == len(mask):
+			return addr.String(), true
+		}
+
+		return addr.String() + "/" + net.HardwareAddr(mask).String(), true
+	case flagFields[field]:
+		set, unset, err := parseFlagMatch(field, value)
+		if err != nil {
+			return value, true
+		}
+		if len(set) == 0 && len(unset) == 0 {
+			return "", false
+		}
+
+		sort.Strings(set)
+		sort.Strings(unset)
+
+		var b strings.Builder
+		for _, f := range set {
+			b.WriteString("+" + f)
+		}
+		for _, f := range unset {
+			b.WriteString("-" + f)
+		}
+
+		return b.String(), true
+	}
+
+	// Numeric fields.  Values of dl_type are always hexadecimal.
+	s := value
+	if field == dlType && !strings.HasPrefix(s, hexPrefix) {
+		s = hexPrefix + s
+	}
+
+	v, mask, err := parseMaskedUint64(s)
+	if err != nil {
+		return value, true
+	}
+
+	full := ^uint64(0)
+	if w, ok := canonicalWidths[field]; ok {
+		full = 1<<w - 1
+	} else if strings.HasPrefix(field, "reg") {
+		full = 1<<32 - 1
+	}
+	if !strings.Contains(s, "/") {
+		mask = full
+	}
+	mask &= full
+	v &= mask
+
+	switch {
+	case mask == 0:
+		return "", false
+	case mask != full:
+		return fmt.Sprintf("0x%x/0x%x", v, mask), true
+	case field == dlType:
+		return fmt.Sprintf("0x%04x", v), true
+	case canonicalDecimalFields[field]:
+		return strconv.FormatUint(v, 10), true
+	}
+
+	return fmt.Sprintf("0x%x", v), true
+}
+
+// sortMatches sorts matches by their textual form, and removes duplicate
+// matches.
+func sortMatches(matches []Match) []Match {
+	type textMatch struct {
+		text  string
+		match Match
+	}
+
+	tms := make([]textMatch, 0, len(matches))
+	for _, m := range matches {
+		b, _ := m.MarshalText()
+		tms = append(tms, textMatch{text: string(b), match: m})
+	}
+
+	sort.SliceStable(tms, func(i, j int) bool {
+		return tms[i].text < tms[j].text
+	})
+
+	out := make([]Match, 0, len(tms))
+	for i, tm := range tms {
+		if i > 0 && tm.text == tms[i-1].text {
+			continue
+		}
+
+		out = append(out, tm.match)
+	}
+
+	return out
+}
+
+// canonicalActions returns the canonical form of actions.
+func canonicalActions(actions []Action) []Action {
+	out := make([]Action, 0, len(actions))
+	for _, a := range actions {
+		out = append(out, canonicalAction(a))
+	}
+
+	return out
+}
+
+// canonicalAction returns the canonical form of a.  Loads of entire fields
+// are equivalent to set_field actions, and the fields and values of both
+// are normalized.  Fields with typed Actions, such as arp_op, use them.
+func canonicalAction(a Action) Action {
+	if sa, ok := a.(*setARPAction); ok {
+		v, err := sa.value()
+		if err != nil {
+			return a
+		}
+
+		a = SetField(v, sa.field)
+	}
+
+	l, ok := a.(*loadSetFieldAction)
+	if !ok {
+		return a
+	}
+
+	field := l.field
+	if l.typ == actionLoad {
+		// Only loads of entire fields are equivalent to set_field.
+		if !strings.HasSuffix(field, "[]") {
+			return a
+		}
+		field = strings.TrimSuffix(field, "[]")
+	}
+
+	field = classifierField(field)
+
+	value := l.value
+	switch {
+	case net.ParseIP(value) != nil:
+		value = net.ParseIP(value).String()
+	default:
+		if mac, err := net.ParseMAC(value); err == nil {
+			value = mac.String()
+		} else if v, err := strconv.ParseUint(value, 0, 64); err == nil {
+			value = fmt.Sprintf("0x%x", v)
+		}
+	}
+
+	return parseSetField(value, field)
+}
@@ -0,0 +1,360 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"net"
+	"testing"
+)
+
+func TestFlowCanonical(t *testing.T) {
+	var tests = []struct {
+		desc string
+		f    *Flow
+		s    string
+	}{
+		{
+			desc: "dl_type folded into protocol",
+			f: &Flow{
+				Priority: 10,
+				Matches: []Match{
+					DataLinkType(0x0800),
+				},
+				Actions: []Action{Drop()},
+			},
+			s: "priority=10,ip,table=0,idle_timeout=0,actions=drop",
+		},
+		{
+			desc: "dl_type and nw_proto folded into protocol",
+			f: &Flow{
+				Priority: 10,
+				Matches: []Match{
+					NetworkProtocol(6),
+					DataLinkType(0x86dd),
+				},
+				Actions: []Action{Drop()},
+			},
+			s: "priority=10,tcp6,table=0,idle_timeout=0,actions=drop",
+		},
+		{
+			desc: "nw_proto without protocol",
+			f: &Flow{
+				Priority: 10,
+				Protocol: ProtocolIPv4,
+				Matches: []Match{
+					NetworkProtocol(47),
+				},
+				Actions: []Action{Drop()},
+			},
+			s: "priority=10,ip,nw_proto=47,table=0,idle_timeout=0,actions=drop",
+		},
+		{
+			desc: "ICMPv6 type and code aliases",
+			f: &Flow{
+				Priority: 10,
+				Protocol: ProtocolICMPv6,
+				Matches: []Match{
+					ICMPv6Type(135),
+					ICMPv6Code(0),
+					NetworkTTL(255),
+					IPFragment(IPFragNo),
+				},
+				Actions: []Action{Drop()},
+			},
+			s: "priority=10,icmp6,icmp_code=0,icmp_type=135,ip_frag=no,nw_ttl=255,table=0,idle_timeout=0,actions=drop",
+		},
+		{
+			desc: "redundant dl_type",
+			f: &Flow{
+				Priority: 10,
+				Protocol: ProtocolARP,
+				Matches: []Match{
+					DataLinkType(0x0806),
+				},
+				Actions: []Action{Drop()},
+			},
+			s: "priority=10,arp,table=0,idle_timeout=0,actions=drop",
+		},
+		{
+			desc: "unknown dl_type",
+			f: &Flow{
+				Priority: 10,
+				Matches: []Match{
+					DataLinkType(0x88cc),
+				},
+				Actions: []Action{Drop()},
+			},
+			s: "priority=10,dl_type=0x88cc,table=0,idle_timeout=0,actions=drop",
+		},
+		{
+			desc: "matches sorted, normalized and deduplicated",
+			f: &Flow{
+				Priority: 10,
+				Protocol: ProtocolTCPv4,
+				Matches: []Match{
+					TransportDestinationMaskedPort(0x50, 0xffff),
+					NetworkSource("192.0.2.1/24"),
+					NetworkDestination("198.51.100.10/32"),
+					NetworkSource("192.0.2.0/24"),
+					DataLinkSource("DE:AD:BE:EF:DE:AD"),
+					ConnectionTrackingState(SetState(CTStateTracked), SetState(CTStateNew)),
+				},
+				Actions: []Action{Drop()},
+			},
+			s: "priority=10,tcp,ct_state=+new+trk,dl_src=de:ad:be:ef:de:ad,nw_dst=198.51.100.10,nw_src=192.0.2.0/24,tp_dst=80,table=0,idle_timeout=0,actions=drop",
+		},
+		{
+			desc: "wildcards removed",
+			f: &Flow{
+				Priority: 10,
+				Matches: []Match{
+					NetworkSource("0.0.0.0/0"),
+					DataLinkDestination("de:ad:be:ef:de:ad/00:00:00:00:00:00"),
+				},
+				Actions: []Action{Drop()},
+			},
+			s: "priority=10,table=0,idle_timeout=0,actions=drop",
+		},
+		{
+			desc: "masked values",
+			f: &Flow{
+				Priority: 10,
+				Matches: []Match{
+					RegMatch(0, 0xff, 0x0f),
+					DataLinkDestination("01:00:5e:ff:ff:ff/ff:ff:ff:00:00:00"),
+					RawMatch("metadata=0x10/0xffffffffffffffff"),
+					RawMatch("nw_src=192.0.2.1/255.0.255.0"),
+				},
+				Actions: []Action{Drop()},
+			},
+			s: "priority=10,dl_dst=01:00:5e:00:00:00/ff:ff:ff:00:00:00,metadata=0x10,nw_src=192.0.2.0/255.0.255.0,reg0=0xf/0xf,table=0,idle_timeout=0,actions=drop",
+		},
+		{
+			desc: "load and set_field",
+			f: &Flow{
+				Priority: 10,
+				Actions: []Action{
+					Load("1", "NXM_NX_REG0[]"),
+					Load("0x1", "NXM_NX_REG1[0..15]"),
+					SetField("192.0.2.1", "ip_dst"),
+				},
+			},
+			s: "priority=10,table=0,idle_timeout=0,actions=set_field:0x1->reg0,load:0x1->NXM_NX_REG1[0..15],set_field:192.0.2.1->nw_dst",
+		},
+		{
+			desc: "typed ARP set_field",
+			f: &Flow{
+				Priority: 10,
+				Matches: []Match{
+					DataLinkType(0x8035),
+					ARPOperation(ARPOperationRequest),
+				},
+				Actions: []Action{
+					Load("0x2", "NXM_OF_ARP_OP[]"),
+					SetField("DE:AD:BE:EF:DE:AD", "arp_sha"),
+					SetARPSourceProtocolAddress(net.IPv4(192, 0, 2, 1)),
+				},
+			},
+			s: "priority=10,rarp,arp_op=1,table=0,idle_timeout=0,actions=set_field:2->arp_op,set_field:de:ad:be:ef:de:ad->arp_sha,set_field:192.0.2.1->arp_spa",
+		},
+		{
+			desc: "packet metadata",
+			f: &Flow{
+				Priority: 10,
+				Matches: []Match{
+					PacketType(PacketNamespaceEtherType, 0x0800),
+					PacketMark(0x1, 0xffffffff),
+				},
+				Actions: []Action{
+					Load("0x2", "NXM_NX_PKT_MARK[]"),
+					SetField("0x1/0xffffffffffffffff", "metadata"),
+				},
+			},
+			s: "priority=10,packet_type=(1,0x800),pkt_mark=0x1,table=0,idle_timeout=0,actions=set_field:0x2->pkt_mark,set_field:0x1->metadata",
+		},
+		{
+			desc: "MPLS and NSH fields",
+			f: &Flow{
+				Priority: 10,
+				Matches: []Match{
+					DataLinkType(0x8847),
+					MPLSTTL(64),
+					RawMatch("mpls_label=0x64"),
+					RawMatch("nsh_c1=0x1/0xffffffff"),
+				},
+				Actions: []Action{Drop()},
+			},
+			s: "priority=10,mpls,mpls_label=100,mpls_ttl=64,nsh_c1=0x1,table=0,idle_timeout=0,actions=drop",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			b, err := tt.f.Canonical().MarshalText()
+			if err != nil {
+				t.Fatalf("failed to marshal canonical flow: %v", err)
+			}
+
+			if want, got := tt.s, string(b); want != got {
+				t.Fatalf("unexpected canonical flow:\n- want: %v\n-  got: %v", want, got)
+			}
+		})
+	}
+}
+
+func TestFlowEqual(t *testing.T) {
+	added := &Flow{
+		Priority: DefaultPriority,
+		Matches: []Match{
+			DataLinkType(0x0800),
+			NetworkDestination("192.0.2.10/24"),
+			DataLinkSource("DE:AD:BE:EF:DE:AD"),
+		},
+		Actions: []Action{
+			Load("0x2a", "NXM_NX_REG0[]"),
+			Output(1),
+		},
+	}
+
+	// As reported by 'ovs-ofctl dump-flows'.
+	dumped := new(Flow)
+	err := dumped.UnmarshalText([]byte(" cookie=0x0, duration=9.1s, table=0, n_packets=0, n_bytes=0, ip,dl_src=de:ad:be:ef:de:ad,nw_dst=192.0.2.0/24 actions=set_field:42->reg0,output:1"))
+	if err != nil {
+		t.Fatalf("failed to unmarshal flow: %v", err)
+	}
+
+	if !added.Equal(dumped) || !dumped.Equal(added) {
+		t.Fatalf("expected flows to be equal:\n- added: %#v\n- dumped: %#v", added, dumped)
+	}
+
+	var tests = []struct {
+		desc string
+		fn   func(f *Flow)
+	}{
+		{
+			desc: "priority",
+			fn:   func(f *Flow) { f.Priority = 10 },
+		},
+		{
+			desc: "table",
+			fn:   func(f *Flow) { f.Table = 1 },
+		},
+		{
+			desc: "cookie",
+			fn:   func(f *Flow) { f.Cookie = 1 },
+		},
+		{
+			desc: "protocol",
+			fn:   func(f *Flow) { f.Protocol = ProtocolTCPv4 },
+		},
+		{
+			desc: "match",
+			fn:   func(f *Flow) { f.Matches = append(f.Matches, NetworkSource("192.0.2.1")) },
+		},
+		{
+			desc: "actions",
+			fn:   func(f *Flow) { f.Actions = []Action{Output(1), Load("0x2a", "NXM_NX_REG0[]")} },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			f := &Flow{
+				Priority: added.Priority,
+				Matches:  append([]Match(nil), added.Matches...),
+				Actions:  append([]Action(nil), added.Actions...),
+			}
+			tt.fn(f)
+
+			if f.Equal(added) {
+				t.Fatalf("expected flows to differ:\n- a: %#v\n- b: %#v", f, added)
+			}
+		})
+	}
+
+	if (*Flow)(nil).Equal(added) || !(*Flow)(nil).Equal(nil) {
+		t.Fatal("unexpected result comparing nil flows")
+	}
+}
+
+func TestMatchFlowEqual(t *testing.T) {
+	var tests = []struct {
+		desc  string
+		a, b  *MatchFlow
+		equal bool
+	}{
+		{
+			desc: "protocol and matches",
+			a: &MatchFlow{
+				Protocol: ProtocolUDPv4,
+				Matches: []Match{
+					TransportSourcePort(53),
+					ARPSourceProtocolAddress("192.0.2.1/32"),
+				},
+			},
+			b: &MatchFlow{
+				Matches: []Match{
+					NetworkProtocol(17),
+					ARPSourceProtocolAddress("192.0.2.1"),
+					DataLinkType(0x0800),
+					TransportSourcePort(53),
+				},
+			},
+			equal: true,
+		},
+		{
+			desc:  "priority ignored if not strict",
+			a:     &MatchFlow{Priority: 10, Table: 1},
+			b:     &MatchFlow{Priority: 20, Table: 1},
+			equal: true,
+		},
+		{
+			desc: "priority compared if strict",
+			a:    &MatchFlow{Strict: true, Priority: 10, Table: 1},
+			b:    &MatchFlow{Strict: true, Priority: 20, Table: 1},
+		},
+		{
+			desc:  "exact cookie mask",
+			a:     &MatchFlow{Cookie: 0x10, Table: AnyTable},
+			b:     &MatchFlow{Cookie: 0x10, CookieMask: 0xffffffffffffffff, Table: AnyTable},
+			equal: true,
+		},
+		{
+			desc: "cookie mask",
+			a:    &MatchFlow{Cookie: 0x10, Table: AnyTable},
+			b:    &MatchFlow{Cookie: 0x10, CookieMask: 0xff, Table: AnyTable},
+		},
+		{
+			desc: "matches",
+			a: &MatchFlow{
+				Matches: []Match{ARPSourceHardwareAddress(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad})},
+			},
+			b: &MatchFlow{
+				Matches: []Match{ARPTargetHardwareAddress(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad})},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if want, got := tt.equal, tt.a.Equal(tt.b); want != got {
+				t.Fatalf("unexpected equality:\n- want: %v\n-  got: %v", want, got)
+			}
+			if want, got := tt.equal, tt.b.Equal(tt.a); want != got {
+				t.Fatalf("unexpected reversed equality:\n- want: %v\n-  got: %v", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,1027 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrResubmitDepth is returned when evaluating a packet exceeds the
+	// maximum number of nested resubmits and goto_table instructions, which
+	// typically indicates a loop in the pipeline.
+	ErrResubmitDepth = errors.New("maximum resubmit depth exceeded")
+
+	// errUnsupportedProtocol is returned when a Classifier cannot determine
+	// the packets matched by a flow's Protocol.
+	errUnsupportedProtocol = errors.New("unsupported protocol")
+)
+
+// maxResubmitDepth is the maximum depth of nested table lookups, which
+// matches the limit used by Open vSwitch.
+const maxResubmitDepth = 64
+
+// classifierAliases maps field names accepted by Open vSwitch to the names
+// used in Packet.Fields.
+var classifierAliases = map[string]string{
+	"eth_src": dlSRC,
+	"eth_dst": dlDST,
+	"ip_src":  nwSRC,
+	"ip_dst":  nwDST,
+	"tcp_src": tpSRC,
+	"tcp_dst": tpDST,
+	"udp_src": tpSRC,
+	"udp_dst": tpDST,
+	sctpSRC:   tpSRC,
+	sctpDST:   tpDST,
+
+	ipECN:      nwECN,
+	icmpv6Type: icmpType,
+	icmpv6Code: icmpCode,
+}
+
+// Fields which contain IP or hardware addresses, or flags.
+var (
+	ipFields = map[string]bool{
+		nwSRC: true, nwDST: true, ipv6SRC: true, ipv6DST: true,
+		arpSPA: true, arpTPA: true, ndTarget: true,
+	}
+
+	hwAddrFields = map[string]bool{
+		dlSRC: true, dlDST: true, arpSHA: true, arpTHA: true,
+		ndSLL: true, ndTLL: true,
+	}
+
+	flagFields = map[string]bool{
+		ctState: true, tcpFlags: true,
+	}
+)
+
+// A Packet describes a packet evaluated by a Classifier.
+type Packet struct {
+	// Protocol, if set, sets the dl_type and nw_proto fields implied by
+	// the protocol.
+	Protocol Protocol
+
+	// InPort is the OpenFlow port the packet was received on.
+	InPort int
+
+	// Fields are the values of other fields, keyed by name, such as
+	// "nw_src" or "reg0".  Values use the same textual form as Matches,
+	// such as "192.0.2.1" or "+trk+est".  Fields which are not set are zero.
+	Fields map[string]string
+
+	// ConnectionState is the ct_state the packet is assigned when it is
+	// recirculated by a ct action, such as "+new" or "+est+rpl".  "+trk"
+	// is always added.
+	ConnectionState string
+}
+
+// A Trace is the result of evaluating a Packet with a Classifier.
+type Trace struct {
+	// Steps are the table lookups performed, in order.
+	Steps []TraceStep
+
+	// Actions are the actions applied to the packet, in order.
+	Actions []Action
+
+	// ActionSet contains the actions written by write_actions instructions,
+	// which are executed when pipeline processing ends.
+	ActionSet []Action
+
+	// Fields are the values of the packet's fields when pipeline
+	// processing ends.
+	Fields map[string]string
+}
+
+// A TraceStep is a single table lookup in a Trace.
+type TraceStep struct {
+	// Table is the table in which the lookup was performed.
+	Table int
+
+	// Depth is the number of resubmits, goto_table instructions, and
+	// recirculations which led to this lookup.
+	Depth int
+
+	// Flow is the flow which matched the packet, or nil if no flow
+	// matched and the packet was dropped by the table.
+	Flow *Flow
+}
+
+// A Classifier performs OpenFlow table lookups on a set of flows, such as
+// those returned by DumpFlows, without the need for Open vSwitch.
+//
+// A Classifier compares each field independently, so fields which overlap,
+// such as dl_vlan and vlan_tci, must be set consistently in a Packet.
+// Conjunctive matches are satisfied when every dimension of a conjunction
+// is matched by a flow in the same table, regardless of priority.
+type Classifier struct {
+	tables map[int][]*classifierFlow
+}
+
+// A classifierFlow is a Flow compiled for use by a Classifier.
+type classifierFlow struct {
+	flow  *Flow
+	conds []condition
+
+	// conj is set if every action of the flow is a conjunction action.
+	conj []*conjunctionAction
+}
+
+// A condition reports whether a packet satisfies a single match.
+type condition func(p *packetState) bool
+
+// NewClassifier creates a Classifier which classifies packets using flows.
+func NewClassifier(flows []*Flow) (*Classifier, error) {
+	c := &Classifier{
+		tables: make(map[int][]*classifierFlow),
+	}
+
+	for _, f := range flows {
+		cf, err := compileClassifierFlow(f)
+		if err != nil {
+			return nil, err
+		}
+
+		c.tables[f.Table] = append(c.tables[f.Table], cf)
+	}
+
+	for _, t := range c.tables {
+		sort.SliceStable(t, func(i, j int) bool {
+			return t[i].flow.Priority > t[j].flow.Priority
+		})
+	}
+
+	return c, nil
+}
+
+// compileClassifierFlow compiles the matches of f into conditions.
+func compileClassifierFlow(f *Flow) (*classifierFlow, error) {
+	cf := &classifierFlow{
+		flow: f,
+	}
+
+	if f.Protocol != "" {
+		pc, ok := protocolContexts[f.Protocol]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errUnsupportedProtocol, f.Protocol)
+		}
+
+		cf.conds = append(cf.conds, numericCondition(dlType, uint64(pc.etherType), ^uint64(0)))
+		if pc.ipProto >= 0 {
+			cf.conds = append(cf.conds, numericCondition(nwProto, uint64(pc.ipProto), ^uint64(0)))
+		}
+	}
+
+	if f.InPort != 0 {
+		cf.conds = append(cf.conds, inPortCondition(f.InPort))
+	}
+
+	err := eachMatchField(f, func(field, value string) error {
+		cond, err := compileCondition(field, value)
+		if err != nil {
+			return err
+		}
+
+		cf.conds = append(cf.conds, cond)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range f.Actions {
+		ca, ok := a.(*conjunctionAction)
+		if !ok {
+			cf.conj = nil
+			break
+		}
+
+		cf.conj = append(cf.conj, ca)
+	}
+
+	return cf, nil
+}
+
+// eachMatchField invokes fn with the field and value of each key/value pair
+// produced by the Matches of f.
+func eachMatchField(f *Flow, fn func(field, value string) error) error {
+	for _, m := range f.Matches {
+		b, err := m.MarshalText()
+		if err != nil {
+			return err
+		}
+
+		if len(b) == 0 {
+			continue
+		}
+
+		for s := string(b); s != ""; {
+			kv := s
+			if i := indexMatchSeparator(s); i != -1 {
+				kv, s = s[:i], s[i+1:]
+			} else {
+				s = ""
+			}
+
+			ss := strings.SplitN(kv, "=", 2)
+			if len(ss) != 2 {
+				return fmt.Errorf("invalid match: %q", kv)
+			}
+
+			if err := fn(ss[0], ss[1]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// compileCondition compiles a single match of field against value.
+func compileCondition(field, value string) (condition, error) {
+	field = classifierField(field)
+
+	switch {
+	case field == conjID:
+		id, err := strconv.ParseUint(value, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s match: %q", conjID, value)
+		}
+
+		return func(p *packetState) bool {
+			return p.conjIDs[int(id)]
+		}, nil
+	case field == inPort:
+		if value == portLOCAL {
+			return inPortCondition(PortLOCAL), nil
+		}
+
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s match: %q", inPort, value)
+		}
+
+		return inPortCondition(port), nil
+	case ipFields[field]:
+		_, want, err := parseIPNet(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s match: %v", field, err)
+		}
+
+		return func(p *packetState) bool {
+			ip := net.ParseIP(p.fields[field])
+			if ip == nil {
+				return false
+			}
+
+			return want.Contains(ip)
+		}, nil
+	case hwAddrFields[field]:
+		want, mask, err := parseMaskedHardwareAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s match: %v", field, err)
+		}
+
+		return func(p *packetState) bool {
+			addr, err := net.ParseMAC(p.fields[field])
+			if err != nil {
+				addr = make(net.HardwareAddr, len(want))
+			}
+
+			return maskedBytesEqual(addr, want, mask)
+		}, nil
+	case field == ipFrag:
+		return ipFragCondition(IPFrag(value))
+	case isWideRegister(field):
+		return wideRegisterCondition(field, value)
+	case field == packetType:
+		wantNS, wantType, err := parsePacketType(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(p *packetState) bool {
+			// Packets are Ethernet frames unless specified otherwise.
+			v, ok := p.fields[packetType]
+			if !ok {
+				return wantNS == PacketNamespaceOpenFlow && wantType == 0
+			}
+
+			ns, typ, err := parsePacketType(v)
+			return err == nil && ns == wantNS && typ == wantType
+		}, nil
+	case flagFields[field]:
+		set, unset, err := parseFlagMatch(field, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s match: %v", field, err)
+		}
+
+		return func(p *packetState) bool {
+			have, _, _ := parseFlagMatch(field, p.fields[field])
+			for _, f := range set {
+				if !containsString(have, f) {
+					return false
+				}
+			}
+			for _, f := range unset {
+				if containsString(have, f) {
+					return false
+				}
+			}
+
+			return true
+		}, nil
+	}
+
+	// All remaining fields are numeric, with an optional mask.
+	v, mask, err := parseMaskedUint64(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s match: %q", field, value)
+	}
+	if mask == 0 {
+		mask = ^uint64(0)
+	}
+
+	return numericCondition(field, v, mask), nil
+}
+
+// numericCondition creates a condition which matches packets whose field
+// is equal to value under mask.
+func numericCondition(field string, value, mask uint64) condition {
+	return func(p *packetState) bool {
+		v, ok := p.uint(field)
+		if !ok {
+			return false
+		}
+
+		return v&mask == value&mask
+	}
+}
+
+// isWideRegister reports whether field is an xreg or xxreg register, which
+// the classifier stores as the 32 bit registers it consists of.
+func isWideRegister(field string) bool {
+	family, _, ok := parseRegisterName(field)
+	return ok && family != regFamily
+}
+
+// wideRegisterCondition compiles a match of an xreg or xxreg register into
+// matches of the 32 bit registers it consists of.
+func wideRegisterCondition(field, value string) (condition, error) {
+	family, n, _ := parseRegisterName(field)
+	v, mask, err := parseRegisterValue(family, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s match: %v", field, err)
+	}
+
+	var conds []condition
+	for _, w := range registerWords(family, n, v, mask) {
+		conds = append(conds, numericCondition(regFamily+strconv.Itoa(w.reg), uint64(w.value), uint64(w.mask)))
+	}
+
+	return func(p *packetState) bool {
+		for _, c := range conds {
+			if !c(p) {
+				return false
+			}
+		}
+
+		return true
+	}, nil
+}
+
+// ipFragBits maps each IPFrag to the value and mask of the two bit field
+// Open vSwitch uses to match fragments, in which bit 0 is set for fragments
+// and bit 1 is set for fragments other than the first.
+var ipFragBits = map[IPFrag][2]uint64{
+	IPFragNo:       {0, 3},
+	IPFragYes:      {1, 1},
+	IPFragFirst:    {1, 3},
+	IPFragLater:    {3, 3},
+	IPFragNotLater: {0, 2},
+}
+
+// ipFragCondition creates a condition which matches packets in the
+// fragmentation state frag.  The ip_frag field of a packet is one of "no",
+// "first", or "later", and packets which do not set it are not fragments.
+func ipFragCondition(frag IPFrag) (condition, error) {
+	want, ok := ipFragBits[frag]
+	if !ok {
+		return nil, fmt.Errorf("invalid %s match: %q", ipFrag, frag)
+	}
+
+	return func(p *packetState) bool {
+		have := IPFrag(p.fields[ipFrag])
+		if have == "" {
+			have = IPFragNo
+		}
+
+		bits, ok := ipFragBits[have]
+		if !ok {
+			return false
+		}
+
+		return bits[0]&want[1] == want[0]
+	}, nil
+}
+
+// inPortCondition creates a condition which matches packets received on
+// port.
+func inPortCondition(port int) condition {
+	return func(p *packetState) bool {
+		return p.inPort == port
+	}
+}
+
+// classifierField returns the canonical name of the field referred to by s.
+func classifierField(s string) string {
+	s = fieldName(s)
+	if alias, ok := classifierAliases[s]; ok {
+		return alias
+	}
+
+	return s
+}
+
+// parseIPNet parses an IP address, CIDR block, or address and mask.
+func parseIPNet(s string) (net.IP, *net.IPNet, error) {
+	ss := strings.SplitN(s, "/", 2)
+
+	ip := net.ParseIP(ss[0])
+	if ip == nil {
+		return nil, nil, fmt.Errorf("invalid IP address: %q", s)
+	}
+
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+
+	mask := net.CIDRMask(bits, bits)
+	if len(ss) == 2 {
+		if ones, err := strconv.Atoi(ss[1]); err == nil {
+			mask = net.CIDRMask(ones, bits)
+		} else if m := net.ParseIP(ss[1]); m != nil {
+			if bits == 32 {
+				m = m.To4()
+			}
+			mask = net.IPMask(m)
+		}
+		if mask == nil || len(mask) != len(ip) {
+			return nil, nil, fmt.Errorf("invalid IP mask: %q", s)
+		}
+	}
+
+	return ip, &net.IPNet{IP: ip.Mask(mask), Mask: mask}, nil
+}
+
+// parseMaskedHardwareAddr parses a hardware address with an optional mask.
+func parseMaskedHardwareAddr(s string) (net.HardwareAddr, []byte, error) {
+	ss := strings.SplitN(s, "/", 2)
+
+	addr, err := net.ParseMAC(ss[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mask := bytes.Repeat([]byte{0xff}, len(addr))
+	if len(ss) == 2 {
+		m, err := net.ParseMAC(ss[1])
+		if err != nil || len(m) != len(addr) {
+			return nil, nil, fmt.Errorf("invalid hardware address mask: %q", s)
+		}
+		mask = m
+	}
+
+	return addr, mask, nil
+}
+
+// maskedBytesEqual reports whether a and b are equal under mask.
+func maskedBytesEqual(a, b, mask []byte) bool {
+	if len(a) != len(b) || len(a) != len(mask) {
+		return false
+	}
+
+	for i := range a {
+		if a[i]&mask[i] != b[i]&mask[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseFlagMatch parses flags of field in the form "+trk+est-new", or in
+// the hexadecimal form "0x22/0x23", into the flags which must be set and
+// unset.
+func parseFlagMatch(field, s string) (set []string, unset []string, err error) {
+	if ff, ok := flagBitFields[field]; ok && s != "" && s[0] != '+' && s[0] != '-' {
+		setBits, unsetBits, err := ff.parse(s)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for i, name := range ff.names {
+			switch bit := uint16(1) << uint(i); {
+			case setBits&bit != 0:
+				set = append(set, name)
+			case unsetBits&bit != 0:
+				unset = append(unset, name)
+			}
+		}
+
+		return set, unset, nil
+	}
+
+	for len(s) > 0 {
+		sign := s[0]
+		if sign != '+' && sign != '-' {
+			return nil, nil, fmt.Errorf("invalid flags: %q", s)
+		}
+
+		end := strings.IndexAny(s[1:], "+-")
+		if end == -1 {
+			end = len(s) - 1
+		}
+
+		flag := s[1 : end+1]
+		if flag == "" {
+			return nil, nil, fmt.Errorf("invalid flags: %q", s)
+		}
+		if sign == '+' {
+			set = append(set, flag)
+		} else {
+			unset = append(unset, flag)
+		}
+
+		s = s[end+1:]
+	}
+
+	return set, unset, nil
+}
+
+// containsString reports whether ss contains s.
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A packetState is the state of a packet during evaluation.
+type packetState struct {
+	inPort  int
+	fields  map[string]string
+	conjIDs map[int]bool
+}
+
+// newPacketState creates a packetState from p.
+func newPacketState(p *Packet) (*packetState, error) {
+	ps := &packetState{
+		inPort: p.InPort,
+		fields: make(map[string]string, len(p.Fields)+2),
+	}
+
+	for k, v := range p.Fields {
+		ps.fields[classifierField(k)] = v
+	}
+
+	if p.Protocol != "" {
+		pc, ok := protocolContexts[p.Protocol]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errUnsupportedProtocol, p.Protocol)
+		}
+
+		ps.fields[dlType] = fmt.Sprintf("%#04x", pc.etherType)
+		if pc.ipProto >= 0 {
+			ps.fields[nwProto] = strconv.Itoa(pc.ipProto)
+		}
+	}
+
+	return ps, nil
+}
+
+// uint returns the numeric value of a field, which is zero if the field is
+// not set.
+func (p *packetState) uint(field string) (uint64, bool) {
+	s, ok := p.fields[field]
+	if !ok || s == "" {
+		return 0, true
+	}
+
+	v, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return v, true
+}
+
+// setField sets field to value, or the bits of field selected by bits, which
+// is a range such as "[0..15]", "[3]", or "[]".
+func (p *packetState) setField(field, bits, value string) error {
+	field = classifierField(field)
+	if isWideRegister(field) {
+		return p.setWideRegister(field, bits, value)
+	}
+	if bits == "" || bits == "[]" {
+		if ipFields[field] || hwAddrFields[field] || flagFields[field] {
+			if v, err := strconv.ParseUint(value, 0, 64); err == nil && ipFields[field] {
+				value = net.IPv4(byte(v>>24), byte(v>>16), byte(v>>8), byte(v)).String()
+			}
+
+			p.fields[field] = value
+			return nil
+		}
+	}
+
+	start, end, err := parseBitRange(bits)
+	if err != nil {
+		return err
+	}
+
+	// Values may carry their own mask, as in set_field:0x1/0xff->reg0.
+	v, vmask, err := parseMaskedUint64(value)
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %q", field, value)
+	}
+
+	cur, ok := p.uint(field)
+	if !ok {
+		return fmt.Errorf("field %s is not numeric", field)
+	}
+
+	mask := ^uint64(0)
+	if end-start < 63 {
+		mask = (uint64(1) << uint(end-start+1)) - 1
+	}
+	if vmask != 0 {
+		mask &= vmask
+	}
+	cur = cur&^(mask<<uint(start)) | (v&mask)<<uint(start)
+
+	p.fields[field] = fmt.Sprintf("%#x", cur)
+	return nil
+}
+
+// setWideRegister sets the bits of an xreg or xxreg register selected by
+// bits to value, by setting the 32 bit registers it consists of.
+func (p *packetState) setWideRegister(field, bits, value string) error {
+	family, n, _ := parseRegisterName(field)
+	f, err := parseRegisterField(field, field+bits)
+	if err != nil {
+		return err
+	}
+
+	// Values may carry their own mask, as in set_field:0x1/0xff->xreg0.
+	v, vmask, err := parseRegisterValue(xxregFamily, value)
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %q", field, value)
+	}
+
+	mask := uint128Mask(0, f.Width()-1).and(vmask).lsh(uint(f.Start))
+	for _, w := range registerWords(family, n, v.lsh(uint(f.Start)), mask) {
+		reg := regFamily + strconv.Itoa(w.reg)
+		cur, ok := p.uint(reg)
+		if !ok {
+			return fmt.Errorf("field %s is not numeric", reg)
+		}
+
+		p.fields[reg] = fmt.Sprintf("%#x", cur&^uint64(w.mask)|uint64(w.value))
+	}
+
+	return nil
+}
+
+// getField returns the bits of field selected by bits, which is a range
+// such as "[0..15]", "[3]", or "[]".  Only numeric fields may be read.
+func (p *packetState) getField(field, bits string) (uint64, error) {
+	field = classifierField(field)
+
+	if isWideRegister(field) {
+		family, n, _ := parseRegisterName(field)
+		f, err := parseRegisterField(field, field+bits)
+		if err != nil {
+			return 0, err
+		}
+		if f.Width() > 64 {
+			return 0, fmt.Errorf("cannot read more than 64 bits of %s", field)
+		}
+
+		var v Uint128
+		for _, w := range registerWords(family, n, Uint128{}, uint128Mask(f.Start, f.End)) {
+			cur, _ := p.uint(regFamily + strconv.Itoa(w.reg))
+
+			// Reassemble the register, whose lowest numbered 32 bit
+			// register holds its most significant bits.
+			i := n*registerWidths[family]/32 + registerWidths[family]/32 - 1 - w.reg
+			v = v.or(Uint128{Lo: cur & uint64(w.mask)}.lsh(uint(i * 32)))
+		}
+
+		return v.rsh(uint(f.Start)).Lo, nil
+	}
+
+	start, end, err := parseBitRange(bits)
+	if err != nil {
+		return 0, err
+	}
+
+	v, ok := p.uint(field)
+	if !ok {
+		return 0, fmt.Errorf("field %s is not numeric", field)
+	}
+
+	v >>= uint(start)
+	if end-start < 63 {
+		v &= (uint64(1) << uint(end-start+1)) - 1
+	}
+
+	return v, nil
+}
+
+// splitBitRange splits a field such as "reg0[0..15]" into its name and bit
+// range.
+func splitBitRange(s string) (field, bits string) {
+	if i := strings.IndexByte(s, '['); i != -1 {
+		return s[:i], s[i:]
+	}
+
+	return s, ""
+}
+
+// bitRangeRe matches a bit range such as "[0..15]" or "[3]".
+var bitRangeRe = regexp.MustCompile(`^\[(\d+)(?:\.\.(\d+))?\]$`)
+
+// parseBitRange parses a bit range.  An empty range selects all 64 bits.
+func parseBitRange(s string) (int, int, error) {
+	if s == "" || s == "[]" {
+		return 0, 63, nil
+	}
+
+	ss := bitRangeRe.FindStringSubmatch(s)
+	if ss == nil {
+		return 0, 0, fmt.Errorf("invalid bit range: %q", s)
+	}
+
+	start, _ := strconv.Atoi(ss[1])
+	end := start
+	if ss[2] != "" {
+		end, _ = strconv.Atoi(ss[2])
+	}
+	if end < start || end > 63 {
+		return 0, 0, fmt.Errorf("invalid bit range: %q", s)
+	}
+
+	return start, end, nil
+}
+
+// Lookup returns the highest priority flow in table which matches p, or nil
+// if no flow matches.
+func (c *Classifier) Lookup(table int, p *Packet) (*Flow, error) {
+	ps, err := newPacketState(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.lookup(table, ps), nil
+}
+
+// lookup returns the highest priority flow in table which matches p.
+func (c *Classifier) lookup(table int, p *packetState) *Flow {
+	flows := c.tables[table]
+
+	// Determine which conjunctions have every dimension matched before
+	// matching conj_id.
+	dims := make(map[int]map[int]bool)
+	sizes := make(map[int]int)
+	for _, cf := range flows {
+		if cf.conj == nil || !cf.matches(p) {
+			continue
+		}
+
+		for _, ca := range cf.conj {
+			if dims[ca.id] == nil {
+				dims[ca.id] = make(map[int]bool)
+			}
+			dims[ca.id][ca.dimensionNumber] = true
+			sizes[ca.id] = ca.dimensionSize
+		}
+	}
+
+	p.conjIDs = make(map[int]bool, len(dims))
+	for id, d := range dims {
+		if len(d) == sizes[id] {
+			p.conjIDs[id] = true
+		}
+	}
+
+	for _, cf := range flows {
+		if cf.conj == nil && cf.matches(p) {
+			return cf.flow
+		}
+	}
+
+	return nil
+}
+
+// matches reports whether p satisfies every condition of cf.
+func (cf *classifierFlow) matches(p *packetState) bool {
+	for _, cond := range cf.conds {
+		if !cond(p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Evaluate evaluates p beginning in table 0, following resubmit actions,
+// goto_table instructions, and ct actions which recirculate to a table,
+// and returns a Trace of the lookups performed and actions applied.
+func (c *Classifier) Evaluate(p *Packet) (*Trace, error) {
+	ps, err := newPacketState(p)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &evaluation{
+		c:     c,
+		p:     ps,
+		ct:    "+trk" + p.ConnectionState,
+		trace: &Trace{},
+	}
+
+	if err := e.run(0, 0); err != nil {
+		return nil, err
+	}
+
+	e.trace.Fields = ps.fields
+	return e.trace, nil
+}
+
+// An evaluation is the state of a single call to Classifier.Evaluate.
+type evaluation struct {
+	c     *Classifier
+	p     *packetState
+	ct    string
+	trace *Trace
+}
+
+// ctTableRe matches the table argument of a ct action.
+var ctTableRe = regexp.MustCompile(`(?:^|,)table=(\d+)`)
+
+// run performs a lookup in table and applies the actions of the matching
+// flow.
+func (e *evaluation) run(table, depth int) error {
+	if depth > maxResubmitDepth {
+		return ErrResubmitDepth
+	}
+
+	f := e.c.lookup(table, e.p)
+	e.trace.Steps = append(e.trace.Steps, TraceStep{
+		Table: table,
+		Depth: depth,
+		Flow:  f,
+	})
+	if f == nil {
+		return nil
+	}
+
+	actions, err := sortInstructions(f.Actions)
+	if err != nil {
+		return err
+	}
+
+	gotoTable := -1
+	for _, a := range actions {
+		e.trace.Actions = append(e.trace.Actions, a)
+
+		switch a := a.(type) {
+		case *resubmitAction:
+			next := a.table
+			if next == 0 {
+				next = table
+			}
+			if err := e.resubmit(a.port, next, depth); err != nil {
+				return err
+			}
+		case *resubmitPortAction:
+			if err := e.resubmit(a.port, table, depth); err != nil {
+				return err
+			}
+		case *ctAction:
+			ss := ctTableRe.FindStringSubmatch(a.args)
+			if ss == nil {
+				continue
+			}
+
+			next, _ := strconv.Atoi(ss[1])
+			e.p.fields[ctState] = e.ct
+			if err := e.run(next, depth+1); err != nil {
+				return err
+			}
+		case *gotoTableInstruction:
+			gotoTable = a.table
+		case *clearActionsInstruction:
+			e.trace.ActionSet = nil
+		case *writeActionsInstruction:
+			e.trace.ActionSet = append(e.trace.ActionSet, a.actions...)
+		case *writeMetadataInstruction:
+			mask := a.mask
+			if mask == 0 {
+				mask = ^uint64(0)
+			}
+
+			cur, _ := e.p.uint(metadata)
+			e.p.fields[metadata] = fmt.Sprintf("%#x", cur&^mask|a.value&mask)
+		case *loadSetFieldAction:
+			field, bits := splitBitRange(a.field)
+			if err := e.p.setField(field, bits, a.value); err != nil {
+				return err
+			}
+		case *moveAction:
+			src, srcBits := splitBitRange(a.src)
+			dst, dstBits := splitBitRange(a.dst)
+
+			v, err := e.p.getField(src, srcBits)
+			if err != nil {
+				return err
+			}
+
+			if err := e.p.setField(dst, dstBits, fmt.Sprintf("%#x", v)); err != nil {
+				return err
+			}
+		case *setPacketMetadataAction:
+			if err := e.p.setField(a.field, "", a.valueMask()); err != nil {
+				return err
+			}
+		case *setARPAction:
+			v, err := a.value()
+			if err != nil {
+				return err
+			}
+
+			if err := e.p.setField(a.field, "", v); err != nil {
+				return err
+			}
+		case *mplsAction:
+			e.p.fields[dlType] = fmt.Sprintf("%#04x", a.etherType)
+		case *setMPLSLabelAction:
+			e.p.fields[mplsLabel] = strconv.Itoa(int(a.label))
+		case *modNetworkAction:
+			e.p.fields["nw_"+a.srcdst] = a.ip.String()
+		case *modTransportPortAction:
+			e.p.fields["tp_"+a.srcdst] = strconv.Itoa(int(a.port))
+		case *modDataLinkAction:
+			e.p.fields["dl_"+a.srcdst] = a.addr.String()
+		case *modVLANVIDAction:
+			e.p.fields[dlVLAN] = strconv.Itoa(a.vid)
+		case *setTunnelAction:
+			e.p.fields[tunID] = fmt.Sprintf("%#x", a.tunnelID)
+		}
+	}
+
+	if gotoTable >= 0 {
+		return e.run(gotoTable, depth+1)
+	}
+
+	return nil
+}
+
+// resubmit performs a nested lookup in table, as if the packet was received
+// on port if port is non-zero.
+func (e *evaluation) resubmit(port, table, depth int) error {
+	if port == 0 {
+		return e.run(table, depth+1)
+	}
+
+	prev := e.p.inPort
+	e.p.inPort = port
+	err := e.run(table, depth+1)
+	e.p.inPort = prev
+
+	return err
+}
@@ -0,0 +1,524 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestClassifierLookup(t *testing.T) {
+	var (
+		sshFlow = &Flow{
+			Priority: 200,
+			Protocol: ProtocolTCPv4,
+			Matches: []Match{
+				NetworkDestination("192.0.2.0/24"),
+				TransportDestinationPort(22),
+			},
+			Actions: []Action{Normal()},
+		}
+		highPortFlow = &Flow{
+			Priority: 150,
+			Protocol: ProtocolTCPv4,
+			Matches: []Match{
+				TransportDestinationMaskedPort(0x8000, 0x8000),
+			},
+			Actions: []Action{Normal()},
+		}
+		establishedFlow = &Flow{
+			Priority: 100,
+			Protocol: ProtocolIPv4,
+			Matches: []Match{
+				ConnectionTrackingState(
+					SetState(CTStateTracked),
+					SetState(CTStateEstablished),
+					UnsetState(CTStateInvalid),
+				),
+			},
+			Actions: []Action{Normal()},
+		}
+		macFlow = &Flow{
+			Priority: 50,
+			InPort:   1,
+			Matches: []Match{
+				DataLinkSource("de:ad:be:ef:de:ad"),
+			},
+			Actions: []Action{Normal()},
+		}
+		fragmentFlow = &Flow{
+			Priority: 300,
+			Protocol: ProtocolIPv4,
+			Matches: []Match{
+				IPFragment(IPFragLater),
+			},
+			Actions: []Action{Drop()},
+		}
+		dropFlow = &Flow{
+			Priority: 0,
+			Actions:  []Action{Drop()},
+		}
+	)
+
+	c, err := NewClassifier([]*Flow{
+		dropFlow, macFlow, establishedFlow, highPortFlow, sshFlow, fragmentFlow,
+	})
+	if err != nil {
+		t.Fatalf("failed to create classifier: %v", err)
+	}
+
+	var tests = []struct {
+		desc string
+		p    *Packet
+		f    *Flow
+	}{
+		{
+			desc: "CIDR and port",
+			p: &Packet{
+				Protocol: ProtocolTCPv4,
+				Fields: map[string]string{
+					"nw_dst": "192.0.2.10",
+					"tp_dst": "22",
+				},
+			},
+			f: sshFlow,
+		},
+		{
+			desc: "outside CIDR",
+			p: &Packet{
+				Protocol: ProtocolTCPv4,
+				Fields: map[string]string{
+					"nw_dst": "198.51.100.10",
+					"tp_dst": "22",
+				},
+			},
+			f: dropFlow,
+		},
+		{
+			desc: "first fragment",
+			p: &Packet{
+				Protocol: ProtocolTCPv4,
+				Fields: map[string]string{
+					"nw_dst":  "192.0.2.10",
+					"tp_dst":  "22",
+					"ip_frag": "first",
+				},
+			},
+			f: sshFlow,
+		},
+		{
+			desc: "later fragment",
+			p: &Packet{
+				Protocol: ProtocolTCPv4,
+				Fields: map[string]string{
+					"nw_dst":  "192.0.2.10",
+					"ip_frag": "later",
+				},
+			},
+			f: fragmentFlow,
+		},
+		{
+			desc: "masked port",
+			p: &Packet{
+				Protocol: ProtocolTCPv4,
+				Fields: map[string]string{
+					"tcp_dst": "40000",
+				},
+			},
+			f: highPortFlow,
+		},
+		{
+			desc: "connection state",
+			p: &Packet{
+				Protocol: ProtocolUDPv4,
+				Fields: map[string]string{
+					"ct_state": "+trk+est",
+				},
+			},
+			f: establishedFlow,
+		},
+		{
+			desc: "hexadecimal connection state",
+			p: &Packet{
+				Protocol: ProtocolUDPv4,
+				Fields: map[string]string{
+					"ct_state": "0x22",
+				},
+			},
+			f: establishedFlow,
+		},
+		{
+			desc: "invalid connection state",
+			p: &Packet{
+				Protocol: ProtocolUDPv4,
+				Fields: map[string]string{
+					"ct_state": "+trk+est+inv",
+				},
+			},
+			f: dropFlow,
+		},
+		{
+			desc: "in_port and hardware address",
+			p: &Packet{
+				InPort: 1,
+				Fields: map[string]string{
+					"dl_src": "de:ad:be:ef:de:ad",
+				},
+			},
+			f: macFlow,
+		},
+		{
+			desc: "wrong in_port",
+			p: &Packet{
+				InPort: 2,
+				Fields: map[string]string{
+					"dl_src": "de:ad:be:ef:de:ad",
+				},
+			},
+			f: dropFlow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			f, err := c.Lookup(0, tt.p)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if want, got := tt.f, f; want != got {
+				t.Fatalf("unexpected flow:\n- want: %#v\n-  got: %#v", want, got)
+			}
+		})
+	}
+}
+
+func TestClassifierLookupConjunction(t *testing.T) {
+	allowFlow := &Flow{
+		Priority: 100,
+		Matches:  []Match{ConjunctionID(1)},
+		Actions:  []Action{Normal()},
+	}
+
+	c, err := NewClassifier([]*Flow{
+		{
+			Priority: 100,
+			Protocol: ProtocolIPv4,
+			Matches:  []Match{NetworkSource("192.0.2.1")},
+			Actions:  []Action{Conjunction(1, 1, 2)},
+		},
+		{
+			Priority: 100,
+			Protocol: ProtocolTCPv4,
+			Matches:  []Match{TransportDestinationPort(443)},
+			Actions:  []Action{Conjunction(1, 2, 2)},
+		},
+		allowFlow,
+	})
+	if err != nil {
+		t.Fatalf("failed to create classifier: %v", err)
+	}
+
+	var tests = []struct {
+		desc   string
+		fields map[string]string
+		f      *Flow
+	}{
+		{
+			desc: "both dimensions",
+			fields: map[string]string{
+				"nw_src": "192.0.2.1",
+				"tp_dst": "443",
+			},
+			f: allowFlow,
+		},
+		{
+			desc: "one dimension",
+			fields: map[string]string{
+				"nw_src": "192.0.2.1",
+				"tp_dst": "80",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			f, err := c.Lookup(0, &Packet{
+				Protocol: ProtocolTCPv4,
+				Fields:   tt.fields,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if want, got := tt.f, f; want != got {
+				t.Fatalf("unexpected flow:\n- want: %#v\n-  got: %#v", want, got)
+			}
+		})
+	}
+}
+
+func TestClassifierEvaluate(t *testing.T) {
+	var (
+		classifyFlow = &Flow{
+			Table:    0,
+			Priority: 100,
+			InPort:   1,
+			Actions: []Action{
+				Load("0x2a", "NXM_NX_REG0[0..15]"),
+				ConnectionTracking("table=1"),
+			},
+		}
+		newFlow = &Flow{
+			Table:    1,
+			Priority: 100,
+			Matches: []Match{
+				ConnectionTrackingState(SetState(CTStateNew)),
+				RegMatch(0, 0x2a, 0xffff),
+			},
+			Actions: []Action{
+				ModNetworkDestination(net.IPv4(198, 51, 100, 1)),
+				Resubmit(2, 2),
+			},
+		}
+		outputFlow = &Flow{
+			Table:    2,
+			Priority: 100,
+			InPort:   2,
+			Matches:  []Match{NetworkDestination("198.51.100.0/24")},
+			Protocol: ProtocolIPv4,
+			Actions: []Action{
+				WriteActions(Output(3)),
+				GotoTable(3),
+			},
+		}
+	)
+
+	c, err := NewClassifier([]*Flow{classifyFlow, newFlow, outputFlow})
+	if err != nil {
+		t.Fatalf("failed to create classifier: %v", err)
+	}
+
+	trace, err := c.Evaluate(&Packet{
+		Protocol: ProtocolUDPv4,
+		InPort:   1,
+		Fields: map[string]string{
+			"nw_dst": "192.0.2.1",
+		},
+		ConnectionState: "+new",
+	})
+	if err != nil {
+		t.Fatalf("failed to evaluate packet: %v", err)
+	}
+
+	wantSteps := []TraceStep{
+		{Table: 0, Depth: 0, Flow: classifyFlow},
+		{Table: 1, Depth: 1, Flow: newFlow},
+		{Table: 2, Depth: 2, Flow: outputFlow},
+		{Table: 3, Depth: 3},
+	}
+	if want, got := wantSteps, trace.Steps; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected steps:\n- want: %#v\n-  got: %#v", want, got)
+	}
+
+	if want, got := []Action{Output(3)}, trace.ActionSet; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected action set:\n- want: %#v\n-  got: %#v", want, got)
+	}
+
+	wantFields := map[string]string{
+		"dl_type":  "0x0800",
+		"nw_proto": "17",
+		"nw_dst":   "198.51.100.1",
+		"reg0":     "0x2a",
+		"ct_state": "+trk+new",
+	}
+	if want, got := wantFields, trace.Fields; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected fields:\n- want: %v\n-  got: %v", want, got)
+	}
+
+	if want, got := 6, len(trace.Actions); want != got {
+		t.Fatalf("unexpected number of actions:\n- want: %v\n-  got: %v", want, got)
+	}
+}
+
+func TestClassifierEvaluateARPResponder(t *testing.T) {
+	responder := &Flow{
+		Priority: 100,
+		Protocol: ProtocolARP,
+		Matches: []Match{
+			ARPOperation(ARPOperationRequest),
+			ARPTargetProtocolAddress("192.0.2.1"),
+		},
+		Actions: []Action{
+			SetARPOperation(ARPOperationReply),
+			SetARPTargetHardwareAddress(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0x00, 0x02}),
+			SetARPTargetProtocolAddress(net.IPv4(192, 0, 2, 2)),
+			SetARPSourceHardwareAddress(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0x00, 0x01}),
+			SetARPSourceProtocolAddress(net.IPv4(192, 0, 2, 1)),
+			InPort(),
+		},
+	}
+
+	c, err := NewClassifier([]*Flow{responder})
+	if err != nil {
+		t.Fatalf("failed to create classifier: %v", err)
+	}
+
+	trace, err := c.Evaluate(&Packet{
+		Protocol: ProtocolARP,
+		InPort:   1,
+		Fields: map[string]string{
+			"arp_op":  "1",
+			"arp_sha": "de:ad:be:ef:00:02",
+			"arp_spa": "192.0.2.2",
+			"arp_tpa": "192.0.2.1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to evaluate packet: %v", err)
+	}
+
+	wantFields := map[string]string{
+		"dl_type": "0x0806",
+		"arp_op":  "0x2",
+		"arp_sha": "de:ad:be:ef:00:01",
+		"arp_spa": "192.0.2.1",
+		"arp_tha": "de:ad:be:ef:00:02",
+		"arp_tpa": "192.0.2.2",
+	}
+	if want, got := wantFields, trace.Fields; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected fields:\n- want: %v\n-  got: %v", want, got)
+	}
+}
+
+func TestClassifierEvaluatePacketMark(t *testing.T) {
+	c, err := NewClassifier([]*Flow{{
+		Priority: 10,
+		Matches: []Match{
+			PacketType(PacketNamespaceEtherType, 0x0800),
+		},
+		Actions: []Action{
+			SetPacketMark(0x100, 0xff00),
+			Resubmit(0, 1),
+		},
+	}, {
+		Table: 1,
+		Matches: []Match{
+			PacketMark(0x100, 0xff00),
+		},
+		Actions: []Action{
+			SetMetadata(0x1, 0xf),
+			Output(1),
+		},
+	}})
+	if err != nil {
+		t.Fatalf("failed to create classifier: %v", err)
+	}
+
+	trace, err := c.Evaluate(&Packet{
+		Fields: map[string]string{
+			"packet_type": "(1,0x800)",
+			"pkt_mark":    "0x1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to evaluate packet: %v", err)
+	}
+
+	wantFields := map[string]string{
+		"packet_type": "(1,0x800)",
+		"pkt_mark":    "0x101",
+		"metadata":    "0x1",
+	}
+	if want, got := wantFields, trace.Fields; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected fields:\n- want: %v\n-  got: %v", want, got)
+	}
+
+	// Ethernet frames do not match the L3 packet type.
+	trace, err = c.Evaluate(&Packet{})
+	if err != nil {
+		t.Fatalf("failed to evaluate packet: %v", err)
+	}
+	if len(trace.Steps) != 1 || trace.Steps[0].Flow != nil {
+		t.Fatalf("unexpected trace steps: %v", trace.Steps)
+	}
+}
+
+func TestClassifierEvaluateWideRegisters(t *testing.T) {
+	c, err := NewClassifier([]*Flow{{
+		Actions: []Action{
+			Load("0x100000002", "xreg0[]"),
+			Move("reg1[0..15]", "reg2[16..31]"),
+			Resubmit(0, 1),
+		},
+	}, {
+		Table: 1,
+		Matches: []Match{
+			XXRegMatch(0, Uint128{Hi: 0x100000002}, Uint128{Hi: 0xffffffffffffffff}),
+			RegMatch(2, 0x20000, 0xffff0000),
+		},
+		Actions: []Action{
+			Output(1),
+		},
+	}})
+	if err != nil {
+		t.Fatalf("failed to create classifier: %v", err)
+	}
+
+	trace, err := c.Evaluate(&Packet{})
+	if err != nil {
+		t.Fatalf("failed to evaluate packet: %v", err)
+	}
+
+	wantFields := map[string]string{
+		"reg0": "0x1",
+		"reg1": "0x2",
+		"reg2": "0x20000",
+	}
+	if want, got := wantFields, trace.Fields; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected fields:\n- want: %v\n-  got: %v", want, got)
+	}
+	if len(trace.Steps) != 2 || trace.Steps[1].Flow == nil {
+		t.Fatalf("unexpected trace steps: %v", trace.Steps)
+	}
+}
+
+func TestClassifierEvaluateLoop(t *testing.T) {
+	c, err := NewClassifier([]*Flow{{
+		Table:   1,
+		Actions: []Action{Resubmit(0, 1)},
+	}, {
+		Actions: []Action{Resubmit(0, 1)},
+	}})
+	if err != nil {
+		t.Fatalf("failed to create classifier: %v", err)
+	}
+
+	if _, err := c.Evaluate(&Packet{}); !errors.Is(err, ErrResubmitDepth) {
+		t.Fatalf("expected ErrResubmitDepth, but got: %v", err)
+	}
+}
+
+func TestNewClassifierInvalidMatch(t *testing.T) {
+	_, err := NewClassifier([]*Flow{{
+		Matches: []Match{NetworkSource("foo")},
+		Actions: []Action{Drop()},
+	}})
+	if err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
@@ -16,6 +16,8 @@ package ovs
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -33,6 +35,9 @@ type Client struct {
 	// VSwitch wraps functionality of the 'ovs-vsctl' binary.
 	VSwitch *VSwitchService
 
+	// App wraps functionality of the 'ovs-appctl' binary.
+	App *AppService
+
 	// Additional flags applied to all OVS actions, such as timeouts
 	// or retries.
 	flags []string
@@ -46,11 +51,20 @@ type Client struct {
 	// Prefix all commands with "sudo".
 	sudo bool
 
-	// Implementation of ExecFunc.
-	execFunc ExecFunc
+	// The Open vSwitch instance targeted by all commands.
+	instance InstanceOptions
+
+	// Validate flows before they are passed to 'ovs-ofctl'.
+	validate bool
+
+	// Implementation of ExecContextFunc.
+	execFunc ExecContextFunc
+
+	// Implementation of PipeContextFunc.
+	pipeFunc PipeContextFunc
 
-	// Implementation of PipeFunc.
-	pipeFunc PipeFunc
+	// Implementation of StreamContextFunc.
+	streamFunc StreamContextFunc
 }
 
 // An ExecFunc is a function which accepts input arguments and returns raw
@@ -58,19 +72,52 @@ type Client struct {
 // without OVS installed.
 type ExecFunc func(cmd string, args ...string) ([]byte, error)
 
+// An ExecContextFunc is like an ExecFunc, but accepts a context.Context
+// which should be used to terminate the command when the context is
+// canceled or its deadline expires.
+type ExecContextFunc func(ctx context.Context, cmd string, args ...string) ([]byte, error)
+
 // shellExec is an ExecFunc which shells out to the binary cmd using the
 // arguments args, and returns its combined stdout and stderr and any errors
 // which may have occurred.
 func shellExec(cmd string, args ...string) ([]byte, error) {
-	return exec.Command(cmd, args...).CombinedOutput()
+	return shellExecContext(context.Background(), cmd, args...)
+}
+
+// shellExecContext is an ExecContextFunc which shells out to the binary cmd
+// using the arguments args.  The process is killed if ctx is canceled before
+// the command completes.
+func shellExecContext(ctx context.Context, cmd string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, cmd, args...).CombinedOutput()
+}
+
+// execContextFunc adapts an ExecFunc for use as an ExecContextFunc.  An
+// ExecFunc cannot be interrupted, so ctx is only checked before and after
+// fn is invoked.
+func execContextFunc(fn ExecFunc) ExecContextFunc {
+	return func(ctx context.Context, cmd string, args ...string) ([]byte, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		out, err := fn(cmd, args...)
+		if cerr := ctx.Err(); err == nil && cerr != nil {
+			return out, cerr
+		}
+
+		return out, err
+	}
 }
 
-// exec executes an ExecFunc using the values from cmd and args.
-// The ExecFunc may shell out to an appropriate binary, or may be swapped
-// for testing.
-func (c *Client) exec(cmd string, args ...string) ([]byte, error) {
-	// Prepend recurring flags before arguments
-	flags := append(c.flags, args...)
+// exec executes an ExecContextFunc using the values from cmd and args.
+// The ExecContextFunc may shell out to an appropriate binary, or may be
+// swapped for testing.
+func (c *Client) exec(ctx context.Context, cmd string, args ...string) ([]byte, error) {
+	// Prepend recurring flags before arguments.  A copy is made so that
+	// concurrent commands never share the backing array of c.flags.
+	flags := make([]string, 0, len(c.flags)+len(args))
+	flags = append(flags, c.flags...)
+	flags = append(flags, args...)
 
 	// If needed, prefix sudo.
 	if c.sudo {
@@ -82,7 +129,7 @@ func (c *Client) exec(cmd string, args ...string) ([]byte, error) {
 
 	// Execute execFunc with all flags and clean up any whitespace or
 	// newlines from its output.
-	out, err := c.execFunc(cmd, flags...)
+	out, err := c.execFunc(ctx, cmd, flags...)
 	if out != nil {
 		out = bytes.TrimSpace(out)
 		c.debugf("exec: %q", string(out))
@@ -91,7 +138,7 @@ func (c *Client) exec(cmd string, args ...string) ([]byte, error) {
 		// Wrap errors in Error type for further introspection
 		return nil, &Error{
 			Out: out,
-			Err: err,
+			Err: contextError(ctx, err),
 		}
 	}
 
@@ -103,10 +150,22 @@ func (c *Client) exec(cmd string, args ...string) ([]byte, error) {
 // swappable to enable testing without OVS installed.
 type PipeFunc func(stdin io.Reader, cmd string, args ...string) ([]byte, error)
 
+// A PipeContextFunc is like a PipeFunc, but accepts a context.Context
+// which should be used to terminate the command when the context is
+// canceled or its deadline expires.
+type PipeContextFunc func(ctx context.Context, stdin io.Reader, cmd string, args ...string) ([]byte, error)
+
 // shellPipe is a PipeFunc which shells out to the binary cmd using the arguments
 // args, and writing to the command's stdin using stdin.
 func shellPipe(stdin io.Reader, cmd string, args ...string) ([]byte, error) {
-	command := exec.Command(cmd, args...)
+	return shellPipeContext(context.Background(), stdin, cmd, args...)
+}
+
+// shellPipeContext is a PipeContextFunc which shells out to the binary cmd
+// using the arguments args, and writing to the command's stdin using stdin.
+// The process is killed if ctx is canceled before the command completes.
+func shellPipeContext(ctx context.Context, stdin io.Reader, cmd string, args ...string) ([]byte, error) {
+	command := exec.CommandContext(ctx, cmd, args...)
 
 	stdout, err := command.StdoutPipe()
 	if err != nil {
@@ -127,6 +186,7 @@ func shellPipe(stdin io.Reader, cmd string, args ...string) ([]byte, error) {
 	}
 
 	if _, err := io.Copy(wc, stdin); err != nil {
+		_ = command.Wait()
 		return nil, err
 	}
 
@@ -135,25 +195,48 @@ func shellPipe(stdin io.Reader, cmd string, args ...string) ([]byte, error) {
 	// closed, the caller must close the pipe."
 	// Reference: https://golang.org/pkg/os/exec/#Cmd.StdinPipe
 	if err := wc.Close(); err != nil {
+		_ = command.Wait()
 		return nil, err
 	}
 
 	mr := io.MultiReader(stdout, stderr)
 	b, err := ioutil.ReadAll(mr)
 	if err != nil {
+		_ = command.Wait()
 		return nil, err
 	}
 
 	return b, command.Wait()
 }
 
-// pipe executes a PipeFunc using the values from stdin, cmd, and args.
+// pipeContextFunc adapts a PipeFunc for use as a PipeContextFunc.  A
+// PipeFunc cannot be interrupted, so ctx is only checked before and after
+// fn is invoked.
+func pipeContextFunc(fn PipeFunc) PipeContextFunc {
+	return func(ctx context.Context, stdin io.Reader, cmd string, args ...string) ([]byte, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		out, err := fn(stdin, cmd, args...)
+		if cerr := ctx.Err(); err == nil && cerr != nil {
+			return out, cerr
+		}
+
+		return out, err
+	}
+}
+
+// pipe executes a PipeContextFunc using the values from stdin, cmd, and args.
 // stdin is used to feed input data to the stdin of a forked process.
-// The PipeFunc may shell out to an appropriate binary, or may be swapped
-// for testing.
-func (c *Client) pipe(stdin io.Reader, cmd string, args ...string) error {
-	// Prepend recurring flags before arguments
-	flags := append(c.flags, args...)
+// The PipeContextFunc may shell out to an appropriate binary, or may be
+// swapped for testing.
+func (c *Client) pipe(ctx context.Context, stdin io.Reader, cmd string, args ...string) error {
+	// Prepend recurring flags before arguments.  A copy is made so that
+	// concurrent commands never share the backing array of c.flags.
+	flags := make([]string, 0, len(c.flags)+len(args))
+	flags = append(flags, c.flags...)
+	flags = append(flags, args...)
 
 	// If needed, prefix sudo.
 	if c.sudo {
@@ -169,28 +252,182 @@ func (c *Client) pipe(stdin io.Reader, cmd string, args ...string) error {
 		return len(p), nil
 	}))
 
-	if out, err := c.pipeFunc(tr, cmd, flags...); err != nil {
+	if out, err := c.pipeFunc(ctx, tr, cmd, flags...); err != nil {
 		c.debugf("pipe error: %v: %q", err, string(out))
-		return &pipeError{
-			out: out,
-			err: err,
+
+		// Wrap errors in Error type for further introspection
+		return &Error{
+			Out: bytes.TrimSpace(out),
+			Err: contextError(ctx, err),
+		}
+	}
+
+	return nil
+
+}
+
+// A StreamContextFunc is a function which starts the command cmd using the
+// arguments args, and returns a stream of the command's output.  Closing the
+// stream must terminate the command if it is still running, and return any
+// error reported by the command if its output was read in its entirety.
+// StreamContextFuncs are swappable to enable testing without OVS installed.
+type StreamContextFunc func(ctx context.Context, cmd string, args ...string) (io.ReadCloser, error)
+
+// shellStreamContext is a StreamContextFunc which shells out to the binary
+// cmd using the arguments args, and streams the command's stdout.  The
+// process is killed if ctx is canceled or the stream is closed before the
+// command completes.
+func shellStreamContext(ctx context.Context, cmd string, args ...string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	command := exec.CommandContext(ctx, cmd, args...)
+
+	cs := &commandStream{
+		command: command,
+		cancel:  cancel,
+	}
+	command.Stderr = &cs.stderr
+
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	cs.stdout = stdout
+
+	if err := command.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return cs, nil
+}
+
+// A commandStream is an io.ReadCloser which streams the stdout of a running
+// command.
+type commandStream struct {
+	command *exec.Cmd
+	cancel  func()
+	stdout  io.Reader
+	stderr  bytes.Buffer
+	eof     bool
+}
+
+// Read implements io.Reader.
+func (cs *commandStream) Read(b []byte) (int, error) {
+	n, err := cs.stdout.Read(b)
+	if err == io.EOF {
+		cs.eof = true
+	}
+
+	return n, err
+}
+
+// Close implements io.Closer.  If the command's output was not read in its
+// entirety, the command is killed and its exit status is ignored.
+func (cs *commandStream) Close() error {
+	if !cs.eof {
+		cs.cancel()
+		_ = cs.command.Wait()
+		return nil
+	}
+
+	defer cs.cancel()
+	if err := cs.command.Wait(); err != nil {
+		return &Error{
+			Out: bytes.TrimSpace(cs.stderr.Bytes()),
+			Err: err,
 		}
 	}
 
 	return nil
+}
+
+// execStreamFunc adapts an ExecContextFunc for use as a StreamContextFunc,
+// by buffering the entire output of the command.
+func execStreamFunc(fn ExecContextFunc) StreamContextFunc {
+	return func(ctx context.Context, cmd string, args ...string) (io.ReadCloser, error) {
+		out, err := fn(ctx, cmd, args...)
+		if err != nil {
+			return nil, &Error{
+				Out: bytes.TrimSpace(out),
+				Err: err,
+			}
+		}
+
+		return ioutil.NopCloser(bytes.NewReader(bytes.TrimSpace(out))), nil
+	}
+}
+
+// stream executes a StreamContextFunc using the values from cmd and args.
+// The StreamContextFunc may shell out to an appropriate binary, or may be
+// swapped for testing.  Errors from the returned stream's Close method are
+// wrapped in the Error type.
+func (c *Client) stream(ctx context.Context, cmd string, args ...string) (io.ReadCloser, error) {
+	// Prepend recurring flags before arguments.  A copy is made so that
+	// concurrent commands never share the backing array of c.flags.
+	flags := make([]string, 0, len(c.flags)+len(args))
+	flags = append(flags, c.flags...)
+	flags = append(flags, args...)
+
+	// If needed, prefix sudo.
+	if c.sudo {
+		flags = append([]string{cmd}, flags...)
+		cmd = "sudo"
+	}
+
+	c.debugf("stream: %s %v", cmd, flags)
+
+	rc, err := c.streamFunc(ctx, cmd, flags...)
+	if err != nil {
+		return nil, streamError(ctx, err)
+	}
+
+	return &clientStream{
+		ReadCloser: rc,
+		ctx:        ctx,
+	}, nil
+}
+
+// A clientStream wraps the errors returned when closing a stream.
+type clientStream struct {
+	io.ReadCloser
+	ctx context.Context
+}
+
+// Close implements io.Closer.
+func (cs *clientStream) Close() error {
+	if err := cs.ReadCloser.Close(); err != nil {
+		return streamError(cs.ctx, err)
+	}
 
+	return nil
 }
 
-// A pipeError is an error returned by Client.pipe, containing combined
-// stdout/stderr from a process as well as its error.
-type pipeError struct {
-	out []byte
-	err error
+// streamError wraps err in the Error type for further introspection, if it
+// is not already of type *Error.
+func streamError(ctx context.Context, err error) error {
+	var out []byte
+	var oerr *Error
+	if errors.As(err, &oerr) {
+		out, err = oerr.Out, oerr.Err
+	}
+
+	return &Error{
+		Out: out,
+		Err: contextError(ctx, err),
+	}
 }
 
-// Error returns the string representation of a pipeError.
-func (e *pipeError) Error() string {
-	return fmt.Sprintf("pipe error: %v: %q", e.err, string(e.out))
+// contextError returns the error from ctx if ctx was canceled or its deadline
+// expired, so that callers can distinguish these errors from failures reported
+// by Open vSwitch.  Otherwise, err is returned.
+func contextError(ctx context.Context, err error) error {
+	if cerr := ctx.Err(); cerr != nil {
+		return cerr
+	}
+
+	return err
 }
 
 // debugf prints a logging debug message when debugging is enabled.
@@ -209,8 +446,9 @@ func New(options ...OptionFunc) *Client {
 	c := &Client{
 		flags:      make([]string, 0),
 		ofctlFlags: make([]string, 0),
-		execFunc:   shellExec,
-		pipeFunc:   shellPipe,
+		execFunc:   shellExecContext,
+		pipeFunc:   shellPipeContext,
+		streamFunc: shellStreamContext,
 	}
 	for _, o := range options {
 		o(c)
@@ -232,6 +470,10 @@ func New(options ...OptionFunc) *Client {
 	}
 	c.OpenFlow = ofs
 
+	c.App = &AppService{
+		c: c,
+	}
+
 	return c
 }
 
@@ -255,16 +497,47 @@ func Debug(enable bool) OptionFunc {
 }
 
 // Exec returns an OptionFunc which sets an ExecFunc for use with a Client.
-// This function should typically only be used in tests.
+// This function should typically only be used in tests.  An ExecFunc cannot
+// be interrupted by a context.Context; use ExecContext instead if needed.
+//
+// Commands whose output is streamed also use fn, unless Stream is applied
+// after Exec.
 func Exec(fn ExecFunc) OptionFunc {
+	return ExecContext(execContextFunc(fn))
+}
+
+// ExecContext returns an OptionFunc which sets an ExecContextFunc for use
+// with a Client.
+//
+// Commands whose output is streamed also use fn, unless Stream is applied
+// after ExecContext.
+func ExecContext(fn ExecContextFunc) OptionFunc {
 	return func(c *Client) {
 		c.execFunc = fn
+		c.streamFunc = execStreamFunc(fn)
+	}
+}
+
+// Stream returns an OptionFunc which sets a StreamContextFunc for use with
+// a Client.  This function should typically only be used in tests.
+func Stream(fn StreamContextFunc) OptionFunc {
+	return func(c *Client) {
+		c.streamFunc = fn
 	}
 }
 
 // Pipe returns an OptionFunc which sets a PipeFunc for use with a Client.
-// This function should typically only be used in tests.
+// This function should typically only be used in tests.  A PipeFunc cannot
+// be interrupted by a context.Context; use PipeContext instead if needed.
 func Pipe(fn PipeFunc) OptionFunc {
+	return func(c *Client) {
+		c.pipeFunc = pipeContextFunc(fn)
+	}
+}
+
+// PipeContext returns an OptionFunc which sets a PipeContextFunc for use
+// with a Client.
+func PipeContext(fn PipeContextFunc) OptionFunc {
 	return func(c *Client) {
 		c.pipeFunc = fn
 	}
@@ -278,6 +551,15 @@ func Strict() OptionFunc {
 	}
 }
 
+// StrictValidation specifies that flows passed to OpenFlowService.AddFlow,
+// OpenFlowService.DelFlows, and OpenFlowService.AddFlowBundle must pass
+// Flow.Validate or MatchFlow.Validate before they are passed to 'ovs-ofctl'.
+func StrictValidation() OptionFunc {
+	return func(c *Client) {
+		c.validate = true
+	}
+}
+
 const (
 	// FlowFormatNXMTableID is a flow format which allows Nicira Extended match
 	// with the ability to place a flow in a specific table.
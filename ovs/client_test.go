@@ -16,8 +16,12 @@ package ovs
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -166,3 +170,165 @@ func testClient(options []OptionFunc, fn ExecFunc) *Client {
 	c := New(options...)
 	return c
 }
+
+func Test_shellExecContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// The process must be killed when the deadline expires.  This test will
+	// hang for the duration of the sleep if broken.
+	start := time.Now()
+	if _, err := shellExecContext(ctx, "sleep", "10"); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("process was not killed on deadline, ran for %v", d)
+	}
+}
+
+func Test_shellPipeContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := shellPipeContext(ctx, bytes.NewReader(nil), "sleep", "10"); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("process was not killed on deadline, ran for %v", d)
+	}
+}
+
+func Test_shellStreamContext(t *testing.T) {
+	rc, err := shellStreamContext(context.Background(), "printf", "foo\nbar\n")
+	if err != nil {
+		t.Fatalf("failed to stream printf: %v", err)
+	}
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("failed to read stream: %v", err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatalf("failed to close stream: %v", err)
+	}
+
+	if want, got := "foo\nbar\n", string(b); want != got {
+		t.Fatalf("unexpected output:\n- want: %q\n-  got: %q", want, got)
+	}
+}
+
+func Test_shellStreamContextEarlyClose(t *testing.T) {
+	rc, err := shellStreamContext(context.Background(), "yes")
+	if err != nil {
+		t.Fatalf("failed to stream yes: %v", err)
+	}
+
+	if _, err := rc.Read(make([]byte, 16)); err != nil {
+		t.Fatalf("failed to read stream: %v", err)
+	}
+
+	// The process must be killed when the stream is closed.  This test will
+	// hang if broken.
+	if err := rc.Close(); err != nil {
+		t.Fatalf("unexpected error closing stream early: %v", err)
+	}
+}
+
+func Test_shellStreamContextError(t *testing.T) {
+	rc, err := shellStreamContext(context.Background(), "sh", "-c", "echo foo; echo bar >&2; exit 1")
+	if err != nil {
+		t.Fatalf("failed to stream sh: %v", err)
+	}
+
+	if _, err := ioutil.ReadAll(rc); err != nil {
+		t.Fatalf("failed to read stream: %v", err)
+	}
+
+	var oerr *Error
+	if err := rc.Close(); !errors.As(err, &oerr) {
+		t.Fatalf("expected *Error, but got: %#v", err)
+	}
+
+	if want, got := "bar", string(oerr.Out); want != got {
+		t.Fatalf("unexpected error output:\n- want: %q\n-  got: %q", want, got)
+	}
+}
+
+func TestClientExecContextError(t *testing.T) {
+	var tests = []struct {
+		desc   string
+		fn     ExecContextFunc
+		cancel bool
+		is     error
+	}{
+		{
+			desc:   "deadline",
+			cancel: true,
+			fn: func(ctx context.Context, _ string, _ ...string) ([]byte, error) {
+				<-ctx.Done()
+				return []byte("killed"), errors.New("signal: killed")
+			},
+			is: context.Canceled,
+		},
+		{
+			desc: "OVS error",
+			fn: func(_ context.Context, _ string, _ ...string) ([]byte, error) {
+				return []byte("ovs-vsctl: no bridge named br0"), errors.New("exit status 1")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancel {
+				cancel()
+			} else {
+				defer cancel()
+			}
+
+			c := New(ExecContext(tt.fn))
+
+			_, err := c.VSwitch.ListPortsContext(ctx, "br0")
+			if err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			var oerr *Error
+			if !errors.As(err, &oerr) {
+				t.Fatalf("expected *Error, but got: %#v", err)
+			}
+
+			if tt.is == nil {
+				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+					t.Fatalf("OVS error must not be reported as a context error: %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, tt.is) {
+				t.Fatalf("expected error to wrap %v, but got: %v", tt.is, err)
+			}
+		})
+	}
+}
+
+func TestClientExecCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// An ExecFunc cannot be interrupted, so it must not be invoked at all
+	// when its context is already canceled.
+	c := testClient(nil, func(cmd string, args ...string) ([]byte, error) {
+		t.Fatal("ExecFunc should not be called")
+		return nil, nil
+	})
+
+	if err := c.VSwitch.AddBridgeContext(ctx, "br0"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error:\n- want: %v\n-  got: %v",
+			context.Canceled, err)
+	}
+}
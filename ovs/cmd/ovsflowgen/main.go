@@ -0,0 +1,169 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command ovsflowgen generates Go source code which constructs the flows
+// installed on an Open vSwitch bridge, or the flows listed in a file.
+//
+// Flows are read from the output of 'ovs-ofctl dump-flows' for a bridge:
+//
+//	ovsflowgen -bridge br0 -pkg lab -var LabFlows > flows.go
+//
+// or from a file containing one flow per line, in the format accepted by
+// 'ovs-ofctl add-flows' or produced by 'ovs-ofctl dump-flows':
+//
+//	ovsflowgen -file flows.txt -o flows.go
+//
+// Blank lines, lines beginning with '#', and dump-flows reply headers are
+// ignored.  Use '-file -' to read from stdin.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+)
+
+func main() {
+	var (
+		bridge = flag.String("bridge", "", "bridge whose flows are dumped using ovs-ofctl")
+		file   = flag.String("file", "", "file containing one flow per line, or '-' for stdin")
+		pkg    = flag.String("pkg", "main", "package name of the generated source")
+		name   = flag.String("var", "Flows", "variable name of the generated flows")
+		out    = flag.String("o", "", "output file (default stdout)")
+		sudo   = flag.Bool("sudo", false, "run ovs-ofctl using sudo")
+	)
+
+	flag.Parse()
+
+	if (*bridge == "") == (*file == "") {
+		log.Fatal("exactly one of -bridge or -file must be specified")
+	}
+
+	var (
+		flows  []*ovs.Flow
+		source string
+		err    error
+	)
+
+	switch {
+	case *bridge != "":
+		var options []ovs.OptionFunc
+		if *sudo {
+			options = append(options, ovs.Sudo())
+		}
+
+		source = fmt.Sprintf("bridge %s", *bridge)
+		flows, err = ovs.New(options...).OpenFlow.DumpFlows(*bridge)
+	case *file == "-":
+		source = "stdin"
+		flows, err = readFlows(os.Stdin)
+	default:
+		source = *file
+		flows, err = readFlowFile(*file)
+	}
+	if err != nil {
+		log.Fatalf("failed to read flows from %s: %v", source, err)
+	}
+
+	b, err := generate(*pkg, *name, source, flows)
+	if err != nil {
+		log.Fatalf("failed to generate code: %v", err)
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(b)
+	} else {
+		err = ioutil.WriteFile(*out, b, 0644)
+	}
+	if err != nil {
+		log.Fatalf("failed to write code: %v", err)
+	}
+}
+
+// readFlowFile reads flows from the file at path.
+func readFlowFile(path string) ([]*ovs.Flow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readFlows(f)
+}
+
+// readFlows reads one flow per line from r.
+func readFlows(r io.Reader) ([]*ovs.Flow, error) {
+	var flows []*ovs.Flow
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "NXST_FLOW"), strings.HasPrefix(line, "OFPST_FLOW"):
+			continue
+		}
+
+		f := new(ovs.Flow)
+		if err := f.UnmarshalText([]byte(line)); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+
+		flows = append(flows, f)
+	}
+
+	return flows, s.Err()
+}
+
+// generate produces formatted Go source code for package pkg, which declares
+// a variable name containing flows read from source.
+func generate(pkg, name, source string, flows []*ovs.Flow) ([]byte, error) {
+	if pkg == "" || name == "" {
+		return nil, errors.New("package and variable names must not be empty")
+	}
+
+	var body bytes.Buffer
+	for _, f := range flows {
+		// Elements of a []*ovs.Flow may omit the &ovs.Flow type.
+		s := strings.TrimPrefix(f.GoString(), "&ovs.Flow")
+		_, _ = fmt.Fprintf(&body, "\t%s,\n", strings.Replace(s, "\n", "\n\t", -1))
+	}
+
+	var buf bytes.Buffer
+	_, _ = fmt.Fprintf(&buf, "// Code generated by ovsflowgen from %s; DO NOT EDIT.\n\n", source)
+	_, _ = fmt.Fprintf(&buf, "package %s\n\n", pkg)
+
+	// Hardware and IP addresses are constructed using package net.
+	_, _ = buf.WriteString("import (\n")
+	if strings.Contains(body.String(), "net.IPv4(") || strings.Contains(body.String(), "net.HardwareAddr{") {
+		_, _ = buf.WriteString("\t\"net\"\n\n")
+	}
+	_, _ = buf.WriteString("\t\"github.com/digitalocean/go-openvswitch/ovs\"\n)\n\n")
+
+	_, _ = fmt.Fprintf(&buf, "// %s contains the flows read from %s.\n", name, source)
+	_, _ = fmt.Fprintf(&buf, "var %s = []*ovs.Flow{\n%s}\n", name, body.String())
+
+	return format.Source(buf.Bytes())
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadFlowsGenerate(t *testing.T) {
+	const in = `NXST_FLOW reply (xid=0x4):
+ cookie=0x1, duration=9215.748s, table=0, n_packets=6, n_bytes=480, idle_age=9206, priority=820,in_port=LOCAL actions=mod_vlan_vid:10,output:1
+
+# Comments and blank lines are ignored.
+table=1,priority=10,tcp,nw_src=192.0.2.0/24,tp_dst=22,actions=mod_dl_dst:de:ad:be:ef:de:ad,normal
+`
+
+	flows, err := readFlows(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("failed to read flows: %v", err)
+	}
+
+	b, err := generate("lab", "LabFlows", "flows.txt", flows)
+	if err != nil {
+		t.Fatalf("failed to generate code: %v", err)
+	}
+
+	want := `// Code generated by ovsflowgen from flows.txt; DO NOT EDIT.
+
+package lab
+
+import (
+	"net"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+)
+
+// LabFlows contains the flows read from flows.txt.
+var LabFlows = []*ovs.Flow{
+	{
+		Priority: 820,
+		InPort:   ovs.PortLOCAL,
+		Cookie:   0x1,
+		Actions: []ovs.Action{
+			ovs.ModVLANVID(10),
+			ovs.Output(1),
+		},
+	},
+	{
+		Priority: 10,
+		Protocol: ovs.ProtocolTCPv4,
+		Matches: []ovs.Match{
+			ovs.NetworkSource("192.0.2.0/24"),
+			ovs.TransportDestinationPort(22),
+		},
+		Table: 1,
+		Actions: []ovs.Action{
+			ovs.ModDataLinkDestination(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}),
+			ovs.Normal(),
+		},
+	},
+}
+`
+
+	if got := string(b); want != got {
+		t.Fatalf("unexpected code:\n- want: %v\n-  got: %v", want, got)
+	}
+}
+
+func TestReadFlowsInvalid(t *testing.T) {
+	_, err := readFlows(strings.NewReader("priority=10,ip,actions=drop\npriority=10,ip\n"))
+	if err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	if want, got := "line 2: ", err.Error(); !strings.HasPrefix(got, want) {
+		t.Fatalf("unexpected error:\n- want: %v\n-  got: %v", want, got)
+	}
+}
+
+func TestGenerateNoNet(t *testing.T) {
+	b, err := generate("main", "Flows", "stdin", nil)
+	if err != nil {
+		t.Fatalf("failed to generate code: %v", err)
+	}
+
+	if strings.Contains(string(b), `"net"`) {
+		t.Fatalf("unexpected import of package net:\n%s", string(b))
+	}
+}
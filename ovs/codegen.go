@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 )
 
 // hwAddrGoString converts a net.HardwareAddr into its Go syntax representation.
@@ -56,6 +57,92 @@ func ipv4GoString(ip net.IP) string {
 	return buf.String()
 }
 
+// protocolGoString converts a Protocol into its Go syntax representation.
+func protocolGoString(p Protocol) string {
+	switch p {
+	case ProtocolARP:
+		return "ovs.ProtocolARP"
+	case ProtocolICMPv4:
+		return "ovs.ProtocolICMPv4"
+	case ProtocolICMPv6:
+		return "ovs.ProtocolICMPv6"
+	case ProtocolIPv4:
+		return "ovs.ProtocolIPv4"
+	case ProtocolIPv6:
+		return "ovs.ProtocolIPv6"
+	case ProtocolMPLS:
+		return "ovs.ProtocolMPLS"
+	case ProtocolMPLSMulticast:
+		return "ovs.ProtocolMPLSMulticast"
+	case ProtocolRARP:
+		return "ovs.ProtocolRARP"
+	case ProtocolSCTPv4:
+		return "ovs.ProtocolSCTPv4"
+	case ProtocolSCTPv6:
+		return "ovs.ProtocolSCTPv6"
+	case ProtocolTCPv4:
+		return "ovs.ProtocolTCPv4"
+	case ProtocolTCPv6:
+		return "ovs.ProtocolTCPv6"
+	case ProtocolUDPv4:
+		return "ovs.ProtocolUDPv4"
+	case ProtocolUDPv6:
+		return "ovs.ProtocolUDPv6"
+	default:
+		return fmt.Sprintf("ovs.Protocol(%q)", string(p))
+	}
+}
+
+// sliceGoString produces the Go syntax representation of a slice of typ
+// containing elems, with one element per line.
+func sliceGoString(typ string, elems []string) string {
+	buf := bytes.NewBufferString("[]" + typ + "{\n")
+	for _, e := range elems {
+		_, _ = buf.WriteString("\t" + indentGoString(e) + ",\n")
+	}
+	_, _ = buf.WriteString("}")
+
+	return buf.String()
+}
+
+// structGoString produces the Go syntax representation of a composite
+// literal of typ with the specified field names and values, with one field
+// per line.  Like gofmt, values are aligned within each run of fields whose
+// values fit on a single line.
+func structGoString(typ string, fields [][2]string) string {
+	widths := make([]int, len(fields))
+	for i := 0; i < len(fields); {
+		if strings.Contains(fields[i][1], "\n") {
+			i++
+			continue
+		}
+
+		// Find the widest name in this run of single line values.
+		j, width := i, 0
+		for ; j < len(fields) && !strings.Contains(fields[j][1], "\n"); j++ {
+			if len(fields[j][0]) > width {
+				width = len(fields[j][0])
+			}
+		}
+		for ; i < j; i++ {
+			widths[i] = width
+		}
+	}
+
+	buf := bytes.NewBufferString(typ + "{\n")
+	for i, f := range fields {
+		_, _ = buf.WriteString(fmt.Sprintf("\t%-*s %s,\n", widths[i]+1, f[0]+":", indentGoString(f[1])))
+	}
+	_, _ = buf.WriteString("}")
+
+	return buf.String()
+}
+
+// indentGoString indents all but the first line of s by one tab.
+func indentGoString(s string) string {
+	return strings.Replace(s, "\n", "\n\t", -1)
+}
+
 // bprintf is fmt.Sprintf, but it returns a byte slice instead of a string.
 func bprintf(format string, a ...interface{}) []byte {
 	return []byte(fmt.Sprintf(format, a...))
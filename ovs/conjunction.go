@@ -0,0 +1,339 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+var (
+	// ErrConjunctionIDsExhausted is returned by a ConjunctionIDPool when no
+	// conjunction IDs remain.
+	ErrConjunctionIDsExhausted = errors.New("conjunction IDs exhausted")
+
+	// errEmptyDimension is returned when a ConjunctiveRule has a dimension
+	// with no alternatives, and therefore can never match.
+	errEmptyDimension = errors.New("conjunctive rule dimension has no alternatives")
+
+	// errConjunctionConflict is returned when two compiled flows have the
+	// same match, but their actions cannot be merged.
+	errConjunctionConflict = errors.New("conjunctive rules produce conflicting flows")
+)
+
+// A ConjunctionIDAllocator allocates conjunction IDs for use by
+// CompileConjunctions.
+type ConjunctionIDAllocator interface {
+	// ConjunctionID returns a conjunction ID which is not in use by any
+	// other conjunction in the same table and priority.
+	ConjunctionID() (uint32, error)
+}
+
+var _ ConjunctionIDAllocator = &ConjunctionIDPool{}
+
+// A ConjunctionIDPool is a ConjunctionIDAllocator which allocates
+// conjunction IDs sequentially.  It is safe for concurrent use.
+type ConjunctionIDPool struct {
+	mu        sync.Mutex
+	next      uint32
+	exhausted bool
+}
+
+// NewConjunctionIDPool creates a ConjunctionIDPool which allocates IDs
+// beginning with first.
+func NewConjunctionIDPool(first uint32) *ConjunctionIDPool {
+	return &ConjunctionIDPool{
+		next: first,
+	}
+}
+
+// ConjunctionID implements ConjunctionIDAllocator.
+func (p *ConjunctionIDPool) ConjunctionID() (uint32, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.exhausted {
+		return 0, ErrConjunctionIDsExhausted
+	}
+
+	id := p.next
+	if id == math.MaxUint32 {
+		p.exhausted = true
+	} else {
+		p.next++
+	}
+
+	return id, nil
+}
+
+// A ConjunctiveRule is a rule which matches packets that match all of its
+// Matches, and at least one alternative Match in every one of its
+// Dimensions.  It is compiled into flows using CompileConjunctions.
+type ConjunctiveRule struct {
+	// Fields which are applied to every compiled flow.
+	Priority    int
+	Protocol    Protocol
+	InPort      int
+	Table       int
+	IdleTimeout int
+	Cookie      uint64
+
+	// Matches are matched by every compiled flow.
+	Matches []Match
+
+	// Dimensions are sets of alternative Matches, such as a set of source
+	// addresses or a set of masked destination ports.
+	Dimensions [][]Match
+
+	// Actions are applied to packets which match the rule.
+	Actions []Action
+}
+
+// flow creates a Flow with the fields of r and the specified Matches and
+// Actions.
+func (r *ConjunctiveRule) flow(matches []Match, actions []Action) *Flow {
+	ms := make([]Match, 0, len(r.Matches)+len(matches))
+	ms = append(ms, r.Matches...)
+	ms = append(ms, matches...)
+
+	return &Flow{
+		Priority:    r.Priority,
+		Protocol:    r.Protocol,
+		InPort:      r.InPort,
+		Matches:     ms,
+		Table:       r.Table,
+		IdleTimeout: r.IdleTimeout,
+		Cookie:      r.Cookie,
+		Actions:     actions,
+	}
+}
+
+// compile compiles r into zero or more Flows, allocating a conjunction ID
+// from ids if needed.
+func (r *ConjunctiveRule) compile(ids ConjunctionIDAllocator) ([]*Flow, error) {
+	// Dimensions with a single alternative don't require a conjunction,
+	// and can be matched directly by every flow.
+	common := make([]Match, 0)
+	var dims [][]Match
+	for _, d := range r.Dimensions {
+		d, err := uniqueMatches(d)
+		if err != nil {
+			return nil, err
+		}
+
+		switch len(d) {
+		case 0:
+			return nil, errEmptyDimension
+		case 1:
+			common = append(common, d[0])
+		default:
+			dims = append(dims, d)
+		}
+	}
+
+	base := *r
+	base.Matches = append(append([]Match{}, r.Matches...), common...)
+
+	// A conjunction requires one flow per alternative plus the conj_id
+	// flow, while the cross product requires one flow per combination of
+	// alternatives.  Use whichever produces fewer flows.
+	cross, sum := 1, 1
+	for _, d := range dims {
+		sum += len(d)
+
+		// Saturate rather than overflow on very large rules.
+		if cross > math.MaxInt32/len(d) {
+			cross = math.MaxInt32
+		} else {
+			cross *= len(d)
+		}
+	}
+
+	if cross <= sum {
+		return base.crossProduct(dims), nil
+	}
+
+	id, err := ids.ConjunctionID()
+	if err != nil {
+		return nil, err
+	}
+
+	flows := make([]*Flow, 0, sum)
+	for i, d := range dims {
+		for _, m := range d {
+			flows = append(flows, base.flow(
+				[]Match{m},
+				[]Action{Conjunction(int(id), i+1, len(dims))},
+			))
+		}
+	}
+
+	// The conj_id flow only requires the matches that are common to all
+	// dimensions, which are already matched by the dimension flows.
+	conj := r.flow(nil, r.Actions)
+	conj.InPort = 0
+	conj.Matches = []Match{ConjunctionID(id)}
+
+	return append(flows, conj), nil
+}
+
+// crossProduct returns one Flow for each combination of alternatives in
+// dims.
+func (r *ConjunctiveRule) crossProduct(dims [][]Match) []*Flow {
+	combos := [][]Match{{}}
+	for _, d := range dims {
+		next := make([][]Match, 0, len(combos)*len(d))
+		for _, c := range combos {
+			for _, m := range d {
+				combo := make([]Match, 0, len(c)+1)
+				combo = append(combo, c...)
+				combo = append(combo, m)
+				next = append(next, combo)
+			}
+		}
+		combos = next
+	}
+
+	flows := make([]*Flow, 0, len(combos))
+	for _, c := range combos {
+		flows = append(flows, r.flow(c, r.Actions))
+	}
+
+	return flows
+}
+
+// CompileConjunctions compiles one or more ConjunctiveRules into Flows,
+// using conjunctive matches where they produce fewer flows than the cross
+// product of a rule's Dimensions.  Conjunction IDs are allocated from ids.
+//
+// Open vSwitch allows only one flow with a given match and priority in a
+// table, so dimension flows which are shared by multiple rules are merged
+// into a single flow with multiple conjunction actions.  The returned Flows
+// should be added atomically using OpenFlowService.AddFlowBundle, so that
+// packets never observe a partially installed conjunction.
+func CompileConjunctions(ids ConjunctionIDAllocator, rules ...*ConjunctiveRule) ([]*Flow, error) {
+	var flows []*Flow
+	byMatch := make(map[string]*Flow)
+
+	for _, r := range rules {
+		fs, err := r.compile(ids)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range fs {
+			key, err := flowMatchKey(f)
+			if err != nil {
+				return nil, err
+			}
+
+			prev, ok := byMatch[key]
+			if !ok {
+				byMatch[key] = f
+				flows = append(flows, f)
+				continue
+			}
+
+			if err := mergeConjunctionFlow(prev, f); err != nil {
+				return nil, fmt.Errorf("%v: %s", err, key)
+			}
+		}
+	}
+
+	return flows, nil
+}
+
+// flowMatchKey returns a string which uniquely identifies the match and
+// priority of f within its table.
+func flowMatchKey(f *Flow) (string, error) {
+	mf := f.Canonical().MatchFlowStrict()
+	mf.Cookie = 0
+
+	b, err := mf.MarshalText()
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// mergeConjunctionFlow merges the actions of f into prev, if both flows
+// consist only of conjunction actions.  Flows with identical actions are
+// also permitted.
+func mergeConjunctionFlow(prev, f *Flow) error {
+	if actionsEqual(prev.Actions, f.Actions) {
+		return nil
+	}
+
+	ids := make(map[int]bool)
+	for _, as := range [][]Action{prev.Actions, f.Actions} {
+		for _, a := range as {
+			ca, ok := a.(*conjunctionAction)
+			if !ok {
+				return errConjunctionConflict
+			}
+
+			// A flow may not contribute to the same conjunction twice,
+			// which occurs when one alternative is shared by two
+			// dimensions of the same rule.
+			if ids[ca.id] {
+				return errConjunctionConflict
+			}
+			ids[ca.id] = true
+		}
+	}
+
+	prev.Actions = append(prev.Actions, f.Actions...)
+	return nil
+}
+
+// uniqueMatches returns ms with duplicate Matches removed.
+func uniqueMatches(ms []Match) ([]Match, error) {
+	seen := make(map[string]bool, len(ms))
+	out := make([]Match, 0, len(ms))
+	for _, m := range ms {
+		b, err := m.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[string(b)] {
+			continue
+		}
+		seen[string(b)] = true
+		out = append(out, m)
+	}
+
+	return out, nil
+}
+
+// actionsEqual reports whether a and b marshal to identical text.
+func actionsEqual(a, b []Action) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		ab, aerr := a[i].MarshalText()
+		bb, berr := b[i].MarshalText()
+		if aerr != nil || berr != nil || string(ab) != string(bb) {
+			return false
+		}
+	}
+
+	return true
+}
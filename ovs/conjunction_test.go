@@ -0,0 +1,262 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConjunctionIDPool(t *testing.T) {
+	p := NewConjunctionIDPool(10)
+	for _, want := range []uint32{10, 11, 12} {
+		got, err := p.ConjunctionID()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want != got {
+			t.Fatalf("unexpected ID:\n- want: %v\n-  got: %v", want, got)
+		}
+	}
+
+	p = NewConjunctionIDPool(math.MaxUint32)
+	if _, err := p.ConjunctionID(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := p.ConjunctionID(); err != ErrConjunctionIDsExhausted {
+		t.Fatalf("expected ErrConjunctionIDsExhausted, but got: %v", err)
+	}
+}
+
+func TestCompileConjunctions(t *testing.T) {
+	sources := []Match{
+		NetworkSource("10.0.0.1"),
+		NetworkSource("10.0.0.2"),
+		NetworkSource("10.0.0.3"),
+	}
+	ports := []Match{
+		TransportDestinationPort(22),
+		TransportDestinationPort(80),
+		TransportDestinationPort(443),
+	}
+
+	vlans := []Match{
+		DataLinkVLAN(1),
+		DataLinkVLAN(2),
+		DataLinkVLAN(3),
+	}
+
+	var tests = []struct {
+		desc  string
+		rules []*ConjunctiveRule
+		flows []string
+		err   string
+	}{
+		{
+			desc: "empty dimension",
+			rules: []*ConjunctiveRule{{
+				Dimensions: [][]Match{sources, {}},
+				Actions:    []Action{Drop()},
+			}},
+			err: errEmptyDimension.Error(),
+		},
+		{
+			desc: "conjunction",
+			rules: []*ConjunctiveRule{{
+				Priority:   100,
+				Protocol:   ProtocolTCPv4,
+				InPort:     1,
+				Table:      10,
+				Dimensions: [][]Match{sources, ports},
+				Actions:    []Action{Resubmit(0, 20)},
+			}},
+			flows: []string{
+				"priority=100,tcp,in_port=1,nw_src=10.0.0.1,table=10,idle_timeout=0,actions=conjunction(1,1/2)",
+				"priority=100,tcp,in_port=1,nw_src=10.0.0.2,table=10,idle_timeout=0,actions=conjunction(1,1/2)",
+				"priority=100,tcp,in_port=1,nw_src=10.0.0.3,table=10,idle_timeout=0,actions=conjunction(1,1/2)",
+				"priority=100,tcp,in_port=1,tp_dst=22,table=10,idle_timeout=0,actions=conjunction(1,2/2)",
+				"priority=100,tcp,in_port=1,tp_dst=80,table=10,idle_timeout=0,actions=conjunction(1,2/2)",
+				"priority=100,tcp,in_port=1,tp_dst=443,table=10,idle_timeout=0,actions=conjunction(1,2/2)",
+				"priority=100,tcp,conj_id=1,table=10,idle_timeout=0,actions=resubmit(,20)",
+			},
+		},
+		{
+			desc: "cross product is smaller",
+			rules: []*ConjunctiveRule{{
+				Priority:   100,
+				Protocol:   ProtocolTCPv4,
+				Dimensions: [][]Match{sources[:2], ports[:2]},
+				Actions:    []Action{Drop()},
+			}},
+			flows: []string{
+				"priority=100,tcp,nw_src=10.0.0.1,tp_dst=22,table=0,idle_timeout=0,actions=drop",
+				"priority=100,tcp,nw_src=10.0.0.1,tp_dst=80,table=0,idle_timeout=0,actions=drop",
+				"priority=100,tcp,nw_src=10.0.0.2,tp_dst=22,table=0,idle_timeout=0,actions=drop",
+				"priority=100,tcp,nw_src=10.0.0.2,tp_dst=80,table=0,idle_timeout=0,actions=drop",
+			},
+		},
+		{
+			desc: "single alternatives and duplicates are folded",
+			rules: []*ConjunctiveRule{{
+				Priority: 100,
+				Protocol: ProtocolTCPv4,
+				Matches:  []Match{DataLinkVLAN(10)},
+				Dimensions: [][]Match{
+					{sources[0], sources[0]},
+					ports[:1],
+				},
+				Actions: []Action{Drop()},
+			}},
+			flows: []string{
+				"priority=100,tcp,dl_vlan=10,nw_src=10.0.0.1,tp_dst=22,table=0,idle_timeout=0,actions=drop",
+			},
+		},
+		{
+			desc: "shared dimension flows are merged",
+			rules: []*ConjunctiveRule{
+				{
+					Priority:   100,
+					Protocol:   ProtocolTCPv4,
+					Dimensions: [][]Match{sources, ports},
+					Actions:    []Action{Normal()},
+				},
+				{
+					Priority:   100,
+					Protocol:   ProtocolTCPv4,
+					Dimensions: [][]Match{sources, vlans},
+					Actions:    []Action{Drop()},
+				},
+			},
+			flows: []string{
+				"priority=100,tcp,nw_src=10.0.0.1,table=0,idle_timeout=0,actions=conjunction(1,1/2),conjunction(2,1/2)",
+				"priority=100,tcp,nw_src=10.0.0.2,table=0,idle_timeout=0,actions=conjunction(1,1/2),conjunction(2,1/2)",
+				"priority=100,tcp,nw_src=10.0.0.3,table=0,idle_timeout=0,actions=conjunction(1,1/2),conjunction(2,1/2)",
+				"priority=100,tcp,tp_dst=22,table=0,idle_timeout=0,actions=conjunction(1,2/2)",
+				"priority=100,tcp,tp_dst=80,table=0,idle_timeout=0,actions=conjunction(1,2/2)",
+				"priority=100,tcp,tp_dst=443,table=0,idle_timeout=0,actions=conjunction(1,2/2)",
+				"priority=100,tcp,conj_id=1,table=0,idle_timeout=0,actions=normal",
+				"priority=100,tcp,dl_vlan=1,table=0,idle_timeout=0,actions=conjunction(2,2/2)",
+				"priority=100,tcp,dl_vlan=2,table=0,idle_timeout=0,actions=conjunction(2,2/2)",
+				"priority=100,tcp,dl_vlan=3,table=0,idle_timeout=0,actions=conjunction(2,2/2)",
+				"priority=100,tcp,conj_id=2,table=0,idle_timeout=0,actions=drop",
+			},
+		},
+		{
+			desc: "alternative shared between dimensions",
+			rules: []*ConjunctiveRule{{
+				Dimensions: [][]Match{
+					{NetworkSource("10.0.0.1"), NetworkSource("10.0.0.2"), NetworkSource("10.0.0.3")},
+					{NetworkSource("10.0.0.1"), NetworkDestination("10.0.0.2"), NetworkDestination("10.0.0.3")},
+				},
+				Actions: []Action{Drop()},
+			}},
+			err: errConjunctionConflict.Error(),
+		},
+		{
+			desc: "conflicting actions",
+			rules: []*ConjunctiveRule{
+				{
+					Dimensions: [][]Match{sources[:1]},
+					Actions:    []Action{Drop()},
+				},
+				{
+					Dimensions: [][]Match{sources[:1]},
+					Actions:    []Action{Normal()},
+				},
+			},
+			err: errConjunctionConflict.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			flows, err := CompileConjunctions(NewConjunctionIDPool(1), tt.rules...)
+			if err != nil {
+				if tt.err == "" || !strings.HasPrefix(err.Error(), tt.err) {
+					t.Fatalf("unexpected error:\n- want: %v\n-  got: %v",
+						tt.err, err)
+				}
+				return
+			}
+			if tt.err != "" {
+				t.Fatalf("expected error %q, but none occurred", tt.err)
+			}
+
+			var got []string
+			for _, f := range flows {
+				b, err := f.MarshalText()
+				if err != nil {
+					t.Fatalf("failed to marshal flow: %v", err)
+				}
+				got = append(got, string(b))
+			}
+
+			if want := tt.flows; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected flows:\n- want: %v\n-  got: %v",
+					strings.Join(want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestCompileConjunctionsRangeDimensions(t *testing.T) {
+	regs, err := RegRange(0, 0x10, 0x2f)
+	if err != nil {
+		t.Fatalf("failed to decompose register range: %v", err)
+	}
+
+	// A dimension which contains every value cannot be expressed as
+	// matches, and is omitted from the rule instead.
+	if _, err := ConnectionTrackingMarkRange(0, math.MaxUint32); err != ErrFullRange {
+		t.Fatalf("unexpected error:\n- want: %v\n-  got: %v",
+			ErrFullRange, err)
+	}
+
+	marks, err := ConnectionTrackingMarkRange(1, 3)
+	if err != nil {
+		t.Fatalf("failed to decompose mark range: %v", err)
+	}
+
+	flows, err := CompileConjunctions(NewConjunctionIDPool(1), &ConjunctiveRule{
+		Priority:   100,
+		Dimensions: [][]Match{regs, marks},
+		Actions:    []Action{Drop()},
+	})
+	if err != nil {
+		t.Fatalf("failed to compile conjunctions: %v", err)
+	}
+
+	var got []string
+	for _, f := range flows {
+		b, err := f.MarshalText()
+		if err != nil {
+			t.Fatalf("failed to marshal flow: %v", err)
+		}
+		got = append(got, string(b))
+	}
+
+	want := []string{
+		"priority=100,reg0=0x10/0xfffffff0,ct_mark=0x00000001/0xffffffff,table=0,idle_timeout=0,actions=drop",
+		"priority=100,reg0=0x10/0xfffffff0,ct_mark=0x00000002/0xfffffffe,table=0,idle_timeout=0,actions=drop",
+		"priority=100,reg0=0x20/0xfffffff0,ct_mark=0x00000001/0xffffffff,table=0,idle_timeout=0,actions=drop",
+		"priority=100,reg0=0x20/0xfffffff0,ct_mark=0x00000002/0xfffffffe,table=0,idle_timeout=0,actions=drop",
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected flows:\n- want: %v\n-  got: %v",
+			strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,374 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errNoFlags is returned when a flag Match neither sets nor unsets any
+// flags.
+var errNoFlags = errors.New("at least one flag must be set or unset")
+
+// A CTStateFlag is a bitset of connection tracking states, which can be
+// combined using bitwise OR and used with CTState.
+type CTStateFlag uint8
+
+// List of CTStateFlag constants available in OVS.  Reference the ovs-fields
+// man-page for a description of each one.
+const (
+	CTStateNew CTStateFlag = 1 << iota
+	CTStateEstablished
+	CTStateRelated
+	CTStateReply
+	CTStateInvalid
+	CTStateTracked
+	CTStateSNAT
+	CTStateDNAT
+)
+
+// String returns the OVS names of the flags in f, such as "new|trk".
+func (f CTStateFlag) String() string {
+	return ctStateFlags.join(uint16(f))
+}
+
+// A CTState is a connection tracking state match, which requires the flags
+// in Set to be set and the flags in Unset to be unset, and ignores all others.
+// A CTState can be used with ConnectionTrackingStateBits.
+//
+// CTState was previously a string type holding a single "+flag" or "-flag"
+// value; the CTStateFlag constants replace those strings.
+type CTState struct {
+	Set, Unset CTStateFlag
+}
+
+// String returns the OVS form of s, such as "+new+trk-inv".
+func (s CTState) String() string {
+	return ctStateFlags.format(uint16(s.Set), uint16(s.Unset))
+}
+
+// GoString returns the Go syntax of s.
+func (s CTState) GoString() string {
+	return ctStateFlags.goString("CTState", uint16(s.Set), uint16(s.Unset))
+}
+
+// ParseCTState parses a CTState in either the symbolic form, such as
+// "+new+trk-inv", or the hexadecimal value and mask form, such as
+// "0x21/0x31", used by ovs-ofctl for some OpenFlow versions.
+func ParseCTState(s string) (CTState, error) {
+	set, unset, err := ctStateFlags.parse(s)
+	if err != nil {
+		return CTState{}, err
+	}
+
+	return CTState{
+		Set:   CTStateFlag(set),
+		Unset: CTStateFlag(unset),
+	}, nil
+}
+
+// A TCPFlag is a bitset of flags in the TCP header, which can be combined
+// using bitwise OR and used with TCPFlagState.
+//
+// TCPFlag was previously a string type holding a flag name such as "syn";
+// the TCPFlag constants are now bits rather than names.
+type TCPFlag uint16
+
+// RFC 793 TCP Flags, and the RFC 3168 and RFC 3540 ECN flags.
+const (
+	TCPFlagFIN TCPFlag = 1 << iota
+	TCPFlagSYN
+	TCPFlagRST
+	TCPFlagPSH
+	TCPFlagACK
+	TCPFlagURG
+	TCPFlagECE
+	TCPFlagCWR
+	TCPFlagNS
+)
+
+// String returns the OVS names of the flags in f, such as "syn|ack".
+func (f TCPFlag) String() string {
+	return tcpFlagFlags.join(uint16(f))
+}
+
+// A TCPFlagState is a TCP flags match, which requires the flags in Set to be
+// set and the flags in Unset to be unset, and ignores all others.  A
+// TCPFlagState can be used with TCPFlagBits.
+type TCPFlagState struct {
+	Set, Unset TCPFlag
+}
+
+// String returns the OVS form of s, such as "+syn-ack".
+func (s TCPFlagState) String() string {
+	return tcpFlagFlags.format(uint16(s.Set), uint16(s.Unset))
+}
+
+// GoString returns the Go syntax of s.
+func (s TCPFlagState) GoString() string {
+	return tcpFlagFlags.goString("TCPFlagState", uint16(s.Set), uint16(s.Unset))
+}
+
+// ParseTCPFlagState parses a TCPFlagState in either the symbolic form, such
+// as "+syn-ack", or the hexadecimal value and mask form, such as
+// "0x002/0x012", used by ovs-ofctl for some OpenFlow versions.
+func ParseTCPFlagState(s string) (TCPFlagState, error) {
+	set, unset, err := tcpFlagFlags.parse(s)
+	if err != nil {
+		return TCPFlagState{}, err
+	}
+
+	return TCPFlagState{
+		Set:   TCPFlag(set),
+		Unset: TCPFlag(unset),
+	}, nil
+}
+
+// ConnectionTrackingStateBits matches packets using their connection state,
+// when connection tracking is enabled on the host.
+func ConnectionTrackingStateBits(state CTState) Match {
+	return &flagsMatch{
+		field: ctState,
+		set:   uint16(state.Set),
+		unset: uint16(state.Unset),
+	}
+}
+
+// TCPFlagBits matches packets using their TCP flags, when matching TCP
+// flags on a TCP segment.
+func TCPFlagBits(flags TCPFlagState) Match {
+	return &flagsMatch{
+		field: tcpFlags,
+		set:   uint16(flags.Set),
+		unset: uint16(flags.Unset),
+	}
+}
+
+var _ Match = &flagsMatch{}
+
+// A flagsMatch is a Match returned by ConnectionTrackingStateBits and
+// TCPFlagBits.
+type flagsMatch struct {
+	field      string
+	set, unset uint16
+}
+
+// MarshalText implements Match.
+func (m *flagsMatch) MarshalText() ([]byte, error) {
+	ff := flagBitFields[m.field]
+	if err := ff.validate(m.set, m.unset); err != nil {
+		return nil, err
+	}
+
+	return bprintf("%s=%s", m.field, ff.format(m.set, m.unset)), nil
+}
+
+// GoString implements Match.
+func (m *flagsMatch) GoString() string {
+	if m.field == ctState {
+		return fmt.Sprintf("ovs.ConnectionTrackingStateBits(%s)",
+			ctStateFlags.goString("CTState", m.set, m.unset))
+	}
+
+	return fmt.Sprintf("ovs.TCPFlagBits(%s)",
+		tcpFlagFlags.goString("TCPFlagState", m.set, m.unset))
+}
+
+// A flagBitField describes the bits of a flag field, such as ct_state.
+type flagBitField struct {
+	field string
+	// The OVS and Go constant names of each bit, indexed by bit number.
+	names  []string
+	consts []string
+}
+
+// Flag fields with typed Matches.
+var (
+	ctStateFlags = &flagBitField{
+		field: ctState,
+		names: []string{"new", "est", "rel", "rpl", "inv", "trk", "snat", "dnat"},
+		consts: []string{
+			"CTStateNew", "CTStateEstablished", "CTStateRelated", "CTStateReply",
+			"CTStateInvalid", "CTStateTracked", "CTStateSNAT", "CTStateDNAT",
+		},
+	}
+
+	tcpFlagFlags = &flagBitField{
+		field: tcpFlags,
+		names: []string{"fin", "syn", "rst", "psh", "ack", "urg", "ece", "cwr", "ns"},
+		consts: []string{
+			"TCPFlagFIN", "TCPFlagSYN", "TCPFlagRST", "TCPFlagPSH", "TCPFlagACK",
+			"TCPFlagURG", "TCPFlagECE", "TCPFlagCWR", "TCPFlagNS",
+		},
+	}
+
+	flagBitFields = map[string]*flagBitField{
+		ctState:  ctStateFlags,
+		tcpFlags: tcpFlagFlags,
+	}
+)
+
+// all returns the bits which have names in ff.
+func (ff *flagBitField) all() uint16 {
+	return 1<<uint(len(ff.names)) - 1
+}
+
+// validate verifies that set and unset are a valid match of ff.
+func (ff *flagBitField) validate(set, unset uint16) error {
+	switch {
+	case set == 0 && unset == 0:
+		return errNoFlags
+	case (set|unset)&^ff.all() != 0:
+		return fmt.Errorf("unknown %s flags: %#x", ff.field, (set|unset)&^ff.all())
+	case set&unset != 0:
+		return fmt.Errorf("%s flags both set and unset: %#x", ff.field, set&unset)
+	}
+
+	return nil
+}
+
+// format returns the symbolic form of set and unset, such as "+new+trk-inv".
+// Flags are in bit order, set flags first.  Bits with no name are formatted
+// in hexadecimal.
+func (ff *flagBitField) format(set, unset uint16) string {
+	var b strings.Builder
+	for _, f := range []struct {
+		sign byte
+		bits uint16
+	}{{'+', set}, {'-', unset}} {
+		for i := uint(0); i < 16; i++ {
+			if f.bits&(1<<i) == 0 {
+				continue
+			}
+
+			b.WriteByte(f.sign)
+			if int(i) < len(ff.names) {
+				b.WriteString(ff.names[i])
+			} else {
+				fmt.Fprintf(&b, "%#x", 1<<i)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// join returns the names of bits joined by "|", such as "new|trk".
+func (ff *flagBitField) join(bits uint16) string {
+	s := strings.Replace(ff.format(bits, 0), "+", "|", -1)
+	if s == "" {
+		return "0"
+	}
+
+	return s[1:]
+}
+
+// goString returns the Go syntax of a struct of type typ with the fields Set
+// and Unset.
+func (ff *flagBitField) goString(typ string, set, unset uint16) string {
+	consts := func(bits uint16) string {
+		var cs []string
+		for i := uint(0); i < 16; i++ {
+			if bits&(1<<i) == 0 {
+				continue
+			}
+
+			if int(i) < len(ff.consts) {
+				cs = append(cs, "ovs."+ff.consts[i])
+			} else {
+				cs = append(cs, fmt.Sprintf("%#x", 1<<i))
+			}
+		}
+
+		return strings.Join(cs, "|")
+	}
+
+	var fields []string
+	if set != 0 {
+		fields = append(fields, "Set: "+consts(set))
+	}
+	if unset != 0 {
+		fields = append(fields, "Unset: "+consts(unset))
+	}
+
+	return fmt.Sprintf("ovs.%s{%s}", typ, strings.Join(fields, ", "))
+}
+
+// parse parses flags of ff in either the symbolic form, such as
+// "+trk-new", or the hexadecimal value and mask form, such as "0x21/0x3f".
+// A hexadecimal value without a mask matches all named flags.
+func (ff *flagBitField) parse(s string) (set, unset uint16, err error) {
+	if s == "" {
+		return 0, 0, fmt.Errorf("invalid %s match: %q", ff.field, s)
+	}
+
+	if s[0] != '+' && s[0] != '-' {
+		v, mask, err := parseMaskedUint64(s)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid %s match: %q", ff.field, s)
+		}
+		if !strings.Contains(s, "/") {
+			mask = uint64(ff.all())
+		}
+		if v&^mask != 0 || mask&^uint64(ff.all()) != 0 {
+			return 0, 0, fmt.Errorf("invalid %s match: %q", ff.field, s)
+		}
+
+		return uint16(v & mask), uint16(mask &^ v), nil
+	}
+
+	for len(s) > 0 {
+		sign := s[0]
+		if sign != '+' && sign != '-' {
+			return 0, 0, fmt.Errorf("invalid %s flags: %q", ff.field, s)
+		}
+
+		end := strings.IndexAny(s[1:], "+-")
+		if end == -1 {
+			end = len(s) - 1
+		}
+
+		bit, ok := ff.bit(s[1 : end+1])
+		if !ok {
+			return 0, 0, fmt.Errorf("unknown %s flag: %q", ff.field, s[1:end+1])
+		}
+		if (set|unset)&bit != 0 {
+			return 0, 0, fmt.Errorf("duplicate %s flag: %q", ff.field, s[1:end+1])
+		}
+
+		if sign == '+' {
+			set |= bit
+		} else {
+			unset |= bit
+		}
+
+		s = s[end+1:]
+	}
+
+	return set, unset, nil
+}
+
+// bit returns the bit of the flag with the specified name.
+func (ff *flagBitField) bit(name string) (uint16, bool) {
+	for i, n := range ff.names {
+		if n == name {
+			return 1 << uint(i), true
+		}
+	}
+
+	return 0, false
+}
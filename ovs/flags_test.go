@@ -0,0 +1,121 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"testing"
+)
+
+func TestCTState(t *testing.T) {
+	var tests = []struct {
+		desc string
+		s    string
+		hex  string
+		st   CTState
+		gs   string
+	}{
+		{
+			desc: "set",
+			s:    "+new+trk",
+			hex:  "0x21/0x21",
+			st:   CTState{Set: CTStateNew | CTStateTracked},
+			gs:   "ovs.CTState{Set: ovs.CTStateNew|ovs.CTStateTracked}",
+		},
+		{
+			desc: "set and unset",
+			s:    "+new+trk-inv",
+			hex:  "0x21/0x31",
+			st:   CTState{Set: CTStateNew | CTStateTracked, Unset: CTStateInvalid},
+			gs:   "ovs.CTState{Set: ovs.CTStateNew|ovs.CTStateTracked, Unset: ovs.CTStateInvalid}",
+		},
+		{
+			desc: "unset",
+			s:    "-snat-dnat",
+			hex:  "0x0/0xc0",
+			st:   CTState{Unset: CTStateSNAT | CTStateDNAT},
+			gs:   "ovs.CTState{Unset: ovs.CTStateSNAT|ovs.CTStateDNAT}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if want, got := tt.s, tt.st.String(); want != got {
+				t.Fatalf("unexpected string:\n- want: %q\n-  got: %q", want, got)
+			}
+			if want, got := tt.gs, tt.st.GoString(); want != got {
+				t.Fatalf("unexpected Go syntax:\n- want: %q\n-  got: %q", want, got)
+			}
+
+			for _, s := range []string{tt.s, tt.hex} {
+				st, err := ParseCTState(s)
+				if err != nil {
+					t.Fatalf("failed to parse %q: %v", s, err)
+				}
+				if want, got := tt.st, st; want != got {
+					t.Fatalf("unexpected state for %q:\n- want: %#v\n-  got: %#v", s, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestTCPFlagState(t *testing.T) {
+	st, err := ParseTCPFlagState("0x012/0x016")
+	if err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	want := TCPFlagState{Set: TCPFlagSYN | TCPFlagACK, Unset: TCPFlagRST}
+	if st != want {
+		t.Fatalf("unexpected flags:\n- want: %#v\n-  got: %#v", want, st)
+	}
+	if want, got := "+syn+ack-rst", st.String(); want != got {
+		t.Fatalf("unexpected string:\n- want: %q\n-  got: %q", want, got)
+	}
+	if want, got := "syn|ack", st.Set.String(); want != got {
+		t.Fatalf("unexpected flag string:\n- want: %q\n-  got: %q", want, got)
+	}
+}
+
+func TestFlagsMatchInvalid(t *testing.T) {
+	var tests = []struct {
+		desc string
+		m    Match
+	}{
+		{
+			desc: "no flags",
+			m:    ConnectionTrackingStateBits(CTState{}),
+		},
+		{
+			desc: "set and unset",
+			m: ConnectionTrackingStateBits(CTState{
+				Set:   CTStateNew,
+				Unset: CTStateNew | CTStateTracked,
+			}),
+		},
+		{
+			desc: "unknown TCP flag",
+			m:    TCPFlagBits(TCPFlagState{Set: 0x200}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if _, err := tt.m.MarshalText(); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
@@ -30,11 +30,10 @@ const (
 // Possible errors which may be encountered while marshaling or unmarshaling
 // a Flow.
 var (
-	errActionsWithDrop   = errors.New("Flow actions include drop, but multiple actions specified")
-	errInvalidActions    = errors.New("invalid actions for Flow")
-	errNoActions         = errors.New("no actions defined for Flow")
-	errNotEnoughElements = errors.New("not enough elements for valid Flow")
-	errPriorityNotFirst  = errors.New("priority field is not first in Flow")
+	errActionsWithDrop  = errors.New("Flow actions include drop, but multiple actions specified")
+	errInvalidActions   = errors.New("invalid actions for Flow")
+	errNoActions        = errors.New("no actions defined for Flow")
+	errPriorityNotFirst = errors.New("priority field is not first in Flow")
 )
 
 // A Protocol is an OpenFlow protocol designation accepted by Open vSwitch.
@@ -42,15 +41,20 @@ type Protocol string
 
 // Protocol constants which can be used in OVS flow configurations.
 const (
-	ProtocolARP    Protocol = "arp"
-	ProtocolICMPv4 Protocol = "icmp"
-	ProtocolICMPv6 Protocol = "icmp6"
-	ProtocolIPv4   Protocol = "ip"
-	ProtocolIPv6   Protocol = "ipv6"
-	ProtocolTCPv4  Protocol = "tcp"
-	ProtocolTCPv6  Protocol = "tcp6"
-	ProtocolUDPv4  Protocol = "udp"
-	ProtocolUDPv6  Protocol = "udp6"
+	ProtocolARP           Protocol = "arp"
+	ProtocolICMPv4        Protocol = "icmp"
+	ProtocolICMPv6        Protocol = "icmp6"
+	ProtocolIPv4          Protocol = "ip"
+	ProtocolIPv6          Protocol = "ipv6"
+	ProtocolMPLS          Protocol = "mpls"
+	ProtocolMPLSMulticast Protocol = "mplsm"
+	ProtocolRARP          Protocol = "rarp"
+	ProtocolSCTPv4        Protocol = "sctp"
+	ProtocolSCTPv6        Protocol = "sctp6"
+	ProtocolTCPv4         Protocol = "tcp"
+	ProtocolTCPv6         Protocol = "tcp6"
+	ProtocolUDPv4         Protocol = "udp"
+	ProtocolUDPv6         Protocol = "udp6"
 )
 
 // A Flow is an OpenFlow flow meant for adding flows to a software bridge.  It can be marshaled
@@ -184,33 +188,54 @@ func (f *Flow) MarshalText() ([]byte, error) {
 }
 
 // UnmarshalText unmarshals flow text into a Flow.
+//
+// If the flow text does not specify a priority, Priority is set to
+// DefaultPriority, which is the priority Open vSwitch assigns to such a flow
+// and omits from the output of 'ovs-ofctl dump-flows'.  Previously, Priority
+// was left at 0 in this case.
+//
+// To reduce allocations when many flows are parsed, UnmarshalText reuses the
+// backing arrays of the Matches and Actions slices of f, if any.  A Flow
+// which is reused must not share those slices with any other Flow.
 func (f *Flow) UnmarshalText(b []byte) error {
 	// Make a copy per documentation for encoding.TextUnmarshaler.
-	// A string is easier to work with in this case.
+	// A string is easier to work with in this case, and the values of
+	// matches and actions refer to it rather than being copied again.
 	s := string(b)
 
 	// Must have one and only one actions=... field in the flow.
-	ss := strings.Split(s, keyActions+"=")
-	if len(ss) != 2 || ss[1] == "" {
+	i := strings.Index(s, keyActions+"=")
+	if i == -1 || i+len(keyActions)+1 == len(s) || strings.Count(s, keyActions+"=") != 1 {
 		return &FlowError{
 			Err: errNoActions,
 		}
 	}
-	if len(ss) < 2 {
-		return &FlowError{
-			Err: errNotEnoughElements,
-		}
+	matchers, actions := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+len(keyActions)+1:])
+
+	// Open vSwitch omits the priority of flows with the default priority.
+	*f = Flow{
+		Priority: DefaultPriority,
+		Matches:  f.Matches[:0],
+		Actions:  f.Actions[:0],
+	}
+	if f.Matches == nil {
+		f.Matches = make([]Match, 0)
 	}
-	matchers, actions := strings.TrimSpace(ss[0]), strings.TrimSpace(ss[1])
 
-	// Handle matchers first.
-	ss = strings.Split(matchers, ",")
-	f.Matches = make([]Match, 0)
-	for i := 0; i < len(ss); i++ {
-		if !strings.Contains(ss[i], "=") {
+	// Handle matchers first, scanning each comma-separated field in turn.
+	for len(matchers) > 0 {
+		field := matchers
+		if j := indexMatchSeparator(matchers); j != -1 {
+			field, matchers = matchers[:j], matchers[j+1:]
+		} else {
+			matchers = ""
+		}
+
+		j := strings.IndexByte(field, '=')
+		if j == -1 {
 			// that means this will be a protocol field.
-			if ss[i] != "" {
-				f.Protocol = Protocol(ss[i])
+			if field = strings.TrimSpace(field); field != "" {
+				f.Protocol = Protocol(field)
 			}
 			continue
 		}
@@ -218,19 +243,18 @@ func (f *Flow) UnmarshalText(b []byte) error {
 		// All remaining comma-separated values should be in key=value format,
 		// but parsing "actions" is done later because actions can use the form:
 		//  actions=foo,bar,baz
-		kv := strings.Split(ss[i], "=")
-		if len(kv) != 2 {
+		key, value := strings.TrimSpace(field[:j]), strings.TrimSpace(field[j+1:])
+		if strings.IndexByte(value, '=') != -1 {
 			continue
 		}
-		kv[1] = strings.TrimSpace(kv[1])
 
-		switch strings.TrimSpace(kv[0]) {
+		switch key {
 		case priority:
 			// Parse priority into struct field.
-			pri, err := strconv.ParseInt(kv[1], 10, 0)
+			pri, err := strconv.ParseInt(value, 10, 0)
 			if err != nil {
 				return &FlowError{
-					Str: kv[1],
+					Str: value,
 					Err: err,
 				}
 			}
@@ -238,30 +262,26 @@ func (f *Flow) UnmarshalText(b []byte) error {
 			continue
 		case cookie:
 			// Parse cookie into struct field.
-			cookie, err := strconv.ParseUint(kv[1], 0, 64)
+			cookie, err := strconv.ParseUint(value, 0, 64)
 			if err != nil {
 				return &FlowError{
-					Str: kv[1],
+					Str: value,
 					Err: err,
 				}
 			}
 			f.Cookie = cookie
 			continue
-		case keyActions:
-			// Parse actions outside this loop.
-			continue
 		case inPort:
 			// Parse in_port into struct field.
-			s := kv[1]
-			if strings.TrimSpace(s) == portLOCAL {
+			if value == portLOCAL {
 				f.InPort = PortLOCAL
 				continue
 			}
 
-			port, err := strconv.ParseInt(s, 10, 0)
+			port, err := strconv.ParseInt(value, 10, 0)
 			if err != nil {
 				return &FlowError{
-					Str: s,
+					Str: value,
 					Err: err,
 				}
 			}
@@ -269,10 +289,10 @@ func (f *Flow) UnmarshalText(b []byte) error {
 			continue
 		case idleTimeout:
 			// Parse idle_timeout into struct field.
-			timeout, err := strconv.ParseInt(kv[1], 10, 0)
+			timeout, err := strconv.ParseInt(value, 10, 0)
 			if err != nil {
 				return &FlowError{
-					Str: kv[1],
+					Str: value,
 					Err: err,
 				}
 			}
@@ -280,10 +300,10 @@ func (f *Flow) UnmarshalText(b []byte) error {
 			continue
 		case table:
 			// Parse table into struct field.
-			table, err := strconv.ParseInt(kv[1], 10, 0)
+			table, err := strconv.ParseInt(value, 10, 0)
 			if err != nil {
 				return &FlowError{
-					Str: kv[1],
+					Str: value,
 					Err: err,
 				}
 			}
@@ -296,7 +316,7 @@ func (f *Flow) UnmarshalText(b []byte) error {
 
 		// All arbitrary key/value pairs that
 		// don't match the case above.
-		match, err := parseMatch(kv[0], kv[1])
+		match, err := parseMatch(key, value)
 		if err != nil {
 			return err
 		}
@@ -304,30 +324,105 @@ func (f *Flow) UnmarshalText(b []byte) error {
 	}
 
 	// Parse all actions from the flow.
-	p := newActionParser(strings.NewReader(actions))
-	out, raw, err := p.Parse()
+	var n int
+	var drop bool
+	err := splitActions(actions, func(raw string) error {
+		a, err := parseAction(raw)
+		if err != nil {
+			return err
+		}
+
+		f.Actions = append(f.Actions, a)
+		n++
+		drop = drop || raw == actionDrop
+		return nil
+	})
 	if err != nil {
 		return &FlowError{
 			Str: actions,
 			Err: errInvalidActions,
 		}
 	}
-	f.Actions = out
 
 	// Action "drop" must only be specified by itself.
-	if len(raw) > 1 {
-		for _, a := range raw {
-			if a == actionDrop {
-				return &FlowError{
-					Err: errActionsWithDrop,
-				}
-			}
+	if drop && n > 1 {
+		return &FlowError{
+			Err: errActionsWithDrop,
 		}
 	}
 
 	return nil
 }
 
+// indexMatchSeparator returns the index of the first comma in s which
+// separates two matches, or -1 if there is none.  Commas within parentheses,
+// such as the one in "packet_type=(1,0x800)", do not separate matches.
+func indexMatchSeparator(s string) int {
+	var depth int
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth <= 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// GoString implements fmt.GoStringer, and returns Go syntax which constructs
+// a Flow equivalent to f.  Fields with zero values are omitted.
+func (f *Flow) GoString() string {
+	var fields [][2]string
+	add := func(name, value string) {
+		fields = append(fields, [2]string{name, value})
+	}
+
+	if f.Priority != 0 {
+		add("Priority", strconv.Itoa(f.Priority))
+	}
+	if f.Protocol != "" {
+		add("Protocol", protocolGoString(f.Protocol))
+	}
+	switch f.InPort {
+	case 0:
+	case PortLOCAL:
+		add("InPort", "ovs.PortLOCAL")
+	default:
+		add("InPort", strconv.Itoa(f.InPort))
+	}
+	if len(f.Matches) > 0 {
+		ss := make([]string, 0, len(f.Matches))
+		for _, m := range f.Matches {
+			ss = append(ss, m.GoString())
+		}
+		add("Matches", sliceGoString("ovs.Match", ss))
+	}
+	if f.Table != 0 {
+		add("Table", strconv.Itoa(f.Table))
+	}
+	if f.IdleTimeout != 0 {
+		add("IdleTimeout", strconv.Itoa(f.IdleTimeout))
+	}
+	if f.Cookie != 0 {
+		add("Cookie", fmt.Sprintf("%#x", f.Cookie))
+	}
+	if len(f.Actions) > 0 {
+		ss := make([]string, 0, len(f.Actions))
+		for _, a := range f.Actions {
+			ss = append(ss, a.GoString())
+		}
+		add("Actions", sliceGoString("ovs.Action", ss))
+	}
+
+	return structGoString("&ovs.Flow", fields)
+}
+
 // MatchFlow converts Flow into MatchFlow.
 func (f *Flow) MatchFlow() *MatchFlow {
 	return &MatchFlow{
@@ -349,8 +444,16 @@ func (f *Flow) MatchFlowStrict() *MatchFlow {
 
 // marshalActions marshals all Actions in a Flow to their text form.
 func (f *Flow) marshalActions() ([]string, error) {
-	fns := make([]func() ([]byte, error), 0, len(f.Actions))
-	for _, fn := range f.Actions {
+	// Instructions must follow all other actions, in a specific order.
+	actions, err := sortInstructions(f.Actions)
+	if err != nil {
+		return nil, &FlowError{
+			Err: err,
+		}
+	}
+
+	fns := make([]func() ([]byte, error), 0, len(actions))
+	for _, fn := range actions {
 		fns = append(fns, fn.MarshalText)
 	}
 
@@ -15,7 +15,9 @@
 package ovs
 
 import (
+	"bytes"
 	"fmt"
+	"go/format"
 	"net"
 	"reflect"
 	"strconv"
@@ -631,10 +633,9 @@ func TestFlowUnmarshalText(t *testing.T) {
 				Priority: 4010,
 				Protocol: ProtocolTCPv4,
 				Matches: []Match{
-					ConnectionTrackingState(
-						SetState(CTStateTracked),
-						SetState(CTStateNew),
-					),
+					ConnectionTrackingStateBits(CTState{
+						Set: CTStateTracked | CTStateNew,
+					}),
 					NetworkDestination("192.0.2.1"),
 					TransportDestinationPort(22),
 				},
@@ -720,11 +721,10 @@ func TestFlowUnmarshalText(t *testing.T) {
 				Priority: 1010,
 				Protocol: ProtocolTCPv4,
 				Matches: []Match{
-					TCPFlags(
-						SetTCPFlag(TCPFlagSYN),
-						UnsetTCPFlag(TCPFlagPSH),
-						SetTCPFlag(TCPFlagACK),
-					),
+					TCPFlagBits(TCPFlagState{
+						Set:   TCPFlagSYN | TCPFlagACK,
+						Unset: TCPFlagPSH,
+					}),
 				},
 				Table: 12,
 				Actions: []Action{
@@ -750,6 +750,51 @@ func TestFlowUnmarshalText(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "NSH service chain flow generated by ovs-ofctl dump-flows",
+			s:    " cookie=0x0, duration=4.001s, table=0, n_packets=0, n_bytes=0, idle_age=4, priority=10,in_port=1 actions=encap(nsh(md_type=1)),set_field:0x10->nsh_spi,encap(ethernet),output:2",
+			f: &Flow{
+				Priority: 10,
+				InPort:   1,
+				Matches:  []Match{},
+				Table:    0,
+				Actions: []Action{
+					EncapNSH(1),
+					SetField("0x10", "nsh_spi"),
+					EncapEthernet(),
+					Output(2),
+				},
+			},
+		},
+		{
+			desc: "NSH decap flow generated by ovs-ofctl dump-flows",
+			s:    " cookie=0x0, duration=4.001s, table=0, n_packets=0, n_bytes=0, idle_age=4, priority=10,dl_type=0x894f actions=decap(),decap(packet_type(ns=1,type=0x800)),output:3",
+			f: &Flow{
+				Priority: 10,
+				Matches: []Match{
+					DataLinkType(0x894f),
+				},
+				Table: 0,
+				Actions: []Action{
+					Decap(),
+					DecapPacketType(PacketNamespaceEtherType, 0x0800),
+					Output(3),
+				},
+			},
+		},
+		{
+			desc: "IP fragment flow generated by ovs-ofctl dump-flows",
+			s:    " cookie=0x0, duration=12.001s, table=0, n_packets=0, n_bytes=0, idle_age=12, priority=10,ip,nw_frag=first actions=drop",
+			f: &Flow{
+				Priority: 10,
+				Protocol: ProtocolIPv4,
+				Matches: []Match{
+					IPFragment(IPFragFirst),
+				},
+				Table:   0,
+				Actions: []Action{Drop()},
+			},
+		},
 		{
 			desc: "TP Port Range",
 			s:    "priority=3000,tcp,in_port=72,tp_src=0xea60/0xffe0,tp_dst=0xea60/0xffe0,table=0,idle_timeout=0,actions=drop",
@@ -766,6 +811,21 @@ func TestFlowUnmarshalText(t *testing.T) {
 				Actions:     []Action{Drop()},
 			},
 		},
+		{
+			desc: "Flow with packet type and packet mark",
+			s:    "priority=10,packet_type=(1,0x800),pkt_mark=0x1/0xff,actions=set_field:0x2/0xff->pkt_mark,output:1",
+			f: &Flow{
+				Priority: 10,
+				Matches: []Match{
+					PacketType(PacketNamespaceEtherType, 0x0800),
+					PacketMark(0x1, 0xff),
+				},
+				Actions: []Action{
+					SetPacketMark(0x2, 0xff),
+					Output(1),
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -791,6 +851,93 @@ func TestFlowUnmarshalText(t *testing.T) {
 	}
 }
 
+func TestFlowGoString(t *testing.T) {
+	var tests = []struct {
+		desc string
+		f    *Flow
+		s    string
+	}{
+		{
+			desc: "drop",
+			f: &Flow{
+				Actions: []Action{Drop()},
+			},
+			s: `&ovs.Flow{
+	Actions: []ovs.Action{
+		ovs.Drop(),
+	},
+}`,
+		},
+		{
+			desc: "all fields",
+			f: &Flow{
+				Priority: 100,
+				Protocol: ProtocolTCPv4,
+				InPort:   PortLOCAL,
+				Matches: []Match{
+					NetworkSource("192.0.2.0/24"),
+					TransportDestinationPort(22),
+				},
+				Table:       1,
+				IdleTimeout: 10,
+				Cookie:      0xdeadbeef,
+				Actions: []Action{
+					WriteActions(Output(1), ModNetworkDestination(net.IPv4(192, 0, 2, 1))),
+					GotoTable(2),
+				},
+			},
+			s: `&ovs.Flow{
+	Priority: 100,
+	Protocol: ovs.ProtocolTCPv4,
+	InPort:   ovs.PortLOCAL,
+	Matches: []ovs.Match{
+		ovs.NetworkSource("192.0.2.0/24"),
+		ovs.TransportDestinationPort(22),
+	},
+	Table:       1,
+	IdleTimeout: 10,
+	Cookie:      0xdeadbeef,
+	Actions: []ovs.Action{
+		ovs.WriteActions(ovs.Output(1), ovs.ModNetworkDestination(net.IPv4(192, 0, 2, 1))),
+		ovs.GotoTable(2),
+	},
+}`,
+		},
+		{
+			desc: "unknown protocol",
+			f: &Flow{
+				Protocol: Protocol("dccp"),
+				Actions:  []Action{Normal()},
+			},
+			s: `&ovs.Flow{
+	Protocol: ovs.Protocol("dccp"),
+	Actions: []ovs.Action{
+		ovs.Normal(),
+	},
+}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			s := tt.f.GoString()
+			if want, got := tt.s, s; want != got {
+				t.Fatalf("unexpected Flow Go syntax:\n- want: %v\n-  got: %v", want, got)
+			}
+
+			// The output must already be formatted.
+			src := "package foo\n\nvar f = " + s + "\n"
+			b, err := format.Source([]byte(src))
+			if err != nil {
+				t.Fatalf("failed to format Go syntax: %v", err)
+			}
+			if want, got := src, string(b); want != got {
+				t.Fatalf("Go syntax is not formatted:\n- want: %v\n-  got: %v", want, got)
+			}
+		})
+	}
+}
+
 func TestFlowMatchFlow(t *testing.T) {
 	var tests = []struct {
 		desc string
@@ -1197,3 +1344,106 @@ func flowErrorEqual(a error, b error) bool {
 
 	return reflect.DeepEqual(fa, fb)
 }
+
+func TestFlowUnmarshalTextReuse(t *testing.T) {
+	f := new(Flow)
+	if err := f.UnmarshalText([]byte("priority=10,tcp,in_port=1,tp_dst=22,table=1,cookie=0x1,actions=output:2,resubmit(,3)")); err != nil {
+		t.Fatalf("failed to unmarshal flow: %v", err)
+	}
+
+	if err := f.UnmarshalText([]byte("ip,nw_src=192.0.2.1,actions=drop")); err != nil {
+		t.Fatalf("failed to unmarshal flow: %v", err)
+	}
+
+	want := &Flow{
+		Priority: DefaultPriority,
+		Protocol: ProtocolIPv4,
+		Matches:  []Match{NetworkSource("192.0.2.1")},
+		Actions:  []Action{Drop()},
+	}
+
+	if !flowsEqual(want, f) {
+		t.Fatalf("unexpected Flow:\n- want: %#v\n-  got: %#v", want, f)
+	}
+}
+
+func TestFlowUnmarshalTextDefaultPriority(t *testing.T) {
+	var tests = []struct {
+		s        string
+		priority int
+	}{
+		{
+			s:        "ip,actions=drop",
+			priority: DefaultPriority,
+		},
+		{
+			s:        "priority=0,ip,actions=drop",
+			priority: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			f := new(Flow)
+			if err := f.UnmarshalText([]byte(tt.s)); err != nil {
+				t.Fatalf("failed to unmarshal flow: %v", err)
+			}
+
+			if want, got := tt.priority, f.Priority; want != got {
+				t.Fatalf("unexpected priority:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+		})
+	}
+}
+
+func BenchmarkFlowUnmarshalText(b *testing.B) {
+	lines := bytes.Split(benchmarkFlowDump(100000), []byte("\n"))
+	lines = lines[1 : len(lines)-1]
+
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, l := range lines {
+				f := new(Flow)
+				if err := f.UnmarshalText(l); err != nil {
+					b.Fatalf("failed to unmarshal flow: %v", err)
+				}
+			}
+		}
+	})
+
+	b.Run("reuse", func(b *testing.B) {
+		b.ReportAllocs()
+		f := new(Flow)
+		for i := 0; i < b.N; i++ {
+			for _, l := range lines {
+				if err := f.UnmarshalText(l); err != nil {
+					b.Fatalf("failed to unmarshal flow: %v", err)
+				}
+			}
+		}
+	})
+}
+
+// benchmarkFlowDump generates the output of 'ovs-ofctl dump-flows' for n
+// flows, resembling the tables of a typical virtual switch.
+func benchmarkFlowDump(n int) []byte {
+	formats := []string{
+		" cookie=0x%x, duration=9215.748s, table=0, n_packets=6, n_bytes=480, idle_age=9206, priority=%d,in_port=%d actions=mod_vlan_vid:10,output:1",
+		" cookie=0x%x, duration=1121991.329s, table=50, n_packets=0, n_bytes=0, priority=%d,ip,dl_src=f1:f2:f3:f4:f5:%02x actions=ct(table=51)",
+		" cookie=0x%x, duration=83229.846s, table=51, n_packets=3, n_bytes=234, priority=%d,ct_state=+new+rel+trk,ip,reg0=0x%x actions=ct(commit,table=65)",
+		" cookie=0x%x, duration=1381314.983s, table=65, n_packets=0, n_bytes=0, priority=%d,ip,dl_dst=f1:f2:f3:f4:f5:f6,nw_src=169.254.169.254,nw_dst=10.%d.0.0/16 actions=output:19",
+		" cookie=0x%x, duration=13.265s, table=12, n_packets=0, n_bytes=0, idle_age=13, priority=%d,tcp,tp_dst=%d,tcp_flags=+syn-psh+ack actions=load:0x1->NXM_NX_REG0[0..15],resubmit(,13)",
+		" cookie=0x%x, duration=13.265s, table=20, n_packets=0, n_bytes=0, priority=%d,arp,arp_spa=192.0.2.1,arp_tpa=192.0.2.%d actions=set_field:de:ad:be:ef:de:ad->eth_src,mod_nw_src:192.0.2.1,IN_PORT",
+	}
+
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("NXST_FLOW reply (xid=0x4):\n")
+	for i := 0; i < n; i++ {
+		_, _ = fmt.Fprintf(&buf, formats[i%len(formats)], i, i%65536, i%256)
+		_ = buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// InstanceOptions describes how to reach a single Open vSwitch instance,
+// such as a sandboxed ovs-vswitchd and ovsdb-server pair.  The zero value
+// describes the default instance of the host.
+type InstanceOptions struct {
+	// DB is the OVSDB remote used by 'ovs-vsctl', such as
+	// "unix:/tmp/sandbox/db.sock" or "tcp:127.0.0.1:6640".  If empty and
+	// RunDir is set, "unix:<RunDir>/db.sock" is used.
+	DB string
+
+	// RunDir is the run directory of the instance.  If set, 'ovs-ofctl'
+	// commands address a bridge using its management socket,
+	// "<RunDir>/<bridge>.mgmt".
+	RunDir string
+
+	// BridgeSockets maps bridge names to the path of their management
+	// sockets, overriding the path derived from RunDir.
+	BridgeSockets map[string]string
+
+	// Control is the path to the unixctl socket of ovs-vswitchd, used by
+	// 'ovs-appctl'.  ovs-vswitchd names its socket using its PID, so this
+	// path cannot be derived from RunDir.
+	Control string
+}
+
+// Instance returns an OptionFunc which directs all commands issued by a
+// Client to the Open vSwitch instance described by o.
+func Instance(o InstanceOptions) OptionFunc {
+	return func(c *Client) {
+		c.instance = o
+	}
+}
+
+// vsctlFlags returns the flags needed to direct 'ovs-vsctl' to the instance.
+func (o InstanceOptions) vsctlFlags() []string {
+	db := o.DB
+	if db == "" && o.RunDir != "" {
+		db = "unix:" + filepath.Join(o.RunDir, "db.sock")
+	}
+	if db == "" {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("--db=%s", db)}
+}
+
+// appctlFlags returns the flags needed to direct 'ovs-appctl' to the
+// instance's ovs-vswitchd.
+func (o InstanceOptions) appctlFlags() []string {
+	if o.Control == "" {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("--target=%s", o.Control)}
+}
+
+// bridgeTarget returns the argument used to address bridge in 'ovs-ofctl'
+// commands.  Arguments which already specify a connection method, such as
+// "unix:/path" or "tcp:127.0.0.1:6653", are returned unchanged.
+func (o InstanceOptions) bridgeTarget(bridge string) string {
+	if strings.ContainsAny(bridge, ":/") {
+		return bridge
+	}
+
+	if path, ok := o.BridgeSockets[bridge]; ok {
+		return "unix:" + path
+	}
+
+	if o.RunDir != "" {
+		return "unix:" + filepath.Join(o.RunDir, bridge+".mgmt")
+	}
+
+	return bridge
+}
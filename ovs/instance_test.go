@@ -0,0 +1,126 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInstanceOptions(t *testing.T) {
+	var tests = []struct {
+		desc   string
+		o      InstanceOptions
+		bridge string
+		vsctl  []string
+		target string
+		appctl []string
+	}{
+		{
+			desc:   "default instance",
+			bridge: "br0",
+			target: "br0",
+		},
+		{
+			desc: "run directory",
+			o: InstanceOptions{
+				RunDir: "/tmp/sandbox",
+			},
+			bridge: "br0",
+			vsctl:  []string{"--db=unix:/tmp/sandbox/db.sock"},
+			target: "unix:/tmp/sandbox/br0.mgmt",
+		},
+		{
+			desc: "all options",
+			o: InstanceOptions{
+				DB:     "tcp:127.0.0.1:6640",
+				RunDir: "/tmp/sandbox",
+				BridgeSockets: map[string]string{
+					"br0": "/tmp/br0.sock",
+				},
+				Control: "/tmp/sandbox/ovs-vswitchd.100.ctl",
+			},
+			bridge: "br0",
+			vsctl:  []string{"--db=tcp:127.0.0.1:6640"},
+			target: "unix:/tmp/br0.sock",
+			appctl: []string{"--target=/tmp/sandbox/ovs-vswitchd.100.ctl"},
+		},
+		{
+			desc: "explicit connection method",
+			o: InstanceOptions{
+				RunDir: "/tmp/sandbox",
+			},
+			bridge: "tcp:127.0.0.1:6653",
+			vsctl:  []string{"--db=unix:/tmp/sandbox/db.sock"},
+			target: "tcp:127.0.0.1:6653",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if want, got := tt.vsctl, tt.o.vsctlFlags(); !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected ovs-vsctl flags:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+
+			if want, got := tt.target, tt.o.bridgeTarget(tt.bridge); want != got {
+				t.Fatalf("unexpected bridge target:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+
+			if want, got := tt.appctl, tt.o.appctlFlags(); !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected ovs-appctl flags:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+		})
+	}
+}
+
+func TestClientInstance(t *testing.T) {
+	var cmds []string
+
+	c := testClient([]OptionFunc{
+		Timeout(1),
+		Instance(InstanceOptions{
+			RunDir:  "/tmp/sandbox",
+			Control: "/tmp/sandbox/ovs-vswitchd.100.ctl",
+		}),
+	}, func(cmd string, args ...string) ([]byte, error) {
+		cmds = append(cmds, cmd+" "+strings.Join(args, " "))
+		return nil, nil
+	})
+
+	if err := c.VSwitch.AddBridge("br0"); err != nil {
+		t.Fatalf("unexpected error for Client.VSwitch.AddBridge: %v", err)
+	}
+	if err := c.OpenFlow.ModPort("br0", "eth0", PortActionUp); err != nil {
+		t.Fatalf("unexpected error for Client.OpenFlow.ModPort: %v", err)
+	}
+	if _, err := c.App.Run("dpif/show"); err != nil {
+		t.Fatalf("unexpected error for Client.App.Run: %v", err)
+	}
+
+	want := []string{
+		"ovs-vsctl --timeout=1 --db=unix:/tmp/sandbox/db.sock --may-exist add-br br0",
+		"ovs-ofctl --timeout=1 mod-port unix:/tmp/sandbox/br0.mgmt eth0 up",
+		"ovs-appctl --timeout=1 --target=/tmp/sandbox/ovs-vswitchd.100.ctl dpif/show",
+	}
+
+	if got := cmds; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected commands:\n- want: %v\n-  got: %v",
+			want, got)
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidGotoTable is returned when a goto_table instruction does
+	// not target a table later than the table of its flow.
+	ErrInvalidGotoTable = errors.New("goto_table must target a later table")
+
+	// errDuplicateInstruction is returned when a flow specifies the same
+	// OpenFlow 1.1+ instruction more than once.
+	errDuplicateInstruction = errors.New("instruction may only be specified once per flow")
+
+	// errEmptyWriteActions is returned when WriteActions is called with no
+	// actions.
+	errEmptyWriteActions = errors.New("write_actions requires at least one action")
+)
+
+// Instruction strings, as they appear in flow actions.
+const (
+	instructionClearActions  = "clear_actions"
+	instructionWriteActions  = "write_actions"
+	instructionWriteMetadata = "write_metadata"
+	instructionGotoTable     = "goto_table"
+)
+
+// instructionOrder is the order in which Open vSwitch requires OpenFlow
+// 1.1+ instructions to appear, after all apply actions.
+var instructionOrder = map[string]int{
+	instructionClearActions:  1,
+	instructionWriteActions:  2,
+	instructionWriteMetadata: 3,
+	instructionGotoTable:     4,
+}
+
+// An instruction is an Action which is an OpenFlow 1.1+ instruction rather
+// than an action applied immediately to a packet.
+type instruction interface {
+	Action
+	instruction() string
+}
+
+// ClearActions clears all actions in the action set of a packet.  It
+// requires OpenFlow 1.1 or later.
+func ClearActions() Action {
+	return &clearActionsInstruction{}
+}
+
+var _ instruction = &clearActionsInstruction{}
+
+// A clearActionsInstruction is an Action returned by ClearActions.
+type clearActionsInstruction struct{}
+
+func (a *clearActionsInstruction) instruction() string { return instructionClearActions }
+
+// MarshalText implements Action.
+func (a *clearActionsInstruction) MarshalText() ([]byte, error) {
+	return []byte(instructionClearActions), nil
+}
+
+// GoString implements Action.
+func (a *clearActionsInstruction) GoString() string {
+	return "ovs.ClearActions()"
+}
+
+// WriteActions adds the specified actions to the action set of a packet,
+// to be executed when pipeline processing ends.  It requires OpenFlow 1.1
+// or later.
+func WriteActions(actions ...Action) Action {
+	return &writeActionsInstruction{
+		actions: actions,
+	}
+}
+
+var _ instruction = &writeActionsInstruction{}
+
+// A writeActionsInstruction is an Action returned by WriteActions.
+type writeActionsInstruction struct {
+	actions []Action
+}
+
+func (a *writeActionsInstruction) instruction() string { return instructionWriteActions }
+
+// MarshalText implements Action.
+func (a *writeActionsInstruction) MarshalText() ([]byte, error) {
+	if len(a.actions) == 0 {
+		return nil, errEmptyWriteActions
+	}
+
+	ss := make([]string, 0, len(a.actions))
+	for _, act := range a.actions {
+		if _, ok := act.(instruction); ok {
+			return nil, fmt.Errorf("%s may only contain actions, not instructions", instructionWriteActions)
+		}
+
+		b, err := act.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+
+		ss = append(ss, string(b))
+	}
+
+	return bprintf("%s(%s)", instructionWriteActions, strings.Join(ss, ",")), nil
+}
+
+// GoString implements Action.
+func (a *writeActionsInstruction) GoString() string {
+	ss := make([]string, 0, len(a.actions))
+	for _, act := range a.actions {
+		ss = append(ss, act.GoString())
+	}
+
+	return fmt.Sprintf("ovs.WriteActions(%s)", strings.Join(ss, ", "))
+}
+
+// WriteMetadata writes value to the bits of the metadata field of a packet
+// which are set in mask.  If mask is zero, value is written to the entire
+// field.  It requires OpenFlow 1.1 or later.
+func WriteMetadata(value, mask uint64) Action {
+	return &writeMetadataInstruction{
+		value: value,
+		mask:  mask,
+	}
+}
+
+var _ instruction = &writeMetadataInstruction{}
+
+// A writeMetadataInstruction is an Action returned by WriteMetadata.
+type writeMetadataInstruction struct {
+	value uint64
+	mask  uint64
+}
+
+func (a *writeMetadataInstruction) instruction() string { return instructionWriteMetadata }
+
+// MarshalText implements Action.
+func (a *writeMetadataInstruction) MarshalText() ([]byte, error) {
+	if a.mask == 0 || a.mask == math.MaxUint64 {
+		return bprintf("%s:%#x", instructionWriteMetadata, a.value), nil
+	}
+
+	return bprintf("%s:%#x/%#x", instructionWriteMetadata, a.value, a.mask), nil
+}
+
+// GoString implements Action.
+func (a *writeMetadataInstruction) GoString() string {
+	return fmt.Sprintf("ovs.WriteMetadata(%#x, %#x)", a.value, a.mask)
+}
+
+// GotoTable continues pipeline processing of a packet in the specified
+// table, which must be later than the table of the flow.  It requires
+// OpenFlow 1.1 or later.
+func GotoTable(table int) Action {
+	return &gotoTableInstruction{
+		table: table,
+	}
+}
+
+var _ instruction = &gotoTableInstruction{}
+
+// A gotoTableInstruction is an Action returned by GotoTable.
+type gotoTableInstruction struct {
+	table int
+}
+
+func (a *gotoTableInstruction) instruction() string { return instructionGotoTable }
+
+// MarshalText implements Action.
+func (a *gotoTableInstruction) MarshalText() ([]byte, error) {
+	if a.table < 0 || a.table > maxTableID {
+		return nil, fmt.Errorf("%s table must be between 0 and %d", instructionGotoTable, maxTableID)
+	}
+
+	return bprintf("%s:%d", instructionGotoTable, a.table), nil
+}
+
+// GoString implements Action.
+func (a *gotoTableInstruction) GoString() string {
+	return fmt.Sprintf("ovs.GotoTable(%d)", a.table)
+}
+
+// sortInstructions returns actions with all instructions moved after the
+// remaining actions, in the order required by Open vSwitch.  The relative
+// order of all other actions is preserved.
+func sortInstructions(actions []Action) ([]Action, error) {
+	out := make([]Action, len(actions))
+	copy(out, actions)
+
+	seen := make(map[string]bool)
+	for _, a := range out {
+		in, ok := a.(instruction)
+		if !ok {
+			continue
+		}
+
+		if seen[in.instruction()] {
+			return nil, fmt.Errorf("%v: %s", errDuplicateInstruction, in.instruction())
+		}
+		seen[in.instruction()] = true
+	}
+
+	if len(seen) == 0 {
+		return out, nil
+	}
+
+	rank := func(a Action) int {
+		if in, ok := a.(instruction); ok {
+			return instructionOrder[in.instruction()]
+		}
+
+		return 0
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return rank(out[i]) < rank(out[j])
+	})
+
+	return out, nil
+}
+
+// parseInstruction parses an OpenFlow 1.1+ instruction from s.  It returns
+// false if s is not an instruction.
+func parseInstruction(s string) (Action, bool, error) {
+	switch {
+	case s == instructionClearActions:
+		return ClearActions(), true, nil
+	case strings.HasPrefix(s, instructionGotoTable+":"):
+		table, err := strconv.Atoi(strings.TrimPrefix(s, instructionGotoTable+":"))
+		if err != nil {
+			return nil, true, fmt.Errorf("invalid %s instruction: %q", instructionGotoTable, s)
+		}
+
+		return GotoTable(table), true, nil
+	case strings.HasPrefix(s, instructionWriteMetadata+":"):
+		value, mask, err := parseMaskedUint64(strings.TrimPrefix(s, instructionWriteMetadata+":"))
+		if err != nil {
+			return nil, true, fmt.Errorf("invalid %s instruction: %q", instructionWriteMetadata, s)
+		}
+
+		return WriteMetadata(value, mask), true, nil
+	case strings.HasPrefix(s, instructionWriteActions+"(") && strings.HasSuffix(s, ")"):
+		inner := s[len(instructionWriteActions)+1 : len(s)-1]
+
+		actions, err := parseActions(inner, nil)
+		if err != nil {
+			return nil, true, err
+		}
+		if len(actions) == 0 {
+			return nil, true, errEmptyWriteActions
+		}
+
+		return WriteActions(actions...), true, nil
+	}
+
+	return nil, false, nil
+}
@@ -0,0 +1,267 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInstructionMarshalText(t *testing.T) {
+	var tests = []struct {
+		desc    string
+		a       Action
+		out     string
+		invalid bool
+	}{
+		{
+			desc: "clear_actions",
+			a:    ClearActions(),
+			out:  "clear_actions",
+		},
+		{
+			desc:    "write_actions empty",
+			a:       WriteActions(),
+			invalid: true,
+		},
+		{
+			desc:    "write_actions with instruction",
+			a:       WriteActions(GotoTable(1)),
+			invalid: true,
+		},
+		{
+			desc: "write_actions",
+			a:    WriteActions(ModVLANVID(10), Output(2)),
+			out:  "write_actions(mod_vlan_vid:10,output:2)",
+		},
+		{
+			desc: "write_metadata",
+			a:    WriteMetadata(0x10, 0),
+			out:  "write_metadata:0x10",
+		},
+		{
+			desc: "write_metadata all ones mask",
+			a:    WriteMetadata(0x10, math.MaxUint64),
+			out:  "write_metadata:0x10",
+		},
+		{
+			desc: "write_metadata with mask",
+			a:    WriteMetadata(0x10, 0xf0),
+			out:  "write_metadata:0x10/0xf0",
+		},
+		{
+			desc:    "goto_table too large",
+			a:       GotoTable(255),
+			invalid: true,
+		},
+		{
+			desc: "goto_table",
+			a:    GotoTable(10),
+			out:  "goto_table:10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			out, err := tt.a.MarshalText()
+			if err != nil && !tt.invalid {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.invalid {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+				return
+			}
+
+			if want, got := tt.out, string(out); want != got {
+				t.Fatalf("unexpected Action output:\n- want: %q\n-  got: %q",
+					want, got)
+			}
+		})
+	}
+}
+
+func TestFlowMarshalTextInstructions(t *testing.T) {
+	var tests = []struct {
+		desc    string
+		f       *Flow
+		out     string
+		invalid bool
+	}{
+		{
+			desc: "instructions are sorted after actions",
+			f: &Flow{
+				Table:    1,
+				Priority: 10,
+				Matches:  []Match{Metadata(0x1, 0)},
+				Actions: []Action{
+					GotoTable(5),
+					WriteMetadata(0x2, 0xff),
+					ModVLANVID(10),
+					WriteActions(Output(2)),
+					ClearActions(),
+					Output(1),
+				},
+			},
+			out: "priority=10,metadata=0x1,table=1,idle_timeout=0,actions=mod_vlan_vid:10,output:1,clear_actions,write_actions(output:2),write_metadata:0x2/0xff,goto_table:5",
+		},
+		{
+			desc: "duplicate instruction",
+			f: &Flow{
+				Actions: []Action{GotoTable(1), GotoTable(2)},
+			},
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			out, err := tt.f.MarshalText()
+			if tt.invalid {
+				if err == nil || !strings.Contains(err.Error(), errDuplicateInstruction.Error()) {
+					t.Fatalf("expected duplicate instruction error, but got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if want, got := tt.out, string(out); want != got {
+				t.Fatalf("unexpected Flow output:\n- want: %q\n-  got: %q",
+					want, got)
+			}
+		})
+	}
+}
+
+func Test_parseInstruction(t *testing.T) {
+	var tests = []struct {
+		s       string
+		final   string
+		a       Action
+		invalid bool
+	}{
+		{
+			s: "clear_actions",
+			a: ClearActions(),
+		},
+		{
+			s:       "goto_table:foo",
+			invalid: true,
+		},
+		{
+			s: "goto_table:5",
+			a: GotoTable(5),
+		},
+		{
+			s:       "write_metadata:0x1/foo",
+			invalid: true,
+		},
+		{
+			s: "write_metadata:0x1/0xff",
+			a: WriteMetadata(0x1, 0xff),
+		},
+		{
+			s:     "write_metadata:16",
+			final: "write_metadata:0x10",
+			a:     WriteMetadata(0x10, 0),
+		},
+		{
+			s:       "write_actions()",
+			invalid: true,
+		},
+		{
+			s:       "write_actions(foo)",
+			invalid: true,
+		},
+		{
+			s: "write_actions(output:2)",
+			a: WriteActions(Output(2)),
+		},
+		{
+			s: "write_actions(ct(commit),resubmit(,2))",
+			a: WriteActions(ConnectionTracking("commit"), Resubmit(0, 2)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			a, err := parseAction(tt.s)
+			if err != nil && !tt.invalid {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.invalid {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+				return
+			}
+
+			if want, got := tt.a, a; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected Action:\n- want: %#v\n-  got: %#v",
+					want, got)
+			}
+
+			s, err := a.MarshalText()
+			if err != nil {
+				t.Fatalf("failed to marshal Action: %v", err)
+			}
+
+			final := tt.final
+			if final == "" {
+				final = tt.s
+			}
+
+			if want, got := final, string(s); want != got {
+				t.Fatalf("unexpected final Action:\n- want: %q\n-  got: %q",
+					want, got)
+			}
+		})
+	}
+}
+
+func TestFlowUnmarshalTextInstructions(t *testing.T) {
+	s := " cookie=0x0, duration=1.5s, table=1, n_packets=0, n_bytes=0, priority=10,metadata=0x1/0xff actions=output:1,write_actions(output:2),write_metadata:0x2/0xff,goto_table:2"
+
+	f := new(Flow)
+	if err := f.UnmarshalText([]byte(s)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantMatches := []Match{Metadata(0x1, 0xff)}
+	if want, got := wantMatches, f.Matches; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected Matches:\n- want: %#v\n-  got: %#v",
+			want, got)
+	}
+
+	wantActions := []Action{
+		Output(1),
+		WriteActions(Output(2)),
+		WriteMetadata(0x2, 0xff),
+		GotoTable(2),
+	}
+	if want, got := wantActions, f.Actions; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected Actions:\n- want: %#v\n-  got: %#v",
+			want, got)
+	}
+
+	if err := f.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+}
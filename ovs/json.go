@@ -0,0 +1,749 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONVersion is the version of the JSON schema produced by the MarshalJSON
+// methods of Flow and MatchFlow.
+//
+// In version 1, a Flow is an object with the keys "version", "priority",
+// "protocol", "in_port", "table", "idle_timeout", "cookie" (a hexadecimal
+// string), "matches", and "actions".  A MatchFlow additionally has the keys
+// "strict" and "cookie_mask", and has no "idle_timeout" or "actions".
+//
+// Each Match is an object with the keys "field" and "value", such as
+// {"field":"nw_src","value":"192.0.2.0/24"}.
+//
+// Each Action is an object with the key "type" and zero or more of the keys
+// "value", "field", "args", and "actions":
+//   - {"type":"drop"}
+//   - {"type":"output","value":"1"}
+//   - {"type":"load","value":"0x1","field":"NXM_NX_REG0[]"}
+//   - {"type":"ct","args":["commit","table=2"]}
+//   - {"type":"write_actions","actions":[{"type":"output","value":"1"}]}
+//
+// Matches and Actions which this package cannot parse are stored in their
+// textual form as {"raw":"..."}, and are decoded as RawMatch or RawAction.
+const JSONVersion = 1
+
+// ErrJSONVersion is returned when decoding JSON with an unsupported schema
+// version.
+var ErrJSONVersion = errors.New("unsupported JSON schema version")
+
+// A flowJSON is the JSON representation of a Flow.
+type flowJSON struct {
+	Version     int          `json:"version"`
+	Priority    int          `json:"priority"`
+	Protocol    Protocol     `json:"protocol,omitempty"`
+	InPort      int          `json:"in_port,omitempty"`
+	Table       int          `json:"table"`
+	IdleTimeout int          `json:"idle_timeout,omitempty"`
+	Cookie      string       `json:"cookie,omitempty"`
+	Matches     []matchJSON  `json:"matches,omitempty"`
+	Actions     []actionJSON `json:"actions,omitempty"`
+}
+
+// A matchFlowJSON is the JSON representation of a MatchFlow.
+type matchFlowJSON struct {
+	Version    int         `json:"version"`
+	Strict     bool        `json:"strict,omitempty"`
+	Priority   int         `json:"priority"`
+	Protocol   Protocol    `json:"protocol,omitempty"`
+	InPort     int         `json:"in_port,omitempty"`
+	Table      int         `json:"table"`
+	Cookie     string      `json:"cookie,omitempty"`
+	CookieMask string      `json:"cookie_mask,omitempty"`
+	Matches    []matchJSON `json:"matches,omitempty"`
+}
+
+// A matchJSON is the JSON representation of a Match.
+type matchJSON struct {
+	Field string `json:"field,omitempty"`
+	Value string `json:"value,omitempty"`
+	Raw   string `json:"raw,omitempty"`
+}
+
+// An actionJSON is the JSON representation of an Action.
+type actionJSON struct {
+	Type    string       `json:"type,omitempty"`
+	Value   string       `json:"value,omitempty"`
+	Field   string       `json:"field,omitempty"`
+	Args    []string     `json:"args,omitempty"`
+	Actions []actionJSON `json:"actions,omitempty"`
+	Raw     string       `json:"raw,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (f *Flow) MarshalJSON() ([]byte, error) {
+	matches, err := newMatchesJSON(f.Matches)
+	if err != nil {
+		return nil, err
+	}
+
+	actions, err := newActionsJSON(f.Actions)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(flowJSON{
+		Version:     JSONVersion,
+		Priority:    f.Priority,
+		Protocol:    f.Protocol,
+		InPort:      f.InPort,
+		Table:       f.Table,
+		IdleTimeout: f.IdleTimeout,
+		Cookie:      cookieJSON(f.Cookie),
+		Matches:     matches,
+		Actions:     actions,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *Flow) UnmarshalJSON(b []byte) error {
+	var fj flowJSON
+	if err := json.Unmarshal(b, &fj); err != nil {
+		return err
+	}
+	if err := checkJSONVersion(fj.Version); err != nil {
+		return err
+	}
+
+	cookie, err := parseCookieJSON(fj.Cookie)
+	if err != nil {
+		return err
+	}
+
+	matches, err := parseMatchesJSON(fj.Matches)
+	if err != nil {
+		return err
+	}
+
+	actions, err := parseActionsJSON(fj.Actions)
+	if err != nil {
+		return err
+	}
+
+	*f = Flow{
+		Priority:    fj.Priority,
+		Protocol:    fj.Protocol,
+		InPort:      fj.InPort,
+		Matches:     matches,
+		Table:       fj.Table,
+		IdleTimeout: fj.IdleTimeout,
+		Cookie:      cookie,
+		Actions:     actions,
+	}
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (f *MatchFlow) MarshalJSON() ([]byte, error) {
+	matches, err := newMatchesJSON(f.Matches)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(matchFlowJSON{
+		Version:    JSONVersion,
+		Strict:     f.Strict,
+		Priority:   f.Priority,
+		Protocol:   f.Protocol,
+		InPort:     f.InPort,
+		Table:      f.Table,
+		Cookie:     cookieJSON(f.Cookie),
+		CookieMask: cookieJSON(f.CookieMask),
+		Matches:    matches,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *MatchFlow) UnmarshalJSON(b []byte) error {
+	var fj matchFlowJSON
+	if err := json.Unmarshal(b, &fj); err != nil {
+		return err
+	}
+	if err := checkJSONVersion(fj.Version); err != nil {
+		return err
+	}
+
+	cookie, err := parseCookieJSON(fj.Cookie)
+	if err != nil {
+		return err
+	}
+
+	cookieMask, err := parseCookieJSON(fj.CookieMask)
+	if err != nil {
+		return err
+	}
+
+	matches, err := parseMatchesJSON(fj.Matches)
+	if err != nil {
+		return err
+	}
+
+	*f = MatchFlow{
+		Strict:     fj.Strict,
+		InPort:     fj.InPort,
+		Priority:   fj.Priority,
+		Protocol:   fj.Protocol,
+		Matches:    matches,
+		Table:      fj.Table,
+		Cookie:     cookie,
+		CookieMask: cookieMask,
+	}
+
+	return nil
+}
+
+// UnmarshalMatchJSON unmarshals a Match from the JSON representation
+// produced by its MarshalJSON method.
+func UnmarshalMatchJSON(b []byte) (Match, error) {
+	var mj matchJSON
+	if err := json.Unmarshal(b, &mj); err != nil {
+		return nil, err
+	}
+
+	return mj.match()
+}
+
+// UnmarshalActionJSON unmarshals an Action from the JSON representation
+// produced by its MarshalJSON method.
+func UnmarshalActionJSON(b []byte) (Action, error) {
+	var aj actionJSON
+	if err := json.Unmarshal(b, &aj); err != nil {
+		return nil, err
+	}
+
+	return aj.action()
+}
+
+// checkJSONVersion verifies that a JSON schema version is supported.  A
+// missing version is treated as the current version.
+func checkJSONVersion(v int) error {
+	if v != 0 && v != JSONVersion {
+		return fmt.Errorf("%w: %d", ErrJSONVersion, v)
+	}
+
+	return nil
+}
+
+// cookieJSON returns the JSON representation of a cookie or cookie mask.
+func cookieJSON(cookie uint64) string {
+	if cookie == 0 {
+		return ""
+	}
+
+	// Cookies are strings so that 64-bit values survive decoders which use
+	// floating point numbers.
+	return fmt.Sprintf("%#x", cookie)
+}
+
+// parseCookieJSON parses the JSON representation of a cookie.
+func parseCookieJSON(s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	cookie, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cookie %q: %v", s, err)
+	}
+
+	return cookie, nil
+}
+
+// marshalMatchJSON produces the JSON representation of m.
+func marshalMatchJSON(m Match) ([]byte, error) {
+	mj, err := newMatchJSON(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mj)
+}
+
+// newMatchesJSON creates the JSON representation of matches.
+func newMatchesJSON(matches []Match) ([]matchJSON, error) {
+	out := make([]matchJSON, 0, len(matches))
+	for _, m := range matches {
+		mj, err := newMatchJSON(m)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, mj)
+	}
+
+	return out, nil
+}
+
+// newMatchJSON creates the JSON representation of m.
+func newMatchJSON(m Match) (matchJSON, error) {
+	b, err := m.MarshalText()
+	if err != nil {
+		return matchJSON{}, err
+	}
+
+	s := string(b)
+	if _, ok := m.(*rawMatch); ok {
+		return matchJSON{Raw: s}, nil
+	}
+
+	// Only matches which can be parsed again are stored as a field and
+	// value.
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || indexMatchSeparator(s) != -1 {
+		return matchJSON{Raw: s}, nil
+	}
+	if _, err := parseMatch(kv[0], kv[1]); err != nil {
+		return matchJSON{Raw: s}, nil
+	}
+
+	return matchJSON{Field: kv[0], Value: kv[1]}, nil
+}
+
+// parseMatchesJSON parses the JSON representation of matches.
+func parseMatchesJSON(matches []matchJSON) ([]Match, error) {
+	out := make([]Match, 0, len(matches))
+	for _, mj := range matches {
+		m, err := mj.match()
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, m)
+	}
+
+	return out, nil
+}
+
+// match creates a Match from its JSON representation.
+func (mj matchJSON) match() (Match, error) {
+	if mj.Field == "" {
+		return RawMatch(mj.Raw), nil
+	}
+
+	return parseMatch(mj.Field, mj.Value)
+}
+
+// marshalActionJSON produces the JSON representation of a.
+func marshalActionJSON(a Action) ([]byte, error) {
+	aj, err := newActionJSON(a)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(aj)
+}
+
+// newActionsJSON creates the JSON representation of actions.
+func newActionsJSON(actions []Action) ([]actionJSON, error) {
+	out := make([]actionJSON, 0, len(actions))
+	for _, a := range actions {
+		aj, err := newActionJSON(a)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, aj)
+	}
+
+	return out, nil
+}
+
+// newActionJSON creates the JSON representation of a.
+func newActionJSON(a Action) (actionJSON, error) {
+	b, err := a.MarshalText()
+	if err != nil {
+		return actionJSON{}, err
+	}
+
+	s := string(b)
+	if _, ok := a.(*rawAction); ok {
+		return actionJSON{Raw: s}, nil
+	}
+
+	// Only actions which can be parsed again are stored in structured form.
+	pa, err := parseAction(s)
+	if err != nil {
+		return actionJSON{Raw: s}, nil
+	}
+
+	if wa, ok := pa.(*writeActionsInstruction); ok {
+		actions, err := newActionsJSON(wa.actions)
+		if err != nil {
+			return actionJSON{}, err
+		}
+
+		return actionJSON{Type: instructionWriteActions, Actions: actions}, nil
+	}
+
+	i := strings.IndexAny(s, ":(")
+	switch {
+	case i == -1:
+		return actionJSON{Type: s}, nil
+	case s[i] == '(' && strings.HasSuffix(s, ")"):
+		return actionJSON{
+			Type: s[:i],
+			Args: splitActionArgs(s[i+1 : len(s)-1]),
+		}, nil
+	case s[i] == ':':
+		aj := actionJSON{
+			Type:  s[:i],
+			Value: s[i+1:],
+		}
+
+		// Actions such as load and set_field move a value into a field.
+		if vf := strings.SplitN(aj.Value, "->", 2); len(vf) == 2 {
+			aj.Value, aj.Field = vf[0], vf[1]
+		}
+
+		return aj, nil
+	}
+
+	return actionJSON{Raw: s}, nil
+}
+
+// splitActionArgs splits the comma separated arguments of an action,
+// ignoring commas nested within parentheses.
+func splitActionArgs(s string) []string {
+	var (
+		args  []string
+		depth int
+		start int
+	)
+
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(args, s[start:])
+}
+
+// parseActionsJSON parses the JSON representation of actions.
+func parseActionsJSON(actions []actionJSON) ([]Action, error) {
+	out := make([]Action, 0, len(actions))
+	for _, aj := range actions {
+		a, err := aj.action()
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, a)
+	}
+
+	return out, nil
+}
+
+// action creates an Action from its JSON representation.
+func (aj actionJSON) action() (Action, error) {
+	switch {
+	case aj.Type == "":
+		return RawAction(aj.Raw), nil
+	case aj.Type == instructionWriteActions:
+		actions, err := parseActionsJSON(aj.Actions)
+		if err != nil {
+			return nil, err
+		}
+
+		return WriteActions(actions...), nil
+	}
+
+	s := aj.Type
+	switch {
+	case aj.Args != nil:
+		s += "(" + strings.Join(aj.Args, ",") + ")"
+	case aj.Field != "":
+		s += ":" + aj.Value + "->" + aj.Field
+	case aj.Value != "":
+		s += ":" + aj.Value
+	}
+
+	a, err := parseAction(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid action %q: %v", s, err)
+	}
+
+	return a, nil
+}
+
+// RawMatch creates a Match whose textual form is s, which is passed to
+// Open vSwitch verbatim.  RawMatch is used when decoding JSON which
+// contains matches that this package cannot parse.
+func RawMatch(s string) Match {
+	return &rawMatch{
+		s: s,
+	}
+}
+
+var _ Match = &rawMatch{}
+
+// A rawMatch is a Match returned by RawMatch.
+type rawMatch struct {
+	s string
+}
+
+// MarshalText implements Match.
+func (m *rawMatch) MarshalText() ([]byte, error) {
+	return []byte(m.s), nil
+}
+
+// GoString implements Match.
+func (m *rawMatch) GoString() string {
+	return fmt.Sprintf("ovs.RawMatch(%q)", m.s)
+}
+
+// RawAction creates an Action whose textual form is s, which is passed to
+// Open vSwitch verbatim.  RawAction is used when decoding JSON which
+// contains actions that this package cannot parse.
+func RawAction(s string) Action {
+	return &rawAction{
+		s: s,
+	}
+}
+
+var _ Action = &rawAction{}
+
+// A rawAction is an Action returned by RawAction.
+type rawAction struct {
+	s string
+}
+
+// MarshalText implements Action.
+func (a *rawAction) MarshalText() ([]byte, error) {
+	return []byte(a.s), nil
+}
+
+// GoString implements Action.
+func (a *rawAction) GoString() string {
+	return fmt.Sprintf("ovs.RawAction(%q)", a.s)
+}
+
+// MarshalJSON implementations for each Match.
+
+// MarshalJSON implements json.Marshaler.
+func (m *dataLinkMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *dataLinkTypeMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *dataLinkVLANMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *networkMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *regMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *xregMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *xxregMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *conjunctionIDMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *networkProtocolMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *ipDSCPMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *networkTOSMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *networkECNMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *networkTTLMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *ipFragMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *ipv6Match) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *icmpTypeMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *icmpCodeMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *icmpv6TypeMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *icmpv6CodeMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *neighborDiscoveryTargetMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *neighborDiscoveryLinkLayerMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *arpHardwareAddressMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *arpProtocolAddressMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *arpOperationMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *transportPortMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *sctpPortMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *mplsMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *nshMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *vlanTCIMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *connectionTrackingMarkMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *connectionTrackingZoneMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *connectionTrackingMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *tcpFlagsMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *flagsMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *tunnelIDMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *metadataMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *packetMetadataMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *packetTypeMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implements json.Marshaler.
+func (m *rawMatch) MarshalJSON() ([]byte, error) { return marshalMatchJSON(m) }
+
+// MarshalJSON implementations for each Action.
+
+// MarshalJSON implements json.Marshaler.
+func (a *textAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *ctAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *modDataLinkAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *modNetworkAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *modTransportPortAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *modVLANVIDAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *setARPAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *setPacketMetadataAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *setQueueAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *mplsAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *setMPLSLabelAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *encapAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *decapAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *outputAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *conjunctionAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *resubmitAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *resubmitPortAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *loadSetFieldAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *moveAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *setTunnelAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *clearActionsInstruction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *writeActionsInstruction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *writeMetadataInstruction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *gotoTableInstruction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *stageAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
+
+// MarshalJSON implements json.Marshaler.
+func (a *rawAction) MarshalJSON() ([]byte, error) { return marshalActionJSON(a) }
@@ -0,0 +1,313 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// jsonMatches contains at least one of every Match.
+var jsonMatches = []Match{
+	DataLinkSource("de:ad:be:ef:de:ad"),
+	DataLinkDestination("de:ad:be:ef:00:00/ff:ff:ff:ff:00:00"),
+	DataLinkType(0x0800),
+	DataLinkVLAN(10),
+	NetworkSource("192.0.2.1"),
+	NetworkDestination("192.0.2.0/24"),
+	RegMatch(1, 0xa, 0xff),
+	XRegMatch(0, 0x1, 0xff),
+	XXRegMatch(1, Uint128{Lo: 0x1}, Uint128{Lo: 0xff}),
+	ConjunctionID(10),
+	NetworkProtocol(6),
+	IPv6Source("2001:db8::1"),
+	IPv6Destination("2001:db8::/32"),
+	IPDSCP(46),
+	NetworkTOS(184),
+	NetworkECN(1),
+	NetworkTTL(64),
+	IPFragment(IPFragNotLater),
+	ICMPType(3),
+	ICMPCode(1),
+	ICMPv6Type(135),
+	ICMPv6Code(0),
+	NeighborDiscoveryTarget("2001:db8::1"),
+	NeighborDiscoverySourceLinkLayer(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}),
+	NeighborDiscoveryTargetLinkLayer(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}),
+	ARPSourceHardwareAddress(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}),
+	ARPTargetHardwareAddress(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}),
+	ARPSourceProtocolAddress("192.0.2.1"),
+	ARPTargetProtocolAddress("192.0.2.0/24"),
+	ARPOperation(ARPOperationRequest),
+	TransportSourcePort(80),
+	TransportDestinationMaskedPort(0x1000, 0xf000),
+	SCTPSourcePort(3868),
+	MPLSLabel(100),
+	MPLSBottomOfStack(true),
+	NSHServicePathID(0x10),
+	NSHContext(1, 0x1, 0xff),
+	VLANTCI(0x1000, 0x1000),
+	ConnectionTrackingMark(0x1, 0xff),
+	ConnectionTrackingZone(10),
+	ConnectionTrackingStateBits(CTState{Set: CTStateTracked, Unset: CTStateNew}),
+	TCPFlagBits(TCPFlagState{Set: TCPFlagSYN, Unset: TCPFlagACK}),
+	TunnelID(10),
+	Metadata(0x1, 0xff),
+	PacketMark(0x1, 0xff),
+	SKBPriority(0x10001),
+	PacketType(PacketNamespaceEtherType, 0x0800),
+	RawMatch("ipv6_label=0x1"),
+}
+
+// jsonActions contains at least one of every Action.
+var jsonActions = []Action{
+	Drop(),
+	Normal(),
+	StripVLAN(),
+	ConnectionTracking("commit,table=2,exec(set_field:0x1->ct_mark)"),
+	ModDataLinkSource(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}),
+	ModNetworkDestination(net.IPv4(192, 0, 2, 1)),
+	ModTransportSourcePort(80),
+	ModVLANVID(10),
+	SetARPOperation(ARPOperationReply),
+	SetARPSourceHardwareAddress(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}),
+	SetPacketMark(0x1, 0xff),
+	SetQueue(2),
+	SetMetadata(0x1, 0),
+	PushMPLS(0x8847),
+	PopMPLS(0x0800),
+	SetMPLSLabel(100),
+	DecMPLSTTL(),
+	EncapNSH(1),
+	EncapEthernet(),
+	Encap("mpls"),
+	Decap(),
+	DecapPacketType(PacketNamespaceEtherType, 0x894f),
+	Output(1),
+	Conjunction(1, 1, 2),
+	Resubmit(0, 2),
+	Resubmit(1, 2),
+	ResubmitPort(1),
+	Load("0x1", "NXM_NX_REG0[0..15]"),
+	Move("reg0[0..15]", "reg1[0..15]"),
+	SetField("192.0.2.1", "nw_dst"),
+	SetTunnel(0xa),
+	ClearActions(),
+	WriteActions(Output(1), SetField("0x1", "reg0")),
+	WriteMetadata(0x1, 0xff),
+	GotoTable(3),
+	RawAction("dec_ttl"),
+}
+
+func TestFlowJSONRoundTrip(t *testing.T) {
+	want := &Flow{
+		Priority:    100,
+		Protocol:    ProtocolTCPv4,
+		InPort:      PortLOCAL,
+		Matches:     jsonMatches,
+		Table:       1,
+		IdleTimeout: 10,
+		Cookie:      0xffffffffffffffff,
+		// Drop must be the only action in a flow.
+		Actions: jsonActions[1:],
+	}
+
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("failed to marshal flow: %v", err)
+	}
+
+	got := new(Flow)
+	if err := json.Unmarshal(b, got); err != nil {
+		t.Fatalf("failed to unmarshal flow: %v", err)
+	}
+
+	wantText, err := want.MarshalText()
+	if err != nil {
+		t.Fatalf("failed to marshal flow text: %v", err)
+	}
+	gotText, err := got.MarshalText()
+	if err != nil {
+		t.Fatalf("failed to marshal flow text: %v", err)
+	}
+
+	if want, got := string(wantText), string(gotText); want != got {
+		t.Fatalf("unexpected flow:\n- want: %v\n-  got: %v", want, got)
+	}
+
+	// Re-encoding must produce identical JSON.
+	bb, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("failed to marshal flow: %v", err)
+	}
+	if want, got := string(b), string(bb); want != got {
+		t.Fatalf("unexpected JSON:\n- want: %v\n-  got: %v", want, got)
+	}
+}
+
+func TestMatchFlowJSONRoundTrip(t *testing.T) {
+	want := &MatchFlow{
+		Strict:     true,
+		Priority:   10,
+		Protocol:   ProtocolUDPv6,
+		InPort:     2,
+		Matches:    jsonMatches,
+		Table:      AnyTable,
+		Cookie:     0xdeadbeef,
+		CookieMask: 0xffffffff,
+	}
+
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("failed to marshal match flow: %v", err)
+	}
+
+	got := new(MatchFlow)
+	if err := json.Unmarshal(b, got); err != nil {
+		t.Fatalf("failed to unmarshal match flow: %v", err)
+	}
+
+	if want, got := want.Strict, got.Strict; want != got {
+		t.Fatalf("unexpected strict:\n- want: %v\n-  got: %v", want, got)
+	}
+
+	wantText, err := want.MarshalText()
+	if err != nil {
+		t.Fatalf("failed to marshal match flow text: %v", err)
+	}
+	gotText, err := got.MarshalText()
+	if err != nil {
+		t.Fatalf("failed to marshal match flow text: %v", err)
+	}
+
+	if want, got := string(wantText), string(gotText); want != got {
+		t.Fatalf("unexpected match flow:\n- want: %v\n-  got: %v", want, got)
+	}
+}
+
+func TestFlowJSONSchema(t *testing.T) {
+	f := &Flow{
+		Priority: 10,
+		Protocol: ProtocolIPv4,
+		Matches: []Match{
+			NetworkSource("192.0.2.0/24"),
+		},
+		Cookie: 0x10,
+		Actions: []Action{
+			Load("0x1", "NXM_NX_REG0[]"),
+			ConnectionTracking("commit,table=2"),
+			WriteActions(Output(1)),
+			RawAction("dec_ttl"),
+		},
+	}
+
+	b, err := json.Marshal(f)
+	if err != nil {
+		t.Fatalf("failed to marshal flow: %v", err)
+	}
+
+	want := `{"version":1,"priority":10,"protocol":"ip","table":0,"cookie":"0x10",` +
+		`"matches":[{"field":"nw_src","value":"192.0.2.0/24"}],` +
+		`"actions":[{"type":"load","value":"0x1","field":"NXM_NX_REG0[]"},` +
+		`{"type":"ct","args":["commit","table=2"]},` +
+		`{"type":"write_actions","actions":[{"type":"output","value":"1"}]},` +
+		`{"raw":"dec_ttl"}]}`
+
+	if got := string(b); want != got {
+		t.Fatalf("unexpected JSON:\n- want: %v\n-  got: %v", want, got)
+	}
+}
+
+func TestMatchActionJSON(t *testing.T) {
+	for _, m := range jsonMatches {
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("failed to marshal %#v: %v", m, err)
+		}
+
+		got, err := UnmarshalMatchJSON(b)
+		if err != nil {
+			t.Fatalf("failed to unmarshal %s: %v", string(b), err)
+		}
+
+		if !reflect.DeepEqual(m, got) {
+			t.Fatalf("unexpected match:\n- want: %#v\n-  got: %#v", m, got)
+		}
+	}
+
+	for _, a := range jsonActions {
+		b, err := json.Marshal(a)
+		if err != nil {
+			t.Fatalf("failed to marshal %#v: %v", a, err)
+		}
+
+		got, err := UnmarshalActionJSON(b)
+		if err != nil {
+			t.Fatalf("failed to unmarshal %s: %v", string(b), err)
+		}
+
+		if !actionsEqual([]Action{a}, []Action{got}) {
+			t.Fatalf("unexpected action:\n- want: %#v\n-  got: %#v", a, got)
+		}
+	}
+}
+
+func TestFlowJSONErrors(t *testing.T) {
+	var tests = []struct {
+		desc string
+		s    string
+		err  error
+	}{
+		{
+			desc: "version",
+			s:    `{"version":2,"priority":10,"actions":[{"type":"drop"}]}`,
+			err:  ErrJSONVersion,
+		},
+		{
+			desc: "cookie",
+			s:    `{"version":1,"cookie":"foo","actions":[{"type":"drop"}]}`,
+		},
+		{
+			desc: "match",
+			s:    `{"version":1,"matches":[{"field":"dl_type","value":"foo"}],"actions":[{"type":"drop"}]}`,
+		},
+		{
+			desc: "action",
+			s:    `{"version":1,"actions":[{"type":"output","value":"foo"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			err := json.Unmarshal([]byte(tt.s), new(Flow))
+			if err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error:\n- want: %v\n-  got: %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestStageActionJSONUnresolved(t *testing.T) {
+	if _, err := json.Marshal(ResubmitStage("foo")); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
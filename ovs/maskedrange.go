@@ -0,0 +1,287 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"errors"
+	"math/big"
+	"net"
+)
+
+var (
+	// ErrInvalidRange is returned when a range's start is greater than its
+	// end, or either value does not fit in the field being matched.
+	ErrInvalidRange = errors.New("invalid range")
+
+	// ErrFullRange is returned when a range contains every possible value
+	// of a field which cannot be matched with a zero mask.  The field
+	// should not be matched, so omit it from the Flow or omit the dimension
+	// from the ConjunctiveRule instead.
+	ErrFullRange = errors.New("range contains every value of field")
+)
+
+// A MaskedValue is a value and bitmask pair, which matches any value v for
+// which v&Mask == Value.
+type MaskedValue struct {
+	Value uint64
+	Mask  uint64
+}
+
+// MaskedRange returns the minimal set of MaskedValues which match every
+// value between start and end, inclusive, in a field which is bits wide.
+// bits must be between 1 and 64.
+func MaskedRange(start, end uint64, bits int) ([]MaskedValue, error) {
+	if bits < 1 || bits > 64 {
+		return nil, ErrInvalidRange
+	}
+
+	prefixes, err := maskedRange(
+		new(big.Int).SetUint64(start),
+		new(big.Int).SetUint64(end),
+		bits,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]MaskedValue, 0, len(prefixes))
+	for _, p := range prefixes {
+		out = append(out, MaskedValue{
+			Value: p.value.Uint64(),
+			Mask:  prefixMask(p.ones, bits).Uint64(),
+		})
+	}
+
+	return out, nil
+}
+
+// A maskedPrefix is a value whose most significant ones bits are matched.
+type maskedPrefix struct {
+	value *big.Int
+	ones  int
+}
+
+// maskedRange is the common implementation of all masked range
+// decompositions.  It greedily selects the largest aligned block which begins
+// at start and does not extend past end, until the range is covered.
+func maskedRange(start, end *big.Int, bits int) ([]maskedPrefix, error) {
+	max := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	max.Sub(max, big.NewInt(1))
+
+	if start.Sign() < 0 || start.Cmp(end) > 0 || end.Cmp(max) > 0 {
+		return nil, ErrInvalidRange
+	}
+
+	var (
+		out   []maskedPrefix
+		cur   = new(big.Int).Set(start)
+		one   = big.NewInt(1)
+		block = new(big.Int)
+		last  = new(big.Int)
+	)
+
+	for {
+		// Grow the block while cur remains aligned to its size and the
+		// block does not pass end.
+		size := 0
+		for size < bits && cur.Bit(size) == 0 {
+			block.Lsh(one, uint(size+1))
+			last.Add(cur, block)
+			last.Sub(last, one)
+			if last.Cmp(end) > 0 {
+				break
+			}
+			size++
+		}
+
+		out = append(out, maskedPrefix{
+			value: new(big.Int).Set(cur),
+			ones:  bits - size,
+		})
+
+		block.Lsh(one, uint(size))
+		cur.Add(cur, block)
+		if cur.Cmp(end) > 0 {
+			return out, nil
+		}
+	}
+}
+
+// prefixMask returns a mask with the most significant ones bits of a bits
+// wide field set.
+func prefixMask(ones, bits int) *big.Int {
+	m := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	m.Sub(m, new(big.Int).Lsh(big.NewInt(1), uint(bits-ones)))
+	return m
+}
+
+// IPRange returns the minimal set of CIDR blocks which contain every address
+// between start and end, inclusive.  start and end must both be IPv4
+// addresses or both be IPv6 addresses.
+func IPRange(start, end net.IP) ([]*net.IPNet, error) {
+	s, e, bits := start.To4(), end.To4(), 32
+	if s == nil || e == nil {
+		if start.To4() != nil || end.To4() != nil {
+			return nil, ErrInvalidRange
+		}
+
+		s, e, bits = start.To16(), end.To16(), 128
+		if s == nil || e == nil {
+			return nil, ErrInvalidRange
+		}
+	}
+
+	prefixes, err := maskedRange(
+		new(big.Int).SetBytes(s),
+		new(big.Int).SetBytes(e),
+		bits,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*net.IPNet, 0, len(prefixes))
+	for _, p := range prefixes {
+		ip := make(net.IP, bits/8)
+		p.value.FillBytes(ip)
+
+		out = append(out, &net.IPNet{
+			IP:   ip,
+			Mask: net.CIDRMask(p.ones, bits),
+		})
+	}
+
+	return out, nil
+}
+
+// ipRangeMatches applies fn to each CIDR block produced by IPRange.
+func ipRangeMatches(start, end net.IP, ipv6 bool, fn func(ip string) Match) ([]Match, error) {
+	if (start.To4() == nil) != ipv6 || (end.To4() == nil) != ipv6 {
+		return nil, ErrInvalidRange
+	}
+
+	nets, err := IPRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Match, 0, len(nets))
+	for _, n := range nets {
+		out = append(out, fn(n.String()))
+	}
+
+	return out, nil
+}
+
+// NetworkSourceRange returns Matches which together match packets with a
+// source IPv4 address between start and end, inclusive.
+func NetworkSourceRange(start, end net.IP) ([]Match, error) {
+	return ipRangeMatches(start, end, false, NetworkSource)
+}
+
+// NetworkDestinationRange returns Matches which together match packets with
+// a destination IPv4 address between start and end, inclusive.
+func NetworkDestinationRange(start, end net.IP) ([]Match, error) {
+	return ipRangeMatches(start, end, false, NetworkDestination)
+}
+
+// IPv6SourceRange returns Matches which together match packets with a
+// source IPv6 address between start and end, inclusive.
+func IPv6SourceRange(start, end net.IP) ([]Match, error) {
+	return ipRangeMatches(start, end, true, IPv6Source)
+}
+
+// IPv6DestinationRange returns Matches which together match packets with a
+// destination IPv6 address between start and end, inclusive.
+func IPv6DestinationRange(start, end net.IP) ([]Match, error) {
+	return ipRangeMatches(start, end, true, IPv6Destination)
+}
+
+// RegRange returns Matches which together match packets with the value of
+// register n between start and end, inclusive.  If the range contains every
+// possible value, ErrFullRange is returned, because the register need not be
+// matched.
+func RegRange(n int, start, end uint32) ([]Match, error) {
+	mvs, err := MaskedRange(uint64(start), uint64(end), 32)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(mvs) == 1 && mvs[0].Mask == 0 {
+		return nil, ErrFullRange
+	}
+
+	out := make([]Match, 0, len(mvs))
+	for _, mv := range mvs {
+		out = append(out, RegMatch(n, uint32(mv.Value), uint32(mv.Mask)))
+	}
+
+	return out, nil
+}
+
+// ConnectionTrackingMarkRange returns Matches which together match packets
+// with a connection tracking mark between start and end, inclusive.  If the
+// range contains every possible value, ErrFullRange is returned, because the
+// mark need not be matched.
+func ConnectionTrackingMarkRange(start, end uint32) ([]Match, error) {
+	mvs, err := MaskedRange(uint64(start), uint64(end), 32)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(mvs) == 1 && mvs[0].Mask == 0 {
+		return nil, ErrFullRange
+	}
+
+	out := make([]Match, 0, len(mvs))
+	for _, mv := range mvs {
+		out = append(out, ConnectionTrackingMark(uint32(mv.Value), uint32(mv.Mask)))
+	}
+
+	return out, nil
+}
+
+const (
+	// vlanCFI is the bit of a VLAN TCI which Open vSwitch uses to indicate
+	// that a VLAN tag is present.
+	vlanCFI = 0x1000
+
+	// vlanVIDMask is the bits of a VLAN TCI which contain the VLAN ID.
+	vlanVIDMask = 0x0fff
+)
+
+// DataLinkVLANRange returns Matches which together match packets with a
+// VLAN tag whose VLAN ID is between start and end, inclusive.  Packets with
+// no VLAN tag are never matched.
+func DataLinkVLANRange(start, end int) ([]Match, error) {
+	if !validVLANVID(start) || !validVLANVID(end) {
+		return nil, ErrInvalidRange
+	}
+
+	mvs, err := MaskedRange(uint64(start), uint64(end), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Match, 0, len(mvs))
+	for _, mv := range mvs {
+		out = append(out, VLANTCI(
+			vlanCFI|uint16(mv.Value),
+			vlanCFI|uint16(mv.Mask&vlanVIDMask),
+		))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,281 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"math"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestMaskedRange(t *testing.T) {
+	var tests = []struct {
+		desc       string
+		start, end uint64
+		bits       int
+		mvs        []MaskedValue
+		err        error
+	}{
+		{
+			desc:  "start after end",
+			start: 10,
+			end:   1,
+			bits:  32,
+			err:   ErrInvalidRange,
+		},
+		{
+			desc: "end too large",
+			end:  0x1000,
+			bits: 12,
+			err:  ErrInvalidRange,
+		},
+		{
+			desc: "invalid width",
+			bits: 65,
+			err:  ErrInvalidRange,
+		},
+		{
+			desc:  "single value",
+			start: 7,
+			end:   7,
+			bits:  8,
+			mvs:   []MaskedValue{{Value: 7, Mask: 0xff}},
+		},
+		{
+			desc:  "unaligned",
+			start: 1,
+			end:   6,
+			bits:  8,
+			mvs: []MaskedValue{
+				{Value: 1, Mask: 0xff},
+				{Value: 2, Mask: 0xfe},
+				{Value: 4, Mask: 0xfe},
+				{Value: 6, Mask: 0xff},
+			},
+		},
+		{
+			desc:  "full 64-bit range",
+			start: 0,
+			end:   math.MaxUint64,
+			bits:  64,
+			mvs:   []MaskedValue{{Value: 0, Mask: 0}},
+		},
+		{
+			desc:  "upper half of 64-bit range",
+			start: 1 << 63,
+			end:   math.MaxUint64,
+			bits:  64,
+			mvs:   []MaskedValue{{Value: 1 << 63, Mask: 1 << 63}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			mvs, err := MaskedRange(tt.start, tt.end, tt.bits)
+			if want, got := tt.err, err; want != got {
+				t.Fatalf("unexpected error:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+
+			if want, got := tt.mvs, mvs; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected MaskedValues:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+		})
+	}
+}
+
+func TestIPRange(t *testing.T) {
+	var tests = []struct {
+		desc       string
+		start, end string
+		nets       []string
+		err        error
+	}{
+		{
+			desc:  "mixed families",
+			start: "192.0.2.1",
+			end:   "2001:db8::1",
+			err:   ErrInvalidRange,
+		},
+		{
+			desc:  "start after end",
+			start: "192.0.2.10",
+			end:   "192.0.2.1",
+			err:   ErrInvalidRange,
+		},
+		{
+			desc:  "IPv4 aligned",
+			start: "10.0.0.0",
+			end:   "10.0.255.255",
+			nets:  []string{"10.0.0.0/16"},
+		},
+		{
+			desc:  "IPv4 unaligned",
+			start: "192.0.2.1",
+			end:   "192.0.2.10",
+			nets: []string{
+				"192.0.2.1/32",
+				"192.0.2.2/31",
+				"192.0.2.4/30",
+				"192.0.2.8/31",
+				"192.0.2.10/32",
+			},
+		},
+		{
+			desc:  "IPv4 everything",
+			start: "0.0.0.0",
+			end:   "255.255.255.255",
+			nets:  []string{"0.0.0.0/0"},
+		},
+		{
+			desc:  "IPv6 unaligned",
+			start: "2001:db8::ffff",
+			end:   "2001:db8::1:1",
+			nets: []string{
+				"2001:db8::ffff/128",
+				"2001:db8::1:0/127",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			nets, err := IPRange(net.ParseIP(tt.start), net.ParseIP(tt.end))
+			if want, got := tt.err, err; want != got {
+				t.Fatalf("unexpected error:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+
+			var got []string
+			for _, n := range nets {
+				got = append(got, n.String())
+			}
+
+			if want := tt.nets; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected CIDR blocks:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+		})
+	}
+}
+
+func TestRangeMatches(t *testing.T) {
+	var tests = []struct {
+		desc string
+		fn   func() ([]Match, error)
+		out  []string
+		err  error
+	}{
+		{
+			desc: "network source",
+			fn: func() ([]Match, error) {
+				return NetworkSourceRange(net.ParseIP("192.0.2.6"), net.ParseIP("192.0.2.9"))
+			},
+			out: []string{"nw_src=192.0.2.6/31", "nw_src=192.0.2.8/31"},
+		},
+		{
+			desc: "network destination with IPv6 address",
+			fn: func() ([]Match, error) {
+				return NetworkDestinationRange(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"))
+			},
+			err: ErrInvalidRange,
+		},
+		{
+			desc: "IPv6 destination",
+			fn: func() ([]Match, error) {
+				return IPv6DestinationRange(net.ParseIP("2001:db8::"), net.ParseIP("2001:db8::3"))
+			},
+			out: []string{"ipv6_dst=2001:db8::/126"},
+		},
+		{
+			desc: "register",
+			fn: func() ([]Match, error) {
+				return RegRange(3, 0x10, 0x2f)
+			},
+			out: []string{"reg3=0x10/0xfffffff0", "reg3=0x20/0xfffffff0"},
+		},
+		{
+			desc: "register full range",
+			fn: func() ([]Match, error) {
+				return RegRange(3, 0, math.MaxUint32)
+			},
+			err: ErrFullRange,
+		},
+		{
+			desc: "connection tracking mark full range",
+			fn: func() ([]Match, error) {
+				return ConnectionTrackingMarkRange(0, math.MaxUint32)
+			},
+			err: ErrFullRange,
+		},
+		{
+			desc: "connection tracking mark",
+			fn: func() ([]Match, error) {
+				return ConnectionTrackingMarkRange(1, 3)
+			},
+			out: []string{"ct_mark=0x00000001/0xffffffff", "ct_mark=0x00000002/0xfffffffe"},
+		},
+		{
+			desc: "VLAN",
+			fn: func() ([]Match, error) {
+				return DataLinkVLANRange(100, 103)
+			},
+			out: []string{"vlan_tci=0x1064/0x1ffc"},
+		},
+		{
+			desc: "VLAN all tagged",
+			fn: func() ([]Match, error) {
+				return DataLinkVLANRange(0, 4095)
+			},
+			out: []string{"vlan_tci=0x1000/0x1000"},
+		},
+		{
+			desc: "VLAN out of range",
+			fn: func() ([]Match, error) {
+				return DataLinkVLANRange(1, 4096)
+			},
+			err: ErrInvalidRange,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			ms, err := tt.fn()
+			if want, got := tt.err, err; want != got {
+				t.Fatalf("unexpected error:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+			if err != nil {
+				return
+			}
+
+			out := make([]string, 0, len(ms))
+			for _, m := range ms {
+				b, err := m.MarshalText()
+				if err != nil {
+					t.Fatalf("failed to marshal match: %v", err)
+				}
+				out = append(out, string(b))
+			}
+
+			if want, got := tt.out, out; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected matches:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+		})
+	}
+}
@@ -35,32 +35,49 @@ const (
 
 // Constants of full Match names.
 const (
-	arpSHA   = "arp_sha"
-	arpSPA   = "arp_spa"
-	arpTHA   = "arp_tha"
-	arpTPA   = "arp_tpa"
-	conjID   = "conj_id"
-	ctMark   = "ct_mark"
-	ctState  = "ct_state"
-	ctZone   = "ct_zone"
-	dlSRC    = "dl_src"
-	dlDST    = "dl_dst"
-	dlType   = "dl_type"
-	dlVLAN   = "dl_vlan"
-	icmpType = "icmp_type"
-	ipv6DST  = "ipv6_dst"
-	ipv6SRC  = "ipv6_src"
-	ndSLL    = "nd_sll"
-	ndTLL    = "nd_tll"
-	ndTarget = "nd_target"
-	nwDST    = "nw_dst"
-	nwProto  = "nw_proto"
-	nwSRC    = "nw_src"
-	tcpFlags = "tcp_flags"
-	tpDST    = "tp_dst"
-	tpSRC    = "tp_src"
-	tunID    = "tun_id"
-	vlanTCI  = "vlan_tci"
+	arpOp       = "arp_op"
+	arpSHA      = "arp_sha"
+	arpSPA      = "arp_spa"
+	arpTHA      = "arp_tha"
+	arpTPA      = "arp_tpa"
+	conjID      = "conj_id"
+	ctMark      = "ct_mark"
+	ctState     = "ct_state"
+	ctZone      = "ct_zone"
+	dlSRC       = "dl_src"
+	dlDST       = "dl_dst"
+	dlType      = "dl_type"
+	dlVLAN      = "dl_vlan"
+	icmpCode    = "icmp_code"
+	icmpType    = "icmp_type"
+	icmpv6Code  = "icmpv6_code"
+	icmpv6Type  = "icmpv6_type"
+	ipDSCP      = "ip_dscp"
+	ipECN       = "ip_ecn"
+	ipFrag      = "ip_frag"
+	ipv6DST     = "ipv6_dst"
+	ipv6SRC     = "ipv6_src"
+	metadata    = "metadata"
+	ndSLL       = "nd_sll"
+	ndTLL       = "nd_tll"
+	ndTarget    = "nd_target"
+	nwDST       = "nw_dst"
+	nwECN       = "nw_ecn"
+	nwFrag      = "nw_frag"
+	nwProto     = "nw_proto"
+	nwSRC       = "nw_src"
+	nwTOS       = "nw_tos"
+	nwTTL       = "nw_ttl"
+	packetType  = "packet_type"
+	pktMark     = "pkt_mark"
+	sctpDST     = "sctp_dst"
+	sctpSRC     = "sctp_src"
+	skbPriority = "skb_priority"
+	tcpFlags    = "tcp_flags"
+	tpDST       = "tp_dst"
+	tpSRC       = "tp_src"
+	tunID       = "tun_id"
+	vlanTCI     = "vlan_tci"
 )
 
 // A Match is a type which can be marshaled into an OpenFlow packet matching
@@ -279,7 +296,7 @@ func (m *regMatch) MarshalText() ([]byte, error) {
 
 // GoString implements Match.
 func (m *regMatch) GoString() string {
-	return fmt.Sprintf("ovs.RegMatch(%q, %q, %q)", m.n, m.val, m.mask)
+	return fmt.Sprintf("ovs.RegMatch(%d, %#x, %#x)", m.n, m.val, m.mask)
 }
 
 // ConjunctionID matches flows that have matched all dimension of a conjunction
@@ -332,6 +349,183 @@ func (m *networkProtocolMatch) GoString() string {
 	return fmt.Sprintf("ovs.NetworkProtocol(%d)", m.num)
 }
 
+// Limits of IP header fields which are narrower than their types.
+const (
+	maxDSCP = 63
+	maxECN  = 3
+)
+
+// IPDSCP matches IPv4 or IPv6 packets with the specified Differentiated
+// Services Code Point, the upper 6 bits of the IPv4 ToS or IPv6 traffic
+// class field.  dscp must be between 0 and 63.
+func IPDSCP(dscp uint8) Match {
+	return &ipDSCPMatch{
+		dscp: dscp,
+	}
+}
+
+var _ Match = &ipDSCPMatch{}
+
+// An ipDSCPMatch is a Match returned by IPDSCP.
+type ipDSCPMatch struct {
+	dscp uint8
+}
+
+// MarshalText implements Match.
+func (m *ipDSCPMatch) MarshalText() ([]byte, error) {
+	if m.dscp > maxDSCP {
+		return nil, fmt.Errorf("DSCP must be between 0 and %d, but got %d", maxDSCP, m.dscp)
+	}
+
+	return bprintf("%s=%d", ipDSCP, m.dscp), nil
+}
+
+// GoString implements Match.
+func (m *ipDSCPMatch) GoString() string {
+	return fmt.Sprintf("ovs.IPDSCP(%d)", m.dscp)
+}
+
+// NetworkTOS matches IPv4 or IPv6 packets with the specified type of service
+// byte, in which the DSCP is shifted left by 2 bits.  The 2 least significant
+// bits of tos, which hold the ECN, must be zero; use NetworkECN to match them.
+func NetworkTOS(tos uint8) Match {
+	return &networkTOSMatch{
+		tos: tos,
+	}
+}
+
+var _ Match = &networkTOSMatch{}
+
+// A networkTOSMatch is a Match returned by NetworkTOS.
+type networkTOSMatch struct {
+	tos uint8
+}
+
+// MarshalText implements Match.
+func (m *networkTOSMatch) MarshalText() ([]byte, error) {
+	if m.tos&maxECN != 0 {
+		return nil, fmt.Errorf("ECN bits of ToS %d must be zero", m.tos)
+	}
+
+	return bprintf("%s=%d", nwTOS, m.tos), nil
+}
+
+// GoString implements Match.
+func (m *networkTOSMatch) GoString() string {
+	return fmt.Sprintf("ovs.NetworkTOS(%d)", m.tos)
+}
+
+// NetworkECN matches IPv4 or IPv6 packets with the specified Explicit
+// Congestion Notification bits.  ecn must be between 0 and 3.
+func NetworkECN(ecn uint8) Match {
+	return &networkECNMatch{
+		ecn: ecn,
+	}
+}
+
+var _ Match = &networkECNMatch{}
+
+// A networkECNMatch is a Match returned by NetworkECN.
+type networkECNMatch struct {
+	ecn uint8
+}
+
+// MarshalText implements Match.
+func (m *networkECNMatch) MarshalText() ([]byte, error) {
+	if m.ecn > maxECN {
+		return nil, fmt.Errorf("ECN must be between 0 and %d, but got %d", maxECN, m.ecn)
+	}
+
+	return bprintf("%s=%d", nwECN, m.ecn), nil
+}
+
+// GoString implements Match.
+func (m *networkECNMatch) GoString() string {
+	return fmt.Sprintf("ovs.NetworkECN(%d)", m.ecn)
+}
+
+// NetworkTTL matches IPv4 or IPv6 packets with the specified time to live
+// or hop limit.
+func NetworkTTL(ttl uint8) Match {
+	return &networkTTLMatch{
+		ttl: ttl,
+	}
+}
+
+var _ Match = &networkTTLMatch{}
+
+// A networkTTLMatch is a Match returned by NetworkTTL.
+type networkTTLMatch struct {
+	ttl uint8
+}
+
+// MarshalText implements Match.
+func (m *networkTTLMatch) MarshalText() ([]byte, error) {
+	return bprintf("%s=%d", nwTTL, m.ttl), nil
+}
+
+// GoString implements Match.
+func (m *networkTTLMatch) GoString() string {
+	return fmt.Sprintf("ovs.NetworkTTL(%d)", m.ttl)
+}
+
+// An IPFrag is an IP fragmentation state, which can be used with the
+// IPFragment function.
+type IPFrag string
+
+// IPFrag constants accepted by Open vSwitch.  Reference the ovs-fields
+// man-page for a description of each one.
+const (
+	IPFragNo       IPFrag = "no"
+	IPFragYes      IPFrag = "yes"
+	IPFragFirst    IPFrag = "first"
+	IPFragLater    IPFrag = "later"
+	IPFragNotLater IPFrag = "not_later"
+)
+
+// ipFragGoStrings maps each valid IPFrag to its Go syntax.
+var ipFragGoStrings = map[IPFrag]string{
+	IPFragNo:       "ovs.IPFragNo",
+	IPFragYes:      "ovs.IPFragYes",
+	IPFragFirst:    "ovs.IPFragFirst",
+	IPFragLater:    "ovs.IPFragLater",
+	IPFragNotLater: "ovs.IPFragNotLater",
+}
+
+// IPFragment matches IPv4 or IPv6 packets in the specified fragmentation
+// state.  For example, IPFragNotLater matches unfragmented packets and the
+// first fragment of fragmented packets, which carry the transport header.
+func IPFragment(frag IPFrag) Match {
+	return &ipFragMatch{
+		frag: frag,
+	}
+}
+
+var _ Match = &ipFragMatch{}
+
+// An ipFragMatch is a Match returned by IPFragment.
+type ipFragMatch struct {
+	frag IPFrag
+}
+
+// MarshalText implements Match.
+func (m *ipFragMatch) MarshalText() ([]byte, error) {
+	if _, ok := ipFragGoStrings[m.frag]; !ok {
+		return nil, fmt.Errorf("invalid IP fragmentation state: %q", m.frag)
+	}
+
+	return bprintf("%s=%s", ipFrag, m.frag), nil
+}
+
+// GoString implements Match.
+func (m *ipFragMatch) GoString() string {
+	if s, ok := ipFragGoStrings[m.frag]; ok {
+		return fmt.Sprintf("ovs.IPFragment(%s)", s)
+	}
+
+	return fmt.Sprintf("ovs.IPFragment(%q)", m.frag)
+}
+
 // IPv6Source matches packets with a source IPv6 address or IPv6 CIDR
 // block matching ip.
 func IPv6Source(ip string) Match {
@@ -396,6 +590,82 @@ func (m *icmpTypeMatch) GoString() string {
 	return fmt.Sprintf("ovs.ICMPType(%d)", m.typ)
 }
 
+// ICMPCode matches packets with the specified ICMP code matching code.
+func ICMPCode(code uint8) Match {
+	return &icmpCodeMatch{
+		code: code,
+	}
+}
+
+var _ Match = &icmpCodeMatch{}
+
+// An icmpCodeMatch is a Match returned by ICMPCode.
+type icmpCodeMatch struct {
+	code uint8
+}
+
+// MarshalText implements Match.
+func (m *icmpCodeMatch) MarshalText() ([]byte, error) {
+	return bprintf("%s=%d", icmpCode, m.code), nil
+}
+
+// GoString implements Match.
+func (m *icmpCodeMatch) GoString() string {
+	return fmt.Sprintf("ovs.ICMPCode(%d)", m.code)
+}
+
+// ICMPv6Type matches packets with the specified ICMPv6 type matching typ.
+// Open vSwitch dumps ICMPv6 types as icmp_type, which is parsed as an
+// ICMPType match.
+func ICMPv6Type(typ uint8) Match {
+	return &icmpv6TypeMatch{
+		typ: typ,
+	}
+}
+
+var _ Match = &icmpv6TypeMatch{}
+
+// An icmpv6TypeMatch is a Match returned by ICMPv6Type.
+type icmpv6TypeMatch struct {
+	typ uint8
+}
+
+// MarshalText implements Match.
+func (m *icmpv6TypeMatch) MarshalText() ([]byte, error) {
+	return bprintf("%s=%d", icmpv6Type, m.typ), nil
+}
+
+// GoString implements Match.
+func (m *icmpv6TypeMatch) GoString() string {
+	return fmt.Sprintf("ovs.ICMPv6Type(%d)", m.typ)
+}
+
+// ICMPv6Code matches packets with the specified ICMPv6 code matching code.
+// Open vSwitch dumps ICMPv6 codes as icmp_code, which is parsed as an
+// ICMPCode match.
+func ICMPv6Code(code uint8) Match {
+	return &icmpv6CodeMatch{
+		code: code,
+	}
+}
+
+var _ Match = &icmpv6CodeMatch{}
+
+// An icmpv6CodeMatch is a Match returned by ICMPv6Code.
+type icmpv6CodeMatch struct {
+	code uint8
+}
+
+// MarshalText implements Match.
+func (m *icmpv6CodeMatch) MarshalText() ([]byte, error) {
+	return bprintf("%s=%d", icmpv6Code, m.code), nil
+}
+
+// GoString implements Match.
+func (m *icmpv6CodeMatch) GoString() string {
+	return fmt.Sprintf("ovs.ICMPv6Code(%d)", m.code)
+}
+
 // NeighborDiscoveryTarget matches packets with an IPv6 neighbor discovery target
 // IPv6 address or IPv6 CIDR block matching ip.
 func NeighborDiscoveryTarget(ip string) Match {
@@ -557,6 +827,50 @@ func (m *arpProtocolAddressMatch) GoString() string {
 	return fmt.Sprintf("ovs.ARPTargetProtocolAddress(%q)", m.ip)
 }
 
+// ARP operation codes which can be used with ARPOperation and
+// SetARPOperation.
+const (
+	ARPOperationRequest uint16 = 1
+	ARPOperationReply   uint16 = 2
+)
+
+// ARPOperation matches ARP or RARP packets with the specified operation
+// code, such as ARPOperationRequest.  Only the lower 8 bits of op are
+// matched by Open vSwitch, so op must be less than 256.
+func ARPOperation(op uint16) Match {
+	return &arpOperationMatch{
+		op: op,
+	}
+}
+
+var _ Match = &arpOperationMatch{}
+
+// An arpOperationMatch is a Match returned by ARPOperation.
+type arpOperationMatch struct {
+	op uint16
+}
+
+// MarshalText implements Match.
+func (m *arpOperationMatch) MarshalText() ([]byte, error) {
+	if m.op > maxARPOperation {
+		return nil, errInvalidARPOperation
+	}
+
+	return bprintf("%s=%d", arpOp, m.op), nil
+}
+
+// GoString implements Match.
+func (m *arpOperationMatch) GoString() string {
+	switch m.op {
+	case ARPOperationRequest:
+		return "ovs.ARPOperation(ovs.ARPOperationRequest)"
+	case ARPOperationReply:
+		return "ovs.ARPOperation(ovs.ARPOperationReply)"
+	}
+
+	return fmt.Sprintf("ovs.ARPOperation(%d)", m.op)
+}
+
 // TransportSourcePort matches packets with a transport layer (TCP/UDP) source
 // port matching port.
 func TransportSourcePort(port uint16) Match {
@@ -684,6 +998,78 @@ func (m *transportPortMatch) GoString() string {
 	return fmt.Sprintf("ovs.TransportDestinationPort(%d)", m.port)
 }
 
+// SCTPSourcePort matches SCTP packets with a source port matching port.
+func SCTPSourcePort(port uint16) Match {
+	return &sctpPortMatch{
+		srcdst: source,
+		port:   port,
+	}
+}
+
+// SCTPDestinationPort matches SCTP packets with a destination port matching
+// port.
+func SCTPDestinationPort(port uint16) Match {
+	return &sctpPortMatch{
+		srcdst: destination,
+		port:   port,
+	}
+}
+
+// SCTPSourceMaskedPort matches SCTP packets with a source port matching a
+// masked port range.
+func SCTPSourceMaskedPort(port, mask uint16) Match {
+	return &sctpPortMatch{
+		srcdst: source,
+		port:   port,
+		mask:   mask,
+	}
+}
+
+// SCTPDestinationMaskedPort matches SCTP packets with a destination port
+// matching a masked port range.
+func SCTPDestinationMaskedPort(port, mask uint16) Match {
+	return &sctpPortMatch{
+		srcdst: destination,
+		port:   port,
+		mask:   mask,
+	}
+}
+
+var _ Match = &sctpPortMatch{}
+
+// An sctpPortMatch is a Match returned by SCTP{Source,Destination}Port.
+type sctpPortMatch struct {
+	srcdst string
+	port   uint16
+	mask   uint16
+}
+
+// MarshalText implements Match.
+func (m *sctpPortMatch) MarshalText() ([]byte, error) {
+	if m.mask == 0 {
+		return bprintf("sctp_%s=%d", m.srcdst, m.port), nil
+	}
+
+	return bprintf("sctp_%s=0x%04x/0x%04x", m.srcdst, m.port, m.mask), nil
+}
+
+// GoString implements Match.
+func (m *sctpPortMatch) GoString() string {
+	if m.mask > 0 {
+		if m.srcdst == source {
+			return fmt.Sprintf("ovs.SCTPSourceMaskedPort(%#x, %#x)", m.port, m.mask)
+		}
+
+		return fmt.Sprintf("ovs.SCTPDestinationMaskedPort(%#x, %#x)", m.port, m.mask)
+	}
+
+	if m.srcdst == source {
+		return fmt.Sprintf("ovs.SCTPSourcePort(%d)", m.port)
+	}
+
+	return fmt.Sprintf("ovs.SCTPDestinationPort(%d)", m.port)
+}
+
 // A vlanTCIMatch is a Match returned by VLANTCI.
 type vlanTCIMatch struct {
 	tci  uint16
@@ -766,6 +1152,13 @@ func (m *connectionTrackingZoneMatch) GoString() string {
 // ConnectionTrackingState matches packets using their connection state, when
 // connection tracking is enabled on the host.  Use the SetState and UnsetState
 // functions to populate the parameter list for this function.
+//
+// Flows parsed by Flow.UnmarshalText, and so returned by Client.OpenFlow.DumpFlows,
+// never contain this Match: ct_state is parsed as a ConnectionTrackingStateBits
+// Match, which marshals set flags before unset flags in bit order.  For
+// example, "+trk-est+new" is returned as "+new+trk-est".
+//
+// Deprecated: Use ConnectionTrackingStateBits with a CTState instead.
 func ConnectionTrackingState(state ...string) Match {
 	return &connectionTrackingMatch{
 		state: state,
@@ -798,36 +1191,32 @@ func (m *connectionTrackingMatch) GoString() string {
 	return fmt.Sprintf("ovs.ConnectionTrackingState(%s)", buf.String())
 }
 
-// CTState is a connection tracking state, which can be used with the
-// ConnectionTrackingState function.
-type CTState string
-
-// List of common CTState constants available in OVS 2.5.  Reference the
-// ovs-ofctl man-page for a description of each one.
-const (
-	CTStateNew         CTState = "new"
-	CTStateEstablished CTState = "est"
-	CTStateRelated     CTState = "rel"
-	CTStateReply       CTState = "rpl"
-	CTStateInvalid     CTState = "inv"
-	CTStateTracked     CTState = "trk"
-)
-
-// SetState sets the specified CTState flag.  This helper should be used
+// SetState sets the specified CTStateFlag flags.  This helper should be used
 // with ConnectionTrackingState.
-func SetState(state CTState) string {
-	return fmt.Sprintf("+%s", state)
+//
+// Deprecated: Use CTState{Set: state} with ConnectionTrackingStateBits instead.
+func SetState(state CTStateFlag) string {
+	return CTState{Set: state}.String()
 }
 
-// UnsetState unsets the specified CTState flag.  This helper should be used
-// with ConnectionTrackingState.
-func UnsetState(state CTState) string {
-	return fmt.Sprintf("-%s", state)
+// UnsetState unsets the specified CTStateFlag flags.  This helper should be
+// used with ConnectionTrackingState.
+//
+// Deprecated: Use CTState{Unset: state} with ConnectionTrackingStateBits instead.
+func UnsetState(state CTStateFlag) string {
+	return CTState{Unset: state}.String()
 }
 
 // TCPFlags matches packets using their enabled TCP flags, when matching TCP
 // flags on a TCP segment.   Use the SetTCPFlag and UnsetTCPFlag functions to
 // populate the parameter list for this function.
+//
+// Flows parsed by Flow.UnmarshalText, and so returned by Client.OpenFlow.DumpFlows,
+// never contain this Match: tcp_flags is parsed as a TCPFlagBits Match, which
+// marshals set flags before unset flags in bit order.  For example,
+// "+syn-psh+ack" is returned as "+syn+ack-psh".
+//
+// Deprecated: Use TCPFlagBits with a TCPFlagState instead.
 func TCPFlags(flags ...string) Match {
 	return &tcpFlagsMatch{
 		flags: flags,
@@ -860,30 +1249,20 @@ func (m *tcpFlagsMatch) GoString() string {
 	return fmt.Sprintf("ovs.TCPFlags(%s)", buf.String())
 }
 
-// TCPFlag represents a flag in the TCP header, which can be used with the
-// TCPFlags function.
-type TCPFlag string
-
-// RFC 793 TCP Flags
-const (
-	TCPFlagURG TCPFlag = "urg"
-	TCPFlagACK TCPFlag = "ack"
-	TCPFlagPSH TCPFlag = "psh"
-	TCPFlagRST TCPFlag = "rst"
-	TCPFlagSYN TCPFlag = "syn"
-	TCPFlagFIN TCPFlag = "fin"
-)
-
-// SetTCPFlag sets the specified TCPFlag.  This helper should be used
+// SetTCPFlag sets the specified TCPFlag flags.  This helper should be used
 // with TCPFlags.
+//
+// Deprecated: Use TCPFlagState{Set: flag} with TCPFlagBits instead.
 func SetTCPFlag(flag TCPFlag) string {
-	return fmt.Sprintf("+%s", flag)
+	return TCPFlagState{Set: flag}.String()
 }
 
-// UnsetTCPFlag unsets the specified TCPFlag.  This helper should be used
-// with TCPFlags.
+// UnsetTCPFlag unsets the specified TCPFlag flags.  This helper should be
+// used with TCPFlags.
+//
+// Deprecated: Use TCPFlagState{Unset: flag} with TCPFlagBits instead.
 func UnsetTCPFlag(flag TCPFlag) string {
-	return fmt.Sprintf("-%s", flag)
+	return TCPFlagState{Unset: flag}.String()
 }
 
 // TunnelID returns a Match that matches the given ID exactly.
@@ -928,6 +1307,136 @@ func (m *tunnelIDMatch) MarshalText() ([]byte, error) {
 	return bprintf("%s=%#x/%#x", tunID, m.id, m.mask), nil
 }
 
+// Metadata matches packets with the specified OpenFlow metadata value,
+// using an optional mask.  If mask is zero, value is matched exactly.
+// Metadata is written by the WriteMetadata instruction.
+func Metadata(value, mask uint64) Match {
+	return &metadataMatch{
+		value: value,
+		mask:  mask,
+	}
+}
+
+var _ Match = &metadataMatch{}
+
+// A metadataMatch is a Match returned by Metadata.
+type metadataMatch struct {
+	value uint64
+	mask  uint64
+}
+
+// MarshalText implements Match.
+func (m *metadataMatch) MarshalText() ([]byte, error) {
+	if m.mask == 0 {
+		return bprintf("%s=%#x", metadata, m.value), nil
+	}
+
+	return bprintf("%s=%#x/%#x", metadata, m.value, m.mask), nil
+}
+
+// GoString implements Match.
+func (m *metadataMatch) GoString() string {
+	return fmt.Sprintf("ovs.Metadata(%#x, %#x)", m.value, m.mask)
+}
+
+// PacketMark matches packets with the specified Linux packet mark, or
+// skb->mark, using an optional mask.  If mask is zero, value is matched
+// exactly.  Packet marks are commonly used with Linux policy routing.
+func PacketMark(value, mask uint32) Match {
+	return &packetMetadataMatch{
+		field: pktMark,
+		value: value,
+		mask:  mask,
+	}
+}
+
+// SKBPriority matches packets with the specified Linux queueing priority,
+// or skb->priority.  skb_priority is read-only in Open vSwitch; use SetQueue
+// to change it.
+func SKBPriority(priority uint32) Match {
+	return &packetMetadataMatch{
+		field: skbPriority,
+		value: priority,
+	}
+}
+
+var _ Match = &packetMetadataMatch{}
+
+// A packetMetadataMatch is a Match returned by PacketMark or SKBPriority.
+type packetMetadataMatch struct {
+	field string
+	value uint32
+	mask  uint32
+}
+
+// MarshalText implements Match.
+func (m *packetMetadataMatch) MarshalText() ([]byte, error) {
+	if m.mask == 0 || m.mask == ^uint32(0) {
+		return bprintf("%s=%#x", m.field, m.value), nil
+	}
+
+	return bprintf("%s=%#x/%#x", m.field, m.value, m.mask), nil
+}
+
+// GoString implements Match.
+func (m *packetMetadataMatch) GoString() string {
+	if m.field == skbPriority {
+		return fmt.Sprintf("ovs.SKBPriority(%#x)", m.value)
+	}
+
+	return fmt.Sprintf("ovs.PacketMark(%#x, %#x)", m.value, m.mask)
+}
+
+// Packet type namespaces, as used with PacketType.
+const (
+	// PacketNamespaceOpenFlow is the namespace of OpenFlow packet types,
+	// in which type 0 is an Ethernet frame.
+	PacketNamespaceOpenFlow uint16 = 0
+
+	// PacketNamespaceEtherType is the namespace of packets with no Ethernet
+	// header, in which the type is the Ethernet type of the packet, such
+	// as 0x0800 for IPv4.
+	PacketNamespaceEtherType uint16 = 1
+)
+
+// PacketType matches packets with the specified packet type, which is a
+// namespace and a type within that namespace.  Packets received on L3
+// tunnels have no Ethernet header, and are matched by their Ethernet type in
+// PacketNamespaceEtherType.  Ethernet frames are matched by
+// PacketType(PacketNamespaceOpenFlow, 0).
+func PacketType(namespace, typ uint16) Match {
+	return &packetTypeMatch{
+		namespace: namespace,
+		typ:       typ,
+	}
+}
+
+var _ Match = &packetTypeMatch{}
+
+// A packetTypeMatch is a Match returned by PacketType.
+type packetTypeMatch struct {
+	namespace uint16
+	typ       uint16
+}
+
+// MarshalText implements Match.
+func (m *packetTypeMatch) MarshalText() ([]byte, error) {
+	return bprintf("%s=(%d,%#x)", packetType, m.namespace, m.typ), nil
+}
+
+// GoString implements Match.
+func (m *packetTypeMatch) GoString() string {
+	ns := fmt.Sprintf("%d", m.namespace)
+	switch m.namespace {
+	case PacketNamespaceOpenFlow:
+		ns = "ovs.PacketNamespaceOpenFlow"
+	case PacketNamespaceEtherType:
+		ns = "ovs.PacketNamespaceEtherType"
+	}
+
+	return fmt.Sprintf("ovs.PacketType(%s, %#x)", ns, m.typ)
+}
+
 // matchIPv4AddressOrCIDR attempts to create a Match using the specified key
 // and input string, which could be interpreted as an IPv4 address or IPv4
 // CIDR block.
@@ -486,6 +486,121 @@ func TestMatchNetworkProtocol(t *testing.T) {
 	}
 }
 
+func TestMatchIPHeader(t *testing.T) {
+	var tests = []struct {
+		desc    string
+		m       Match
+		out     string
+		invalid bool
+	}{
+		{
+			desc: "DSCP",
+			m:    IPDSCP(46),
+			out:  "ip_dscp=46",
+		},
+		{
+			desc:    "DSCP too large",
+			m:       IPDSCP(64),
+			invalid: true,
+		},
+		{
+			desc: "ToS",
+			m:    NetworkTOS(184),
+			out:  "nw_tos=184",
+		},
+		{
+			desc:    "ToS with ECN bits",
+			m:       NetworkTOS(185),
+			invalid: true,
+		},
+		{
+			desc: "ECN",
+			m:    NetworkECN(3),
+			out:  "nw_ecn=3",
+		},
+		{
+			desc:    "ECN too large",
+			m:       NetworkECN(4),
+			invalid: true,
+		},
+		{
+			desc: "TTL",
+			m:    NetworkTTL(1),
+			out:  "nw_ttl=1",
+		},
+		{
+			desc: "not a fragment",
+			m:    IPFragment(IPFragNo),
+			out:  "ip_frag=no",
+		},
+		{
+			desc: "not a later fragment",
+			m:    IPFragment(IPFragNotLater),
+			out:  "ip_frag=not_later",
+		},
+		{
+			desc:    "invalid fragment state",
+			m:       IPFragment("sometimes"),
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			out, err := tt.m.MarshalText()
+			if err != nil && !tt.invalid {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err == nil && tt.invalid {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if want, got := tt.out, string(out); want != got {
+				t.Fatalf("unexpected Match output:\n- want: %q\n-  got: %q",
+					want, got)
+			}
+		})
+	}
+}
+
+func TestMatchICMPCode(t *testing.T) {
+	var tests = []struct {
+		desc string
+		m    Match
+		out  string
+	}{
+		{
+			desc: "ICMP port unreachable",
+			m:    ICMPCode(3),
+			out:  "icmp_code=3",
+		},
+		{
+			desc: "ICMPv6 neighbor solicitation",
+			m:    ICMPv6Type(135),
+			out:  "icmpv6_type=135",
+		},
+		{
+			desc: "ICMPv6 port unreachable",
+			m:    ICMPv6Code(4),
+			out:  "icmpv6_code=4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			out, err := tt.m.MarshalText()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if want, got := tt.out, string(out); want != got {
+				t.Fatalf("unexpected Match output:\n- want: %q\n-  got: %q",
+					want, got)
+			}
+		})
+	}
+}
+
 func TestMatchConjunctionID(t *testing.T) {
 	var tests = []struct {
 		desc string
@@ -540,6 +655,22 @@ func TestMatchConnectionTrackingState(t *testing.T) {
 			),
 			out: "ct_state=+new-trk",
 		},
+		{
+			desc: "typed connection state",
+			m: ConnectionTrackingStateBits(CTState{
+				Set:   CTStateNew | CTStateTracked,
+				Unset: CTStateInvalid,
+			}),
+			out: "ct_state=+new+trk-inv",
+		},
+		{
+			desc: "multiple flags with legacy helpers",
+			m: ConnectionTrackingState(
+				SetState(CTStateTracked|CTStateEstablished),
+				UnsetState(CTStateReply),
+			),
+			out: "ct_state=+est+trk-rpl",
+		},
 	}
 
 	for _, tt := range tests {
@@ -578,6 +709,14 @@ func TestMatchTCPFlags(t *testing.T) {
 			),
 			out: "tcp_flags=+syn-ack",
 		},
+		{
+			desc: "typed flags",
+			m: TCPFlagBits(TCPFlagState{
+				Set:   TCPFlagSYN | TCPFlagECE | TCPFlagCWR,
+				Unset: TCPFlagACK,
+			}),
+			out: "tcp_flags=+syn+ece+cwr-ack",
+		},
 	}
 
 	for _, tt := range tests {
@@ -764,6 +903,144 @@ func TestMatchTransportPortRange(t *testing.T) {
 	}
 }
 
+func TestMatchARPOperation(t *testing.T) {
+	var tests = []struct {
+		desc    string
+		op      uint16
+		out     string
+		invalid bool
+	}{
+		{
+			desc: "request",
+			op:   ARPOperationRequest,
+			out:  "arp_op=1",
+		},
+		{
+			desc: "reply",
+			op:   ARPOperationReply,
+			out:  "arp_op=2",
+		},
+		{
+			desc:    "too large",
+			op:      256,
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			out, err := ARPOperation(tt.op).MarshalText()
+			if err != nil && !tt.invalid {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err == nil && tt.invalid {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if want, got := tt.out, string(out); want != got {
+				t.Fatalf("unexpected Match output:\n- want: %q\n-  got: %q",
+					want, got)
+			}
+		})
+	}
+}
+
+func TestMatchSCTP(t *testing.T) {
+	var tests = []struct {
+		desc string
+		m    Match
+		out  string
+	}{
+		{
+			desc: "source port",
+			m:    SCTPSourcePort(3868),
+			out:  "sctp_src=3868",
+		},
+		{
+			desc: "destination port",
+			m:    SCTPDestinationPort(2905),
+			out:  "sctp_dst=2905",
+		},
+		{
+			desc: "masked source port",
+			m:    SCTPSourceMaskedPort(0x1000, 0xf000),
+			out:  "sctp_src=0x1000/0xf000",
+		},
+		{
+			desc: "masked destination port",
+			m:    SCTPDestinationMaskedPort(0x0b50, 0xfff0),
+			out:  "sctp_dst=0x0b50/0xfff0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			out, err := tt.m.MarshalText()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if want, got := tt.out, string(out); want != got {
+				t.Fatalf("unexpected Match output:\n- want: %q\n-  got: %q",
+					want, got)
+			}
+		})
+	}
+}
+
+func TestMatchPacketMetadata(t *testing.T) {
+	var tests = []struct {
+		desc string
+		m    Match
+		out  string
+	}{
+		{
+			desc: "packet mark",
+			m:    PacketMark(0x10, 0),
+			out:  "pkt_mark=0x10",
+		},
+		{
+			desc: "packet mark all ones mask",
+			m:    PacketMark(0x10, 0xffffffff),
+			out:  "pkt_mark=0x10",
+		},
+		{
+			desc: "masked packet mark",
+			m:    PacketMark(0x10, 0xf0),
+			out:  "pkt_mark=0x10/0xf0",
+		},
+		{
+			desc: "skb priority",
+			m:    SKBPriority(0x10001),
+			out:  "skb_priority=0x10001",
+		},
+		{
+			desc: "ethernet packet type",
+			m:    PacketType(PacketNamespaceOpenFlow, 0),
+			out:  "packet_type=(0,0x0)",
+		},
+		{
+			desc: "IPv4 packet type",
+			m:    PacketType(PacketNamespaceEtherType, 0x0800),
+			out:  "packet_type=(1,0x800)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			out, err := tt.m.MarshalText()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if want, got := tt.out, string(out); want != got {
+				t.Fatalf("unexpected Match output:\n- want: %q\n-  got: %q",
+					want, got)
+			}
+		})
+	}
+}
+
 func TestMatchVLANTCI(t *testing.T) {
 	var tests = []struct {
 		desc string
@@ -957,6 +1234,38 @@ func TestMatchGoString(t *testing.T) {
 			m: ICMPType(10),
 			s: `ovs.ICMPType(10)`,
 		},
+		{
+			m: ICMPCode(3),
+			s: `ovs.ICMPCode(3)`,
+		},
+		{
+			m: ICMPv6Type(135),
+			s: `ovs.ICMPv6Type(135)`,
+		},
+		{
+			m: ICMPv6Code(4),
+			s: `ovs.ICMPv6Code(4)`,
+		},
+		{
+			m: IPDSCP(46),
+			s: `ovs.IPDSCP(46)`,
+		},
+		{
+			m: NetworkTOS(184),
+			s: `ovs.NetworkTOS(184)`,
+		},
+		{
+			m: NetworkECN(1),
+			s: `ovs.NetworkECN(1)`,
+		},
+		{
+			m: NetworkTTL(64),
+			s: `ovs.NetworkTTL(64)`,
+		},
+		{
+			m: IPFragment(IPFragFirst),
+			s: `ovs.IPFragment(ovs.IPFragFirst)`,
+		},
 		{
 			m: NeighborDiscoveryTarget("2001:db8::1"),
 			s: `ovs.NeighborDiscoveryTarget("2001:db8::1")`,
@@ -985,6 +1294,38 @@ func TestMatchGoString(t *testing.T) {
 			m: ARPTargetProtocolAddress("192.168.1.1"),
 			s: `ovs.ARPTargetProtocolAddress("192.168.1.1")`,
 		},
+		{
+			m: ARPOperation(ARPOperationReply),
+			s: `ovs.ARPOperation(ovs.ARPOperationReply)`,
+		},
+		{
+			m: ARPOperation(3),
+			s: `ovs.ARPOperation(3)`,
+		},
+		{
+			m: SCTPSourcePort(3868),
+			s: `ovs.SCTPSourcePort(3868)`,
+		},
+		{
+			m: PacketMark(0x1, 0xff),
+			s: `ovs.PacketMark(0x1, 0xff)`,
+		},
+		{
+			m: SKBPriority(0x10001),
+			s: `ovs.SKBPriority(0x10001)`,
+		},
+		{
+			m: PacketType(PacketNamespaceEtherType, 0x86dd),
+			s: `ovs.PacketType(ovs.PacketNamespaceEtherType, 0x86dd)`,
+		},
+		{
+			m: PacketType(2, 0x1),
+			s: `ovs.PacketType(2, 0x1)`,
+		},
+		{
+			m: SCTPDestinationMaskedPort(0x10, 0xfff0),
+			s: `ovs.SCTPDestinationMaskedPort(0x10, 0xfff0)`,
+		},
 		{
 			m: TransportSourcePort(80),
 			s: `ovs.TransportSourcePort(80)`,
@@ -1035,6 +1376,10 @@ func TestMatchGoString(t *testing.T) {
 			m: ConjunctionID(123),
 			s: `ovs.ConjunctionID(123)`,
 		},
+		{
+			m: RegMatch(1, 0xa, 0xff),
+			s: `ovs.RegMatch(1, 0xa, 0xff)`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -15,8 +15,6 @@
 package ovs
 
 import (
-	"bytes"
-	"errors"
 	"fmt"
 	"math"
 	"net"
@@ -29,12 +27,21 @@ func parseMatch(key string, value string) (Match, error) {
 	switch key {
 	case arpSHA, arpTHA, ndSLL, ndTLL:
 		return parseMACMatch(key, value)
-	case icmpType, nwProto:
+	case icmpType, icmpCode, icmpv6Type, icmpv6Code, nwProto, nwTOS, nwTTL:
 		return parseIntMatch(key, value, math.MaxUint8)
+	case ipDSCP:
+		return parseIntMatch(key, value, maxDSCP)
+	case nwECN, ipECN:
+		return parseIntMatch(key, value, maxECN)
+	case ipFrag, nwFrag:
+		// ovs-ofctl dump-flows prints ip_frag as nw_frag.
+		return parseIPFrag(value)
 	case ctZone:
 		return parseIntMatch(key, value, math.MaxUint16)
-	case tpSRC, tpDST:
+	case tpSRC, tpDST, sctpSRC, sctpDST:
 		return parsePort(key, value, math.MaxUint16)
+	case arpOp:
+		return parseIntMatch(key, value, maxARPOperation)
 	case conjID:
 		return parseIntMatch(key, value, math.MaxUint32)
 	case arpSPA:
@@ -74,10 +81,44 @@ func parseMatch(key string, value string) (Match, error) {
 		return parseCTMark(value)
 	case tunID:
 		return parseTunID(value)
+	case pktMark, skbPriority:
+		v, mask, err := parseMaskedUint64(value)
+		if err != nil || v > math.MaxUint32 || mask > math.MaxUint32 ||
+			(key == skbPriority && mask != 0 && mask != math.MaxUint32) {
+			return nil, fmt.Errorf("invalid %s match: %q", key, value)
+		}
+
+		if key == skbPriority {
+			return SKBPriority(uint32(v)), nil
+		}
+
+		return PacketMark(uint32(v), uint32(mask)), nil
+	case packetType:
+		ns, typ, err := parsePacketType(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return PacketType(ns, typ), nil
+	case mplsLabel, mplsTC, mplsBOS, mplsTTL:
+		return parseMPLSMatch(key, value)
+	case nshSPI, nshSI, nshC1, nshC2, nshC3, nshC4:
+		return parseNSHMatch(key, value)
+	case metadata:
+		v, mask, err := parseMaskedUint64(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s match: %q", metadata, value)
+		}
+
+		return Metadata(v, mask), nil
 	}
 
-	if strings.HasPrefix(key, "reg") {
-		return parseRegMatch(key, value)
+	if family, n, ok := parseRegisterName(key); ok {
+		if family == regFamily {
+			return parseRegMatch(key, value)
+		}
+
+		return parseWideRegisterMatch(family, n, value)
 	}
 
 	return nil, fmt.Errorf("no match parser found for %s=%s", key, value)
@@ -88,34 +129,41 @@ func parseRegMatch(key, value string) (Match, error) {
 	if err != nil {
 		return nil, err
 	}
-	values := []uint32{}
-	for _, s := range strings.Split(value, "/") {
-		if !strings.HasPrefix(s, hexPrefix) {
-			v, err := strconv.Atoi(s)
-			if err != nil {
-				return nil, err
-			}
 
-			values = append(values, uint32(v))
-			continue
-		}
+	// Match may not have too many parts, e.g. "reg0=10/10/10"
+	v, m, parts := splitMask(value)
+	if parts > 2 {
+		return nil, fmt.Errorf("invalid reg%d match: %q", n, value)
+	}
+
+	val, err := parseRegValue(v)
+	if err != nil {
+		return nil, err
+	}
+	if parts == 1 {
+		return RegMatch(n, val, ^uint32(0)), nil
+	}
+
+	mask, err := parseRegValue(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return RegMatch(n, val, mask), nil
+}
 
-		v, err := parseHexUint32(s)
+// parseRegValue parses a decimal or hexadecimal register value.
+func parseRegValue(s string) (uint32, error) {
+	if !strings.HasPrefix(s, hexPrefix) {
+		v, err := strconv.Atoi(s)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
 
-		values = append(values, v)
-	}
-	switch len(values) {
-	case 1:
-		return RegMatch(n, values[0], ^uint32(0)), nil
-	case 2:
-		return RegMatch(n, values[0], values[1]), nil
-	// Match had too many parts, e.g. "vlan_tci=10/10/10"
-	default:
-		return nil, fmt.Errorf("invalid reg%d match: %q", n, value)
+		return uint32(v), nil
 	}
+
+	return parseHexUint32(s)
 }
 
 // parseClampInt calls strconv.Atoi on s, and then ensures that s is less than
@@ -143,12 +191,34 @@ func parseIntMatch(key string, value string, max int) (Match, error) {
 	switch key {
 	case icmpType:
 		return ICMPType(uint8(t)), nil
+	case icmpCode:
+		return ICMPCode(uint8(t)), nil
+	case icmpv6Type:
+		return ICMPv6Type(uint8(t)), nil
+	case icmpv6Code:
+		return ICMPv6Code(uint8(t)), nil
 	case nwProto:
 		return NetworkProtocol(uint8(t)), nil
+	case nwTOS:
+		// nw_tos only matches the DSCP bits, so its ECN bits must be zero.
+		if t&maxECN != 0 {
+			return nil, fmt.Errorf("invalid %s match: ECN bits of %d must be zero", key, t)
+		}
+
+		return NetworkTOS(uint8(t)), nil
+	case nwTTL:
+		return NetworkTTL(uint8(t)), nil
+	case ipDSCP:
+		return IPDSCP(uint8(t)), nil
+	case nwECN, ipECN:
+		// ip_ecn is a synonym for nw_ecn.
+		return NetworkECN(uint8(t)), nil
 	case ctZone:
 		return ConnectionTrackingZone(uint16(t)), nil
 	case conjID:
 		return ConjunctionID(uint32(t)), nil
+	case arpOp:
+		return ARPOperation(uint16(t)), nil
 	}
 
 	return nil, fmt.Errorf("no action matched for %s=%s", key, value)
@@ -157,33 +227,25 @@ func parseIntMatch(key string, value string, max int) (Match, error) {
 // parsePort parses a port or port/mask Match value from the input key and value,
 // with a maximum possible value of max.
 func parsePort(key string, value string, max int) (Match, error) {
+	var port, mask uint64
 
-	var values []uint64
-	//Split the string
-	ss := strings.Split(value, "/")
-
-	//If input is just port
-	switch len(ss) {
+	v, m, parts := splitMask(value)
+	switch parts {
+	// If input is just port
 	case 1:
 		val, err := parseClampInt(value, max)
 		if err != nil {
 			return nil, err
 		}
-		values = append(values, uint64(val))
-		values = append(values, 0)
-		// If input is port/mask
+		port = uint64(val)
+	// If input is port/mask
 	case 2:
-		for _, s := range ss {
-			val, err := parseHexUint64(s)
-			if err != nil {
-				return nil, err
-			}
-			// Return error if val > 65536 (uint16)
-			if val > uint64(max) {
-				return nil, fmt.Errorf("integer %d too large; %d > %d", val, val, max)
-			}
-
-			values = append(values, val)
+		var err error
+		if port, err = parseHexClamp(v, max); err != nil {
+			return nil, err
+		}
+		if mask, err = parseHexClamp(m, max); err != nil {
+			return nil, err
 		}
 	default:
 		return nil, fmt.Errorf("invalid value, no action matched for %s=%s", key, value)
@@ -191,14 +253,33 @@ func parsePort(key string, value string, max int) (Match, error) {
 
 	switch key {
 	case tpSRC:
-		return TransportSourceMaskedPort(uint16(values[0]), uint16(values[1])), nil
+		return TransportSourceMaskedPort(uint16(port), uint16(mask)), nil
 	case tpDST:
-		return TransportDestinationMaskedPort(uint16(values[0]), uint16(values[1])), nil
+		return TransportDestinationMaskedPort(uint16(port), uint16(mask)), nil
+	case sctpSRC:
+		return SCTPSourceMaskedPort(uint16(port), uint16(mask)), nil
+	case sctpDST:
+		return SCTPDestinationMaskedPort(uint16(port), uint16(mask)), nil
 	}
 	// Return error if input is invalid
 	return nil, fmt.Errorf("no action matched for %s=%s", key, value)
 }
 
+// parseHexClamp parses a hexadecimal value from s, and then ensures that
+// it is less than or equal to the integer specified by max.
+func parseHexClamp(s string, max int) (uint64, error) {
+	val, err := parseHexUint64(s)
+	if err != nil {
+		return 0, err
+	}
+	// Return error if val > 65536 (uint16)
+	if val > uint64(max) {
+		return 0, fmt.Errorf("integer %d too large; %d > %d", val, val, max)
+	}
+
+	return val, nil
+}
+
 // parseMACMatch parses a MAC address Match value from the input key and value.
 func parseMACMatch(key string, value string) (Match, error) {
 	mac, err := net.ParseMAC(value)
@@ -220,49 +301,36 @@ func parseMACMatch(key string, value string) (Match, error) {
 	return nil, fmt.Errorf("no action matched for %s=%s", key, value)
 }
 
-// parseCTState parses a series of connection tracking values into a Match.
-func parseCTState(value string) (Match, error) {
-	if len(value)%4 != 0 {
-		return nil, errors.New("ct_state length must be divisible by 4")
+// parseIPFrag parses an IPFragment Match from value.
+func parseIPFrag(value string) (Match, error) {
+	frag := IPFrag(value)
+	if _, ok := ipFragGoStrings[frag]; !ok {
+		return nil, fmt.Errorf("invalid %s match: %q", ipFrag, value)
 	}
 
-	var buf bytes.Buffer
-	var states []string
-
-	for i, r := range value {
-		if i != 0 && i%4 == 0 {
-			states = append(states, buf.String())
-			buf.Reset()
-		}
+	return IPFragment(frag), nil
+}
 
-		_, _ = buf.WriteRune(r)
+// parseCTState parses connection tracking state flags, in either their
+// symbolic or hexadecimal form, into a Match.
+func parseCTState(value string) (Match, error) {
+	state, err := ParseCTState(value)
+	if err != nil {
+		return nil, err
 	}
-	states = append(states, buf.String())
 
-	return ConnectionTrackingState(states...), nil
+	return ConnectionTrackingStateBits(state), nil
 }
 
 // parseTCPFlags parses a series of TCP flags into a Match.  Open vSwitch's representation
 // of These TCP flags are outlined in the ovs-field(7) man page,
 func parseTCPFlags(value string) (Match, error) {
-	if len(value)%4 != 0 {
-		return nil, errors.New("tcp_flags length must be divisible by 4")
-	}
-
-	var buf bytes.Buffer
-	var flags []string
-
-	for i, r := range value {
-		if i != 0 && i%4 == 0 {
-			flags = append(flags, buf.String())
-			buf.Reset()
-		}
-
-		_, _ = buf.WriteRune(r)
+	flags, err := ParseTCPFlagState(value)
+	if err != nil {
+		return nil, err
 	}
-	flags = append(flags, buf.String())
 
-	return TCPFlags(flags...), nil
+	return TCPFlagBits(flags), nil
 }
 
 // hexPrefix denotes that a string integer is in hex format.
@@ -289,101 +357,128 @@ func parseDataLinkVLAN(value string) (Match, error) {
 
 // parseVLANTCI parses a VLANTCI Match from value.
 func parseVLANTCI(value string) (Match, error) {
-	var values []uint16
-	for _, s := range strings.Split(value, "/") {
-		if !strings.HasPrefix(s, hexPrefix) {
-			v, err := strconv.Atoi(s)
-			if err != nil {
-				return nil, err
-			}
-
-			values = append(values, uint16(v))
-			continue
-		}
+	// Match may not have too many parts, e.g. "vlan_tci=10/10/10"
+	v, m, parts := splitMask(value)
+	if parts > 2 {
+		return nil, fmt.Errorf("invalid vlan_tci match: %q", value)
+	}
 
-		v, err := parseHexUint16(s)
+	tci, err := parseVLANTCIValue(v)
+	if err != nil {
+		return nil, err
+	}
+	if parts == 1 {
+		return VLANTCI(tci, 0), nil
+	}
+
+	mask, err := parseVLANTCIValue(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return VLANTCI(tci, mask), nil
+}
+
+// parseVLANTCIValue parses a decimal or hexadecimal VLAN TCI value.
+func parseVLANTCIValue(s string) (uint16, error) {
+	if !strings.HasPrefix(s, hexPrefix) {
+		v, err := strconv.Atoi(s)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
 
-		values = append(values, v)
+		return uint16(v), nil
 	}
 
-	switch len(values) {
-	case 1:
-		return VLANTCI(values[0], 0), nil
-	case 2:
-		return VLANTCI(values[0], values[1]), nil
-	// Match had too many parts, e.g. "vlan_tci=10/10/10"
-	default:
-		return nil, fmt.Errorf("invalid vlan_tci match: %q", value)
-	}
+	return parseHexUint16(s)
 }
 
 // parseCTMark parses a CTMark Match from value.
 func parseCTMark(value string) (Match, error) {
-	var values []uint32
-	for _, s := range strings.Split(value, "/") {
-		if !strings.HasPrefix(s, hexPrefix) {
-			v, err := strconv.Atoi(s)
-			if err != nil {
-				return nil, err
-			}
-
-			values = append(values, uint32(v))
-			continue
-		}
-
-		v, err := parseHexUint32(s)
-		if err != nil {
-			return nil, err
-		}
+	// Match may not have too many parts, e.g. "ct_mark=10/10/10"
+	v, m, parts := splitMask(value)
+	if parts > 2 {
+		return nil, fmt.Errorf("invalid ct_mark match: %q", value)
+	}
 
-		values = append(values, v)
+	mark, err := parseRegValue(v)
+	if err != nil {
+		return nil, err
+	}
+	if parts == 1 {
+		return ConnectionTrackingMark(mark, 0), nil
 	}
 
-	switch len(values) {
-	case 1:
-		return ConnectionTrackingMark(values[0], 0), nil
-	case 2:
-		return ConnectionTrackingMark(values[0], values[1]), nil
-	// Match had too many parts, e.g. "ct_mark=10/10/10"
-	default:
-		return nil, fmt.Errorf("invalid ct_mark match: %q", value)
+	mask, err := parseRegValue(m)
+	if err != nil {
+		return nil, err
 	}
+
+	return ConnectionTrackingMark(mark, mask), nil
 }
 
 // parseTunID parses a tunID Match from value.
 func parseTunID(value string) (Match, error) {
-	var values []uint64
-	for _, s := range strings.Split(value, "/") {
-		if !strings.HasPrefix(s, hexPrefix) {
-			v, err := strconv.Atoi(s)
-			if err != nil {
-				return nil, err
-			}
-
-			values = append(values, uint64(v))
-			continue
-		}
+	// Match may not have too many parts, e.g. "tun_id=10/10/10"
+	v, m, parts := splitMask(value)
+	if parts > 2 {
+		return nil, fmt.Errorf("invalid tun_id match: %q", value)
+	}
 
-		v, err := parseHexUint64(s)
+	id, err := parseTunIDValue(v)
+	if err != nil {
+		return nil, err
+	}
+	if parts == 1 {
+		return TunnelID(id), nil
+	}
+
+	mask, err := parseTunIDValue(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return TunnelIDWithMask(id, mask), nil
+}
+
+// parseTunIDValue parses a decimal or hexadecimal tunnel ID value.
+func parseTunIDValue(s string) (uint64, error) {
+	if !strings.HasPrefix(s, hexPrefix) {
+		v, err := strconv.Atoi(s)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
 
-		values = append(values, v)
+		return uint64(v), nil
 	}
 
-	switch len(values) {
-	case 1:
-		return TunnelID(values[0]), nil
-	case 2:
-		return TunnelIDWithMask(values[0], values[1]), nil
-	// Match had too many parts, e.g. "tun_id=10/10/10"
-	default:
-		return nil, fmt.Errorf("invalid tun_id match: %q", value)
+	return parseHexUint64(s)
+}
+
+// parsePacketType parses the namespace and type of a packet_type Match
+// value, such as "(1,0x800)".
+func parsePacketType(value string) (namespace, typ uint16, err error) {
+	errInvalid := fmt.Errorf("invalid %s match: %q", packetType, value)
+
+	if !strings.HasPrefix(value, "(") || !strings.HasSuffix(value, ")") {
+		return 0, 0, errInvalid
+	}
+
+	ss := strings.Split(value[1:len(value)-1], ",")
+	if len(ss) != 2 {
+		return 0, 0, errInvalid
 	}
+
+	ns, err := strconv.ParseUint(ss[0], 0, 16)
+	if err != nil {
+		return 0, 0, errInvalid
+	}
+	t, err := strconv.ParseUint(ss[1], 0, 16)
+	if err != nil {
+		return 0, 0, errInvalid
+	}
+
+	return uint16(ns), uint16(t), nil
 }
 
 // parseHexUint16 parses a uint16 value from a hexadecimal string.
@@ -404,6 +499,42 @@ func parseHexUint32(value string) (uint32, error) {
 	return uint32(val), nil
 }
 
+// parseMaskedUint64 parses a decimal or hexadecimal value with an optional
+// mask, such as "0x10/0xff".  If no mask is present, mask is zero.
+func parseMaskedUint64(value string) (v uint64, mask uint64, err error) {
+	vs, ms, parts := splitMask(value)
+	if parts > 2 {
+		return 0, 0, fmt.Errorf("invalid masked value: %q", value)
+	}
+
+	v, err = strconv.ParseUint(vs, 0, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if parts == 2 {
+		mask, err = strconv.ParseUint(ms, 0, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return v, mask, nil
+}
+
+// splitMask splits a value with an optional mask, such as "0x10/0xff", into
+// substrings for its value and mask.  parts is the number of '/'-separated
+// parts in value, so that values with too many parts, such as "10/10/10",
+// can be rejected.
+func splitMask(value string) (v, mask string, parts int) {
+	i := strings.IndexByte(value, '/')
+	if i == -1 {
+		return value, "", 1
+	}
+
+	return value[:i], value[i+1:], strings.Count(value, "/") + 1
+}
+
 // parseHexUint64 parses a uint64 value from a hexadecimal string.
 func parseHexUint64(value string) (uint64, error) {
 	return strconv.ParseUint(strings.TrimPrefix(value, hexPrefix), 16, 64)
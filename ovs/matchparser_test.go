@@ -49,6 +49,50 @@ func Test_parseMatch(t *testing.T) {
 			s: "arp_tha=de:ad:be:ef:de:ad",
 			m: ARPTargetHardwareAddress(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}),
 		},
+		{
+			s: "arp_op=2",
+			m: ARPOperation(ARPOperationReply),
+		},
+		{
+			s:       "arp_op=256",
+			invalid: true,
+		},
+		{
+			s: "pkt_mark=0x10/0xf0",
+			m: PacketMark(0x10, 0xf0),
+		},
+		{
+			s:       "pkt_mark=0x100000000",
+			invalid: true,
+		},
+		{
+			s: "skb_priority=0x10001",
+			m: SKBPriority(0x10001),
+		},
+		{
+			s:       "skb_priority=0x1/0xff",
+			invalid: true,
+		},
+		{
+			s: "packet_type=(1,0x800)",
+			m: PacketType(PacketNamespaceEtherType, 0x0800),
+		},
+		{
+			s:       "packet_type=(1)",
+			invalid: true,
+		},
+		{
+			s:       "packet_type=1,0x800",
+			invalid: true,
+		},
+		{
+			s: "sctp_src=3868",
+			m: SCTPSourceMaskedPort(3868, 0),
+		},
+		{
+			s: "sctp_dst=0x1000/0xf000",
+			m: SCTPDestinationMaskedPort(0x1000, 0xf000),
+		},
 		{
 			s: "arp_spa=192.168.1.1",
 			m: ARPSourceProtocolAddress("192.168.1.1"),
@@ -61,12 +105,41 @@ func Test_parseMatch(t *testing.T) {
 			s:       "ct_state=+hi",
 			invalid: true,
 		},
+		{
+			s:       "ct_state=+trk+trk",
+			invalid: true,
+		},
+		{
+			s:       "ct_state=0x100",
+			invalid: true,
+		},
+		{
+			s:       "ct_state=0x21/0x1",
+			invalid: true,
+		},
 		{
 			s: "ct_state=+trk-new",
-			m: ConnectionTrackingState(
-				SetState(CTStateTracked),
-				UnsetState(CTStateNew),
-			),
+			m: ConnectionTrackingStateBits(CTState{
+				Set:   CTStateTracked,
+				Unset: CTStateNew,
+			}),
+		},
+		{
+			s:     "ct_state=0x21/0x31",
+			final: "ct_state=+new+trk-inv",
+			m: ConnectionTrackingStateBits(CTState{
+				Set:   CTStateNew | CTStateTracked,
+				Unset: CTStateInvalid,
+			}),
+		},
+		{
+			s:     "ct_state=0x22",
+			final: "ct_state=+est+trk-new-rel-rpl-inv-snat-dnat",
+			m: ConnectionTrackingStateBits(CTState{
+				Set: CTStateEstablished | CTStateTracked,
+				Unset: CTStateNew | CTStateRelated | CTStateReply |
+					CTStateInvalid | CTStateSNAT | CTStateDNAT,
+			}),
 		},
 		{
 			s:       "tcp_flags=+omg",
@@ -74,10 +147,22 @@ func Test_parseMatch(t *testing.T) {
 		},
 		{
 			s: "tcp_flags=+syn-ack",
-			m: TCPFlags(
-				SetTCPFlag(TCPFlagSYN),
-				UnsetTCPFlag(TCPFlagACK),
-			),
+			m: TCPFlagBits(TCPFlagState{
+				Set:   TCPFlagSYN,
+				Unset: TCPFlagACK,
+			}),
+		},
+		{
+			s:     "tcp_flags=0x002/0x012",
+			final: "tcp_flags=+syn-ack",
+			m: TCPFlagBits(TCPFlagState{
+				Set:   TCPFlagSYN,
+				Unset: TCPFlagACK,
+			}),
+		},
+		{
+			s:       "tcp_flags=0x200/0x200",
+			invalid: true,
 		},
 		{
 			s: "dl_src=de:ad:be:ef:de:ad",
@@ -119,6 +204,72 @@ func Test_parseMatch(t *testing.T) {
 			s: "icmp_type=1",
 			m: ICMPType(1),
 		},
+		{
+			s: "icmp_code=3",
+			m: ICMPCode(3),
+		},
+		{
+			s: "icmpv6_type=135",
+			m: ICMPv6Type(135),
+		},
+		{
+			s: "icmpv6_code=0",
+			m: ICMPv6Code(0),
+		},
+		{
+			s: "ip_dscp=46",
+			m: IPDSCP(46),
+		},
+		{
+			s:       "ip_dscp=64",
+			invalid: true,
+		},
+		{
+			s: "nw_tos=184",
+			m: NetworkTOS(184),
+		},
+		{
+			s:       "nw_tos=5",
+			invalid: true,
+		},
+		{
+			s: "nw_ecn=2",
+			m: NetworkECN(2),
+		},
+		{
+			s:     "ip_ecn=2",
+			final: "nw_ecn=2",
+			m:     NetworkECN(2),
+		},
+		{
+			s:       "nw_ecn=4",
+			invalid: true,
+		},
+		{
+			s: "nw_ttl=255",
+			m: NetworkTTL(255),
+		},
+		{
+			s:       "nw_ttl=256",
+			invalid: true,
+		},
+		{
+			s: "ip_frag=later",
+			m: IPFragment(IPFragLater),
+		},
+		{
+			s: "ip_frag=not_later",
+			m: IPFragment(IPFragNotLater),
+		},
+		{
+			s:       "ip_frag=maybe",
+			invalid: true,
+		},
+		{
+			s:     "nw_frag=first",
+			final: "ip_frag=first",
+			m:     IPFragment(IPFragFirst),
+		},
 		{
 			s: "ipv6_src=2001:db8::1",
 			m: IPv6Source("2001:db8::1"),
@@ -287,6 +438,23 @@ func Test_parseMatch(t *testing.T) {
 			final: "tun_id=0xa/0x2",
 			m:     TunnelIDWithMask(10, 2),
 		},
+		{
+			s:       "metadata=xyzzy",
+			invalid: true,
+		},
+		{
+			s:       "metadata=0x1/0x2/0x3",
+			invalid: true,
+		},
+		{
+			s:     "metadata=16",
+			final: "metadata=0x10",
+			m:     Metadata(0x10, 0),
+		},
+		{
+			s: "metadata=0x10/0xf0",
+			m: Metadata(0x10, 0xf0),
+		},
 		{
 			s: "conj_id=123",
 			m: ConjunctionID(123),
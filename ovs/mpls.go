@@ -0,0 +1,267 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	// errInvalidMPLSLabel is returned when an MPLS label does not fit in
+	// the 20 bit label field.
+	errInvalidMPLSLabel = errors.New("MPLS label must be between 0 and 1048575")
+
+	// errInvalidMPLSTrafficClass is returned when an MPLS traffic class
+	// does not fit in the 3 bit traffic class field.
+	errInvalidMPLSTrafficClass = errors.New("MPLS traffic class must be between 0 and 7")
+
+	// errInvalidPushMPLSEtherType is returned when PushMPLS is called with
+	// an Ethernet type other than those of MPLS.
+	errInvalidPushMPLSEtherType = errors.New("push_mpls Ethernet type must be 0x8847 or 0x8848")
+)
+
+// Constants of MPLS Match and Action names.
+const (
+	mplsLabel = "mpls_label"
+	mplsTC    = "mpls_tc"
+	mplsBOS   = "mpls_bos"
+	mplsTTL   = "mpls_ttl"
+
+	actionPushMPLS     = "push_mpls"
+	actionPopMPLS      = "pop_mpls"
+	actionSetMPLSLabel = "set_mpls_label"
+	actionDecMPLSTTL   = "dec_mpls_ttl"
+)
+
+// Limits of MPLS fields which are narrower than their types.
+const (
+	maxMPLSLabel = 1<<20 - 1
+	maxMPLSTC    = 1<<3 - 1
+)
+
+// MPLSLabel matches MPLS packets whose outermost label matches label.
+// label must fit in 20 bits.
+func MPLSLabel(label uint32) Match {
+	return &mplsMatch{
+		field: mplsLabel,
+		value: label,
+	}
+}
+
+// MPLSTrafficClass matches MPLS packets whose outermost label has the
+// traffic class tc.  tc must be between 0 and 7.
+func MPLSTrafficClass(tc uint8) Match {
+	return &mplsMatch{
+		field: mplsTC,
+		value: uint32(tc),
+	}
+}
+
+// MPLSBottomOfStack matches MPLS packets whose outermost label is, or is
+// not, the bottom of the label stack.
+func MPLSBottomOfStack(bos bool) Match {
+	m := &mplsMatch{
+		field: mplsBOS,
+	}
+	if bos {
+		m.value = 1
+	}
+
+	return m
+}
+
+// MPLSTTL matches MPLS packets whose outermost label has the time to live
+// ttl.
+func MPLSTTL(ttl uint8) Match {
+	return &mplsMatch{
+		field: mplsTTL,
+		value: uint32(ttl),
+	}
+}
+
+var _ Match = &mplsMatch{}
+
+// An mplsMatch is a Match returned by MPLS{Label,TrafficClass,
+// BottomOfStack,TTL}.
+type mplsMatch struct {
+	field string
+	value uint32
+}
+
+// MarshalText implements Match.
+func (m *mplsMatch) MarshalText() ([]byte, error) {
+	switch {
+	case m.field == mplsLabel && m.value > maxMPLSLabel:
+		return nil, errInvalidMPLSLabel
+	case m.field == mplsTC && m.value > maxMPLSTC:
+		return nil, errInvalidMPLSTrafficClass
+	}
+
+	return bprintf("%s=%d", m.field, m.value), nil
+}
+
+// GoString implements Match.
+func (m *mplsMatch) GoString() string {
+	switch m.field {
+	case mplsLabel:
+		return fmt.Sprintf("ovs.MPLSLabel(%d)", m.value)
+	case mplsTC:
+		return fmt.Sprintf("ovs.MPLSTrafficClass(%d)", m.value)
+	case mplsBOS:
+		return fmt.Sprintf("ovs.MPLSBottomOfStack(%t)", m.value == 1)
+	}
+
+	return fmt.Sprintf("ovs.MPLSTTL(%d)", m.value)
+}
+
+// parseMPLSMatch parses an MPLS Match from the input key and value.
+func parseMPLSMatch(key, value string) (Match, error) {
+	max := map[string]int{
+		mplsLabel: maxMPLSLabel,
+		mplsTC:    maxMPLSTC,
+		mplsBOS:   1,
+		mplsTTL:   0xff,
+	}[key]
+
+	v, err := parseClampInt(value, max)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key {
+	case mplsLabel:
+		return MPLSLabel(uint32(v)), nil
+	case mplsTC:
+		return MPLSTrafficClass(uint8(v)), nil
+	case mplsBOS:
+		return MPLSBottomOfStack(v == 1), nil
+	}
+
+	return MPLSTTL(uint8(v)), nil
+}
+
+// PushMPLS pushes a new MPLS label onto a packet, and sets its Ethernet
+// type to etherType, which must be 0x8847 for unicast or 0x8848 for
+// multicast MPLS.
+func PushMPLS(etherType uint16) Action {
+	return &mplsAction{
+		action:    actionPushMPLS,
+		etherType: etherType,
+	}
+}
+
+// PopMPLS pops the outermost MPLS label from a packet, and sets its Ethernet
+// type to etherType, which is the type of the payload if the label was the
+// bottom of the stack, or an MPLS Ethernet type otherwise.
+func PopMPLS(etherType uint16) Action {
+	return &mplsAction{
+		action:    actionPopMPLS,
+		etherType: etherType,
+	}
+}
+
+// An mplsAction is an Action which is used by PushMPLS and PopMPLS.
+type mplsAction struct {
+	action    string
+	etherType uint16
+}
+
+// MarshalText implements Action.
+func (a *mplsAction) MarshalText() ([]byte, error) {
+	if a.action == actionPushMPLS && !isMPLSEtherType(a.etherType) {
+		return nil, errInvalidPushMPLSEtherType
+	}
+
+	return bprintf("%s:0x%04x", a.action, a.etherType), nil
+}
+
+// GoString implements Action.
+func (a *mplsAction) GoString() string {
+	if a.action == actionPushMPLS {
+		return fmt.Sprintf("ovs.PushMPLS(0x%04x)", a.etherType)
+	}
+
+	return fmt.Sprintf("ovs.PopMPLS(0x%04x)", a.etherType)
+}
+
+// SetMPLSLabel sets the label of the outermost MPLS label of a packet.
+// label must fit in 20 bits.
+func SetMPLSLabel(label uint32) Action {
+	return &setMPLSLabelAction{
+		label: label,
+	}
+}
+
+// A setMPLSLabelAction is an Action which is used by SetMPLSLabel.
+type setMPLSLabelAction struct {
+	label uint32
+}
+
+// MarshalText implements Action.
+func (a *setMPLSLabelAction) MarshalText() ([]byte, error) {
+	if a.label > maxMPLSLabel {
+		return nil, errInvalidMPLSLabel
+	}
+
+	return bprintf("%s(%d)", actionSetMPLSLabel, a.label), nil
+}
+
+// GoString implements Action.
+func (a *setMPLSLabelAction) GoString() string {
+	return fmt.Sprintf("ovs.SetMPLSLabel(%d)", a.label)
+}
+
+// DecMPLSTTL decrements the time to live of the outermost MPLS label of a
+// packet.
+func DecMPLSTTL() Action {
+	return &textAction{
+		action: actionDecMPLSTTL,
+	}
+}
+
+// parseMPLSAction parses an MPLS Action with the specified name and
+// argument, such as "push_mpls" and "0x8847".
+func parseMPLSAction(name, arg string) (Action, error) {
+	switch name {
+	case actionPushMPLS, actionPopMPLS:
+		etherType, err := strconv.ParseUint(arg, 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s action: %q", name, arg)
+		}
+
+		if name == actionPushMPLS {
+			return PushMPLS(uint16(etherType)), nil
+		}
+
+		return PopMPLS(uint16(etherType)), nil
+	case actionSetMPLSLabel:
+		label, err := strconv.ParseUint(arg, 0, 32)
+		if err != nil || label > maxMPLSLabel {
+			return nil, fmt.Errorf("invalid %s action: %q", name, arg)
+		}
+
+		return SetMPLSLabel(uint32(label)), nil
+	}
+
+	return nil, fmt.Errorf("no action matched for %s", name)
+}
+
+// isMPLSEtherType reports whether etherType is the Ethernet type of unicast
+// or multicast MPLS.
+func isMPLSEtherType(etherType uint16) bool {
+	return etherType == etherTypeMPLS || etherType == etherTypeMPLSMulticast
+}
@@ -0,0 +1,231 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMPLSMarshalText(t *testing.T) {
+	var tests = []struct {
+		desc    string
+		m       Match
+		a       Action
+		out     string
+		gs      string
+		invalid bool
+	}{
+		{
+			desc: "mpls_label",
+			m:    MPLSLabel(100),
+			out:  "mpls_label=100",
+			gs:   "ovs.MPLSLabel(100)",
+		},
+		{
+			desc:    "mpls_label too large",
+			m:       MPLSLabel(1 << 20),
+			invalid: true,
+		},
+		{
+			desc: "mpls_tc",
+			m:    MPLSTrafficClass(5),
+			out:  "mpls_tc=5",
+			gs:   "ovs.MPLSTrafficClass(5)",
+		},
+		{
+			desc:    "mpls_tc too large",
+			m:       MPLSTrafficClass(8),
+			invalid: true,
+		},
+		{
+			desc: "mpls_bos",
+			m:    MPLSBottomOfStack(true),
+			out:  "mpls_bos=1",
+			gs:   "ovs.MPLSBottomOfStack(true)",
+		},
+		{
+			desc: "mpls_bos not set",
+			m:    MPLSBottomOfStack(false),
+			out:  "mpls_bos=0",
+			gs:   "ovs.MPLSBottomOfStack(false)",
+		},
+		{
+			desc: "mpls_ttl",
+			m:    MPLSTTL(64),
+			out:  "mpls_ttl=64",
+			gs:   "ovs.MPLSTTL(64)",
+		},
+		{
+			desc: "push_mpls",
+			a:    PushMPLS(0x8847),
+			out:  "push_mpls:0x8847",
+			gs:   "ovs.PushMPLS(0x8847)",
+		},
+		{
+			desc:    "push_mpls non-MPLS Ethernet type",
+			a:       PushMPLS(0x0800),
+			invalid: true,
+		},
+		{
+			desc: "pop_mpls",
+			a:    PopMPLS(0x0800),
+			out:  "pop_mpls:0x0800",
+			gs:   "ovs.PopMPLS(0x0800)",
+		},
+		{
+			desc: "set_mpls_label",
+			a:    SetMPLSLabel(200),
+			out:  "set_mpls_label(200)",
+			gs:   "ovs.SetMPLSLabel(200)",
+		},
+		{
+			desc:    "set_mpls_label too large",
+			a:       SetMPLSLabel(1 << 20),
+			invalid: true,
+		},
+		{
+			desc: "dec_mpls_ttl",
+			a:    DecMPLSTTL(),
+			out:  "dec_mpls_ttl",
+			gs:   "ovs.DecMPLSTTL()",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var (
+				out []byte
+				err error
+				gs  string
+			)
+			if tt.m != nil {
+				out, err = tt.m.MarshalText()
+				gs = tt.m.GoString()
+			} else {
+				out, err = tt.a.MarshalText()
+				gs = tt.a.GoString()
+			}
+
+			if tt.invalid {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if want, got := tt.out, string(out); want != got {
+				t.Fatalf("unexpected output:\n- want: %q\n-  got: %q", want, got)
+			}
+			if want, got := tt.gs, gs; want != got {
+				t.Fatalf("unexpected Go syntax:\n- want: %q\n-  got: %q", want, got)
+			}
+		})
+	}
+}
+
+func TestMPLSParse(t *testing.T) {
+	var tests = []struct {
+		s       string
+		m       Match
+		a       Action
+		invalid bool
+	}{
+		{
+			s: "mpls_label=100",
+			m: MPLSLabel(100),
+		},
+		{
+			s:       "mpls_label=1048576",
+			invalid: true,
+		},
+		{
+			s: "mpls_tc=7",
+			m: MPLSTrafficClass(7),
+		},
+		{
+			s: "mpls_bos=1",
+			m: MPLSBottomOfStack(true),
+		},
+		{
+			s:       "mpls_bos=2",
+			invalid: true,
+		},
+		{
+			s: "mpls_ttl=255",
+			m: MPLSTTL(255),
+		},
+		{
+			s: "push_mpls:0x8848",
+			a: PushMPLS(0x8848),
+		},
+		{
+			s: "pop_mpls:0x86dd",
+			a: PopMPLS(0x86dd),
+		},
+		{
+			s:       "pop_mpls:foo",
+			invalid: true,
+		},
+		{
+			s: "set_mpls_label(16)",
+			a: SetMPLSLabel(16),
+		},
+		{
+			s:       "set_mpls_label(1048576)",
+			invalid: true,
+		},
+		{
+			s: "dec_mpls_ttl",
+			a: DecMPLSTTL(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			var (
+				got interface{}
+				err error
+			)
+			if i := strings.IndexByte(tt.s, '='); i != -1 && tt.a == nil {
+				got, err = parseMatch(tt.s[:i], tt.s[i+1:])
+			} else {
+				got, err = parseAction(tt.s)
+			}
+
+			if tt.invalid {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var want interface{} = tt.m
+			if tt.a != nil {
+				want = tt.a
+			}
+			if !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected value:\n- want: %#v\n-  got: %#v", want, got)
+			}
+		})
+	}
+}
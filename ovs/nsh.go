@@ -0,0 +1,318 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// errInvalidNSHServicePathID is returned when an NSH service path ID
+	// does not fit in the 24 bit service path field.
+	errInvalidNSHServicePathID = errors.New("NSH service path ID must be between 0 and 16777215")
+
+	// errInvalidNSHContext is returned when an NSH context header other
+	// than 1 through 4 is specified.
+	errInvalidNSHContext = errors.New("NSH context header must be between 1 and 4")
+
+	// errInvalidNSHMDType is returned when EncapNSH is called with an NSH
+	// metadata type other than 1 or 2.
+	errInvalidNSHMDType = errors.New("NSH metadata type must be 1 or 2")
+)
+
+// Constants of NSH Match and Action names.
+const (
+	nshSPI = "nsh_spi"
+	nshSI  = "nsh_si"
+	nshC1  = "nsh_c1"
+	nshC2  = "nsh_c2"
+	nshC3  = "nsh_c3"
+	nshC4  = "nsh_c4"
+
+	actionEncap = "encap"
+	actionDecap = "decap"
+)
+
+// maxNSHServicePathID is the largest NSH service path ID.
+const maxNSHServicePathID = 1<<24 - 1
+
+// NSHServicePathID matches NSH packets with the service path ID spi.  spi
+// must fit in 24 bits.
+func NSHServicePathID(spi uint32) Match {
+	return &nshMatch{
+		field: nshSPI,
+		value: spi,
+	}
+}
+
+// NSHServiceIndex matches NSH packets with the service index si.
+func NSHServiceIndex(si uint8) Match {
+	return &nshMatch{
+		field: nshSI,
+		value: uint32(si),
+	}
+}
+
+// NSHContext matches NSH packets whose context header n, between 1 and 4,
+// matches value.  If mask is zero, value must match exactly; otherwise only
+// the bits set in mask are matched.
+func NSHContext(n int, value, mask uint32) Match {
+	return &nshMatch{
+		field: fmt.Sprintf("nsh_c%d", n),
+		n:     n,
+		value: value,
+		mask:  mask,
+	}
+}
+
+var _ Match = &nshMatch{}
+
+// An nshMatch is a Match returned by NSH{ServicePathID,ServiceIndex,Context}.
+type nshMatch struct {
+	field string
+	n     int
+	value uint32
+	mask  uint32
+}
+
+// MarshalText implements Match.
+func (m *nshMatch) MarshalText() ([]byte, error) {
+	switch m.field {
+	case nshSPI:
+		if m.value > maxNSHServicePathID {
+			return nil, errInvalidNSHServicePathID
+		}
+
+		return bprintf("%s=0x%x", m.field, m.value), nil
+	case nshSI:
+		return bprintf("%s=%d", m.field, m.value), nil
+	}
+
+	if m.n < 1 || m.n > 4 {
+		return nil, errInvalidNSHContext
+	}
+	if m.mask == 0 {
+		return bprintf("%s=0x%x", m.field, m.value), nil
+	}
+
+	return bprintf("%s=0x%x/0x%x", m.field, m.value, m.mask), nil
+}
+
+// GoString implements Match.
+func (m *nshMatch) GoString() string {
+	switch m.field {
+	case nshSPI:
+		return fmt.Sprintf("ovs.NSHServicePathID(0x%x)", m.value)
+	case nshSI:
+		return fmt.Sprintf("ovs.NSHServiceIndex(%d)", m.value)
+	}
+
+	return fmt.Sprintf("ovs.NSHContext(%d, 0x%x, 0x%x)", m.n, m.value, m.mask)
+}
+
+// parseNSHMatch parses an NSH Match from the input key and value.
+func parseNSHMatch(key, value string) (Match, error) {
+	switch key {
+	case nshSPI:
+		spi, err := strconv.ParseUint(value, 0, 24)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s match: %q", key, value)
+		}
+
+		return NSHServicePathID(uint32(spi)), nil
+	case nshSI:
+		si, err := strconv.ParseUint(value, 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s match: %q", key, value)
+		}
+
+		return NSHServiceIndex(uint8(si)), nil
+	}
+
+	v, mask, err := parseMaskedUint64(value)
+	if err != nil || v > 0xffffffff || mask > 0xffffffff {
+		return nil, fmt.Errorf("invalid %s match: %q", key, value)
+	}
+
+	// An all ones mask is an exact match.
+	if mask == 0xffffffff {
+		mask = 0
+	}
+
+	return NSHContext(int(key[len(key)-1]-'0'), uint32(v), uint32(mask)), nil
+}
+
+// Headers which may be added by an encap action.
+const (
+	encapNSH      = "nsh"
+	encapEthernet = "ethernet"
+)
+
+// EncapNSH encapsulates a packet in an NSH header.  If mdType is zero, Open
+// vSwitch chooses the NSH metadata type; otherwise it must be 1 or 2.
+func EncapNSH(mdType uint8) Action {
+	return &encapAction{
+		header: encapNSH,
+		mdType: mdType,
+	}
+}
+
+// EncapEthernet encapsulates a packet in an Ethernet header, such as after
+// EncapNSH in a service function chain.
+func EncapEthernet() Action {
+	return &encapAction{
+		header: encapEthernet,
+	}
+}
+
+// Encap encapsulates a packet in the header described by header, in the
+// form used by Open vSwitch, such as "mpls" or "nsh(md_type=2,tlv(...))".
+// Prefer EncapNSH and EncapEthernet for the headers they support.
+func Encap(header string) Action {
+	return &encapAction{
+		header: header,
+	}
+}
+
+// An encapAction is an Action which is used by Encap, EncapNSH and
+// EncapEthernet.
+type encapAction struct {
+	header string
+	mdType uint8
+}
+
+// MarshalText implements Action.
+func (a *encapAction) MarshalText() ([]byte, error) {
+	if a.header != encapNSH {
+		return bprintf("%s(%s)", actionEncap, a.header), nil
+	}
+
+	switch a.mdType {
+	case 0:
+		return []byte(actionEncap + "(nsh)"), nil
+	case 1, 2:
+		return bprintf("%s(nsh(md_type=%d))", actionEncap, a.mdType), nil
+	}
+
+	return nil, errInvalidNSHMDType
+}
+
+// GoString implements Action.
+func (a *encapAction) GoString() string {
+	switch a.header {
+	case encapNSH:
+		return fmt.Sprintf("ovs.EncapNSH(%d)", a.mdType)
+	case encapEthernet:
+		return "ovs.EncapEthernet()"
+	}
+
+	return fmt.Sprintf("ovs.Encap(%q)", a.header)
+}
+
+// Decap removes the outermost encapsulation header, such as NSH, from a
+// packet.
+func Decap() Action {
+	return &decapAction{}
+}
+
+// DecapPacketType removes the outermost encapsulation header from a packet,
+// and specifies that the packet which remains has the packet type with
+// namespace ns and type typ.  See PacketType for the meaning of ns and typ.
+func DecapPacketType(ns, typ uint16) Action {
+	return &decapAction{
+		packetType: true,
+		namespace:  ns,
+		typ:        typ,
+	}
+}
+
+// A decapAction is an Action which is used by Decap and DecapPacketType.
+type decapAction struct {
+	packetType bool
+	namespace  uint16
+	typ        uint16
+}
+
+// MarshalText implements Action.
+func (a *decapAction) MarshalText() ([]byte, error) {
+	if !a.packetType {
+		return []byte(actionDecap + "()"), nil
+	}
+
+	// Open vSwitch prints a zero type without a prefix.
+	typ := "0"
+	if a.typ != 0 {
+		typ = fmt.Sprintf("%#x", a.typ)
+	}
+
+	return bprintf("%s(packet_type(ns=%d,type=%s))", actionDecap, a.namespace, typ), nil
+}
+
+// GoString implements Action.
+func (a *decapAction) GoString() string {
+	if !a.packetType {
+		return "ovs.Decap()"
+	}
+
+	return fmt.Sprintf("ovs.DecapPacketType(%d, %#x)", a.namespace, a.typ)
+}
+
+// parseEncap parses the argument of an encap action, such as "nsh",
+// "nsh(md_type=1)", or "ethernet".  Headers which have no typed Action are
+// parsed using Encap.
+func parseEncap(arg string) (Action, error) {
+	switch {
+	case arg == "":
+		return nil, fmt.Errorf("invalid %s action: %q", actionEncap, arg)
+	case arg == encapNSH:
+		return EncapNSH(0), nil
+	case arg == encapEthernet:
+		return EncapEthernet(), nil
+	case strings.HasPrefix(arg, "nsh(md_type=") && strings.HasSuffix(arg, ")"):
+		mdType, err := strconv.ParseUint(arg[len("nsh(md_type="):len(arg)-1], 10, 8)
+		if err == nil && (mdType == 1 || mdType == 2) {
+			return EncapNSH(uint8(mdType)), nil
+		}
+	}
+
+	return Encap(arg), nil
+}
+
+// parseDecap parses the argument of a decap action, which is empty or a
+// packet type such as "packet_type(ns=0,type=0)".
+func parseDecap(arg string) (Action, error) {
+	if arg == "" {
+		return Decap(), nil
+	}
+
+	var ns, typ uint64
+	ss := strings.Split(strings.TrimSuffix(strings.TrimPrefix(arg, "packet_type("), ")"), ",")
+	ok := strings.HasPrefix(arg, "packet_type(") && strings.HasSuffix(arg, ")") && len(ss) == 2
+	if ok {
+		var err error
+		ns, err = strconv.ParseUint(strings.TrimPrefix(ss[0], "ns="), 0, 16)
+		ok = err == nil && strings.HasPrefix(ss[0], "ns=")
+		typ, err = strconv.ParseUint(strings.TrimPrefix(ss[1], "type="), 0, 16)
+		ok = ok && err == nil && strings.HasPrefix(ss[1], "type=")
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid %s action: %q", actionDecap, arg)
+	}
+
+	return DecapPacketType(uint16(ns), uint16(typ)), nil
+}
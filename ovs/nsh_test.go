@@ -0,0 +1,258 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNSHMarshalText(t *testing.T) {
+	var tests = []struct {
+		desc    string
+		m       Match
+		a       Action
+		out     string
+		gs      string
+		invalid bool
+	}{
+		{
+			desc: "nsh_spi",
+			m:    NSHServicePathID(0x10),
+			out:  "nsh_spi=0x10",
+			gs:   "ovs.NSHServicePathID(0x10)",
+		},
+		{
+			desc:    "nsh_spi too large",
+			m:       NSHServicePathID(1 << 24),
+			invalid: true,
+		},
+		{
+			desc: "nsh_si",
+			m:    NSHServiceIndex(255),
+			out:  "nsh_si=255",
+			gs:   "ovs.NSHServiceIndex(255)",
+		},
+		{
+			desc: "nsh_c1",
+			m:    NSHContext(1, 0xdeadbeef, 0),
+			out:  "nsh_c1=0xdeadbeef",
+			gs:   "ovs.NSHContext(1, 0xdeadbeef, 0x0)",
+		},
+		{
+			desc: "nsh_c4 with mask",
+			m:    NSHContext(4, 0x10, 0xf0),
+			out:  "nsh_c4=0x10/0xf0",
+			gs:   "ovs.NSHContext(4, 0x10, 0xf0)",
+		},
+		{
+			desc:    "nsh_c5",
+			m:       NSHContext(5, 0x1, 0),
+			invalid: true,
+		},
+		{
+			desc: "encap(nsh)",
+			a:    EncapNSH(0),
+			out:  "encap(nsh)",
+			gs:   "ovs.EncapNSH(0)",
+		},
+		{
+			desc: "encap(nsh) with md_type",
+			a:    EncapNSH(2),
+			out:  "encap(nsh(md_type=2))",
+			gs:   "ovs.EncapNSH(2)",
+		},
+		{
+			desc:    "encap(nsh) invalid md_type",
+			a:       EncapNSH(3),
+			invalid: true,
+		},
+		{
+			desc: "decap",
+			a:    Decap(),
+			out:  "decap()",
+			gs:   "ovs.Decap()",
+		},
+		{
+			desc: "encap(ethernet)",
+			a:    EncapEthernet(),
+			out:  "encap(ethernet)",
+			gs:   "ovs.EncapEthernet()",
+		},
+		{
+			desc: "encap other header",
+			a:    Encap("mpls"),
+			out:  "encap(mpls)",
+			gs:   `ovs.Encap("mpls")`,
+		},
+		{
+			desc: "decap Ethernet",
+			a:    DecapPacketType(PacketNamespaceOpenFlow, 0),
+			out:  "decap(packet_type(ns=0,type=0))",
+			gs:   "ovs.DecapPacketType(0, 0x0)",
+		},
+		{
+			desc: "decap IPv4",
+			a:    DecapPacketType(PacketNamespaceEtherType, 0x0800),
+			out:  "decap(packet_type(ns=1,type=0x800))",
+			gs:   "ovs.DecapPacketType(1, 0x800)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var (
+				out []byte
+				err error
+				gs  string
+			)
+			if tt.m != nil {
+				out, err = tt.m.MarshalText()
+				gs = tt.m.GoString()
+			} else {
+				out, err = tt.a.MarshalText()
+				gs = tt.a.GoString()
+			}
+
+			if tt.invalid {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if want, got := tt.out, string(out); want != got {
+				t.Fatalf("unexpected output:\n- want: %q\n-  got: %q", want, got)
+			}
+			if want, got := tt.gs, gs; want != got {
+				t.Fatalf("unexpected Go syntax:\n- want: %q\n-  got: %q", want, got)
+			}
+		})
+	}
+}
+
+func TestNSHParse(t *testing.T) {
+	var tests = []struct {
+		s       string
+		m       Match
+		a       Action
+		invalid bool
+	}{
+		{
+			s: "nsh_spi=0x10",
+			m: NSHServicePathID(0x10),
+		},
+		{
+			s:       "nsh_spi=0x1000000",
+			invalid: true,
+		},
+		{
+			s: "nsh_si=254",
+			m: NSHServiceIndex(254),
+		},
+		{
+			s: "nsh_c2=0x1",
+			m: NSHContext(2, 0x1, 0),
+		},
+		{
+			s: "nsh_c3=0x1/0xffffffff",
+			m: NSHContext(3, 0x1, 0),
+		},
+		{
+			s: "nsh_c4=0x10/0xf0",
+			m: NSHContext(4, 0x10, 0xf0),
+		},
+		{
+			s:       "nsh_c1=0x100000000",
+			invalid: true,
+		},
+		{
+			s: "encap(nsh)",
+			a: EncapNSH(0),
+		},
+		{
+			s: "encap(nsh(md_type=1))",
+			a: EncapNSH(1),
+		},
+		{
+			s: "encap(ethernet)",
+			a: EncapEthernet(),
+		},
+		{
+			s: "encap(nsh(md_type=2,tlv(0x1000,10,0x12345678)))",
+			a: Encap("nsh(md_type=2,tlv(0x1000,10,0x12345678))"),
+		},
+		{
+			s:       "encap()",
+			invalid: true,
+		},
+		{
+			s: "decap()",
+			a: Decap(),
+		},
+		{
+			s: "decap(packet_type(ns=0,type=0))",
+			a: DecapPacketType(PacketNamespaceOpenFlow, 0),
+		},
+		{
+			s: "decap(packet_type(ns=1,type=0x894f))",
+			a: DecapPacketType(PacketNamespaceEtherType, 0x894f),
+		},
+		{
+			s:       "decap(packet_type(ns=1))",
+			invalid: true,
+		},
+		{
+			s:       "decap(ethernet)",
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			var (
+				got interface{}
+				err error
+			)
+			if i := strings.IndexByte(tt.s, '='); i != -1 && tt.a == nil {
+				got, err = parseMatch(tt.s[:i], tt.s[i+1:])
+			} else {
+				got, err = parseAction(tt.s)
+			}
+
+			if tt.invalid {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var want interface{} = tt.m
+			if tt.a != nil {
+				want = tt.a
+			}
+			if !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected value:\n- want: %#v\n-  got: %#v", want, got)
+			}
+		})
+	}
+}
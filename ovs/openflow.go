@@ -17,10 +17,12 @@ package ovs
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding"
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
 )
 
 var (
@@ -41,6 +43,18 @@ type OpenFlowService struct {
 
 // AddFlow adds a Flow to a bridge attached to Open vSwitch.
 func (o *OpenFlowService) AddFlow(bridge string, flow *Flow) error {
+	return o.AddFlowContext(context.Background(), bridge, flow)
+}
+
+// AddFlowContext is the same as AddFlow, but accepts a context.Context which
+// can be used to cancel the command or apply a deadline.
+func (o *OpenFlowService) AddFlowContext(ctx context.Context, bridge string, flow *Flow) error {
+	if o.c.validate {
+		if err := flow.Validate(); err != nil {
+			return err
+		}
+	}
+
 	fb, err := flow.MarshalText()
 	if err != nil {
 		return err
@@ -48,10 +62,13 @@ func (o *OpenFlowService) AddFlow(bridge string, flow *Flow) error {
 
 	args := []string{"add-flow"}
 	args = append(args, o.c.ofctlFlags...)
-	args = append(args, []string{bridge, string(fb)}...)
+	args = append(args, []string{o.target(bridge), string(fb)}...)
 
-	_, err = o.exec(args...)
-	return err
+	if _, err := o.exec(ctx, args...); err != nil {
+		return flowParseError(err, string(fb))
+	}
+
+	return nil
 }
 
 // A FlowTransaction is a transaction used when adding or deleting
@@ -60,6 +77,10 @@ type FlowTransaction struct {
 	flows     []flowDirective
 	committed bool
 	err       error
+
+	// validate specifies whether flows are validated before being pushed
+	// on to the transaction.
+	validate bool
 }
 
 // A flowDirective is a directive and flow string pair, used to perform
@@ -67,6 +88,9 @@ type FlowTransaction struct {
 type flowDirective struct {
 	directive string
 	flow      string
+
+	// source is the Flow or MatchFlow which produced flow.
+	source encoding.TextMarshaler
 }
 
 // Possible flowDirective directive values.
@@ -127,6 +151,13 @@ func (tx *FlowTransaction) DeleteStrict(flows ...*MatchFlow) {
 // (typically a Flow or MatchFlow).
 func (tx *FlowTransaction) push(directive string, flows ...encoding.TextMarshaler) {
 	for _, f := range flows {
+		if v, ok := f.(validator); ok && tx.validate {
+			if err := v.Validate(); err != nil {
+				tx.err = err
+				return
+			}
+		}
+
 		fb, err := f.MarshalText()
 		if err != nil {
 			tx.err = err
@@ -136,6 +167,7 @@ func (tx *FlowTransaction) push(directive string, flows ...encoding.TextMarshale
 		tx.flows = append(tx.flows, flowDirective{
 			directive: directive,
 			flow:      string(fb),
+			source:    f,
 		})
 	}
 }
@@ -166,11 +198,70 @@ func (tx *FlowTransaction) Discard(err error) error {
 // This function enables atomic addition and deletion of flows to and from
 // Open vSwitch.
 func (o *OpenFlowService) AddFlowBundle(bridge string, fn func(tx *FlowTransaction) error) error {
-	// Flows will be added to and read from an in-memory buffer.  The buffer's
-	// contents are piped to 'ovs-ofctl' using stdin.
-	buf := bytes.NewBuffer(nil)
+	return o.AddFlowBundleContext(context.Background(), bridge, fn)
+}
+
+// AddFlowBundleContext is the same as AddFlowBundle, but accepts a
+// context.Context which can be used to cancel the command or apply a deadline.
+func (o *OpenFlowService) AddFlowBundleContext(ctx context.Context, bridge string, fn func(tx *FlowTransaction) error) error {
+	return o.AddFlowBundleOptions(ctx, bridge, BundleOptions{}, fn)
+}
+
+// A BundleMode specifies how Open vSwitch applies the directives of a flow
+// bundle.
+type BundleMode int
+
+// Possible BundleMode values.
+const (
+	// BundleAtomic applies every directive of a bundle, or none of them if
+	// any directive fails.  Atomic bundles use 'ovs-ofctl --bundle', and
+	// require OpenFlow 1.4 or later.
+	BundleAtomic BundleMode = iota
+
+	// BundleOrdered applies directives in order, one at a time, and stops
+	// at the first directive which fails.  'ovs-ofctl' parses every
+	// directive before applying any, so a directive which fails to parse
+	// causes none to be applied.  If the switch rejects a directive, the
+	// directives which precede it remain applied, but Open vSwitch does
+	// not report which directive failed, so it is not known how many were
+	// applied.  Ordered bundles do not require support for OpenFlow
+	// bundles.
+	BundleOrdered
+)
+
+// BundleOptions configures a flow bundle created by AddFlowBundleOptions.
+type BundleOptions struct {
+	// Mode specifies how directives are applied.  The default is
+	// BundleAtomic.
+	Mode BundleMode
+
+	// ChunkSize, if greater than zero, splits transactions with more than
+	// ChunkSize directives into multiple bundles of at most ChunkSize
+	// directives, which are applied in order by separate invocations of
+	// 'ovs-ofctl'.  This bounds the size of each bundle, which Open vSwitch
+	// must hold in memory until it is committed.
+	//
+	// Chunking trades atomicity for size: each chunk of an atomic bundle
+	// is applied atomically, but if a chunk fails, the chunks which
+	// preceded it remain applied and the chunks which follow it are not
+	// applied.  BundleError.Applied reports the number of directives in
+	// the chunks which preceded the failing chunk.  For an ordered bundle
+	// rejected by the switch, some directives of the failing chunk may
+	// also have been applied; they are not included in Applied.
+	ChunkSize int
+}
 
-	tx := &FlowTransaction{}
+// AddFlowBundleOptions is the same as AddFlowBundleContext, but accepts
+// BundleOptions which specify how the bundle is applied.
+//
+// Directives are streamed to the standard input of 'ovs-ofctl' as they are
+// needed, rather than being buffered in their entirety.  If a directive
+// fails, a *BundleError is returned which identifies the directive and the
+// Flow or MatchFlow which produced it.
+func (o *OpenFlowService) AddFlowBundleOptions(ctx context.Context, bridge string, opts BundleOptions, fn func(tx *FlowTransaction) error) error {
+	tx := &FlowTransaction{
+		validate: o.c.validate,
+	}
 	if err := fn(tx); err != nil {
 		// Errors from "tx.Commit()" or "tx.Discard()" will be returned here.
 		return err
@@ -181,52 +272,124 @@ func (o *OpenFlowService) AddFlowBundle(bridge string, fn func(tx *FlowTransacti
 		return errNotCommitted
 	}
 
-	for _, flow := range tx.flows {
-		// Syntax for adding a flow in the file is:
-		// "add priority=10,ip,actions=drop\n"
-		s := fmt.Sprintf("%s %s\n", flow.directive, flow.flow)
-		if _, err := io.WriteString(buf, s); err != nil {
-			return err
-		}
+	var args []string
+	if opts.Mode == BundleAtomic {
+		args = append(args, "--bundle")
 	}
-
-	args := []string{"--bundle", "add-flow"}
+	args = append(args, "add-flow")
 	args = append(args, o.c.ofctlFlags...)
 	// Read from stdin.
-	args = append(args, bridge, "-")
+	args = append(args, o.target(bridge), "-")
+
+	size := opts.ChunkSize
+	if size <= 0 || size > len(tx.flows) {
+		size = len(tx.flows)
+	}
+
+	// An empty transaction is still applied by a single invocation.
+	for offset := 0; ; offset += size {
+		end := offset + size
+		if end > len(tx.flows) {
+			end = len(tx.flows)
+		}
+
+		chunk := tx.flows[offset:end]
+		if err := o.pipe(ctx, &directiveReader{directives: chunk}, args...); err != nil {
+			return bundleError(err, chunk, offset)
+		}
+
+		if end == len(tx.flows) {
+			return nil
+		}
+	}
+}
+
+// A directiveReader is an io.Reader which produces the lines of a flow file
+// for 'ovs-ofctl' from directives, as they are read.
+type directiveReader struct {
+	directives []flowDirective
+	buf        []byte
+}
+
+// Read implements io.Reader.
+func (r *directiveReader) Read(b []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if len(r.directives) == 0 {
+			return 0, io.EOF
+		}
 
-	return o.pipe(buf, args...)
+		// Syntax for adding a flow in the file is:
+		// "add priority=10,ip,actions=drop\n"
+		d := r.directives[0]
+		r.directives = r.directives[1:]
+		r.buf = append(r.buf[:0], d.directive...)
+		r.buf = append(r.buf, ' ')
+		r.buf = append(r.buf, d.flow...)
+		r.buf = append(r.buf, '\n')
+	}
+
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
 }
 
 // DelFlows removes flows that match MatchFlow from a bridge attached to Open vSwitch.
 //
 // If flow is nil, all flows will be deleted from the specified bridge.
 func (o *OpenFlowService) DelFlows(bridge string, flow *MatchFlow) error {
+	return o.DelFlowsContext(context.Background(), bridge, flow)
+}
+
+// DelFlowsContext is the same as DelFlows, but accepts a context.Context which
+// can be used to cancel the command or apply a deadline.
+func (o *OpenFlowService) DelFlowsContext(ctx context.Context, bridge string, flow *MatchFlow) error {
 	if flow == nil {
 		// This means we'll flush the entire flows
 		// from the specifided bridge.
-		_, err := o.exec("del-flows", bridge)
+		_, err := o.exec(ctx, "del-flows", o.target(bridge))
 		return err
 	}
+
+	if o.c.validate {
+		if err := flow.Validate(); err != nil {
+			return err
+		}
+	}
+
 	fb, err := flow.MarshalText()
 	if err != nil {
 		return err
 	}
 
-	_, err = o.exec("del-flows", bridge, string(fb))
-	return err
+	if _, err := o.exec(ctx, "del-flows", o.target(bridge), string(fb)); err != nil {
+		return flowParseError(err, string(fb))
+	}
+
+	return nil
 }
 
 // ModPort modifies the specified characteristics for the specified port.
 func (o *OpenFlowService) ModPort(bridge string, port string, action PortAction) error {
-	_, err := o.exec("mod-port", bridge, string(port), string(action))
+	return o.ModPortContext(context.Background(), bridge, port, action)
+}
+
+// ModPortContext is the same as ModPort, but accepts a context.Context which
+// can be used to cancel the command or apply a deadline.
+func (o *OpenFlowService) ModPortContext(ctx context.Context, bridge string, port string, action PortAction) error {
+	_, err := o.exec(ctx, "mod-port", o.target(bridge), string(port), string(action))
 	return err
 }
 
 // DumpPort retrieves statistics about the specified port attached to the
 // specified bridge.
 func (o *OpenFlowService) DumpPort(bridge string, port string) (*PortStats, error) {
-	stats, err := o.dumpPorts(bridge, port)
+	return o.DumpPortContext(context.Background(), bridge, port)
+}
+
+// DumpPortContext is the same as DumpPort, but accepts a context.Context which
+// can be used to cancel the command or apply a deadline.
+func (o *OpenFlowService) DumpPortContext(ctx context.Context, bridge string, port string) (*PortStats, error) {
+	stats, err := o.dumpPorts(ctx, bridge, port)
 	if err != nil {
 		return nil, err
 	}
@@ -240,14 +403,26 @@ func (o *OpenFlowService) DumpPort(bridge string, port string) (*PortStats, erro
 // DumpPorts retrieves statistics about all ports attached to the specified
 // bridge.
 func (o *OpenFlowService) DumpPorts(bridge string) ([]*PortStats, error) {
-	return o.dumpPorts(bridge, "")
+	return o.DumpPortsContext(context.Background(), bridge)
+}
+
+// DumpPortsContext is the same as DumpPorts, but accepts a context.Context
+// which can be used to cancel the command or apply a deadline.
+func (o *OpenFlowService) DumpPortsContext(ctx context.Context, bridge string) ([]*PortStats, error) {
+	return o.dumpPorts(ctx, bridge, "")
 }
 
 // DumpTables retrieves statistics about all tables for the specified bridge.
 // If a table has no active flows and has not been used for a lookup or matched
 // by an incoming packet, it is filtered from the output.
 func (o *OpenFlowService) DumpTables(bridge string) ([]*Table, error) {
-	out, err := o.exec("dump-tables", bridge)
+	return o.DumpTablesContext(context.Background(), bridge)
+}
+
+// DumpTablesContext is the same as DumpTables, but accepts a context.Context
+// which can be used to cancel the command or apply a deadline.
+func (o *OpenFlowService) DumpTablesContext(ctx context.Context, bridge string) ([]*Table, error) {
+	out, err := o.exec(ctx, "dump-tables", o.target(bridge))
 	if err != nil {
 		return nil, err
 	}
@@ -271,38 +446,267 @@ func (o *OpenFlowService) DumpTables(bridge string) ([]*Table, error) {
 	return tables, err
 }
 
+// DumpTableFeatures retrieves the features of all tables for the specified
+// bridge, including their supported matches, instructions, and actions.
+// Open vSwitch requires OpenFlow 1.3 or later for this command, which can be
+// enabled using the Protocols OptionFunc.
+func (o *OpenFlowService) DumpTableFeatures(bridge string) ([]*TableFeatures, error) {
+	return o.DumpTableFeaturesContext(context.Background(), bridge)
+}
+
+// DumpTableFeaturesContext is the same as DumpTableFeatures, but accepts a
+// context.Context which can be used to cancel the command or apply a deadline.
+func (o *OpenFlowService) DumpTableFeaturesContext(ctx context.Context, bridge string) ([]*TableFeatures, error) {
+	args := []string{"dump-table-features"}
+	args = append(args, o.c.ofctlFlags...)
+	args = append(args, o.target(bridge))
+
+	out, err := o.exec(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTableFeatures(out)
+}
+
+// ModTable modifies the configuration of the specified table on a bridge
+// using the values from a TableOptions struct.  The table's name is stored
+// in the Open vSwitch database using 'ovs-vsctl', and all other settings
+// are applied using 'ovs-ofctl mod-table'.
+func (o *OpenFlowService) ModTable(bridge string, table int, options TableOptions) error {
+	return o.ModTableContext(context.Background(), bridge, table, options)
+}
+
+// ModTableContext is the same as ModTable, but accepts a context.Context which
+// can be used to cancel the command or apply a deadline.
+func (o *OpenFlowService) ModTableContext(ctx context.Context, bridge string, table int, options TableOptions) error {
+	settings, err := options.slice()
+	if err != nil {
+		return err
+	}
+
+	if options.Name != "" {
+		if err := o.c.VSwitch.setFlowTableName(ctx, bridge, table, options.Name); err != nil {
+			return err
+		}
+	}
+
+	// 'ovs-ofctl mod-table' only accepts a single setting per invocation.
+	for _, s := range settings {
+		args := []string{"mod-table"}
+		args = append(args, o.c.ofctlFlags...)
+		args = append(args, o.target(bridge), strconv.Itoa(table), s)
+
+		if _, err := o.exec(ctx, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // DumpFlows retrieves statistics about all flows for the specified bridge.
 // If a table has no active flows and has not been used for a lookup or matched
-// by an incoming packet, it is filtered from the output.
+// by an incoming packet, it is filtered from the output.  Flows which have
+// the default priority are returned with a Priority of DefaultPriority; see
+// Flow.UnmarshalText.
 func (o *OpenFlowService) DumpFlows(bridge string) ([]*Flow, error) {
-	out, err := o.exec("dump-flows", bridge)
+	return o.DumpFlowsContext(context.Background(), bridge)
+}
+
+// DumpFlowsContext is the same as DumpFlows, but accepts a context.Context
+// which can be used to cancel the command or apply a deadline.
+func (o *OpenFlowService) DumpFlowsContext(ctx context.Context, bridge string) ([]*Flow, error) {
+	fs, err := o.ScanFlowsContext(ctx, bridge)
 	if err != nil {
 		return nil, err
 	}
+	defer fs.Close()
 
 	var flows []*Flow
+	for fs.Scan() {
+		flows = append(flows, fs.Flow())
+	}
+
+	return flows, fs.Err()
+}
+
+// ScanFlows retrieves the flows attached to the specified bridge as a
+// FlowScanner, which parses each flow from the output of 'ovs-ofctl' as it
+// is read.  Unlike DumpFlows, the memory used by a FlowScanner does not grow
+// with the number of flows, and a scan may be terminated early by calling
+// Close.  Close must always be called when the FlowScanner is no longer
+// needed.
+func (o *OpenFlowService) ScanFlows(bridge string) (*FlowScanner, error) {
+	return o.ScanFlowsContext(context.Background(), bridge)
+}
+
+// ScanFlowsContext is the same as ScanFlows, but accepts a context.Context
+// which can be used to cancel the command or apply a deadline.
+func (o *OpenFlowService) ScanFlowsContext(ctx context.Context, bridge string) (*FlowScanner, error) {
+	rc, err := o.c.stream(ctx, "ovs-ofctl", "dump-flows", o.target(bridge))
+	if err != nil {
+		return nil, err
+	}
+
+	return &FlowScanner{
+		rc: rc,
+		s:  bufio.NewScanner(rc),
+	}, nil
+}
+
+// A FlowScanner parses flows from the output of 'ovs-ofctl dump-flows', one
+// at a time.  Use OpenFlowService.ScanFlows to create a FlowScanner.
+//
+// Successive calls to Scan step through the flows, in the manner of a
+// bufio.Scanner:
+//
+//	fs, err := c.OpenFlow.ScanFlows("br0")
+//	if err != nil {
+//		// Handle error.
+//	}
+//	defer fs.Close()
+//
+//	for fs.Scan() {
+//		f := fs.Flow()
+//		// Use f, or break to stop scanning.
+//	}
+//	if err := fs.Err(); err != nil {
+//		// Handle error.
+//	}
+type FlowScanner struct {
+	rc     io.ReadCloser
+	s      *bufio.Scanner
+	flow   *Flow
+	header bool
+	done   bool
+	err    error
+}
+
+// Scan advances the FlowScanner to the next flow, which is then available
+// through the Flow method.  Scan returns false when there are no more flows,
+// or when an error occurs.  After Scan returns false, the Err method returns
+// any error that occurred.
+func (fs *FlowScanner) Scan() bool {
+	if fs.done {
+		return false
+	}
+
+	for fs.s.Scan() {
+		b := fs.s.Bytes()
+
+		// First line must contain prefix returned by OVS.
+		if !fs.header {
+			if !bytes.HasPrefix(b, dumpFlowsPrefix) {
+				return fs.stop(io.ErrUnexpectedEOF)
+			}
+
+			fs.header = true
+			continue
+		}
+
+		// Do not attempt to parse NXST_FLOW messages or empty lines.
+		if bytes.HasPrefix(b, dumpFlowsPrefix) || len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+
+		f := new(Flow)
+		if err := f.UnmarshalText(b); err != nil {
+			return fs.stop(err)
+		}
+
+		fs.flow = f
+		return true
+	}
+
+	err := fs.s.Err()
+	if err == nil && !fs.header {
+		// First line must not be empty.
+		err = io.ErrUnexpectedEOF
+	}
+
+	return fs.stop(err)
+}
+
+// stop finishes a scan with the error err, closing the underlying stream.
+// If err is nil, any error reported by 'ovs-ofctl' is used instead.
+func (fs *FlowScanner) stop(err error) bool {
+	fs.done = true
+	fs.flow = nil
+
+	if cerr := fs.rc.Close(); err == nil {
+		err = cerr
+	}
+	fs.err = err
+
+	return false
+}
+
+// Flow returns the most recent flow parsed by a call to Scan.
+func (fs *FlowScanner) Flow() *Flow {
+	return fs.flow
+}
+
+// Err returns the first error that was encountered by the FlowScanner.
+func (fs *FlowScanner) Err() error {
+	return fs.err
+}
+
+// Close stops a scan, terminating 'ovs-ofctl' if it is still running.
+// Close may be called more than once, and after Scan returns false.
+func (fs *FlowScanner) Close() error {
+	if fs.done {
+		return nil
+	}
+
+	fs.done = true
+	fs.flow = nil
+	return fs.rc.Close()
+}
+
+// DumpFlowUsage retrieves the flows attached to the specified bridge along
+// with their counters, for use with AnalyzeFlows.
+func (o *OpenFlowService) DumpFlowUsage(bridge string) ([]*FlowUsage, error) {
+	return o.DumpFlowUsageContext(context.Background(), bridge)
+}
+
+// DumpFlowUsageContext is the same as DumpFlowUsage, but accepts a
+// context.Context which can be used to cancel the command or apply a deadline.
+func (o *OpenFlowService) DumpFlowUsageContext(ctx context.Context, bridge string) ([]*FlowUsage, error) {
+	out, err := o.exec(ctx, "dump-flows", o.target(bridge))
+	if err != nil {
+		return nil, err
+	}
+
+	var usage []*FlowUsage
 	err = parseEachLine(out, dumpFlowsPrefix, func(b []byte) error {
 		// Do not attempt to parse NXST_FLOW messages.
 		if bytes.HasPrefix(b, dumpFlowsPrefix) {
 			return nil
 		}
 
-		f := new(Flow)
-		if err := f.UnmarshalText(b); err != nil {
+		u := new(FlowUsage)
+		if err := u.UnmarshalText(b); err != nil {
 			return err
 		}
 
-		flows = append(flows, f)
+		usage = append(usage, u)
 		return nil
 	})
 
-	return flows, err
+	return usage, err
 }
 
 // DumpAggregate retrieves statistics about the specified flow attached to the
 // specified bridge.
 func (o *OpenFlowService) DumpAggregate(bridge string, flow *MatchFlow) (*FlowStats, error) {
-	stats, err := o.dumpAggregate(bridge, flow)
+	return o.DumpAggregateContext(context.Background(), bridge, flow)
+}
+
+// DumpAggregateContext is the same as DumpAggregate, but accepts a
+// context.Context which can be used to cancel the command or apply a deadline.
+func (o *OpenFlowService) DumpAggregateContext(ctx context.Context, bridge string, flow *MatchFlow) (*FlowStats, error) {
+	stats, err := o.dumpAggregate(ctx, bridge, flow)
 	if err != nil {
 		return nil, err
 	}
@@ -330,10 +734,10 @@ var (
 
 // dumpPorts calls 'ovs-ofctl dump-ports' with the specified arguments and
 // parses the output into zero or more PortStats structs.
-func (o *OpenFlowService) dumpPorts(bridge string, port string) ([]*PortStats, error) {
+func (o *OpenFlowService) dumpPorts(ctx context.Context, bridge string, port string) ([]*PortStats, error) {
 	args := []string{
 		"dump-ports",
-		bridge,
+		o.target(bridge),
 	}
 
 	args = append(o.c.ofctlFlags, args...)
@@ -343,7 +747,7 @@ func (o *OpenFlowService) dumpPorts(bridge string, port string) ([]*PortStats, e
 		args = append(args, string(port))
 	}
 
-	out, err := o.exec(args...)
+	out, err := o.exec(ctx, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -364,7 +768,7 @@ func (o *OpenFlowService) dumpPorts(bridge string, port string) ([]*PortStats, e
 
 // dumpAggregate calls 'ovs-ofctl dump-aggregate' with the specified arguments and
 // parses the output into zero or more FlowStat structs.
-func (o *OpenFlowService) dumpAggregate(bridge string, flow *MatchFlow) (*FlowStats, error) {
+func (o *OpenFlowService) dumpAggregate(ctx context.Context, bridge string, flow *MatchFlow) (*FlowStats, error) {
 
 	flowText, err := flow.MarshalText()
 	if err != nil {
@@ -373,13 +777,13 @@ func (o *OpenFlowService) dumpAggregate(bridge string, flow *MatchFlow) (*FlowSt
 
 	args := []string{
 		"dump-aggregate",
-		bridge,
+		o.target(bridge),
 		string(flowText),
 	}
 
 	args = append(o.c.ofctlFlags, args...)
 
-	out, err := o.exec(args...)
+	out, err := o.exec(ctx, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -467,12 +871,18 @@ func parseEach(in []byte, prefix []byte, fn func(b []byte) error) error {
 	return scanner.Err()
 }
 
+// target returns the argument used to address bridge with 'ovs-ofctl',
+// according to the Client's InstanceOptions.
+func (o *OpenFlowService) target(bridge string) string {
+	return o.c.instance.bridgeTarget(bridge)
+}
+
 // exec executes an ExecFunc using 'ovs-ofctl'.
-func (o *OpenFlowService) exec(args ...string) ([]byte, error) {
-	return o.c.exec("ovs-ofctl", args...)
+func (o *OpenFlowService) exec(ctx context.Context, args ...string) ([]byte, error) {
+	return o.c.exec(ctx, "ovs-ofctl", args...)
 }
 
 // pipe executes a PipeFunc using 'ovs-ofctl'.
-func (o *OpenFlowService) pipe(stdin io.Reader, args ...string) error {
-	return o.c.pipe(stdin, "ovs-ofctl", args...)
+func (o *OpenFlowService) pipe(ctx context.Context, stdin io.Reader, args ...string) error {
+	return o.c.pipe(ctx, stdin, "ovs-ofctl", args...)
 }
@@ -17,12 +17,15 @@ package ovs
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"io"
+	"io/ioutil"
 	"reflect"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestClientOpenFlowAddFlowInvalidFlow(t *testing.T) {
@@ -936,11 +939,10 @@ func TestClientOpenFlowDumpFlows(t *testing.T) {
 					Priority: 4321,
 					Protocol: ProtocolTCPv4,
 					Matches: []Match{
-						TCPFlags(
-							SetTCPFlag(TCPFlagSYN),
-							UnsetTCPFlag(TCPFlagPSH),
-							SetTCPFlag(TCPFlagACK),
-						),
+						TCPFlagBits(TCPFlagState{
+							Set:   TCPFlagSYN | TCPFlagACK,
+							Unset: TCPFlagPSH,
+						}),
 					},
 					Table: 12,
 					Actions: []Action{
@@ -1015,11 +1017,10 @@ NXST_FLOW reply (xid=0x4):
 					Priority: 4321,
 					Protocol: ProtocolTCPv4,
 					Matches: []Match{
-						TCPFlags(
-							SetTCPFlag(TCPFlagSYN),
-							UnsetTCPFlag(TCPFlagPSH),
-							SetTCPFlag(TCPFlagACK),
-						),
+						TCPFlagBits(TCPFlagState{
+							Set:   TCPFlagSYN | TCPFlagACK,
+							Unset: TCPFlagPSH,
+						}),
 					},
 					Table: 12,
 					Actions: []Action{
@@ -1064,6 +1065,187 @@ NXST_FLOW reply (xid=0x4):
 	}
 }
 
+func TestClientOpenFlowScanFlows(t *testing.T) {
+	const out = `NXST_FLOW reply (xid=0x4):
+ cookie=0x0, duration=9215.748s, table=0, n_packets=6, n_bytes=480, priority=820,in_port=LOCAL actions=output:1
+ cookie=0x0, duration=9215.748s, table=0, n_packets=6, n_bytes=480, priority=810,in_port=1 actions=output:2
+ cookie=0x0, duration=9215.748s, table=0, n_packets=6, n_bytes=480, priority=800,in_port=2 actions=output:3
+`
+
+	var tests = []struct {
+		desc   string
+		out    string
+		err    error
+		stop   int
+		want   []int
+		closed bool
+		ok     bool
+	}{
+		{
+			desc:   "all flows",
+			out:    out,
+			stop:   -1,
+			want:   []int{820, 810, 800},
+			closed: true,
+			ok:     true,
+		},
+		{
+			desc:   "early termination",
+			out:    out,
+			stop:   1,
+			want:   []int{820, 810},
+			closed: true,
+			ok:     true,
+		},
+		{
+			desc:   "bad header",
+			out:    "foo\n",
+			stop:   -1,
+			closed: true,
+		},
+		{
+			desc:   "bad flow",
+			out:    "NXST_FLOW reply (xid=0x4):\n priority=foo actions=drop\n",
+			stop:   -1,
+			closed: true,
+		},
+		{
+			desc:   "command error",
+			out:    out,
+			err:    &Error{Out: []byte("ovs-ofctl: br0 is not a bridge or a socket"), Err: errors.New("exit status 1")},
+			stop:   -1,
+			want:   []int{820, 810, 800},
+			closed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			rc := &testStream{
+				r:   strings.NewReader(tt.out),
+				err: tt.err,
+			}
+
+			c := New(Stream(func(_ context.Context, cmd string, args ...string) (io.ReadCloser, error) {
+				if want, got := "ovs-ofctl", cmd; want != got {
+					t.Fatalf("incorrect command:\n- want: %v\n-  got: %v", want, got)
+				}
+
+				wantArgs := []string{"dump-flows", "br0"}
+				if want, got := wantArgs, args; !reflect.DeepEqual(want, got) {
+					t.Fatalf("incorrect arguments\n- want: %v\n-  got: %v", want, got)
+				}
+
+				return rc, nil
+			}))
+
+			fs, err := c.OpenFlow.ScanFlows("br0")
+			if err != nil {
+				t.Fatalf("failed to scan flows: %v", err)
+			}
+
+			var got []int
+			for fs.Scan() {
+				got = append(got, fs.Flow().Priority)
+				if len(got)-1 == tt.stop {
+					break
+				}
+			}
+			if err := fs.Close(); err != nil {
+				t.Fatalf("failed to close scanner: %v", err)
+			}
+
+			if want := tt.want; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected priorities:\n- want: %v\n-  got: %v", want, got)
+			}
+
+			if want, got := tt.closed, rc.closed; want != got {
+				t.Fatalf("unexpected stream closed:\n- want: %v\n-  got: %v", want, got)
+			}
+
+			if err := fs.Err(); (err == nil) != tt.ok {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.err != nil && !errors.Is(fs.Err(), ErrNoSuchBridge) {
+				t.Fatalf("expected ErrNoSuchBridge, but got: %v", fs.Err())
+			}
+		})
+	}
+}
+
+func BenchmarkClientOpenFlowScanFlows(b *testing.B) {
+	out := benchmarkFlowDump(100000)
+
+	c := New(Stream(func(_ context.Context, _ string, _ ...string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(out)), nil
+	}))
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		fs, err := c.OpenFlow.ScanFlows("br0")
+		if err != nil {
+			b.Fatalf("failed to scan flows: %v", err)
+		}
+
+		var n int
+		for fs.Scan() {
+			n++
+		}
+		if err := fs.Err(); err != nil {
+			b.Fatalf("failed to scan flows: %v", err)
+		}
+		if n != 100000 {
+			b.Fatalf("unexpected number of flows: %d", n)
+		}
+	}
+}
+
+// A testStream is an io.ReadCloser which returns err when closed.
+type testStream struct {
+	r      io.Reader
+	err    error
+	closed bool
+}
+
+func (s *testStream) Read(b []byte) (int, error) { return s.r.Read(b) }
+
+func (s *testStream) Close() error {
+	s.closed = true
+	return s.err
+}
+
+func TestClientOpenFlowDumpFlowUsage(t *testing.T) {
+	usage, err := testClient(nil, func(cmd string, args ...string) ([]byte, error) {
+		if want, got := []string{"dump-flows", "br0"}, args; !reflect.DeepEqual(want, got) {
+			t.Fatalf("incorrect arguments\n- want: %v\n-  got: %v",
+				want, got)
+		}
+
+		return []byte(`NXST_FLOW reply (xid=0x4):
+ cookie=0x0, duration=9215.748s, table=0, n_packets=6, n_bytes=480, idle_age=9206, priority=820,in_port=LOCAL actions=mod_vlan_vid:10,output:1
+ cookie=0x0, duration=1121991.329s, table=50, n_packets=0, n_bytes=0, priority=110,ip,dl_src=f1:f2:f3:f4:f5:f6 actions=ct(table=51)
+`), nil
+	}).OpenFlow.DumpFlowUsage("br0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want, got := 2, len(usage); want != got {
+		t.Fatalf("unexpected number of flows:\n- want: %v\n-  got: %v", want, got)
+	}
+
+	if want, got := uint64(6), usage[0].PacketCount; want != got {
+		t.Fatalf("unexpected packet count:\n- want: %v\n-  got: %v", want, got)
+	}
+	if want, got := 1121991329*time.Millisecond, usage[1].Duration; want != got {
+		t.Fatalf("unexpected duration:\n- want: %v\n-  got: %v", want, got)
+	}
+	if want, got := 50, usage[1].Flow.Table; want != got {
+		t.Fatalf("unexpected table:\n- want: %v\n-  got: %v", want, got)
+	}
+}
+
 func mustVerifyFlowBundle(t *testing.T, stdin io.Reader, flows []*Flow, matchFlows []*MatchFlow) {
 	s := bufio.NewScanner(stdin)
 	var gotFlows []*Flow
@@ -1125,3 +1307,117 @@ func mustVerifyFlowBundle(t *testing.T, stdin io.Reader, flows []*Flow, matchFlo
 		}
 	}
 }
+
+func TestClientOpenFlowDumpTableFeaturesOK(t *testing.T) {
+	bridge := "br0"
+
+	c := testClient([]OptionFunc{Protocols([]string{ProtocolOpenFlow13})}, func(cmd string, args ...string) ([]byte, error) {
+		if want, got := "ovs-ofctl", cmd; want != got {
+			t.Fatalf("incorrect command:\n- want: %v\n-  got: %v",
+				want, got)
+		}
+
+		wantArgs := []string{"dump-table-features", "--protocols=OpenFlow13", bridge}
+		if want, got := wantArgs, args; !reflect.DeepEqual(want, got) {
+			t.Fatalf("incorrect arguments\n- want: %v\n-  got: %v",
+				want, got)
+		}
+
+		return []byte(`
+OFPST_TABLE_FEATURES reply (OF1.3) (xid=0x2):
+  table 0 ("classifier"):
+    metadata: match=0xffffffffffffffff write=0xffffffffffffffff
+    max_entries=1000000
+    matching:
+      in_port: exact match or wildcard
+`), nil
+	})
+
+	got, err := c.OpenFlow.DumpTableFeatures(bridge)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []*TableFeatures{{
+		ID:            0,
+		Name:          "classifier",
+		MetadataMatch: 0xffffffffffffffff,
+		MetadataWrite: 0xffffffffffffffff,
+		MaxEntries:    1000000,
+		Matches: []TableMatchField{
+			{Field: "in_port", Support: MatchSupportWildcard},
+		},
+	}}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected table features:\n- want: %+v\n-  got: %+v",
+			want, got)
+	}
+}
+
+func TestClientOpenFlowModTableQuotedName(t *testing.T) {
+	bridge := "br0"
+
+	want := []string{
+		"--timeout=1",
+		"--", "--id=@ft", "create", "Flow_Table", `name="ingress, \"acl\" 1"`,
+		"--", "set", "Bridge", bridge, "flow_tables:0=@ft",
+	}
+
+	var got []string
+	c := testClient([]OptionFunc{Timeout(1)}, func(cmd string, args ...string) ([]byte, error) {
+		got = args
+		return nil, nil
+	})
+
+	err := c.OpenFlow.ModTable(bridge, 0, TableOptions{
+		Name: `ingress, "acl" 1`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error for Client.OpenFlow.ModTable: %v", err)
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected arguments:\n- want: %v\n-  got: %v",
+			want, got)
+	}
+}
+
+func TestClientOpenFlowModTableOK(t *testing.T) {
+	bridge := "br0"
+
+	want := [][]string{
+		{
+			"ovs-vsctl", "--timeout=1",
+			"--", "--id=@ft", "create", "Flow_Table", `name="filter"`,
+			"--", "set", "Bridge", bridge, "flow_tables:2=@ft",
+		},
+		{"ovs-ofctl", "--timeout=1", "mod-table", bridge, "2", "drop"},
+		{"ovs-ofctl", "--timeout=1", "mod-table", bridge, "2", "noevict"},
+		{"ovs-ofctl", "--timeout=1", "mod-table", bridge, "2", "vacancy:20,80"},
+	}
+
+	var got [][]string
+	c := testClient([]OptionFunc{Timeout(1)}, func(cmd string, args ...string) ([]byte, error) {
+		got = append(got, append([]string{cmd}, args...))
+		return nil, nil
+	})
+
+	err := c.OpenFlow.ModTable(bridge, 2, TableOptions{
+		Name:     "filter",
+		Miss:     TableMissDrop,
+		Eviction: TableEvictionDisable,
+		Vacancy: &TableVacancy{
+			Low:  20,
+			High: 80,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error for Client.OpenFlow.ModTable: %v", err)
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected commands:\n- want: %v\n-  got: %v",
+			want, got)
+	}
+}
@@ -16,7 +16,10 @@ package ovs
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"regexp"
+	"strconv"
 )
 
 // A FailMode is a failure mode which Open vSwitch uses when it cannot
@@ -66,6 +69,11 @@ const (
 // An Error is an error returned when shelling out to an Open vSwitch control
 // program.  It captures the combined stdout and stderr as well as the exit
 // code.
+//
+// If a command was terminated because its context.Context was canceled or
+// its deadline expired, Err is the error returned by the context's Err
+// method, and errors.Is can be used to check for context.DeadlineExceeded
+// or context.Canceled.
 type Error struct {
 	Out []byte
 	Err error
@@ -76,8 +84,261 @@ func (e *Error) Error() string {
 	return fmt.Sprintf("%s: %s", e.Err, string(e.Out))
 }
 
+// Unwrap returns the underlying error of an Error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Sentinel errors which can be checked against errors returned by a Client
+// using errors.Is.  They are detected by inspecting the output of the Open
+// vSwitch control program which failed.
+var (
+	// ErrNoSuchBridge indicates that the specified bridge does not exist.
+	ErrNoSuchBridge = errors.New("no such bridge")
+
+	// ErrNoSuchPort indicates that the specified port does not exist.
+	ErrNoSuchPort = errors.New("no such port")
+
+	// ErrNoSuchInterface indicates that the specified interface does not
+	// exist.
+	ErrNoSuchInterface = errors.New("no such interface")
+
+	// ErrDatabaseConnection indicates that a connection to the Open vSwitch
+	// database server could not be established.
+	ErrDatabaseConnection = errors.New("database connection failed")
+
+	// ErrVSwitchdUnreachable indicates that ovs-vswitchd could not be
+	// reached, typically because it is not running.
+	ErrVSwitchdUnreachable = errors.New("ovs-vswitchd unreachable")
+
+	// ErrPermissionDenied indicates that the command lacked the privileges
+	// needed to access Open vSwitch.  The Sudo OptionFunc may help.
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// errorOutputs maps each sentinel error to substrings of control program
+// output which indicate that error.
+var errorOutputs = map[error][]string{
+	ErrNoSuchBridge: {
+		"no bridge named ",
+		" is not a bridge or a socket",
+	},
+	ErrNoSuchPort: {
+		"no port named ",
+		"couldn't find port ",
+	},
+	ErrNoSuchInterface: {
+		"no interface named ",
+		" in table Interface",
+	},
+	ErrDatabaseConnection: {
+		"database connection failed",
+	},
+	ErrVSwitchdUnreachable: {
+		"failed to connect to socket",
+		"cannot connect to ",
+	},
+	ErrPermissionDenied: {
+		"Permission denied",
+		"Operation not permitted",
+	},
+}
+
+// Is implements error equivalence for use with errors.Is, by matching the
+// output of a failed command against the sentinel errors in this package.
+func (e *Error) Is(target error) bool {
+	for _, s := range errorOutputs[target] {
+		if bytes.Contains(e.Out, []byte(s)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isKnownError reports whether err matches any of the sentinel errors
+// in this package.
+func isKnownError(err error) bool {
+	for target := range errorOutputs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+var _ error = &FlowParseError{}
+
+// A FlowParseError is an error returned when 'ovs-ofctl' rejects a flow
+// because it could not be parsed or does not satisfy its prerequisites.
+type FlowParseError struct {
+	// Flow is the textual form of the offending flow.
+	Flow string
+
+	// Reason is the reason reported by 'ovs-ofctl'.
+	Reason string
+
+	// Err is the underlying error, typically of type *Error.
+	Err error
+}
+
+// Error returns the string representation of a FlowParseError.
+func (e *FlowParseError) Error() string {
+	return fmt.Sprintf("failed to parse flow %q: %s", e.Flow, e.Reason)
+}
+
+// Unwrap returns the underlying error of a FlowParseError.
+func (e *FlowParseError) Unwrap() error {
+	return e.Err
+}
+
+var _ error = &BundleError{}
+
+// A BundleError is an error returned when a flow bundle fails.
+type BundleError struct {
+	// Index is the zero-based index of the failing directive within the
+	// bundle, or -1 if the failing directive could not be determined.
+	Index int
+
+	// Directive and Flow are the directive, such as "add" or "delete",
+	// and textual flow at Index, if Index is known.
+	Directive string
+	Flow      string
+
+	// AddedFlow is the Flow passed to FlowTransaction.Add for an "add"
+	// directive, and MatchFlow is the MatchFlow passed to Delete or
+	// DeleteStrict for a "delete" or "delete_strict" directive, if Index
+	// is known.
+	AddedFlow *Flow
+	MatchFlow *MatchFlow
+
+	// Applied is the number of directives, starting from the beginning of
+	// the transaction, which are known to have been applied before the
+	// failure: those of the chunks which preceded the failing chunk.
+	// Applied is always zero for a bundle which is not split into chunks.
+	// See BundleOptions for details.
+	Applied int
+
+	// Reason is the reason reported by 'ovs-ofctl', if any.
+	Reason string
+
+	// Err is the underlying error, typically of type *Error.
+	Err error
+}
+
+// Error returns the string representation of a BundleError.
+func (e *BundleError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("flow bundle failed: %v", e.Err)
+	}
+
+	return fmt.Sprintf("flow bundle failed at directive %d (%s %s): %s",
+		e.Index, e.Directive, e.Flow, e.Reason)
+}
+
+// Unwrap returns the underlying error of a BundleError.
+func (e *BundleError) Unwrap() error {
+	return e.Err
+}
+
+// ofctlReasonRe matches the reason reported by 'ovs-ofctl' when it exits
+// with an error.
+var ofctlReasonRe = regexp.MustCompile(`(?m)^ovs-ofctl: (.+)$`)
+
+// ofctlLineRe matches a reason reported by 'ovs-ofctl' for a specific line
+// of a file read from stdin, such as "-:2: unknown keyword foo".
+var ofctlLineRe = regexp.MustCompile(`^-:(\d+): (.+)$`)
+
+// ofctlReason extracts the reason reported by 'ovs-ofctl' from the output
+// stored in err, if err is of type *Error.
+func ofctlReason(err error) (string, bool) {
+	var oerr *Error
+	if !errors.As(err, &oerr) {
+		return "", false
+	}
+
+	ss := ofctlReasonRe.FindSubmatch(oerr.Out)
+	if len(ss) != 2 {
+		return "", false
+	}
+
+	return string(ss[1]), true
+}
+
+// flowParseError creates a FlowParseError from err if 'ovs-ofctl' rejected
+// flow, or returns err unmodified otherwise.
+func flowParseError(err error, flow string) error {
+	// Failures unrelated to the flow itself must remain distinguishable.
+	if isKnownError(err) {
+		return err
+	}
+
+	reason, ok := ofctlReason(err)
+	if !ok {
+		return err
+	}
+
+	return &FlowParseError{
+		Flow:   flow,
+		Reason: reason,
+		Err:    err,
+	}
+}
+
+// bundleError creates a BundleError from err, using directives to determine
+// which directive caused the bundle to fail.  offset is the index of the
+// first of directives within the transaction; all directives before offset
+// have already been applied.
+//
+// A failure with a line number is a parse error, and 'ovs-ofctl' parses all
+// of directives before sending any of them, so none of directives were
+// applied.  A failure reported by the switch has no line number, so it is
+// not known which of directives were applied.  In both cases, only the
+// directives before offset are known to have been applied.
+func bundleError(err error, directives []flowDirective, offset int) error {
+	berr := &BundleError{
+		Index:   -1,
+		Applied: offset,
+		Err:     err,
+	}
+
+	reason, ok := ofctlReason(err)
+	if !ok {
+		return berr
+	}
+	berr.Reason = reason
+
+	// Lines in the bundle file are one-indexed.
+	ss := ofctlLineRe.FindStringSubmatch(reason)
+	if len(ss) != 3 {
+		return berr
+	}
+
+	line, err := strconv.Atoi(ss[1])
+	if err != nil || line < 1 || line > len(directives) {
+		return berr
+	}
+
+	d := directives[line-1]
+	berr.Index = offset + line - 1
+	berr.Directive = d.directive
+	berr.Flow = d.flow
+	berr.Reason = ss[2]
+
+	switch f := d.source.(type) {
+	case *Flow:
+		berr.AddedFlow = f
+	case *MatchFlow:
+		berr.MatchFlow = f
+	}
+
+	return berr
+}
+
 // IsPortNotExist checks if err is of type Error and is caused by asking OVS for
-// information regarding a non-existent port.
+// information regarding a non-existent port.  New code should prefer using
+// errors.Is with ErrNoSuchPort.
 func IsPortNotExist(err error) bool {
 	oerr, ok := err.(*Error)
 	if !ok {
@@ -15,7 +15,13 @@
 package ovs
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -72,3 +78,344 @@ func errStr(err error) string {
 
 	return err.Error()
 }
+
+func TestErrorIs(t *testing.T) {
+	var tests = []struct {
+		desc string
+		out  string
+		is   []error
+	}{
+		{
+			desc: "unknown error",
+			out:  "ovs-vsctl: something went wrong",
+		},
+		{
+			desc: "no bridge, ovs-vsctl",
+			out:  "ovs-vsctl: no bridge named br0",
+			is:   []error{ErrNoSuchBridge},
+		},
+		{
+			desc: "no bridge, ovs-ofctl",
+			out:  "ovs-ofctl: br0 is not a bridge or a socket",
+			is:   []error{ErrNoSuchBridge},
+		},
+		{
+			desc: "no port",
+			out:  "ovs-vsctl: no port named eth0",
+			is:   []error{ErrNoSuchPort},
+		},
+		{
+			desc: "no interface",
+			out:  `ovs-vsctl: no row "eth0" in table Interface`,
+			is:   []error{ErrNoSuchInterface},
+		},
+		{
+			desc: "database connection",
+			out:  "ovs-vsctl: unix:/var/run/openvswitch/db.sock: database connection failed (No such file or directory)",
+			is:   []error{ErrDatabaseConnection},
+		},
+		{
+			desc: "database connection, permission denied",
+			out:  "ovs-vsctl: unix:/var/run/openvswitch/db.sock: database connection failed (Permission denied)",
+			is:   []error{ErrDatabaseConnection, ErrPermissionDenied},
+		},
+		{
+			desc: "vswitchd unreachable",
+			out:  "ovs-ofctl: br0: failed to connect to socket (Connection refused)",
+			is:   []error{ErrVSwitchdUnreachable},
+		},
+	}
+
+	all := []error{
+		ErrNoSuchBridge,
+		ErrNoSuchPort,
+		ErrNoSuchInterface,
+		ErrDatabaseConnection,
+		ErrVSwitchdUnreachable,
+		ErrPermissionDenied,
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			// Wrap the error to ensure errors.Is inspects the chain.
+			err := fmt.Errorf("wrapped: %w", &Error{
+				Out: []byte(tt.out),
+				Err: errors.New("exit status 1"),
+			})
+
+			for _, target := range all {
+				want := false
+				for _, is := range tt.is {
+					if is == target {
+						want = true
+					}
+				}
+
+				if got := errors.Is(err, target); want != got {
+					t.Fatalf("unexpected errors.Is(%v):\n- want: %v\n-  got: %v",
+						target, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestClientOpenFlowAddFlowParseError(t *testing.T) {
+	flow := &Flow{
+		Protocol: ProtocolIPv4,
+		Actions:  []Action{Drop()},
+	}
+
+	c := testClient(nil, func(cmd string, args ...string) ([]byte, error) {
+		return []byte("ovs-ofctl: unknown keyword foo\n"), errors.New("exit status 1")
+	})
+
+	err := c.OpenFlow.AddFlow("br0", flow)
+
+	var ferr *FlowParseError
+	if !errors.As(err, &ferr) {
+		t.Fatalf("expected *FlowParseError, but got: %#v", err)
+	}
+
+	if want, got := "priority=0,ip,table=0,idle_timeout=0,actions=drop", ferr.Flow; want != got {
+		t.Fatalf("unexpected flow:\n- want: %v\n-  got: %v", want, got)
+	}
+	if want, got := "unknown keyword foo", ferr.Reason; want != got {
+		t.Fatalf("unexpected reason:\n- want: %v\n-  got: %v", want, got)
+	}
+}
+
+func TestClientOpenFlowAddFlowNoSuchBridge(t *testing.T) {
+	c := testClient(nil, func(cmd string, args ...string) ([]byte, error) {
+		return []byte("ovs-ofctl: br0 is not a bridge or a socket"), errors.New("exit status 1")
+	})
+
+	err := c.OpenFlow.AddFlow("br0", &Flow{Actions: []Action{Drop()}})
+
+	var ferr *FlowParseError
+	if errors.As(err, &ferr) {
+		t.Fatalf("unexpected *FlowParseError: %v", err)
+	}
+	if !errors.Is(err, ErrNoSuchBridge) {
+		t.Fatalf("expected ErrNoSuchBridge, but got: %v", err)
+	}
+}
+
+func TestClientOpenFlowAddFlowBundleError(t *testing.T) {
+	var tests = []struct {
+		desc  string
+		out   string
+		index int
+		is    error
+	}{
+		{
+			desc:  "parse error",
+			out:   "ovs-ofctl: -:2: unknown keyword foo",
+			index: 1,
+		},
+		{
+			desc:  "no such bridge",
+			out:   "ovs-ofctl: br0 is not a bridge or a socket",
+			index: -1,
+			is:    ErrNoSuchBridge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			c := testClient([]OptionFunc{
+				Pipe(func(stdin io.Reader, cmd string, args ...string) ([]byte, error) {
+					return []byte(tt.out), errors.New("exit status 1")
+				}),
+			}, nil)
+
+			err := c.OpenFlow.AddFlowBundle("br0", func(tx *FlowTransaction) error {
+				tx.Add(&Flow{Priority: 10, Actions: []Action{Drop()}})
+				tx.Delete(&MatchFlow{Cookie: 0xdeadbeef})
+				return tx.Commit()
+			})
+
+			var berr *BundleError
+			if !errors.As(err, &berr) {
+				t.Fatalf("expected *BundleError, but got: %#v", err)
+			}
+
+			if want, got := tt.index, berr.Index; want != got {
+				t.Fatalf("unexpected index:\n- want: %v\n-  got: %v", want, got)
+			}
+
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Fatalf("expected error to wrap %v, but got: %v", tt.is, err)
+			}
+
+			if tt.index < 0 {
+				return
+			}
+
+			if want, got := "delete", berr.Directive; want != got {
+				t.Fatalf("unexpected directive:\n- want: %v\n-  got: %v", want, got)
+			}
+			if want, got := "unknown keyword foo", berr.Reason; want != got {
+				t.Fatalf("unexpected reason:\n- want: %v\n-  got: %v", want, got)
+			}
+
+			if berr.AddedFlow != nil {
+				t.Fatalf("unexpected added flow: %v", berr.AddedFlow)
+			}
+			if berr.MatchFlow == nil || berr.MatchFlow.Cookie != 0xdeadbeef {
+				t.Fatalf("unexpected match flow: %#v", berr.MatchFlow)
+			}
+			if want, got := 0, berr.Applied; want != got {
+				t.Fatalf("unexpected applied:\n- want: %v\n-  got: %v", want, got)
+			}
+		})
+	}
+}
+
+func TestClientOpenFlowAddFlowBundleOptions(t *testing.T) {
+	flows := []*Flow{
+		{Priority: 10, Actions: []Action{Drop()}},
+		{Priority: 20, Actions: []Action{Drop()}},
+		{Priority: 30, Actions: []Action{Drop()}},
+		{Priority: 40, Actions: []Action{Drop()}},
+		{Priority: 50, Actions: []Action{Drop()}},
+	}
+
+	var tests = []struct {
+		desc    string
+		opts    BundleOptions
+		fail    int
+		calls   []string
+		index   int
+		applied int
+	}{
+		{
+			desc: "atomic",
+			fail: -1,
+			calls: []string{
+				"--bundle add-flow br0 - " + flowLines(flows...),
+			},
+		},
+		{
+			desc:  "atomic failure",
+			fail:  0,
+			index: 1,
+			calls: []string{
+				"--bundle add-flow br0 - " + flowLines(flows...),
+			},
+		},
+		{
+			desc: "ordered failure",
+			opts: BundleOptions{Mode: BundleOrdered},
+			fail: 0,
+			calls: []string{
+				"add-flow br0 - " + flowLines(flows...),
+			},
+			// A parse error applies no directives.
+			index:   1,
+			applied: 0,
+		},
+		{
+			desc: "chunked",
+			opts: BundleOptions{ChunkSize: 2},
+			fail: -1,
+			calls: []string{
+				"--bundle add-flow br0 - " + flowLines(flows[0:2]...),
+				"--bundle add-flow br0 - " + flowLines(flows[2:4]...),
+				"--bundle add-flow br0 - " + flowLines(flows[4:]...),
+			},
+		},
+		{
+			desc: "chunked failure",
+			opts: BundleOptions{ChunkSize: 2},
+			fail: 1,
+			calls: []string{
+				"--bundle add-flow br0 - " + flowLines(flows[0:2]...),
+				"--bundle add-flow br0 - " + flowLines(flows[2:4]...),
+			},
+			index:   3,
+			applied: 2,
+		},
+		{
+			desc: "chunked ordered failure",
+			opts: BundleOptions{Mode: BundleOrdered, ChunkSize: 2},
+			fail: 1,
+			calls: []string{
+				"add-flow br0 - " + flowLines(flows[0:2]...),
+				"add-flow br0 - " + flowLines(flows[2:4]...),
+			},
+			// Only the preceding chunk was applied.
+			index:   3,
+			applied: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var calls []string
+			c := testClient([]OptionFunc{
+				Pipe(func(stdin io.Reader, cmd string, args ...string) ([]byte, error) {
+					b, err := ioutil.ReadAll(stdin)
+					if err != nil {
+						t.Fatalf("failed to read stdin: %v", err)
+					}
+
+					calls = append(calls, strings.Join(args, " ")+" "+string(b))
+
+					// Fail the second line of the configured invocation.
+					if len(calls)-1 == tt.fail {
+						return []byte("ovs-ofctl: -:2: unknown keyword foo"), errors.New("exit status 1")
+					}
+
+					return nil, nil
+				}),
+			}, nil)
+
+			err := c.OpenFlow.AddFlowBundleOptions(context.Background(), "br0", tt.opts, func(tx *FlowTransaction) error {
+				tx.Add(flows...)
+				return tx.Commit()
+			})
+
+			if want, got := tt.calls, calls; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected calls:\n- want: %q\n-  got: %q", want, got)
+			}
+
+			if tt.fail < 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var berr *BundleError
+			if !errors.As(err, &berr) {
+				t.Fatalf("expected *BundleError, but got: %#v", err)
+			}
+
+			if want, got := tt.index, berr.Index; want != got {
+				t.Fatalf("unexpected index:\n- want: %v\n-  got: %v", want, got)
+			}
+			if want, got := tt.applied, berr.Applied; want != got {
+				t.Fatalf("unexpected applied:\n- want: %v\n-  got: %v", want, got)
+			}
+			if want, got := flows[tt.index], berr.AddedFlow; want != got {
+				t.Fatalf("unexpected added flow:\n- want: %v\n-  got: %v", want, got)
+			}
+		})
+	}
+}
+
+// flowLines produces the lines of a flow file which adds flows.
+func flowLines(flows ...*Flow) string {
+	var s string
+	for _, f := range flows {
+		b, err := f.MarshalText()
+		if err != nil {
+			panic(err)
+		}
+
+		s += "add " + string(b) + "\n"
+	}
+
+	return s
+}
@@ -0,0 +1,28 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ovstest provides an in-memory simulation of the Open vSwitch
+// command line tools, for hermetic testing of code built on package ovs.
+//
+// A Switch implements the subset of 'ovs-vsctl' and 'ovs-ofctl' used by
+// ovs.Client, and is plugged in using the ovs.Exec and ovs.Pipe OptionFuncs:
+//
+//	sw := ovstest.NewSwitch()
+//	c := sw.Client()
+//
+// Flows are matched textually, as Open vSwitch would after normalization,
+// so flows should be produced by package ovs or written in the same form.
+// Masked fields are compared by their text rather than by the bits they
+// match.
+package ovstest
@@ -0,0 +1,439 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovstest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits and defaults used by Open vSwitch for flow fields.
+const (
+	defaultPriority = 32768
+	maxPriority     = 0xffff
+	maxTableID      = 254
+)
+
+var (
+	// errNoActions is reported when a flow to be added has no actions.
+	errNoActions = errors.New("must specify an action")
+
+	// errOverlap is reported when a flow with the check_overlap flag
+	// overlaps an existing flow.
+	errOverlap = errors.New("OFPT_ERROR: OFPFMFC_OVERLAP")
+)
+
+// impliedProtocols maps protocol keywords to the less specific protocol
+// keywords they imply.
+var impliedProtocols = map[string]string{
+	"icmp":  "ip",
+	"sctp":  "ip",
+	"tcp":   "ip",
+	"udp":   "ip",
+	"icmp6": "ipv6",
+	"sctp6": "ipv6",
+	"tcp6":  "ipv6",
+	"udp6":  "ipv6",
+}
+
+// A flowSpec is a flow or flow match parsed from 'ovs-ofctl' syntax.
+type flowSpec struct {
+	// table and priority are -1 if not specified.
+	table    int
+	priority int
+
+	cookie     uint64
+	cookieMask uint64
+
+	idleTimeout int
+	hardTimeout int
+
+	// protocol is the protocol keyword, if any.
+	protocol string
+
+	// match holds all other match fields, in their original order.
+	match []string
+
+	actions string
+
+	// Flow flags.
+	checkOverlap bool
+	resetCounts  bool
+}
+
+// parseFlowSpec parses s as a flow.  If actions is true, the flow must
+// specify actions.
+func parseFlowSpec(s string, actions bool) (*flowSpec, error) {
+	f := &flowSpec{
+		table:    -1,
+		priority: -1,
+	}
+
+	if i := strings.Index(s, "actions="); i != -1 {
+		f.actions = strings.TrimSpace(s[i+len("actions="):])
+		s = s[:i]
+	}
+	if actions && f.actions == "" {
+		return nil, errNoActions
+	}
+
+	for _, tok := range splitTopLevel(s) {
+		kv := strings.SplitN(tok, "=", 2)
+		if len(kv) == 1 {
+			switch tok {
+			case "check_overlap":
+				f.checkOverlap = true
+			case "reset_counts":
+				f.resetCounts = true
+			case "send_flow_rem", "no_packet_counts", "no_byte_counts":
+			default:
+				if f.protocol != "" {
+					return nil, fmt.Errorf("%s: conflicting protocol %s", tok, f.protocol)
+				}
+				f.protocol = tok
+			}
+			continue
+		}
+
+		key, value := strings.ToLower(kv[0]), kv[1]
+
+		var err error
+		switch key {
+		case "priority":
+			f.priority, err = parseBounded(key, value, maxPriority)
+		case "table":
+			f.table, err = parseBounded(key, value, maxTableID)
+		case "idle_timeout":
+			f.idleTimeout, err = parseBounded(key, value, 0xffff)
+		case "hard_timeout":
+			f.hardTimeout, err = parseBounded(key, value, 0xffff)
+		case "cookie":
+			f.cookie, f.cookieMask, err = parseCookie(value)
+		case "duration", "n_packets", "n_bytes", "idle_age", "hard_age":
+			// Statistics from dump output are ignored.
+		default:
+			f.match = append(f.match, key+"="+value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// splitTopLevel splits s at commas which are not within parentheses, and
+// trims surrounding whitespace from each element.
+func splitTopLevel(s string) []string {
+	var (
+		out   []string
+		depth int
+		start int
+	)
+
+	add := func(tok string) {
+		if tok = strings.TrimSpace(tok); tok != "" {
+			out = append(out, tok)
+		}
+	}
+
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				add(s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	add(s[start:])
+
+	return out
+}
+
+// parseBounded parses an integer field value between 0 and max.
+func parseBounded(key, value string, max int) (int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil || v < 0 || v > max {
+		return 0, fmt.Errorf("invalid %s %q", key, value)
+	}
+
+	return v, nil
+}
+
+// parseCookie parses a cookie with an optional mask.  If no mask is
+// present, the mask is all ones.
+func parseCookie(value string) (uint64, uint64, error) {
+	ss := strings.SplitN(value, "/", 2)
+
+	cookie, err := strconv.ParseUint(ss[0], 0, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cookie %q", value)
+	}
+
+	if len(ss) == 1 || ss[1] == "-1" {
+		return cookie, ^uint64(0), nil
+	}
+
+	mask, err := strconv.ParseUint(ss[1], 0, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cookie mask %q", value)
+	}
+
+	return cookie, mask, nil
+}
+
+// A flowEntry is a flow installed in a bridge.
+type flowEntry struct {
+	table       int
+	priority    int
+	cookie      uint64
+	idleTimeout int
+	hardTimeout int
+	protocol    string
+	match       []string
+	actions     string
+
+	packets uint64
+	bytes   uint64
+	added   time.Time
+}
+
+// newFlowEntry creates a flowEntry from a flow to be added.
+func newFlowEntry(f *flowSpec, now time.Time) *flowEntry {
+	e := &flowEntry{
+		table:       f.table,
+		priority:    f.priority,
+		cookie:      f.cookie,
+		idleTimeout: f.idleTimeout,
+		hardTimeout: f.hardTimeout,
+		protocol:    f.protocol,
+		match:       f.match,
+		actions:     f.actions,
+		added:       now,
+	}
+
+	if e.table < 0 {
+		e.table = 0
+	}
+	if e.priority < 0 {
+		e.priority = defaultPriority
+	}
+
+	return e
+}
+
+// sameMatch reports whether e has exactly the match of f, which is a flow
+// with a priority.
+func (e *flowEntry) sameMatch(f *flowSpec) bool {
+	priority := f.priority
+	if priority < 0 {
+		priority = defaultPriority
+	}
+
+	if e.priority != priority || e.protocol != f.protocol || len(e.match) != len(f.match) {
+		return false
+	}
+
+	return sortedEqual(e.match, f.match)
+}
+
+// matches reports whether e is matched by the non-strict match f, meaning
+// that e is at least as specific as f.
+func (e *flowEntry) matches(f *flowSpec) bool {
+	if f.table >= 0 && e.table != f.table {
+		return false
+	}
+	if e.cookie&f.cookieMask != f.cookie&f.cookieMask {
+		return false
+	}
+	if f.protocol != "" && f.protocol != e.protocol && f.protocol != impliedProtocols[e.protocol] {
+		return false
+	}
+
+	fields := make(map[string]bool, len(e.match))
+	for _, m := range e.match {
+		fields[m] = true
+	}
+	for _, m := range f.match {
+		if !fields[m] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesStrict reports whether e is matched by the strict match f.
+func (e *flowEntry) matchesStrict(f *flowSpec) bool {
+	if f.table >= 0 && e.table != f.table {
+		return false
+	}
+	if e.cookie&f.cookieMask != f.cookie&f.cookieMask {
+		return false
+	}
+
+	return e.sameMatch(f)
+}
+
+// overlaps reports whether a packet could match both e and f, which have
+// the same table and priority.
+func (e *flowEntry) overlaps(f *flowEntry) bool {
+	if e.protocol != "" && f.protocol != "" && e.protocol != f.protocol &&
+		impliedProtocols[e.protocol] != f.protocol && impliedProtocols[f.protocol] != e.protocol {
+		return false
+	}
+
+	values := make(map[string]string, len(e.match))
+	for _, m := range e.match {
+		kv := strings.SplitN(m, "=", 2)
+		values[kv[0]] = kv[1]
+	}
+	for _, m := range f.match {
+		kv := strings.SplitN(m, "=", 2)
+		if v, ok := values[kv[0]]; ok && v != kv[1] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns e in the format used by 'ovs-ofctl dump-flows'.
+func (e *flowEntry) String(now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, " cookie=%#x, duration=%.3fs, table=%d, n_packets=%d, n_bytes=%d, ",
+		e.cookie, now.Sub(e.added).Seconds(), e.table, e.packets, e.bytes)
+
+	if e.idleTimeout != 0 {
+		fmt.Fprintf(&b, "idle_timeout=%d, ", e.idleTimeout)
+	}
+	if e.hardTimeout != 0 {
+		fmt.Fprintf(&b, "hard_timeout=%d, ", e.hardTimeout)
+	}
+
+	fields := []string{"priority=" + strconv.Itoa(e.priority)}
+	if e.protocol != "" {
+		fields = append(fields, e.protocol)
+	}
+	fields = append(fields, e.match...)
+
+	fmt.Fprintf(&b, "%s actions=%s", strings.Join(fields, ","), e.actions)
+	return b.String()
+}
+
+// A flowTable holds the flows installed in a bridge, in insertion order.
+type flowTable []*flowEntry
+
+// add adds f to the table, replacing any flow with the same table, priority,
+// and match.  If f has the check_overlap flag, a flow with the same match is
+// an overlap and is not replaced.  The table is modified in place, so callers
+// which may need to discard the result must add to a clone.
+func (t flowTable) add(f *flowSpec, now time.Time) (flowTable, error) {
+	e := newFlowEntry(f, now)
+
+	for i, old := range t {
+		if old.table != e.table || old.priority != e.priority {
+			continue
+		}
+		if f.checkOverlap && old.overlaps(e) {
+			return nil, errOverlap
+		}
+		if !old.sameMatch(f) {
+			continue
+		}
+
+		// Counters of a replaced flow are retained unless requested.
+		if !f.resetCounts {
+			e.packets, e.bytes = old.packets, old.bytes
+		}
+
+		t[i] = e
+		return t, nil
+	}
+
+	return append(t, e), nil
+}
+
+// delete removes all flows matched by f from the table.
+func (t flowTable) delete(f *flowSpec, strict bool) flowTable {
+	out := make(flowTable, 0, len(t))
+	for _, e := range t {
+		if strict && e.matchesStrict(f) || !strict && e.matches(f) {
+			continue
+		}
+
+		out = append(out, e)
+	}
+
+	return out
+}
+
+// clone returns a copy of t which shares its flows.
+func (t flowTable) clone() flowTable {
+	out := make(flowTable, len(t))
+	copy(out, t)
+	return out
+}
+
+// sorted returns the flows matched by f, ordered by table and by descending
+// priority.  If f is nil, all flows are returned.
+func (t flowTable) sorted(f *flowSpec) []*flowEntry {
+	out := make([]*flowEntry, 0, len(t))
+	for _, e := range t {
+		if f == nil || e.matches(f) {
+			out = append(out, e)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].table != out[j].table {
+			return out[i].table < out[j].table
+		}
+
+		return out[i].priority > out[j].priority
+	})
+
+	return out
+}
+
+// sortedEqual reports whether a and b contain the same strings, regardless
+// of order.
+func sortedEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	as := append([]string(nil), a...)
+	bs := append([]string(nil), b...)
+	sort.Strings(as)
+	sort.Strings(bs)
+
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
+	}
+
+	return true
+}
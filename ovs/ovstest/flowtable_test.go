@@ -0,0 +1,139 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovstest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_parseFlowSpec(t *testing.T) {
+	var tests = []struct {
+		s       string
+		actions bool
+		f       *flowSpec
+		invalid bool
+	}{
+		{
+			s:       "priority=10,ip",
+			actions: true,
+			invalid: true,
+		},
+		{
+			s:       "table=255,actions=drop",
+			invalid: true,
+		},
+		{
+			s:       "cookie=foo",
+			invalid: true,
+		},
+		{
+			s:       "tcp,udp",
+			invalid: true,
+		},
+		{
+			s: "tcp,cookie=0x10/0xf0",
+			f: &flowSpec{
+				table:      -1,
+				priority:   -1,
+				cookie:     0x10,
+				cookieMask: 0xf0,
+				protocol:   "tcp",
+			},
+		},
+		{
+			s:       " cookie=0x1, duration=1.5s, table=2, n_packets=1, n_bytes=2, idle_timeout=10, priority=5,udp,tp_dst=53 actions=resubmit(,3),ct(commit,zone=1)",
+			actions: true,
+			f: &flowSpec{
+				table:       2,
+				priority:    5,
+				cookie:      0x1,
+				cookieMask:  ^uint64(0),
+				idleTimeout: 10,
+				protocol:    "udp",
+				match:       []string{"tp_dst=53"},
+				actions:     "resubmit(,3),ct(commit,zone=1)",
+			},
+		},
+		{
+			s:       "priority=1,check_overlap,reset_counts,ct_state=+trk,actions=drop",
+			actions: true,
+			f: &flowSpec{
+				table:        -1,
+				priority:     1,
+				match:        []string{"ct_state=+trk"},
+				actions:      "drop",
+				checkOverlap: true,
+				resetCounts:  true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			f, err := parseFlowSpec(tt.s, tt.actions)
+			if err != nil && !tt.invalid {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.invalid {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+				return
+			}
+
+			if want, got := tt.f, f; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected flowSpec:\n- want: %#v\n-  got: %#v",
+					want, got)
+			}
+		})
+	}
+}
+
+func Test_flowEntryOverlaps(t *testing.T) {
+	var tests = []struct {
+		a, b string
+		ok   bool
+	}{
+		{a: "ip", b: "tcp", ok: true},
+		{a: "tcp", b: "udp", ok: false},
+		{a: "tcp", b: "tcp6", ok: false},
+		{a: "tcp,tp_dst=22", b: "tcp,tp_src=1024", ok: true},
+		{a: "tcp,tp_dst=22", b: "tcp,tp_dst=80", ok: false},
+		{a: "in_port=1", b: "ipv6", ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			entry := func(s string) *flowEntry {
+				f, err := parseFlowSpec(s, false)
+				if err != nil {
+					t.Fatalf("failed to parse flow: %v", err)
+				}
+
+				return newFlowEntry(f, time.Time{})
+			}
+
+			a, b := entry(tt.a), entry(tt.b)
+			if want, got := tt.ok, a.overlaps(b); want != got {
+				t.Fatalf("unexpected overlap:\n- want: %v\n-  got: %v", want, got)
+			}
+			if want, got := tt.ok, b.overlaps(a); want != got {
+				t.Fatalf("overlap is not symmetric:\n- want: %v\n-  got: %v", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovstest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Directives which may begin a line of a flow file read by 'ovs-ofctl'.
+const (
+	dirAdd          = "add"
+	dirDelete       = "delete"
+	dirDeleteStrict = "delete_strict"
+)
+
+// ofctl simulates 'ovs-ofctl'.
+func (s *Switch) ofctl(stdin io.Reader, args []string) ([]byte, error) {
+	flags, pos := splitArgs(args)
+	if len(pos) == 0 {
+		return nil, errors.New("missing command name; use --help for help")
+	}
+
+	_, strict := flags["strict"]
+	_, bundle := flags["bundle"]
+
+	cmd, pos := pos[0], pos[1:]
+	if len(pos) == 0 {
+		return nil, fmt.Errorf("'%s' command requires at least 1 arguments", cmd)
+	}
+
+	b, err := s.target(pos[0])
+	if err != nil {
+		return nil, err
+	}
+
+	switch cmd {
+	case "add-flow", "add-flows":
+		if len(pos) != 2 {
+			return nil, fmt.Errorf("'%s' command requires 2 arguments", cmd)
+		}
+		if pos[1] == "-" {
+			return nil, s.addFlowFile(b, stdin, bundle)
+		}
+
+		return nil, s.apply(b, dirAdd, pos[1])
+	case "del-flows":
+		if len(pos) > 2 {
+			return nil, fmt.Errorf("'%s' command requires at most 2 arguments", cmd)
+		}
+		if len(pos) == 1 {
+			b.flows = nil
+			return nil, nil
+		}
+
+		dir := dirDelete
+		if strict {
+			dir = dirDeleteStrict
+		}
+		return nil, s.apply(b, dir, pos[1])
+	case "dump-flows", "dump-aggregate":
+		var f *flowSpec
+		if len(pos) == 2 {
+			if f, err = parseFlowSpec(pos[1], false); err != nil {
+				return nil, err
+			}
+		}
+
+		if cmd == "dump-flows" {
+			return s.dumpFlows(b, f), nil
+		}
+		return dumpAggregate(b, f), nil
+	case "mod-port":
+		if len(pos) != 3 {
+			return nil, fmt.Errorf("'%s' command requires 3 arguments", cmd)
+		}
+		if p, ok := s.ports[pos[1]]; !ok || p.bridge != b.name {
+			return nil, fmt.Errorf("%s: couldn't find port `%s'", pos[0], pos[1])
+		}
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unknown command '%s'; use --help for help", cmd)
+}
+
+// apply applies a single directive to the flows of b.
+func (s *Switch) apply(b *bridge, directive, flow string) error {
+	f, err := parseFlowSpec(flow, directive == dirAdd)
+	if err != nil {
+		return err
+	}
+
+	flows, err := applyDirective(b.flows, directive, f, s.now())
+	if err != nil {
+		return err
+	}
+
+	b.flows = flows
+	return nil
+}
+
+// applyDirective applies a directive to flows, returning the updated flows.
+func applyDirective(flows flowTable, directive string, f *flowSpec, now time.Time) (flowTable, error) {
+	switch directive {
+	case dirAdd:
+		return flows.add(f, now)
+	case dirDelete:
+		return flows.delete(f, false), nil
+	case dirDeleteStrict:
+		return flows.delete(f, true), nil
+	}
+
+	return nil, fmt.Errorf("unknown directive %q", directive)
+}
+
+// A flowDirective is a parsed line of a flow file.
+type flowDirective struct {
+	directive string
+	flow      *flowSpec
+}
+
+// addFlowFile applies each line of a flow file read from stdin to the flows
+// of b.  Like ovs-ofctl, every line is parsed before any is applied, so a
+// line which fails to parse applies nothing.  If bundle is set, either every
+// line is applied or none are.  Otherwise, lines are applied until one
+// fails.
+func (s *Switch) addFlowFile(b *bridge, stdin io.Reader, bundle bool) error {
+	if stdin == nil {
+		return errors.New("-: no input")
+	}
+
+	var directives []flowDirective
+	scanner := bufio.NewScanner(stdin)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Lines without a directive add a flow.
+		directive, flow := dirAdd, line
+		if ss := strings.SplitN(line, " ", 2); len(ss) == 2 {
+			switch ss[0] {
+			case dirAdd, dirDelete, dirDeleteStrict:
+				directive, flow = ss[0], ss[1]
+			}
+		}
+
+		f, err := parseFlowSpec(flow, directive == dirAdd)
+		if err != nil {
+			return fmt.Errorf("-:%d: %v", n, err)
+		}
+
+		directives = append(directives, flowDirective{
+			directive: directive,
+			flow:      f,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	flows := b.flows
+	if bundle {
+		flows = flows.clone()
+	}
+
+	// Errors from the switch do not identify the line which caused them.
+	for _, d := range directives {
+		var err error
+		flows, err = applyDirective(flows, d.directive, d.flow, s.now())
+		if err != nil {
+			return err
+		}
+
+		if !bundle {
+			b.flows = flows
+		}
+	}
+
+	b.flows = flows
+	return nil
+}
+
+// dumpFlows produces the output of 'ovs-ofctl dump-flows' for the flows of
+// b matched by f.
+func (s *Switch) dumpFlows(b *bridge, f *flowSpec) []byte {
+	now := s.now()
+
+	var buf strings.Builder
+	_, _ = buf.WriteString("NXST_FLOW reply (xid=0x4):\n")
+	for _, e := range b.flows.sorted(f) {
+		_, _ = buf.WriteString(e.String(now) + "\n")
+	}
+
+	return []byte(buf.String())
+}
+
+// dumpAggregate produces the output of 'ovs-ofctl dump-aggregate' for the
+// flows of b matched by f.
+func dumpAggregate(b *bridge, f *flowSpec) []byte {
+	var packets, bytes uint64
+	flows := b.flows.sorted(f)
+	for _, e := range flows {
+		packets += e.packets
+		bytes += e.bytes
+	}
+
+	return []byte(fmt.Sprintf("NXST_AGGREGATE reply (xid=0x4): packet_count=%d byte_count=%d flow_count=%d\n",
+		packets, bytes, len(flows)))
+}
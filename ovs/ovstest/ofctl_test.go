@@ -0,0 +1,409 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovstest
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+)
+
+// testSwitch creates a Switch with bridge br0, and a Client which uses it.
+func testSwitch(t *testing.T, options ...ovs.OptionFunc) (*Switch, *ovs.Client) {
+	t.Helper()
+
+	sw := NewSwitch()
+	c := sw.Client(options...)
+	if err := c.VSwitch.AddBridge("br0"); err != nil {
+		t.Fatalf("failed to add bridge: %v", err)
+	}
+
+	return sw, c
+}
+
+// dumpFlows returns the flows of br0 in textual form.
+func dumpFlows(t *testing.T, c *ovs.Client) []string {
+	t.Helper()
+
+	flows, err := c.OpenFlow.DumpFlows("br0")
+	if err != nil {
+		t.Fatalf("failed to dump flows: %v", err)
+	}
+
+	out := make([]string, 0, len(flows))
+	for _, f := range flows {
+		b, err := f.MarshalText()
+		if err != nil {
+			t.Fatalf("failed to marshal flow: %v", err)
+		}
+		out = append(out, string(b))
+	}
+
+	return out
+}
+
+func testFlows() []*ovs.Flow {
+	return []*ovs.Flow{
+		{
+			Priority: 10,
+			Protocol: ovs.ProtocolIPv4,
+			Cookie:   0x1,
+			Actions:  []ovs.Action{ovs.Normal()},
+		},
+		{
+			Priority: 100,
+			Protocol: ovs.ProtocolTCPv4,
+			Matches:  []ovs.Match{ovs.TransportDestinationPort(22)},
+			Cookie:   0x2,
+			Actions:  []ovs.Action{ovs.Drop()},
+		},
+		{
+			Priority: 100,
+			Protocol: ovs.ProtocolTCPv4,
+			Matches:  []ovs.Match{ovs.TransportDestinationPort(80)},
+			Table:    1,
+			Cookie:   0x2,
+			Actions:  []ovs.Action{ovs.Output(1)},
+		},
+	}
+}
+
+func TestSwitchAddAndDumpFlows(t *testing.T) {
+	_, c := testSwitch(t)
+
+	for _, f := range testFlows() {
+		if err := c.OpenFlow.AddFlow("br0", f); err != nil {
+			t.Fatalf("failed to add flow: %v", err)
+		}
+	}
+
+	// Replaces the existing flow with the same match and priority.
+	if err := c.OpenFlow.AddFlow("br0", &ovs.Flow{
+		Priority: 10,
+		Protocol: ovs.ProtocolIPv4,
+		Cookie:   0x3,
+		Actions:  []ovs.Action{ovs.Flood()},
+	}); err != nil {
+		t.Fatalf("failed to replace flow: %v", err)
+	}
+
+	want := []string{
+		"priority=100,tcp,tp_dst=22,table=0,idle_timeout=0,cookie=0x0000000000000002,actions=drop",
+		"priority=10,ip,table=0,idle_timeout=0,cookie=0x0000000000000003,actions=flood",
+		"priority=100,tcp,tp_dst=80,table=1,idle_timeout=0,cookie=0x0000000000000002,actions=output:1",
+	}
+	if got := dumpFlows(t, c); !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected flows:\n- want: %v\n-  got: %v",
+			strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	err := c.OpenFlow.AddFlow("br1", testFlows()[0])
+	if !errors.Is(err, ovs.ErrNoSuchBridge) {
+		t.Fatalf("expected ErrNoSuchBridge, but got: %v", err)
+	}
+}
+
+func TestSwitchAddFlowInvalid(t *testing.T) {
+	sw, _ := testSwitch(t)
+
+	out, err := sw.Exec("ovs-ofctl", "add-flow", "br0", "priority=70000,actions=drop")
+	if err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+	if want, got := "ovs-ofctl: invalid priority \"70000\"\n", string(out); want != got {
+		t.Fatalf("unexpected output:\n- want: %q\n-  got: %q", want, got)
+	}
+
+	if _, err := sw.Exec("ovs-ofctl", "add-flow", "br0", "priority=10,ip"); err == nil {
+		t.Fatal("expected an error for a flow with no actions")
+	}
+
+	if _, err := sw.Exec("ovs-ofctl", "add-flow", "br0", "priority=10,ip,actions=drop"); err != nil {
+		t.Fatalf("failed to add flow: %v", err)
+	}
+	out, err = sw.Exec("ovs-ofctl", "add-flow", "br0", "priority=10,tcp,check_overlap,actions=drop")
+	if err == nil || !strings.Contains(string(out), "OFPFMFC_OVERLAP") {
+		t.Fatalf("expected overlap error, but got: %v: %s", err, out)
+	}
+	if _, err := sw.Exec("ovs-ofctl", "add-flow", "br0", "priority=11,tcp,check_overlap,actions=drop"); err != nil {
+		t.Fatalf("flows with different priorities should not overlap: %v", err)
+	}
+}
+
+func TestSwitchAddFlowCheckOverlapDuplicate(t *testing.T) {
+	sw, _ := testSwitch(t)
+
+	const flow = "priority=10,tcp,tp_dst=80,actions=drop"
+	if _, err := sw.Exec("ovs-ofctl", "add-flow", "br0", flow); err != nil {
+		t.Fatalf("failed to add flow: %v", err)
+	}
+
+	// An identical flow also overlaps, so it must not replace the existing
+	// flow when check_overlap is set, with or without --strict.
+	for _, args := range [][]string{
+		{"add-flow", "br0", "priority=10,tcp,tp_dst=80,check_overlap,actions=normal"},
+		{"--strict", "add-flow", "br0", "priority=10,tcp,tp_dst=80,check_overlap,actions=normal"},
+	} {
+		out, err := sw.Exec("ovs-ofctl", args...)
+		if err == nil || !strings.Contains(string(out), "OFPFMFC_OVERLAP") {
+			t.Fatalf("expected overlap error for %v, but got: %v: %s", args, err, out)
+		}
+	}
+
+	out, err := sw.Exec("ovs-ofctl", "dump-flows", "br0")
+	if err != nil {
+		t.Fatalf("failed to dump flows: %v", err)
+	}
+	if !strings.Contains(string(out), "actions=drop") {
+		t.Fatalf("existing flow was replaced:\n%s", out)
+	}
+
+	// Without check_overlap, the identical flow is replaced.
+	if _, err := sw.Exec("ovs-ofctl", "add-flow", "br0", "priority=10,tcp,tp_dst=80,actions=normal"); err != nil {
+		t.Fatalf("failed to replace flow: %v", err)
+	}
+}
+
+func TestSwitchDelFlows(t *testing.T) {
+	var tests = []struct {
+		desc   string
+		mf     *ovs.MatchFlow
+		strict bool
+		want   []string
+	}{
+		{
+			desc: "all flows",
+			want: []string{},
+		},
+		{
+			desc: "non-strict by protocol in any table",
+			mf: &ovs.MatchFlow{
+				Protocol: ovs.ProtocolTCPv4,
+				Table:    ovs.AnyTable,
+			},
+			want: []string{
+				"priority=10,ip,table=0,idle_timeout=0,cookie=0x0000000000000001,actions=normal",
+			},
+		},
+		{
+			desc: "non-strict by implied protocol in table",
+			mf: &ovs.MatchFlow{
+				Protocol: ovs.ProtocolIPv4,
+				Table:    0,
+			},
+			want: []string{
+				"priority=100,tcp,tp_dst=80,table=1,idle_timeout=0,cookie=0x0000000000000002,actions=output:1",
+			},
+		},
+		{
+			desc: "non-strict by cookie",
+			mf: &ovs.MatchFlow{
+				Cookie: 0x2,
+				Table:  ovs.AnyTable,
+			},
+			want: []string{
+				"priority=10,ip,table=0,idle_timeout=0,cookie=0x0000000000000001,actions=normal",
+			},
+		},
+		{
+			desc: "strict requires exact match",
+			mf: &ovs.MatchFlow{
+				Strict:   true,
+				Priority: 100,
+				Protocol: ovs.ProtocolTCPv4,
+				Table:    ovs.AnyTable,
+			},
+			strict: true,
+			want: []string{
+				"priority=100,tcp,tp_dst=22,table=0,idle_timeout=0,cookie=0x0000000000000002,actions=drop",
+				"priority=10,ip,table=0,idle_timeout=0,cookie=0x0000000000000001,actions=normal",
+				"priority=100,tcp,tp_dst=80,table=1,idle_timeout=0,cookie=0x0000000000000002,actions=output:1",
+			},
+		},
+		{
+			desc:   "strict",
+			mf:     testFlows()[1].MatchFlowStrict(),
+			strict: true,
+			want: []string{
+				"priority=10,ip,table=0,idle_timeout=0,cookie=0x0000000000000001,actions=normal",
+				"priority=100,tcp,tp_dst=80,table=1,idle_timeout=0,cookie=0x0000000000000002,actions=output:1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			sw, c := testSwitch(t)
+
+			for _, f := range testFlows() {
+				if err := c.OpenFlow.AddFlow("br0", f); err != nil {
+					t.Fatalf("failed to add flow: %v", err)
+				}
+			}
+
+			// DelFlows never passes --strict, so strict deletion is
+			// performed directly.
+			if tt.strict {
+				b, err := tt.mf.MarshalText()
+				if err != nil {
+					t.Fatalf("failed to marshal match flow: %v", err)
+				}
+
+				if _, err := sw.Exec("ovs-ofctl", "--strict", "del-flows", "br0", string(b)); err != nil {
+					t.Fatalf("failed to delete flows: %v", err)
+				}
+			} else if err := c.OpenFlow.DelFlows("br0", tt.mf); err != nil {
+				t.Fatalf("failed to delete flows: %v", err)
+			}
+
+			if got := dumpFlows(t, c); !reflect.DeepEqual(tt.want, got) {
+				t.Fatalf("unexpected flows:\n- want: %v\n-  got: %v",
+					strings.Join(tt.want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestSwitchAddFlowBundle(t *testing.T) {
+	_, c := testSwitch(t)
+
+	flows := testFlows()
+	err := c.OpenFlow.AddFlowBundle("br0", func(tx *ovs.FlowTransaction) error {
+		tx.Add(flows...)
+		tx.DeleteStrict(flows[1].MatchFlowStrict())
+		return tx.Commit()
+	})
+	if err != nil {
+		t.Fatalf("failed to commit bundle: %v", err)
+	}
+
+	want := []string{
+		"priority=10,ip,table=0,idle_timeout=0,cookie=0x0000000000000001,actions=normal",
+		"priority=100,tcp,tp_dst=80,table=1,idle_timeout=0,cookie=0x0000000000000002,actions=output:1",
+	}
+	if got := dumpFlows(t, c); !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected flows:\n- want: %v\n-  got: %v",
+			strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	// A failing bundle makes no changes.
+	err = c.OpenFlow.AddFlowBundle("br0", func(tx *ovs.FlowTransaction) error {
+		tx.Delete(&ovs.MatchFlow{Protocol: ovs.ProtocolIPv4, Table: ovs.AnyTable})
+		tx.Add(&ovs.Flow{
+			Table:   300,
+			Actions: []ovs.Action{ovs.Drop()},
+		})
+		return tx.Commit()
+	})
+
+	var berr *ovs.BundleError
+	if !errors.As(err, &berr) {
+		t.Fatalf("expected *ovs.BundleError, but got: %v", err)
+	}
+	if berr.Index != 1 || berr.Directive != "add" {
+		t.Fatalf("unexpected BundleError: %v", berr)
+	}
+
+	if got := dumpFlows(t, c); !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected flows after failed bundle:\n- want: %v\n-  got: %v",
+			strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestSwitchAddFlowFileParseError(t *testing.T) {
+	sw, c := testSwitch(t)
+
+	// A malformed line installs none of the flows in the file.
+	file := strings.Join([]string{
+		"priority=10,ip,actions=normal",
+		"priority=20,ip,table=300,actions=drop",
+	}, "\n")
+
+	out, err := sw.Pipe(strings.NewReader(file), "ovs-ofctl", "add-flow", "br0", "-")
+	if err == nil || !strings.HasPrefix(string(out), "ovs-ofctl: -:2: ") {
+		t.Fatalf("expected a parse error for line 2, but got: %v: %s", err, out)
+	}
+
+	if got := dumpFlows(t, c); len(got) != 0 {
+		t.Fatalf("unexpected flows after parse error: %v", strings.Join(got, "\n"))
+	}
+
+	// Errors from the switch leave earlier lines installed.
+	file = strings.Join([]string{
+		"priority=10,tcp,actions=normal",
+		"priority=10,ip,check_overlap,actions=drop",
+	}, "\n")
+
+	out, err = sw.Pipe(strings.NewReader(file), "ovs-ofctl", "add-flow", "br0", "-")
+	if err == nil || strings.HasPrefix(string(out), "ovs-ofctl: -:") {
+		t.Fatalf("expected a switch error, but got: %v: %s", err, out)
+	}
+
+	want := []string{
+		"priority=10,tcp,table=0,idle_timeout=0,actions=normal",
+	}
+	if got := dumpFlows(t, c); !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected flows:\n- want: %v\n-  got: %v",
+			strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestSwitchAddStats(t *testing.T) {
+	sw, c := testSwitch(t)
+
+	for _, f := range testFlows() {
+		if err := c.OpenFlow.AddFlow("br0", f); err != nil {
+			t.Fatalf("failed to add flow: %v", err)
+		}
+	}
+
+	n, err := sw.AddStats("br0", &ovs.MatchFlow{
+		Protocol: ovs.ProtocolTCPv4,
+		Table:    ovs.AnyTable,
+	}, 2, 128)
+	if err != nil {
+		t.Fatalf("failed to add stats: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("unexpected number of flows updated: %d", n)
+	}
+
+	stats, err := c.OpenFlow.DumpAggregate("br0", &ovs.MatchFlow{
+		Cookie: 0x2,
+		Table:  ovs.AnyTable,
+	})
+	if err != nil {
+		t.Fatalf("failed to dump aggregate: %v", err)
+	}
+	if want, got := (&ovs.FlowStats{PacketCount: 4, ByteCount: 256}), stats; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected stats:\n- want: %+v\n-  got: %+v", want, got)
+	}
+
+	// Replacing a flow retains its counters.
+	if err := c.OpenFlow.AddFlow("br0", testFlows()[1]); err != nil {
+		t.Fatalf("failed to add flow: %v", err)
+	}
+
+	out, err := sw.Exec("ovs-ofctl", "dump-flows", "br0", "tcp,tp_dst=22")
+	if err != nil {
+		t.Fatalf("failed to dump flows: %v", err)
+	}
+	if !strings.Contains(string(out), "n_packets=2, n_bytes=128,") {
+		t.Fatalf("counters were not retained:\n%s", out)
+	}
+}
@@ -0,0 +1,512 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovstest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+)
+
+// errExit is returned along with command output when a simulated command
+// fails, in the same form as a failed process.
+var errExit = errors.New("exit status 1")
+
+// A Switch is an in-memory simulation of an Open vSwitch instance, which
+// holds bridges, ports, and flows.  It is safe for concurrent use.
+type Switch struct {
+	mu      sync.Mutex
+	bridges map[string]*bridge
+	ports   map[string]*port
+	now     func() time.Time
+}
+
+// A bridge is a bridge in a Switch.
+type bridge struct {
+	name       string
+	failMode   string
+	controller []string
+	protocols  []string
+	nextOFPort int
+	flows      flowTable
+}
+
+// A port is a port in a Switch, along with its interface of the same name.
+type port struct {
+	name    string
+	bridge  string
+	ofport  int
+	options map[string]string
+}
+
+// NewSwitch creates a Switch with no bridges.
+func NewSwitch() *Switch {
+	return &Switch{
+		bridges: make(map[string]*bridge),
+		ports:   make(map[string]*port),
+		now:     time.Now,
+	}
+}
+
+// Client creates an ovs.Client which executes all commands using s.  Any
+// additional OptionFuncs are applied after those which configure s.
+func (s *Switch) Client(options ...ovs.OptionFunc) *ovs.Client {
+	opts := []ovs.OptionFunc{
+		ovs.Exec(s.Exec),
+		ovs.Pipe(s.Pipe),
+	}
+
+	return ovs.New(append(opts, options...)...)
+}
+
+// Exec implements ovs.ExecFunc by simulating the specified command.
+func (s *Switch) Exec(cmd string, args ...string) ([]byte, error) {
+	return s.Pipe(nil, cmd, args...)
+}
+
+// Pipe implements ovs.PipeFunc by simulating the specified command, which
+// may read from stdin.
+func (s *Switch) Pipe(stdin io.Reader, cmd string, args ...string) ([]byte, error) {
+	// Commands run using ovs.Sudo are simulated directly.
+	if cmd == "sudo" && len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		out []byte
+		err error
+	)
+
+	switch cmd {
+	case "ovs-vsctl":
+		out, err = s.vsctl(args)
+	case "ovs-ofctl":
+		out, err = s.ofctl(stdin, args)
+	default:
+		return []byte(fmt.Sprintf("%s: command not found", cmd)), errExit
+	}
+
+	if err != nil {
+		return []byte(fmt.Sprintf("%s: %v\n", cmd, err)), errExit
+	}
+
+	return out, nil
+}
+
+// Bridges returns the names of all bridges in s, in sorted order.
+func (s *Switch) Bridges() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bridgeNames()
+}
+
+// OFPort returns the OpenFlow port number assigned to the named port.
+func (s *Switch) OFPort(name string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.ports[name]
+	if !ok {
+		return 0, false
+	}
+
+	return p.ofport, true
+}
+
+// Flows returns the flows installed in the named bridge, in the order
+// reported by 'ovs-ofctl dump-flows'.
+func (s *Switch) Flows(bridge string) ([]*ovs.Flow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.bridge(bridge)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+
+	var flows []*ovs.Flow
+	for _, e := range b.flows.sorted(nil) {
+		f := new(ovs.Flow)
+		if err := f.UnmarshalText([]byte(e.String(now))); err != nil {
+			return nil, err
+		}
+
+		flows = append(flows, f)
+	}
+
+	return flows, nil
+}
+
+// AddStats adds packets and bytes to the counters of every flow in the named
+// bridge which is matched by flow, as if traffic had been forwarded by those
+// flows.  It returns the number of flows which were updated.
+func (s *Switch) AddStats(bridge string, flow *ovs.MatchFlow, packets, bytes uint64) (int, error) {
+	text, err := flow.MarshalText()
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := parseFlowSpec(string(text), false)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := s.bridge(bridge)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, e := range b.flows {
+		var ok bool
+		if flow.Strict {
+			ok = e.matchesStrict(f)
+		} else {
+			ok = e.matches(f)
+		}
+		if !ok {
+			continue
+		}
+
+		e.packets += packets
+		e.bytes += bytes
+		n++
+	}
+
+	return n, nil
+}
+
+// bridge returns the named bridge, or an error in the format used by
+// 'ovs-vsctl' if it does not exist.
+func (s *Switch) bridge(name string) (*bridge, error) {
+	b, ok := s.bridges[name]
+	if !ok {
+		return nil, fmt.Errorf("no bridge named %s", name)
+	}
+
+	return b, nil
+}
+
+// bridgeNames returns the names of all bridges in sorted order.
+func (s *Switch) bridgeNames() []string {
+	names := make([]string, 0, len(s.bridges))
+	for name := range s.bridges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// splitArgs separates flags from positional arguments.  A lone "-" is
+// positional, because it refers to stdin.
+func splitArgs(args []string) (map[string]string, []string) {
+	flags := make(map[string]string)
+	var pos []string
+
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") || a == "-" {
+			pos = append(pos, a)
+			continue
+		}
+
+		kv := strings.SplitN(strings.TrimLeft(a, "-"), "=", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		flags[kv[0]] = kv[1]
+	}
+
+	return flags, pos
+}
+
+// vsctl simulates 'ovs-vsctl'.
+func (s *Switch) vsctl(args []string) ([]byte, error) {
+	for _, a := range args {
+		if a == "--" {
+			return nil, errors.New("multiple commands are not supported by ovstest")
+		}
+	}
+
+	flags, pos := splitArgs(args)
+	if len(pos) == 0 {
+		return nil, errors.New("missing command name (use --help for help)")
+	}
+
+	_, mayExist := flags["may-exist"]
+	_, ifExists := flags["if-exists"]
+
+	cmd, pos := pos[0], pos[1:]
+	need := func(n int) error {
+		if len(pos) != n {
+			return fmt.Errorf("'%s' command requires %d arguments", cmd, n)
+		}
+		return nil
+	}
+
+	switch cmd {
+	case "add-br":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		if _, ok := s.bridges[pos[0]]; ok {
+			if mayExist {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("cannot create a bridge named %s because a bridge named %s already exists", pos[0], pos[0])
+		}
+
+		s.bridges[pos[0]] = &bridge{
+			name:       pos[0],
+			nextOFPort: 1,
+		}
+		return nil, nil
+	case "del-br":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		if _, ok := s.bridges[pos[0]]; !ok {
+			if ifExists {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("no bridge named %s", pos[0])
+		}
+
+		for name, p := range s.ports {
+			if p.bridge == pos[0] {
+				delete(s.ports, name)
+			}
+		}
+		delete(s.bridges, pos[0])
+		return nil, nil
+	case "list-br":
+		return lines(s.bridgeNames()), nil
+	case "add-port":
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		b, err := s.bridge(pos[0])
+		if err != nil {
+			return nil, err
+		}
+		if p, ok := s.ports[pos[1]]; ok {
+			if mayExist && p.bridge == b.name {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("cannot create a port named %s because a port named %s already exists on bridge %s", pos[1], pos[1], p.bridge)
+		}
+
+		s.ports[pos[1]] = &port{
+			name:    pos[1],
+			bridge:  b.name,
+			ofport:  b.nextOFPort,
+			options: make(map[string]string),
+		}
+		b.nextOFPort++
+		return nil, nil
+	case "del-port":
+		if len(pos) != 1 && len(pos) != 2 {
+			return nil, fmt.Errorf("'%s' command requires 1 or 2 arguments", cmd)
+		}
+		name := pos[len(pos)-1]
+		p, ok := s.ports[name]
+		if !ok || len(pos) == 2 && p.bridge != pos[0] {
+			if ifExists {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("no port named %s", name)
+		}
+
+		delete(s.ports, name)
+		return nil, nil
+	case "list-ports":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		if _, err := s.bridge(pos[0]); err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for name, p := range s.ports {
+			if p.bridge == pos[0] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return lines(names), nil
+	case "port-to-br":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		p, ok := s.ports[pos[0]]
+		if !ok {
+			return nil, fmt.Errorf("no port named %s", pos[0])
+		}
+		return []byte(p.bridge + "\n"), nil
+	case "get-fail-mode", "get-controller":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		b, err := s.bridge(pos[0])
+		if err != nil {
+			return nil, err
+		}
+		if cmd == "get-fail-mode" {
+			return []byte(b.failMode + "\n"), nil
+		}
+		return lines(b.controller), nil
+	case "set-fail-mode":
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		b, err := s.bridge(pos[0])
+		if err != nil {
+			return nil, err
+		}
+		if pos[1] != string(ovs.FailModeStandalone) && pos[1] != string(ovs.FailModeSecure) {
+			return nil, fmt.Errorf("fail-mode must be \"standalone\" or \"secure\"")
+		}
+		b.failMode = pos[1]
+		return nil, nil
+	case "set-controller":
+		if len(pos) < 1 {
+			return nil, fmt.Errorf("'%s' command requires at least 1 arguments", cmd)
+		}
+		b, err := s.bridge(pos[0])
+		if err != nil {
+			return nil, err
+		}
+		b.controller = append([]string(nil), pos[1:]...)
+		return nil, nil
+	case "get":
+		return s.vsctlGet(pos)
+	case "set":
+		return nil, s.vsctlSet(pos)
+	}
+
+	return nil, fmt.Errorf("unknown command '%s'; use --help for help", cmd)
+}
+
+// vsctlGet simulates 'ovs-vsctl get' for the columns used by ovs.Client.
+func (s *Switch) vsctlGet(pos []string) ([]byte, error) {
+	if len(pos) != 3 {
+		return nil, errors.New("'get' command requires a table, record, and column")
+	}
+
+	table, record, column := strings.ToLower(pos[0]), pos[1], pos[2]
+	switch {
+	case table == "bridge" && column == "protocols":
+		b, err := s.bridge(record)
+		if err != nil {
+			return nil, err
+		}
+
+		protocols := b.protocols
+		if protocols == nil {
+			protocols = []string{}
+		}
+		return json.Marshal(protocols)
+	case table == "interface":
+		p, ok := s.ports[record]
+		if !ok {
+			return nil, fmt.Errorf("no row \"%s\" in table Interface", record)
+		}
+
+		if column == "ofport" {
+			return []byte(strconv.Itoa(p.ofport) + "\n"), nil
+		}
+		return []byte(p.options[column] + "\n"), nil
+	}
+
+	return nil, fmt.Errorf("column %s in table %s is not supported by ovstest", column, pos[0])
+}
+
+// vsctlSet simulates 'ovs-vsctl set' for the columns used by ovs.Client.
+func (s *Switch) vsctlSet(pos []string) error {
+	if len(pos) < 3 {
+		return errors.New("'set' command requires a table, record, and column")
+	}
+
+	table, record := strings.ToLower(pos[0]), pos[1]
+	for _, kv := range pos[2:] {
+		ss := strings.SplitN(kv, "=", 2)
+		if len(ss) != 2 {
+			return fmt.Errorf("%s: argument does not end in \"=\" followed by a value", kv)
+		}
+
+		switch {
+		case table == "bridge" && ss[0] == "protocols":
+			b, err := s.bridge(record)
+			if err != nil {
+				return err
+			}
+			b.protocols = strings.Split(ss[1], ",")
+		case table == "interface":
+			p, ok := s.ports[record]
+			if !ok {
+				return fmt.Errorf("no row \"%s\" in table Interface", record)
+			}
+			p.options[ss[0]] = ss[1]
+		default:
+			return fmt.Errorf("column %s in table %s is not supported by ovstest", ss[0], pos[0])
+		}
+	}
+
+	return nil
+}
+
+// target returns the bridge referred to by an 'ovs-ofctl' target, which may
+// be a bridge name or the path to its management socket.
+func (s *Switch) target(t string) (*bridge, error) {
+	name := strings.TrimPrefix(t, "unix:")
+	if strings.Contains(name, "/") {
+		name = strings.TrimSuffix(path.Base(name), ".mgmt")
+	}
+
+	b, ok := s.bridges[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a bridge or a socket", t)
+	}
+
+	return b, nil
+}
+
+// lines joins ss into newline-terminated lines.
+func lines(ss []string) []byte {
+	if len(ss) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(ss, "\n") + "\n")
+}
@@ -0,0 +1,139 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovstest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/digitalocean/go-openvswitch/ovs"
+)
+
+func TestSwitchBridgesAndPorts(t *testing.T) {
+	sw := NewSwitch()
+	c := sw.Client(ovs.Sudo())
+
+	for _, br := range []string{"br1", "br0", "br0"} {
+		if err := c.VSwitch.AddBridge(br); err != nil {
+			t.Fatalf("failed to add bridge: %v", err)
+		}
+	}
+
+	bridges, err := c.VSwitch.ListBridges()
+	if err != nil {
+		t.Fatalf("failed to list bridges: %v", err)
+	}
+	if want, got := []string{"br0", "br1"}, bridges; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected bridges:\n- want: %v\n-  got: %v", want, got)
+	}
+
+	for _, p := range []string{"eth1", "eth0"} {
+		if err := c.VSwitch.AddPort("br0", p); err != nil {
+			t.Fatalf("failed to add port: %v", err)
+		}
+	}
+
+	ports, err := c.VSwitch.ListPorts("br0")
+	if err != nil {
+		t.Fatalf("failed to list ports: %v", err)
+	}
+	if want, got := []string{"eth0", "eth1"}, ports; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected ports:\n- want: %v\n-  got: %v", want, got)
+	}
+
+	if ofport, ok := sw.OFPort("eth0"); !ok || ofport != 2 {
+		t.Fatalf("unexpected ofport for eth0: %d, %v", ofport, ok)
+	}
+
+	br, err := c.VSwitch.PortToBridge("eth1")
+	if err != nil {
+		t.Fatalf("failed to find bridge for port: %v", err)
+	}
+	if want, got := "br0", br; want != got {
+		t.Fatalf("unexpected bridge:\n- want: %v\n-  got: %v", want, got)
+	}
+
+	if err := c.VSwitch.DeletePort("br0", "eth1"); err != nil {
+		t.Fatalf("failed to delete port: %v", err)
+	}
+	if _, err := c.VSwitch.PortToBridge("eth1"); !ovs.IsPortNotExist(err) || !errors.Is(err, ovs.ErrNoSuchPort) {
+		t.Fatalf("expected port to not exist, but got: %v", err)
+	}
+
+	if err := c.VSwitch.DeleteBridge("br0"); err != nil {
+		t.Fatalf("failed to delete bridge: %v", err)
+	}
+	if _, ok := sw.OFPort("eth0"); ok {
+		t.Fatal("port should be deleted along with its bridge")
+	}
+	if _, err := c.VSwitch.ListPorts("br0"); !errors.Is(err, ovs.ErrNoSuchBridge) {
+		t.Fatalf("expected ErrNoSuchBridge, but got: %v", err)
+	}
+}
+
+func TestSwitchBridgeSettings(t *testing.T) {
+	sw := NewSwitch()
+	c := sw.Client()
+
+	if err := c.VSwitch.AddBridge("br0"); err != nil {
+		t.Fatalf("failed to add bridge: %v", err)
+	}
+
+	if err := c.VSwitch.SetFailMode("br0", ovs.FailModeSecure); err != nil {
+		t.Fatalf("failed to set fail mode: %v", err)
+	}
+	mode, err := c.VSwitch.GetFailMode("br0")
+	if err != nil {
+		t.Fatalf("failed to get fail mode: %v", err)
+	}
+	if want, got := ovs.FailModeSecure, mode; want != got {
+		t.Fatalf("unexpected fail mode:\n- want: %v\n-  got: %v", want, got)
+	}
+
+	if err := c.VSwitch.SetController("br0", "tcp:192.0.2.1:6653"); err != nil {
+		t.Fatalf("failed to set controller: %v", err)
+	}
+	addr, err := c.VSwitch.GetController("br0")
+	if err != nil {
+		t.Fatalf("failed to get controller: %v", err)
+	}
+	if want, got := "tcp:192.0.2.1:6653", addr; want != got {
+		t.Fatalf("unexpected controller:\n- want: %v\n-  got: %v", want, got)
+	}
+
+	protocols := []string{ovs.ProtocolOpenFlow10, ovs.ProtocolOpenFlow13}
+	if err := c.VSwitch.Set.Bridge("br0", ovs.BridgeOptions{Protocols: protocols}); err != nil {
+		t.Fatalf("failed to set bridge options: %v", err)
+	}
+	opts, err := c.VSwitch.Get.Bridge("br0")
+	if err != nil {
+		t.Fatalf("failed to get bridge options: %v", err)
+	}
+	if want, got := protocols, opts.Protocols; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected protocols:\n- want: %v\n-  got: %v", want, got)
+	}
+}
+
+func TestSwitchUnsupportedCommand(t *testing.T) {
+	out, err := NewSwitch().Exec("ovs-vsctl", "list", "Open_vSwitch")
+	if err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	if want, got := "ovs-vsctl: unknown command 'list'; use --help for help\n", string(out); want != got {
+		t.Fatalf("unexpected output:\n- want: %q\n-  got: %q", want, got)
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	// ErrUnknownStage is returned when a flow in a Pipeline refers to a
+	// stage which does not exist.
+	ErrUnknownStage = errors.New("unknown pipeline stage")
+
+	// errUnresolvedStage is returned when an Action returned by
+	// ResubmitStage or GotoStage is marshaled outside of a Pipeline.
+	errUnresolvedStage = errors.New("stage reference must be compiled by a Pipeline")
+
+	// errInvalidStage is returned when a Pipeline stage has an empty or
+	// duplicate name.
+	errInvalidStage = errors.New("pipeline stages must have unique, non-empty names")
+
+	// errResubmitTableZero is returned when a flow resubmits to a stage in
+	// table 0, which the resubmit action cannot express.
+	errResubmitTableZero = errors.New("cannot resubmit to a stage in table 0, use a nonzero Pipeline.FirstTable")
+
+	// errDuplicatePipelineFlow is returned when a Pipeline contains two
+	// flows with the same match and priority in the same stage.
+	errDuplicatePipelineFlow = errors.New("pipeline stage contains duplicate flows")
+)
+
+// A Pipeline is a sequence of named stages, each of which occupies one
+// OpenFlow table.  Flows in a stage refer to other stages by name using
+// ResubmitStage and GotoStage, and table IDs are assigned when the Pipeline
+// is compiled.
+type Pipeline struct {
+	// FirstTable is the table ID assigned to the first stage.  Each
+	// following stage is assigned the next table ID.
+	FirstTable int
+
+	// Stages are the stages of the pipeline, in table order.
+	Stages []*Stage
+}
+
+// A Stage is a named table in a Pipeline.
+type Stage struct {
+	// Name identifies the stage within its Pipeline.
+	Name string
+
+	// Flows are the flows in the stage.  The Table field of each flow is
+	// ignored, and set to the table ID of the stage when compiled.
+	Flows []*Flow
+
+	// Miss are the actions of the priority 0 flow which matches packets
+	// that match no other flow in the stage.  If Miss is empty, those
+	// packets are dropped.
+	Miss []Action
+}
+
+// ResubmitStage resubmits a packet to the table of the named stage of a
+// Pipeline.  It may only be used in flows compiled by a Pipeline.
+func ResubmitStage(name string) Action {
+	return &stageAction{
+		name: name,
+	}
+}
+
+// GotoStage continues pipeline processing of a packet in the table of the
+// named stage of a Pipeline, which must follow the current stage.  It may
+// only be used in flows compiled by a Pipeline.
+func GotoStage(name string) Action {
+	return &stageAction{
+		name:      name,
+		gotoTable: true,
+	}
+}
+
+var _ Action = &stageAction{}
+
+// A stageAction is an Action returned by ResubmitStage or GotoStage.
+type stageAction struct {
+	name      string
+	gotoTable bool
+}
+
+// MarshalText implements Action.
+func (a *stageAction) MarshalText() ([]byte, error) {
+	return nil, fmt.Errorf("%w: %q", errUnresolvedStage, a.name)
+}
+
+// GoString implements Action.
+func (a *stageAction) GoString() string {
+	if a.gotoTable {
+		return fmt.Sprintf("ovs.GotoStage(%q)", a.name)
+	}
+
+	return fmt.Sprintf("ovs.ResubmitStage(%q)", a.name)
+}
+
+// A CompiledPipeline is a Pipeline whose stages have been assigned table
+// IDs, produced by Pipeline.Compile.
+type CompiledPipeline struct {
+	// Flows are the flows of every stage, including miss flows, in stage
+	// order.
+	Flows []*Flow
+
+	stages []string
+	tables map[string]int
+}
+
+// Compile assigns table IDs to the stages of p, and produces the flows of
+// every stage with all stage references resolved.
+func (p *Pipeline) Compile() (*CompiledPipeline, error) {
+	c := &CompiledPipeline{
+		stages: make([]string, 0, len(p.Stages)),
+		tables: make(map[string]int, len(p.Stages)),
+	}
+
+	for i, s := range p.Stages {
+		if s.Name == "" {
+			return nil, errInvalidStage
+		}
+		if _, ok := c.tables[s.Name]; ok {
+			return nil, fmt.Errorf("%w: %q", errInvalidStage, s.Name)
+		}
+
+		table := p.FirstTable + i
+		if table < 0 || table > maxTableID {
+			return nil, fmt.Errorf("stage %q: table %d is not between 0 and %d: %w",
+				s.Name, table, maxTableID, ErrFieldWidth)
+		}
+
+		c.stages = append(c.stages, s.Name)
+		c.tables[s.Name] = table
+	}
+
+	for _, s := range p.Stages {
+		flows, err := c.compileStage(s)
+		if err != nil {
+			return nil, fmt.Errorf("stage %q: %w", s.Name, err)
+		}
+
+		c.Flows = append(c.Flows, flows...)
+	}
+
+	return c, nil
+}
+
+// compileStage produces the flows of s, including its miss flow.
+func (c *CompiledPipeline) compileStage(s *Stage) ([]*Flow, error) {
+	table := c.tables[s.Name]
+
+	miss := s.Miss
+	if len(miss) == 0 {
+		miss = []Action{Drop()}
+	}
+
+	in := make([]*Flow, 0, len(s.Flows)+1)
+	in = append(in, s.Flows...)
+	in = append(in, &Flow{Actions: miss})
+
+	seen := make(map[string]bool, len(in))
+	out := make([]*Flow, 0, len(in))
+	for _, f := range in {
+		actions, err := c.resolve(table, f.Actions)
+		if err != nil {
+			return nil, err
+		}
+
+		cf := *f
+		cf.Table = table
+		cf.Actions = actions
+
+		key, err := flowMatchKey(&cf)
+		if err != nil {
+			return nil, err
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("%w: %s", errDuplicatePipelineFlow, key)
+		}
+		seen[key] = true
+
+		out = append(out, &cf)
+	}
+
+	return out, nil
+}
+
+// resolve replaces all stage references in actions with the table IDs of
+// their stages, for a flow in table.
+func (c *CompiledPipeline) resolve(table int, actions []Action) ([]Action, error) {
+	out := make([]Action, 0, len(actions))
+	for _, a := range actions {
+		switch a := a.(type) {
+		case *stageAction:
+			next, ok := c.tables[a.name]
+			if !ok {
+				return nil, fmt.Errorf("%w: %q", ErrUnknownStage, a.name)
+			}
+
+			if !a.gotoTable {
+				// Resubmit treats a zero table as the current table.
+				if next == 0 {
+					return nil, fmt.Errorf("stage %q: %w", a.name, errResubmitTableZero)
+				}
+
+				out = append(out, Resubmit(0, next))
+				continue
+			}
+
+			if next <= table {
+				return nil, fmt.Errorf("stage %q: %w", a.name, ErrInvalidGotoTable)
+			}
+			out = append(out, GotoTable(next))
+		case *writeActionsInstruction:
+			inner, err := c.resolve(table, a.actions)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, WriteActions(inner...))
+		default:
+			out = append(out, a)
+		}
+	}
+
+	return out, nil
+}
+
+// Table returns the table ID assigned to the named stage.
+func (c *CompiledPipeline) Table(name string) (int, bool) {
+	table, ok := c.tables[name]
+	return table, ok
+}
+
+// A PipelinePlan is the set of changes required to make the flows of a
+// bridge match a CompiledPipeline.
+type PipelinePlan struct {
+	// Delete are flows which are not part of the pipeline, and must be
+	// deleted.
+	Delete []*MatchFlow
+
+	// Add are flows which are missing or differ from the pipeline, and
+	// must be added.  Adding a flow replaces an existing flow with the same
+	// match and priority.
+	Add []*Flow
+}
+
+// Plan compares current, typically the flows retrieved from a bridge using
+// DumpFlows, with the flows of c, and returns the changes required to make
+// them match.  Flows in current which are in tables not used by c are
+// ignored.
+func (c *CompiledPipeline) Plan(current []*Flow) (*PipelinePlan, error) {
+	tables := make(map[int]bool, len(c.tables))
+	for _, t := range c.tables {
+		tables[t] = true
+	}
+
+	existing := make(map[string]*Flow, len(current))
+	for _, f := range current {
+		if !tables[f.Table] {
+			continue
+		}
+
+		key, err := flowMatchKey(f)
+		if err != nil {
+			return nil, err
+		}
+		existing[key] = f
+	}
+
+	plan := &PipelinePlan{}
+	for _, f := range c.Flows {
+		key, err := flowMatchKey(f)
+		if err != nil {
+			return nil, err
+		}
+
+		cur, ok := existing[key]
+		delete(existing, key)
+		if ok && cur.Equal(f) {
+			continue
+		}
+
+		plan.Add = append(plan.Add, f)
+	}
+
+	// Delete remaining flows in the order they were retrieved, so that
+	// plans are deterministic.
+	for _, f := range current {
+		key, err := flowMatchKey(f)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := existing[key]; !ok {
+			continue
+		}
+
+		plan.Delete = append(plan.Delete, f.MatchFlowStrict())
+	}
+
+	return plan, nil
+}
+
+// Apply pushes the changes in p on to tx, deleting flows before adding
+// them.
+func (p *PipelinePlan) Apply(tx *FlowTransaction) {
+	tx.DeleteStrict(p.Delete...)
+	tx.Add(p.Add...)
+}
+
+// Graph renders the stages of c and the references between them in the
+// Graphviz DOT language, for use in reviewing pipeline changes.  Tables
+// which are referenced but are not part of c are rendered by table ID.
+func (c *CompiledPipeline) Graph() string {
+	names := make(map[int]string, len(c.tables))
+	counts := make(map[int]int, len(c.tables))
+	for name, t := range c.tables {
+		names[t] = name
+	}
+	for _, f := range c.Flows {
+		counts[f.Table]++
+	}
+
+	node := func(table int) string {
+		if name, ok := names[table]; ok {
+			return strconv.Quote(name)
+		}
+
+		return strconv.Quote("table " + strconv.Itoa(table))
+	}
+
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("digraph pipeline {\n")
+	_, _ = buf.WriteString("\trankdir=LR;\n")
+
+	for _, name := range c.stages {
+		t := c.tables[name]
+		_, _ = fmt.Fprintf(&buf, "\t%s [shape=box,label=\"%s\\ntable %d\\n%d flows\"];\n",
+			node(t), name, t, counts[t])
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range c.Flows {
+		for _, e := range tableReferences(f.Table, f.Actions) {
+			edge := fmt.Sprintf("\t%s -> %s [label=%q];\n", node(f.Table), node(e.table), e.kind)
+			if seen[edge] {
+				continue
+			}
+			seen[edge] = true
+
+			_, _ = buf.WriteString(edge)
+		}
+	}
+
+	_, _ = buf.WriteString("}\n")
+	return buf.String()
+}
+
+// A tableReference is a reference to another table by an Action.
+type tableReference struct {
+	kind  string
+	table int
+}
+
+// tableReferences returns the tables referenced by actions of a flow in
+// table.
+func tableReferences(table int, actions []Action) []tableReference {
+	var refs []tableReference
+	for _, a := range actions {
+		switch a := a.(type) {
+		case *resubmitAction:
+			// A resubmit with no table resubmits to the current table.
+			next := a.table
+			if next == 0 {
+				next = table
+			}
+			refs = append(refs, tableReference{kind: "resubmit", table: next})
+		case *gotoTableInstruction:
+			refs = append(refs, tableReference{kind: instructionGotoTable, table: a.table})
+		case *writeActionsInstruction:
+			refs = append(refs, tableReferences(table, a.actions)...)
+		}
+	}
+
+	return refs
+}
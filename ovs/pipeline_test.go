@@ -0,0 +1,308 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testPipeline() *Pipeline {
+	return &Pipeline{
+		FirstTable: 10,
+		Stages: []*Stage{
+			{
+				Name: "classify",
+				Flows: []*Flow{{
+					Priority: 100,
+					Protocol: ProtocolIPv4,
+					Actions:  []Action{GotoStage("acl")},
+				}},
+			},
+			{
+				Name: "acl",
+				Flows: []*Flow{{
+					Priority: 100,
+					Protocol: ProtocolTCPv4,
+					Matches:  []Match{TransportDestinationPort(22)},
+					Actions:  []Action{ResubmitStage("output")},
+				}},
+				Miss: []Action{ResubmitStage("output")},
+			},
+			{
+				Name: "output",
+				Miss: []Action{Normal()},
+			},
+		},
+	}
+}
+
+func TestPipelineCompile(t *testing.T) {
+	c, err := testPipeline().Compile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"priority=100,ip,table=10,idle_timeout=0,actions=goto_table:11",
+		"priority=0,table=10,idle_timeout=0,actions=drop",
+		"priority=100,tcp,tp_dst=22,table=11,idle_timeout=0,actions=resubmit(,12)",
+		"priority=0,table=11,idle_timeout=0,actions=resubmit(,12)",
+		"priority=0,table=12,idle_timeout=0,actions=normal",
+	}
+
+	var got []string
+	for _, f := range c.Flows {
+		b, err := f.MarshalText()
+		if err != nil {
+			t.Fatalf("failed to marshal flow: %v", err)
+		}
+		got = append(got, string(b))
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected flows:\n- want: %v\n-  got: %v",
+			strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	if table, ok := c.Table("acl"); !ok || table != 11 {
+		t.Fatalf("unexpected table for stage acl: %d, %v", table, ok)
+	}
+	if _, ok := c.Table("nope"); ok {
+		t.Fatal("unexpected table for unknown stage")
+	}
+}
+
+func TestPipelineCompileErrors(t *testing.T) {
+	var tests = []struct {
+		desc string
+		p    *Pipeline
+		err  error
+	}{
+		{
+			desc: "empty name",
+			p:    &Pipeline{Stages: []*Stage{{}}},
+			err:  errInvalidStage,
+		},
+		{
+			desc: "duplicate name",
+			p:    &Pipeline{Stages: []*Stage{{Name: "a"}, {Name: "a"}}},
+			err:  errInvalidStage,
+		},
+		{
+			desc: "too many tables",
+			p: &Pipeline{
+				FirstTable: maxTableID,
+				Stages:     []*Stage{{Name: "a"}, {Name: "b"}},
+			},
+			err: ErrFieldWidth,
+		},
+		{
+			desc: "unknown stage",
+			p: &Pipeline{Stages: []*Stage{{
+				Name: "a",
+				Miss: []Action{WriteActions(ResubmitStage("b"))},
+			}}},
+			err: ErrUnknownStage,
+		},
+		{
+			desc: "goto earlier stage",
+			p: &Pipeline{Stages: []*Stage{
+				{Name: "a"},
+				{Name: "b", Miss: []Action{GotoStage("a")}},
+			}},
+			err: ErrInvalidGotoTable,
+		},
+		{
+			desc: "resubmit to stage in table 0",
+			p: &Pipeline{Stages: []*Stage{
+				{Name: "a"},
+				{Name: "b", Miss: []Action{ResubmitStage("a")}},
+			}},
+			err: errResubmitTableZero,
+		},
+		{
+			desc: "duplicate miss flow",
+			p: &Pipeline{Stages: []*Stage{{
+				Name:  "a",
+				Flows: []*Flow{{Actions: []Action{Normal()}}},
+			}}},
+			err: errDuplicatePipelineFlow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := tt.p.Compile()
+			if want, got := tt.err, err; !errors.Is(got, want) {
+				t.Fatalf("unexpected error:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+		})
+	}
+}
+
+func TestStageActionUnresolved(t *testing.T) {
+	f := &Flow{Actions: []Action{ResubmitStage("a")}}
+	if _, err := f.MarshalText(); !errors.Is(err, errUnresolvedStage) {
+		t.Fatalf("expected unresolved stage error, but got: %v", err)
+	}
+
+	if want, got := `ovs.GotoStage("a")`, GotoStage("a").GoString(); want != got {
+		t.Fatalf("unexpected GoString:\n- want: %q\n-  got: %q", want, got)
+	}
+}
+
+func TestCompiledPipelinePlan(t *testing.T) {
+	c, err := testPipeline().Compile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dump := []string{
+		// Unchanged, although written differently.
+		"table=10, priority=100,dl_type=0x0800 actions=goto_table:11",
+		"table=10, priority=0 actions=drop",
+		// Actions differ.
+		"table=11, priority=0 actions=normal",
+		// Not part of the pipeline.
+		"table=11, priority=200,udp actions=drop",
+		// Table not used by the pipeline.
+		"table=1, priority=0 actions=drop",
+	}
+
+	current := make([]*Flow, 0, len(dump))
+	for _, s := range dump {
+		f := new(Flow)
+		if err := f.UnmarshalText([]byte(s)); err != nil {
+			t.Fatalf("failed to unmarshal flow %q: %v", s, err)
+		}
+		current = append(current, f)
+	}
+
+	plan, err := c.Plan(current)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var add []string
+	for _, f := range plan.Add {
+		b, err := f.MarshalText()
+		if err != nil {
+			t.Fatalf("failed to marshal flow: %v", err)
+		}
+		add = append(add, string(b))
+	}
+
+	wantAdd := []string{
+		"priority=100,tcp,tp_dst=22,table=11,idle_timeout=0,actions=resubmit(,12)",
+		"priority=0,table=11,idle_timeout=0,actions=resubmit(,12)",
+		"priority=0,table=12,idle_timeout=0,actions=normal",
+	}
+	if want, got := wantAdd, add; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected added flows:\n- want: %v\n-  got: %v",
+			strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	var del []string
+	for _, f := range plan.Delete {
+		b, err := f.MarshalText()
+		if err != nil {
+			t.Fatalf("failed to marshal flow: %v", err)
+		}
+		del = append(del, string(b))
+	}
+
+	wantDel := []string{"priority=200,udp,table=11"}
+	if want, got := wantDel, del; !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected deleted flows:\n- want: %v\n-  got: %v",
+			want, got)
+	}
+}
+
+func TestCompiledPipelineGraph(t *testing.T) {
+	p := testPipeline()
+	p.Stages[2].Flows = []*Flow{{
+		Priority: 10,
+		Actions:  []Action{Resubmit(0, 50)},
+	}}
+
+	c, err := p.Compile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := strings.Join([]string{
+		`digraph pipeline {`,
+		`	rankdir=LR;`,
+		`	"classify" [shape=box,label="classify\ntable 10\n2 flows"];`,
+		`	"acl" [shape=box,label="acl\ntable 11\n2 flows"];`,
+		`	"output" [shape=box,label="output\ntable 12\n2 flows"];`,
+		`	"classify" -> "acl" [label="goto_table"];`,
+		`	"acl" -> "output" [label="resubmit"];`,
+		`	"output" -> "table 50" [label="resubmit"];`,
+		`}`,
+		``,
+	}, "\n")
+
+	if got := c.Graph(); want != got {
+		t.Fatalf("unexpected graph:\n- want:\n%s\n-  got:\n%s", want, got)
+	}
+}
+
+func TestCompiledPipelineResubmitFirstStage(t *testing.T) {
+	p := &Pipeline{
+		FirstTable: 1,
+		Stages: []*Stage{
+			{Name: "a"},
+			{
+				Name: "b",
+				Flows: []*Flow{{
+					Priority: 10,
+					Actions:  []Action{Resubmit(2, 0)},
+				}},
+				Miss: []Action{ResubmitStage("a")},
+			},
+		},
+	}
+
+	c, err := p.Compile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, f := range c.Flows {
+		if _, err := f.MarshalText(); err != nil {
+			t.Fatalf("failed to marshal flow %#v: %v", f, err)
+		}
+	}
+
+	want := strings.Join([]string{
+		`digraph pipeline {`,
+		`	rankdir=LR;`,
+		`	"a" [shape=box,label="a\ntable 1\n1 flows"];`,
+		`	"b" [shape=box,label="b\ntable 2\n2 flows"];`,
+		`	"b" -> "b" [label="resubmit"];`,
+		`	"b" -> "a" [label="resubmit"];`,
+		`}`,
+		``,
+	}, "\n")
+
+	if got := c.Graph(); want != got {
+		t.Fatalf("unexpected graph:\n- want:\n%s\n-  got:\n%s", want, got)
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PrefixExec returns an ExecContextFunc which runs each command through the
+// command specified by prefix, such as "docker", "exec", "-i", "container".
+// Arguments are passed to the prefix command verbatim, so it must execute
+// its own trailing arguments as a command, without a shell.
+//
+// If the Sudo OptionFunc is also used, "sudo" runs inside the prefix
+// command.  Include "sudo" at the beginning of prefix to run the prefix
+// command itself with elevated privileges.
+func PrefixExec(prefix ...string) ExecContextFunc {
+	return prefixExec(prefix, false, shellExecContext)
+}
+
+// PrefixPipe returns a PipeContextFunc which runs each command through the
+// command specified by prefix, in the same way as PrefixExec.  The prefix
+// command must forward its stdin to the command it runs.
+func PrefixPipe(prefix ...string) PipeContextFunc {
+	return prefixPipe(prefix, false, shellPipeContext)
+}
+
+// PrefixStream returns a StreamContextFunc which runs each command through
+// the command specified by prefix, in the same way as PrefixExec.  The prefix
+// command must forward the stdout of the command it runs.
+func PrefixStream(prefix ...string) StreamContextFunc {
+	return prefixStream(prefix, false, shellStreamContext)
+}
+
+// CommandPrefix returns an OptionFunc which runs all commands through the
+// command specified by prefix, in the same way as PrefixExec, PrefixPipe,
+// and PrefixStream.
+//
+// The prefix is applied to the functions already configured for the Client,
+// so commands passed to an ExecContextFunc, PipeContextFunc, or
+// StreamContextFunc set by an earlier OptionFunc are also prefixed.  Any
+// of those set by a later OptionFunc replace the prefixed functions.
+func CommandPrefix(prefix ...string) OptionFunc {
+	return commandPrefix(prefix, false)
+}
+
+// RemoteShellExec returns an ExecContextFunc which runs each command through
+// the command specified by prefix, such as "ssh", "root@hypervisor".  Unlike
+// PrefixExec, the command and its arguments are quoted and joined into a
+// single argument for interpretation by a shell, as is required by ssh.
+func RemoteShellExec(prefix ...string) ExecContextFunc {
+	return prefixExec(prefix, true, shellExecContext)
+}
+
+// RemoteShellPipe returns a PipeContextFunc which runs each command through
+// the command specified by prefix, in the same way as RemoteShellExec.
+func RemoteShellPipe(prefix ...string) PipeContextFunc {
+	return prefixPipe(prefix, true, shellPipeContext)
+}
+
+// RemoteShellStream returns a StreamContextFunc which runs each command
+// through the command specified by prefix, in the same way as
+// RemoteShellExec.
+func RemoteShellStream(prefix ...string) StreamContextFunc {
+	return prefixStream(prefix, true, shellStreamContext)
+}
+
+// RemoteShell returns an OptionFunc which runs all commands through the
+// command specified by prefix, in the same way as RemoteShellExec,
+// RemoteShellPipe, and RemoteShellStream.  The prefix is applied to the
+// functions already configured for the Client, as with CommandPrefix.
+func RemoteShell(prefix ...string) OptionFunc {
+	return commandPrefix(prefix, true)
+}
+
+// netNSPrefix returns the command prefix used to run a command in the named
+// network namespace.
+func netNSPrefix(name string) []string {
+	return []string{"ip", "netns", "exec", name}
+}
+
+// NetNSExec returns an ExecContextFunc which runs each command in the named
+// network namespace using 'ip netns exec'.
+func NetNSExec(name string) ExecContextFunc {
+	return PrefixExec(netNSPrefix(name)...)
+}
+
+// NetNSPipe returns a PipeContextFunc which runs each command in the named
+// network namespace using 'ip netns exec'.
+func NetNSPipe(name string) PipeContextFunc {
+	return PrefixPipe(netNSPrefix(name)...)
+}
+
+// NetNSStream returns a StreamContextFunc which runs each command in the
+// named network namespace using 'ip netns exec'.
+func NetNSStream(name string) StreamContextFunc {
+	return PrefixStream(netNSPrefix(name)...)
+}
+
+// NetNS returns an OptionFunc which runs all commands in the named network
+// namespace using 'ip netns exec', in the same way as CommandPrefix.
+func NetNS(name string) OptionFunc {
+	return CommandPrefix(netNSPrefix(name)...)
+}
+
+// nsenterPrefix returns the command prefix used to run a command in the
+// namespaces of the process with the specified PID.
+func nsenterPrefix(pid int) []string {
+	return []string{
+		"nsenter",
+		"--target", strconv.Itoa(pid),
+		"--mount", "--uts", "--ipc", "--net", "--pid",
+		"--",
+	}
+}
+
+// NSEnterExec returns an ExecContextFunc which runs each command in the
+// mount, UTS, IPC, network, and PID namespaces of the process with the
+// specified PID using 'nsenter'.
+func NSEnterExec(pid int) ExecContextFunc {
+	return PrefixExec(nsenterPrefix(pid)...)
+}
+
+// NSEnterPipe returns a PipeContextFunc which runs each command in the
+// namespaces of the process with the specified PID, in the same way as
+// NSEnterExec.
+func NSEnterPipe(pid int) PipeContextFunc {
+	return PrefixPipe(nsenterPrefix(pid)...)
+}
+
+// NSEnterStream returns a StreamContextFunc which runs each command in the
+// namespaces of the process with the specified PID, in the same way as
+// NSEnterExec.
+func NSEnterStream(pid int) StreamContextFunc {
+	return PrefixStream(nsenterPrefix(pid)...)
+}
+
+// NSEnter returns an OptionFunc which runs all commands in the namespaces of
+// the process with the specified PID using 'nsenter', in the same way as
+// CommandPrefix.
+func NSEnter(pid int) OptionFunc {
+	return CommandPrefix(nsenterPrefix(pid)...)
+}
+
+// commandPrefix returns an OptionFunc which prefixes the commands passed to
+// the ExecContextFunc, PipeContextFunc, and StreamContextFunc of a Client.
+func commandPrefix(prefix []string, quote bool) OptionFunc {
+	return func(c *Client) {
+		c.execFunc = prefixExec(prefix, quote, c.execFunc)
+		c.pipeFunc = prefixPipe(prefix, quote, c.pipeFunc)
+		c.streamFunc = prefixStream(prefix, quote, c.streamFunc)
+	}
+}
+
+// prefixExec returns an ExecContextFunc which runs each command through fn,
+// prefixed by prefix.
+func prefixExec(prefix []string, quote bool, fn ExecContextFunc) ExecContextFunc {
+	return func(ctx context.Context, cmd string, args ...string) ([]byte, error) {
+		name, args := prefixCommand(prefix, quote, cmd, args)
+		return fn(ctx, name, args...)
+	}
+}
+
+// prefixPipe returns a PipeContextFunc which runs each command through fn,
+// prefixed by prefix.
+func prefixPipe(prefix []string, quote bool, fn PipeContextFunc) PipeContextFunc {
+	return func(ctx context.Context, stdin io.Reader, cmd string, args ...string) ([]byte, error) {
+		name, args := prefixCommand(prefix, quote, cmd, args)
+		return fn(ctx, stdin, name, args...)
+	}
+}
+
+// prefixStream returns a StreamContextFunc which runs each command through
+// fn, prefixed by prefix.
+func prefixStream(prefix []string, quote bool, fn StreamContextFunc) StreamContextFunc {
+	return func(ctx context.Context, cmd string, args ...string) (io.ReadCloser, error) {
+		name, args := prefixCommand(prefix, quote, cmd, args)
+		return fn(ctx, name, args...)
+	}
+}
+
+// prefixCommand prepends prefix to cmd and args, returning the name and
+// arguments of the command to execute.  If quote is true, cmd and args are
+// quoted and joined into a single argument for interpretation by a shell.
+func prefixCommand(prefix []string, quote bool, cmd string, args []string) (string, []string) {
+	if len(prefix) == 0 {
+		return cmd, args
+	}
+
+	out := make([]string, 0, len(prefix)+len(args))
+	out = append(out, prefix[1:]...)
+
+	if !quote {
+		out = append(out, cmd)
+		out = append(out, args...)
+		return prefix[0], out
+	}
+
+	words := make([]string, 0, len(args)+1)
+	words = append(words, shellQuote(cmd))
+	for _, a := range args {
+		words = append(words, shellQuote(a))
+	}
+
+	return prefix[0], append(out, strings.Join(words, " "))
+}
+
+// shellQuote quotes s for use as a single word in a POSIX shell command.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+
+	safe := true
+	for _, r := range s {
+		if !shellSafe(r) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+
+	// Single quotes preserve every character except a single quote, which
+	// must end the quoted string, be escaped, and begin a new one.
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// shellSafe reports whether r can appear unquoted in a POSIX shell word.
+func shellSafe(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+
+	return strings.ContainsRune("@%+=:,./-_", r)
+}
@@ -0,0 +1,252 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_prefixCommand(t *testing.T) {
+	var tests = []struct {
+		desc   string
+		prefix []string
+		quote  bool
+		cmd    string
+		args   []string
+		name   string
+		out    []string
+	}{
+		{
+			desc: "no prefix",
+			cmd:  "ovs-vsctl",
+			args: []string{"list-br"},
+			name: "ovs-vsctl",
+			out:  []string{"list-br"},
+		},
+		{
+			desc:   "netns",
+			prefix: netNSPrefix("ns0"),
+			cmd:    "ovs-ofctl",
+			args:   []string{"add-flow", "br0", "priority=10,actions=resubmit(,1)"},
+			name:   "ip",
+			out: []string{
+				"netns", "exec", "ns0",
+				"ovs-ofctl", "add-flow", "br0", "priority=10,actions=resubmit(,1)",
+			},
+		},
+		{
+			desc:   "nsenter",
+			prefix: nsenterPrefix(1234),
+			cmd:    "ovs-vsctl",
+			args:   []string{"list-br"},
+			name:   "nsenter",
+			out: []string{
+				"--target", "1234", "--mount", "--uts", "--ipc", "--net", "--pid", "--",
+				"ovs-vsctl", "list-br",
+			},
+		},
+		{
+			desc:   "remote shell",
+			prefix: []string{"ssh", "root@hv1"},
+			quote:  true,
+			cmd:    "ovs-ofctl",
+			args:   []string{"add-flow", "br0", "actions=load:0x1->NXM_NX_REG0[]", "it's", ""},
+			name:   "ssh",
+			out: []string{
+				"root@hv1",
+				`ovs-ofctl add-flow br0 'actions=load:0x1->NXM_NX_REG0[]' 'it'\''s' ''`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			name, out := prefixCommand(tt.prefix, tt.quote, tt.cmd, tt.args)
+
+			if want, got := tt.name, name; want != got {
+				t.Fatalf("unexpected command:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+
+			if want, got := tt.out, out; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected arguments:\n- want: %q\n-  got: %q",
+					want, got)
+			}
+		})
+	}
+}
+
+func TestRemoteShellExec(t *testing.T) {
+	// "sh -c" interprets its argument in the same way as a remote shell
+	// invoked by ssh.
+	fn := RemoteShellExec("sh", "-c")
+
+	args := []string{`%s|%s|%s\n`, "a b", "it's", "resubmit(,1);$HOME"}
+	out, err := fn(context.Background(), "printf", args...)
+	if err != nil {
+		t.Fatalf("failed to exec: %v", err)
+	}
+
+	if want, got := "a b|it's|resubmit(,1);$HOME\n", string(out); want != got {
+		t.Fatalf("unexpected output:\n- want: %q\n-  got: %q",
+			want, got)
+	}
+}
+
+func TestPrefixPipe(t *testing.T) {
+	b := []byte("add priority=10,actions=drop\ndelete cookie=0x1/-1\n")
+
+	// stdin must be forwarded through the prefix command.
+	for _, fn := range []PipeContextFunc{
+		PrefixPipe("env"),
+		RemoteShellPipe("sh", "-c"),
+	} {
+		out, err := fn(context.Background(), bytes.NewReader(b), "cat", "-")
+		if err != nil {
+			t.Fatalf("failed to pipe to cat: %v", err)
+		}
+
+		if want, got := b, out; !bytes.Equal(want, got) {
+			t.Fatalf("unexpected bytes:\n- want: %q\n-  got: %q",
+				want, got)
+		}
+	}
+}
+
+func TestClientCommandPrefix(t *testing.T) {
+	var tests = []struct {
+		desc   string
+		o      OptionFunc
+		exec   []string
+		pipe   []string
+		stream []string
+	}{
+		{
+			desc:   "command prefix",
+			o:      CommandPrefix("docker", "exec", "c0"),
+			exec:   []string{"docker", "exec", "c0", "ovs-vsctl", "list-br"},
+			pipe:   []string{"docker", "exec", "c0", "ovs-ofctl", "--bundle", "add-flow", "br0", "-"},
+			stream: []string{"docker", "exec", "c0", "ovs-ofctl", "dump-flows", "br0"},
+		},
+		{
+			desc:   "netns",
+			o:      NetNS("ns0"),
+			exec:   []string{"ip", "netns", "exec", "ns0", "ovs-vsctl", "list-br"},
+			pipe:   []string{"ip", "netns", "exec", "ns0", "ovs-ofctl", "--bundle", "add-flow", "br0", "-"},
+			stream: []string{"ip", "netns", "exec", "ns0", "ovs-ofctl", "dump-flows", "br0"},
+		},
+		{
+			desc: "nsenter",
+			o:    NSEnter(1234),
+			exec: []string{
+				"nsenter", "--target", "1234", "--mount", "--uts", "--ipc", "--net", "--pid", "--",
+				"ovs-vsctl", "list-br",
+			},
+			pipe: []string{
+				"nsenter", "--target", "1234", "--mount", "--uts", "--ipc", "--net", "--pid", "--",
+				"ovs-ofctl", "--bundle", "add-flow", "br0", "-",
+			},
+			stream: []string{
+				"nsenter", "--target", "1234", "--mount", "--uts", "--ipc", "--net", "--pid", "--",
+				"ovs-ofctl", "dump-flows", "br0",
+			},
+		},
+		{
+			desc:   "remote shell",
+			o:      RemoteShell("ssh", "root@hv1"),
+			exec:   []string{"ssh", "root@hv1", "ovs-vsctl list-br"},
+			pipe:   []string{"ssh", "root@hv1", "ovs-ofctl --bundle add-flow br0 -"},
+			stream: []string{"ssh", "root@hv1", "ovs-ofctl dump-flows br0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var execArgv, pipeArgv, streamArgv []string
+
+			exec := ExecContext(func(_ context.Context, cmd string, args ...string) ([]byte, error) {
+				execArgv = append([]string{cmd}, args...)
+				return nil, nil
+			})
+			pipe := PipeContext(func(_ context.Context, stdin io.Reader, cmd string, args ...string) ([]byte, error) {
+				pipeArgv = append([]string{cmd}, args...)
+				_, err := io.Copy(ioutil.Discard, stdin)
+				return nil, err
+			})
+			stream := Stream(func(_ context.Context, cmd string, args ...string) (io.ReadCloser, error) {
+				streamArgv = append([]string{cmd}, args...)
+				return &testStream{
+					r: strings.NewReader("NXST_FLOW reply (xid=0x4):\n"),
+				}, nil
+			})
+
+			// The prefix applies to the functions which are already
+			// configured for the Client.
+			c := New(exec, pipe, stream, tt.o)
+
+			if _, err := c.VSwitch.ListBridges(); err != nil {
+				t.Fatalf("failed to list bridges: %v", err)
+			}
+			if want, got := tt.exec, execArgv; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected exec command line:\n- want: %q\n-  got: %q",
+					want, got)
+			}
+
+			err := c.OpenFlow.AddFlowBundle("br0", func(tx *FlowTransaction) error {
+				tx.Add(&Flow{Actions: []Action{Drop()}})
+				return tx.Commit()
+			})
+			if err != nil {
+				t.Fatalf("failed to add flow bundle: %v", err)
+			}
+			if want, got := tt.pipe, pipeArgv; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected pipe command line:\n- want: %q\n-  got: %q",
+					want, got)
+			}
+
+			if _, err := c.OpenFlow.DumpFlows("br0"); err != nil {
+				t.Fatalf("failed to dump flows: %v", err)
+			}
+			if want, got := tt.stream, streamArgv; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected dump-flows command line:\n- want: %q\n-  got: %q",
+					want, got)
+			}
+
+			streamArgv = nil
+			fs, err := c.OpenFlow.ScanFlows("br0")
+			if err != nil {
+				t.Fatalf("failed to scan flows: %v", err)
+			}
+			for fs.Scan() {
+			}
+			if err := fs.Err(); err != nil {
+				t.Fatalf("failed to scan flows: %v", err)
+			}
+			if err := fs.Close(); err != nil {
+				t.Fatalf("failed to close scanner: %v", err)
+			}
+			if want, got := tt.stream, streamArgv; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected scan command line:\n- want: %q\n-  got: %q",
+					want, got)
+			}
+		})
+	}
+}
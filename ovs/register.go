@@ -0,0 +1,563 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrRegisterOverlap is returned when a RegisterAllocator claim uses
+	// bits which were already claimed, including bits of a register which
+	// overlaps the claimed register, such as reg0 and xreg0.
+	ErrRegisterOverlap = errors.New("register field overlaps an existing claim")
+
+	// errInvalidRegisterField is returned when a register field is not a
+	// register and bit range, such as "reg5[0..23]".
+	errInvalidRegisterField = errors.New("invalid register field")
+
+	// errUnknownRegisterField is returned when a RegisterAllocator is asked
+	// for a field name which was not claimed.
+	errUnknownRegisterField = errors.New("unknown register field")
+)
+
+// Register families, which are prefixes of register names.
+const (
+	regFamily   = "reg"
+	xregFamily  = "xreg"
+	xxregFamily = "xxreg"
+)
+
+// registerWidths maps register families to the width of their registers in
+// bits.  Each family covers the same 16 32-bit registers.
+var registerWidths = map[string]int{
+	regFamily:   32,
+	xregFamily:  64,
+	xxregFamily: 128,
+}
+
+// parseRegisterName parses a register name, such as "xreg3", into its
+// family and number.  It returns false if name is not a register name,
+// but does not check that the register exists.
+func parseRegisterName(name string) (family string, n int, ok bool) {
+	for _, f := range []string{xxregFamily, xregFamily, regFamily} {
+		if !strings.HasPrefix(name, f) {
+			continue
+		}
+
+		n, err := strconv.Atoi(name[len(f):])
+		if err != nil || n < 0 {
+			return "", 0, false
+		}
+
+		return f, n, true
+	}
+
+	return "", 0, false
+}
+
+// numFamilyRegisters returns the number of registers in family.
+func numFamilyRegisters(family string) int {
+	return numRegisters * 32 / registerWidths[family]
+}
+
+// A Uint128 is a 128 bit unsigned integer, such as the value of an xxreg
+// register.
+type Uint128 struct {
+	Hi, Lo uint64
+}
+
+// String returns the hexadecimal form of u, as used in flows.
+func (u Uint128) String() string {
+	if u.Hi == 0 {
+		return fmt.Sprintf("%#x", u.Lo)
+	}
+
+	return fmt.Sprintf("%#x%016x", u.Hi, u.Lo)
+}
+
+// GoString returns the Go syntax of u.
+func (u Uint128) GoString() string {
+	return fmt.Sprintf("ovs.Uint128{Hi: %#x, Lo: %#x}", u.Hi, u.Lo)
+}
+
+func (u Uint128) and(v Uint128) Uint128 { return Uint128{Hi: u.Hi & v.Hi, Lo: u.Lo & v.Lo} }
+func (u Uint128) or(v Uint128) Uint128  { return Uint128{Hi: u.Hi | v.Hi, Lo: u.Lo | v.Lo} }
+func (u Uint128) isZero() bool          { return u.Hi == 0 && u.Lo == 0 }
+
+// lsh returns u shifted left by n bits.
+func (u Uint128) lsh(n uint) Uint128 {
+	switch {
+	case n == 0:
+		return u
+	case n >= 64:
+		return Uint128{Hi: u.Lo << (n - 64)}
+	}
+
+	return Uint128{Hi: u.Hi<<n | u.Lo>>(64-n), Lo: u.Lo << n}
+}
+
+// rsh returns u shifted right by n bits.
+func (u Uint128) rsh(n uint) Uint128 {
+	switch {
+	case n == 0:
+		return u
+	case n >= 64:
+		return Uint128{Lo: u.Hi >> (n - 64)}
+	}
+
+	return Uint128{Hi: u.Hi >> n, Lo: u.Lo>>n | u.Hi<<(64-n)}
+}
+
+// word returns the 32 bit word i of u, where word 0 is the least
+// significant.
+func (u Uint128) word(i int) uint32 {
+	return uint32(u.rsh(uint(i * 32)).Lo)
+}
+
+// uint128Mask returns a Uint128 with bits start through end set.
+func uint128Mask(start, end int) Uint128 {
+	ones := Uint128{Hi: ^uint64(0), Lo: ^uint64(0)}
+	return ones.rsh(uint(127 - end + start)).lsh(uint(start))
+}
+
+// parseUint128 parses a decimal or hexadecimal 128 bit integer.
+func parseUint128(s string) (Uint128, error) {
+	if !strings.HasPrefix(s, hexPrefix) {
+		v, err := strconv.ParseUint(s, 10, 64)
+		return Uint128{Lo: v}, err
+	}
+
+	digits := s[len(hexPrefix):]
+	if len(digits) == 0 || len(digits) > 32 {
+		return Uint128{}, fmt.Errorf("invalid 128 bit integer: %q", s)
+	}
+
+	var hi string
+	if len(digits) > 16 {
+		hi, digits = digits[:len(digits)-16], digits[len(digits)-16:]
+	}
+
+	var (
+		u   Uint128
+		err error
+	)
+	if hi != "" {
+		if u.Hi, err = strconv.ParseUint(hi, 16, 64); err != nil {
+			return Uint128{}, err
+		}
+	}
+	if u.Lo, err = strconv.ParseUint(digits, 16, 64); err != nil {
+		return Uint128{}, err
+	}
+
+	return u, nil
+}
+
+// XRegMatch matches packets whose 64 bit extended register xreg n matches
+// val in the bits set in mask.  xreg n consists of registers 2n, in its
+// upper 32 bits, and 2n+1.  If mask is zero, the register is wildcarded.
+func XRegMatch(n int, val, mask uint64) Match {
+	return &xregMatch{
+		n:    n,
+		val:  val,
+		mask: mask,
+	}
+}
+
+var _ Match = &xregMatch{}
+
+// An xregMatch is a Match returned by XRegMatch.
+type xregMatch struct {
+	n    int
+	val  uint64
+	mask uint64
+}
+
+// MarshalText implements Match.
+func (m *xregMatch) MarshalText() ([]byte, error) {
+	switch m.mask {
+	case 0:
+		return []byte{}, nil
+	case ^uint64(0):
+		return bprintf("%s%d=%#x", xregFamily, m.n, m.val), nil
+	}
+
+	return bprintf("%s%d=%#x/%#x", xregFamily, m.n, m.val, m.mask), nil
+}
+
+// GoString implements Match.
+func (m *xregMatch) GoString() string {
+	return fmt.Sprintf("ovs.XRegMatch(%d, %#x, %#x)", m.n, m.val, m.mask)
+}
+
+// XXRegMatch matches packets whose 128 bit extended register xxreg n
+// matches val in the bits set in mask.  xxreg n consists of registers 4n,
+// in its most significant 32 bits, through 4n+3.  If mask is zero, the
+// register is wildcarded.
+func XXRegMatch(n int, val, mask Uint128) Match {
+	return &xxregMatch{
+		n:    n,
+		val:  val,
+		mask: mask,
+	}
+}
+
+var _ Match = &xxregMatch{}
+
+// An xxregMatch is a Match returned by XXRegMatch.
+type xxregMatch struct {
+	n    int
+	val  Uint128
+	mask Uint128
+}
+
+// MarshalText implements Match.
+func (m *xxregMatch) MarshalText() ([]byte, error) {
+	switch {
+	case m.mask.isZero():
+		return []byte{}, nil
+	case m.mask == uint128Mask(0, 127):
+		return bprintf("%s%d=%s", xxregFamily, m.n, m.val), nil
+	}
+
+	return bprintf("%s%d=%s/%s", xxregFamily, m.n, m.val, m.mask), nil
+}
+
+// GoString implements Match.
+func (m *xxregMatch) GoString() string {
+	return fmt.Sprintf("ovs.XXRegMatch(%d, %#v, %#v)", m.n, m.val, m.mask)
+}
+
+// parseRegisterValue parses the value and optional mask of a match on a
+// register of family.  If no mask is present, the mask selects all bits of
+// the register.
+func parseRegisterValue(family, value string) (v, mask Uint128, err error) {
+	s, m, parts := splitMask(value)
+	if parts > 2 {
+		return Uint128{}, Uint128{}, fmt.Errorf("invalid %s match: %q", family, value)
+	}
+
+	if v, err = parseUint128(s); err != nil {
+		return Uint128{}, Uint128{}, err
+	}
+
+	mask = uint128Mask(0, registerWidths[family]-1)
+	if parts == 2 {
+		if mask, err = parseUint128(m); err != nil {
+			return Uint128{}, Uint128{}, err
+		}
+	}
+
+	return v, mask, nil
+}
+
+// parseWideRegisterMatch parses an xreg or xxreg Match from the input key
+// and value.
+func parseWideRegisterMatch(family string, n int, value string) (Match, error) {
+	v, mask, err := parseRegisterValue(family, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if family == xxregFamily {
+		return XXRegMatch(n, v, mask), nil
+	}
+
+	if v.Hi != 0 || mask.Hi != 0 {
+		return nil, fmt.Errorf("invalid %s%d match: %q", family, n, value)
+	}
+
+	return XRegMatch(n, v.Lo, mask.Lo), nil
+}
+
+// A registerWord is the value and mask of one 32 bit register, which is
+// part of a value and mask of a wider register.
+type registerWord struct {
+	reg   int
+	value uint32
+	mask  uint32
+}
+
+// registerWords splits a value and mask of register n of family into the
+// 32 bit registers it consists of.  Registers with an empty mask are
+// omitted.
+func registerWords(family string, n int, value, mask Uint128) []registerWord {
+	words := registerWidths[family] / 32
+
+	var out []registerWord
+	for i := 0; i < words; i++ {
+		m := mask.word(i)
+		if m == 0 {
+			continue
+		}
+
+		// The lowest numbered register holds the most significant bits.
+		out = append(out, registerWord{
+			reg:   n*words + words - 1 - i,
+			value: value.word(i) & m,
+			mask:  m,
+		})
+	}
+
+	return out
+}
+
+// A RegisterField is a named range of bits in a register, claimed from a
+// RegisterAllocator.
+type RegisterField struct {
+	// Name is the name of the field, such as "tenant id".
+	Name string
+
+	// Register is the register containing the field, such as "reg5",
+	// "xreg2", or "xxreg1".
+	Register string
+
+	// Start and End are the first and last bits of the field in Register,
+	// inclusive.
+	Start, End int
+}
+
+// String returns the field in the form used by load and move actions, such
+// as "reg5[0..23]".
+func (f RegisterField) String() string {
+	if f.Start == f.End {
+		return fmt.Sprintf("%s[%d]", f.Register, f.Start)
+	}
+
+	return fmt.Sprintf("%s[%d..%d]", f.Register, f.Start, f.End)
+}
+
+// Width returns the width of the field in bits.
+func (f RegisterField) Width() int {
+	return f.End - f.Start + 1
+}
+
+// fits returns an error if value does not fit in f.
+func (f RegisterField) fits(value Uint128) error {
+	if f.Width() < 128 && !value.rsh(uint(f.Width())).isZero() {
+		return fmt.Errorf("value %s does not fit in %d bit register field %q: %w",
+			value, f.Width(), f.Name, ErrFieldWidth)
+	}
+
+	return nil
+}
+
+// match returns a Match which matches value in f.
+func (f RegisterField) match(value Uint128) (Match, error) {
+	if err := f.fits(value); err != nil {
+		return nil, err
+	}
+
+	family, n, _ := parseRegisterName(f.Register)
+	v := value.lsh(uint(f.Start))
+	mask := uint128Mask(f.Start, f.End)
+
+	switch family {
+	case regFamily:
+		return RegMatch(n, uint32(v.Lo), uint32(mask.Lo)), nil
+	case xregFamily:
+		return XRegMatch(n, v.Lo, mask.Lo), nil
+	}
+
+	return XXRegMatch(n, v, mask), nil
+}
+
+// A RegisterAllocator assigns named fields to bit ranges of the registers
+// reg0 through reg15, and their 64 and 128 bit xreg and xxreg views, so
+// that separate parts of a pipeline may share registers without
+// conflicting.  The zero value is an empty RegisterAllocator.
+type RegisterAllocator struct {
+	fields []RegisterField
+}
+
+// Claim claims the register bits in field, such as "reg5[0..23]" or
+// "xreg1[]", under name.  It returns an error which wraps
+// ErrRegisterOverlap if any of those bits were previously claimed, or if
+// name was previously claimed.
+func (a *RegisterAllocator) Claim(name, field string) (RegisterField, error) {
+	f, err := parseRegisterField(name, field)
+	if err != nil {
+		return RegisterField{}, err
+	}
+
+	for _, c := range a.fields {
+		if c.Name == name {
+			return RegisterField{}, fmt.Errorf("register field %q is already claimed by %s: %w",
+				name, c, ErrRegisterOverlap)
+		}
+
+		if registerFieldsOverlap(c, f) {
+			return RegisterField{}, fmt.Errorf("register field %q (%s) overlaps %q (%s): %w",
+				name, f, c.Name, c, ErrRegisterOverlap)
+		}
+	}
+
+	a.fields = append(a.fields, f)
+	return f, nil
+}
+
+// Field returns the claimed field with the specified name.
+func (a *RegisterAllocator) Field(name string) (RegisterField, bool) {
+	for _, f := range a.fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+
+	return RegisterField{}, false
+}
+
+// Fields returns all claimed fields, in the order they were claimed.
+func (a *RegisterAllocator) Fields() []RegisterField {
+	return append([]RegisterField(nil), a.fields...)
+}
+
+// Match returns a Match which matches packets whose field with the
+// specified name contains value.  Use MatchUint128 for fields wider than 64
+// bits.
+func (a *RegisterAllocator) Match(name string, value uint64) (Match, error) {
+	return a.MatchUint128(name, Uint128{Lo: value})
+}
+
+// MatchUint128 is the same as Match, but accepts a 128 bit value for fields
+// of an xxreg register which are wider than 64 bits.
+func (a *RegisterAllocator) MatchUint128(name string, value Uint128) (Match, error) {
+	f, err := a.field(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.match(value)
+}
+
+// Load returns an Action which loads value into the field with the
+// specified name.  Use LoadUint128 for fields wider than 64 bits.
+func (a *RegisterAllocator) Load(name string, value uint64) (Action, error) {
+	return a.LoadUint128(name, Uint128{Lo: value})
+}
+
+// LoadUint128 is the same as Load, but accepts a 128 bit value for fields
+// of an xxreg register which are wider than 64 bits.
+func (a *RegisterAllocator) LoadUint128(name string, value Uint128) (Action, error) {
+	f, err := a.field(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.fits(value); err != nil {
+		return nil, err
+	}
+
+	return Load(value.String(), f.String()), nil
+}
+
+// Move returns an Action which copies the field named src to the field
+// named dst.  Both fields must have the same width.
+func (a *RegisterAllocator) Move(src, dst string) (Action, error) {
+	sf, err := a.field(src)
+	if err != nil {
+		return nil, err
+	}
+	df, err := a.field(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	if sf.Width() != df.Width() {
+		return nil, fmt.Errorf("cannot move %d bit register field %q to %d bit register field %q: %w",
+			sf.Width(), src, df.Width(), dst, ErrFieldWidth)
+	}
+
+	return Move(sf.String(), df.String()), nil
+}
+
+// field returns the claimed field with the specified name, or an error if
+// it was not claimed.
+func (a *RegisterAllocator) field(name string) (RegisterField, error) {
+	f, ok := a.Field(name)
+	if !ok {
+		return RegisterField{}, fmt.Errorf("%w: %q", errUnknownRegisterField, name)
+	}
+
+	return f, nil
+}
+
+// parseRegisterField parses a register and bit range, such as
+// "reg5[0..23]", "xreg1[7]", or "xxreg0[]", into a RegisterField.
+func parseRegisterField(name, s string) (RegisterField, error) {
+	errInvalid := fmt.Errorf("%w: %q", errInvalidRegisterField, s)
+
+	reg, bits := s, "[]"
+	if i := strings.IndexByte(s, '['); i != -1 {
+		reg, bits = s[:i], s[i:]
+	}
+
+	family, n, ok := parseRegisterName(reg)
+	if !ok || n >= numFamilyRegisters(family) {
+		return RegisterField{}, errInvalid
+	}
+
+	width := registerWidths[family]
+	start, end := 0, width-1
+	if bits != "[]" {
+		ss := bitRangeRe.FindStringSubmatch(bits)
+		if ss == nil {
+			return RegisterField{}, errInvalid
+		}
+
+		start, _ = strconv.Atoi(ss[1])
+		end = start
+		if ss[2] != "" {
+			end, _ = strconv.Atoi(ss[2])
+		}
+		if end < start || end >= width {
+			return RegisterField{}, errInvalid
+		}
+	}
+
+	return RegisterField{
+		Name:     name,
+		Register: reg,
+		Start:    start,
+		End:      end,
+	}, nil
+}
+
+// registerFieldsOverlap reports whether a and b share any bits of the
+// underlying 32 bit registers.
+func registerFieldsOverlap(a, b RegisterField) bool {
+	bits := make(map[int]uint32)
+	for _, w := range registerFieldWords(a) {
+		bits[w.reg] = w.mask
+	}
+
+	for _, w := range registerFieldWords(b) {
+		if bits[w.reg]&w.mask != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// registerFieldWords returns the 32 bit registers and bits used by f.
+func registerFieldWords(f RegisterField) []registerWord {
+	family, n, _ := parseRegisterName(f.Register)
+	return registerWords(family, n, Uint128{}, uint128Mask(f.Start, f.End))
+}
@@ -0,0 +1,302 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWideRegisterMatch(t *testing.T) {
+	var tests = []struct {
+		desc string
+		m    Match
+		out  string
+		gs   string
+	}{
+		{
+			desc: "xreg wildcarded",
+			m:    XRegMatch(0, 0x1, 0),
+			gs:   "ovs.XRegMatch(0, 0x1, 0x0)",
+		},
+		{
+			desc: "xreg exact",
+			m:    XRegMatch(1, 0xdeadbeef00000001, 0xffffffffffffffff),
+			out:  "xreg1=0xdeadbeef00000001",
+			gs:   "ovs.XRegMatch(1, 0xdeadbeef00000001, 0xffffffffffffffff)",
+		},
+		{
+			desc: "xreg masked",
+			m:    XRegMatch(7, 0x100000000, 0xff00000000),
+			out:  "xreg7=0x100000000/0xff00000000",
+			gs:   "ovs.XRegMatch(7, 0x100000000, 0xff00000000)",
+		},
+		{
+			desc: "xxreg exact",
+			m:    XXRegMatch(0, Uint128{Hi: 0x20010db8, Lo: 0x1}, Uint128{Hi: ^uint64(0), Lo: ^uint64(0)}),
+			out:  "xxreg0=0x20010db80000000000000001",
+			gs:   "ovs.XXRegMatch(0, ovs.Uint128{Hi: 0x20010db8, Lo: 0x1}, ovs.Uint128{Hi: 0xffffffffffffffff, Lo: 0xffffffffffffffff})",
+		},
+		{
+			desc: "xxreg masked",
+			m:    XXRegMatch(3, Uint128{Lo: 0x1}, Uint128{Lo: 0xff}),
+			out:  "xxreg3=0x1/0xff",
+			gs:   "ovs.XXRegMatch(3, ovs.Uint128{Hi: 0x0, Lo: 0x1}, ovs.Uint128{Hi: 0x0, Lo: 0xff})",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			out, err := tt.m.MarshalText()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if want, got := tt.out, string(out); want != got {
+				t.Fatalf("unexpected Match output:\n- want: %q\n-  got: %q", want, got)
+			}
+			if want, got := tt.gs, tt.m.GoString(); want != got {
+				t.Fatalf("unexpected Go syntax:\n- want: %q\n-  got: %q", want, got)
+			}
+		})
+	}
+}
+
+func TestParseWideRegisterMatch(t *testing.T) {
+	var tests = []struct {
+		key, value string
+		m          Match
+		invalid    bool
+	}{
+		{
+			key:   "xreg0",
+			value: "0x1",
+			m:     XRegMatch(0, 0x1, 0xffffffffffffffff),
+		},
+		{
+			key:   "xreg2",
+			value: "0x10/0xf0",
+			m:     XRegMatch(2, 0x10, 0xf0),
+		},
+		{
+			key:     "xreg0",
+			value:   "0x10000000000000000",
+			invalid: true,
+		},
+		{
+			key:   "xxreg1",
+			value: "0x20010db80000000000000001/0xffffffff000000000000000000000000",
+			m:     XXRegMatch(1, Uint128{Hi: 0x20010db8, Lo: 0x1}, Uint128{Hi: 0xffffffff00000000}),
+		},
+		{
+			key:     "xxreg1",
+			value:   "0x1/0x1/0x1",
+			invalid: true,
+		},
+		{
+			key:     "xxreg1",
+			value:   "0x100000000000000000000000000000000",
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			m, err := parseMatch(tt.key, tt.value)
+			if tt.invalid {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if want, got := tt.m, m; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected Match:\n- want: %#v\n-  got: %#v", want, got)
+			}
+		})
+	}
+}
+
+func TestRegisterAllocatorClaim(t *testing.T) {
+	var a RegisterAllocator
+	claims := []struct {
+		name, field string
+		err         error
+	}{
+		{name: "tenant id", field: "reg5[0..23]"},
+		{name: "flags", field: "reg5[24..31]"},
+		{name: "ct label", field: "xxreg2[]"},
+		{name: "next hop", field: "xreg0[32..63]"},
+		{name: "port", field: "reg1[0..15]"},
+		{name: "tenant id", field: "reg6[0..23]", err: ErrRegisterOverlap},
+		{name: "vrf", field: "reg5[20..27]", err: ErrRegisterOverlap},
+		{name: "vrf", field: "reg0[0]", err: ErrRegisterOverlap},
+		{name: "vrf", field: "xreg0[15]", err: ErrRegisterOverlap},
+		{name: "vrf", field: "reg11[31]", err: ErrRegisterOverlap},
+		{name: "vrf", field: "reg16[0..3]", err: errInvalidRegisterField},
+		{name: "vrf", field: "xreg8[]", err: errInvalidRegisterField},
+		{name: "vrf", field: "xreg2[64]", err: errInvalidRegisterField},
+		{name: "vrf", field: "reg2[7..0]", err: errInvalidRegisterField},
+		{name: "vrf", field: "tun_id[0..31]", err: errInvalidRegisterField},
+		{name: "vrf", field: "xreg0[16..31]"},
+	}
+
+	for _, c := range claims {
+		_, err := a.Claim(c.name, c.field)
+		if !errors.Is(err, c.err) {
+			t.Fatalf("unexpected error claiming %q as %q:\n- want: %v\n-  got: %v",
+				c.field, c.name, c.err, err)
+		}
+	}
+
+	want := []RegisterField{
+		{Name: "tenant id", Register: "reg5", Start: 0, End: 23},
+		{Name: "flags", Register: "reg5", Start: 24, End: 31},
+		{Name: "ct label", Register: "xxreg2", Start: 0, End: 127},
+		{Name: "next hop", Register: "xreg0", Start: 32, End: 63},
+		{Name: "port", Register: "reg1", Start: 0, End: 15},
+		{Name: "vrf", Register: "xreg0", Start: 16, End: 31},
+	}
+	if got := a.Fields(); !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected fields:\n- want: %v\n-  got: %v", want, got)
+	}
+
+	if f, ok := a.Field("flags"); !ok || f.String() != "reg5[24..31]" {
+		t.Fatalf("unexpected flags field: %v, %v", f, ok)
+	}
+}
+
+func TestRegisterAllocatorActions(t *testing.T) {
+	var a RegisterAllocator
+	for _, c := range [][2]string{
+		{"tenant id", "reg5[0..23]"},
+		{"flag", "reg5[31]"},
+		{"saved tenant id", "xreg3[40..63]"},
+		{"label", "xxreg0[96..127]"},
+		{"address", "xxreg2[]"},
+	} {
+		if _, err := a.Claim(c[0], c[1]); err != nil {
+			t.Fatalf("failed to claim %q: %v", c[0], err)
+		}
+	}
+
+	text := func(v interface{ MarshalText() ([]byte, error) }, err error) string {
+		if err != nil {
+			return err.Error()
+		}
+
+		b, err := v.MarshalText()
+		if err != nil {
+			return err.Error()
+		}
+
+		return string(b)
+	}
+
+	var tests = []struct {
+		desc string
+		fn   func() string
+		want string
+	}{
+		{
+			desc: "match",
+			fn:   func() string { return text(a.Match("tenant id", 0x123)) },
+			want: "reg5=0x123/0xffffff",
+		},
+		{
+			desc: "match bit",
+			fn:   func() string { return text(a.Match("flag", 1)) },
+			want: "reg5=0x80000000/0x80000000",
+		},
+		{
+			desc: "match xreg",
+			fn:   func() string { return text(a.Match("saved tenant id", 0x123)) },
+			want: "xreg3=0x1230000000000/0xffffff0000000000",
+		},
+		{
+			desc: "match xxreg",
+			fn:   func() string { return text(a.Match("label", 0x1)) },
+			want: "xxreg0=0x1000000000000000000000000/0xffffffff000000000000000000000000",
+		},
+		{
+			desc: "match 128 bit",
+			fn: func() string {
+				return text(a.MatchUint128("address", Uint128{Hi: 0x20010db800000000, Lo: 0x1}))
+			},
+			want: "xxreg2=0x20010db8000000000000000000000001",
+		},
+		{
+			desc: "match too large",
+			fn:   func() string { return text(a.Match("flag", 2)) },
+			want: `value 0x2 does not fit in 1 bit register field "flag": value out of range for field`,
+		},
+		{
+			desc: "match unknown",
+			fn:   func() string { return text(a.Match("vrf", 1)) },
+			want: `unknown register field: "vrf"`,
+		},
+		{
+			desc: "load",
+			fn:   func() string { return text(a.Load("tenant id", 0x123)) },
+			want: "load:0x123->reg5[0..23]",
+		},
+		{
+			desc: "load bit",
+			fn:   func() string { return text(a.Load("flag", 1)) },
+			want: "load:0x1->reg5[31]",
+		},
+		{
+			desc: "load 128 bit",
+			fn: func() string {
+				return text(a.LoadUint128("address", Uint128{Hi: 0x20010db800000000, Lo: 0x1}))
+			},
+			want: "load:0x20010db8000000000000000000000001->xxreg2[0..127]",
+		},
+		{
+			desc: "load 128 bit too large",
+			fn: func() string {
+				return text(a.LoadUint128("label", Uint128{Hi: 0x1}))
+			},
+			want: `value 0x10000000000000000 does not fit in 32 bit register field "label": value out of range for field`,
+		},
+		{
+			desc: "load too large",
+			fn:   func() string { return text(a.Load("tenant id", 0x1000000)) },
+			want: `value 0x1000000 does not fit in 24 bit register field "tenant id": value out of range for field`,
+		},
+		{
+			desc: "move",
+			fn:   func() string { return text(a.Move("tenant id", "saved tenant id")) },
+			want: "move:reg5[0..23]->xreg3[40..63]",
+		},
+		{
+			desc: "move different widths",
+			fn:   func() string { return text(a.Move("tenant id", "label")) },
+			want: `cannot move 24 bit register field "tenant id" to 32 bit register field "label": value out of range for field`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if want, got := tt.want, tt.fn(); want != got {
+				t.Fatalf("unexpected output:\n- want: %q\n-  got: %q", want, got)
+			}
+		})
+	}
+}
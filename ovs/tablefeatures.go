@@ -0,0 +1,593 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidTableFeatures is returned when table features from
+	// 'ovs-ofctl dump-table-features' do not match the expected output format.
+	ErrInvalidTableFeatures = errors.New("invalid openflow table features")
+)
+
+// A MatchSupport indicates how a field may be matched in an OpenFlow table.
+type MatchSupport string
+
+// MatchSupport constants as reported by 'ovs-ofctl dump-table-features'.
+const (
+	MatchSupportExact     MatchSupport = "must exact match"
+	MatchSupportWildcard  MatchSupport = "exact match or wildcard"
+	MatchSupportArbitrary MatchSupport = "arbitrary mask"
+)
+
+// Wildcardable reports whether a field with this MatchSupport may be omitted
+// from a flow's match.
+func (m MatchSupport) Wildcardable() bool {
+	return m == MatchSupportWildcard || m == MatchSupportArbitrary
+}
+
+// Maskable reports whether a field with this MatchSupport may be matched
+// using an arbitrary bitwise mask.
+func (m MatchSupport) Maskable() bool {
+	return m == MatchSupportArbitrary
+}
+
+// A TableMatchField is a field which may be matched in an OpenFlow table.
+type TableMatchField struct {
+	Field   string
+	Support MatchSupport
+}
+
+// TableInstructions describes the instructions and actions which may be
+// used by flows in an OpenFlow table.
+type TableInstructions struct {
+	// NextTables lists the tables which may be targeted by goto_table.
+	NextTables []int
+
+	// Instructions lists supported instructions, such as goto_table.
+	Instructions []string
+
+	// WriteActions and ApplyActions list supported actions for the
+	// write_actions and apply_actions instructions respectively.
+	WriteActions []string
+	ApplyActions []string
+
+	// WriteSetFields and ApplySetFields list the fields which may be
+	// modified using set_field within each instruction.
+	WriteSetFields []string
+	ApplySetFields []string
+}
+
+// TableFeatures contains the features of an Open vSwitch table, as reported
+// by 'ovs-ofctl dump-table-features'.
+type TableFeatures struct {
+	ID   int
+	Name string
+
+	// MetadataMatch and MetadataWrite are the bits of the metadata field
+	// which may be matched and written in this table.
+	MetadataMatch uint64
+	MetadataWrite uint64
+
+	MaxEntries int
+
+	// Instructions apply to flows other than the table-miss flow, and
+	// MissInstructions apply to the table-miss flow.
+	Instructions     TableInstructions
+	MissInstructions TableInstructions
+
+	Matches []TableMatchField
+}
+
+// SupportsMatch reports whether field may be matched in this table.
+func (t *TableFeatures) SupportsMatch(field string) bool {
+	_, ok := t.Match(field)
+	return ok
+}
+
+// Match returns the TableMatchField for the specified field, if it may be
+// matched in this table.
+func (t *TableFeatures) Match(field string) (TableMatchField, bool) {
+	for _, m := range t.Matches {
+		if m.Field == field {
+			return m, true
+		}
+	}
+
+	return TableMatchField{}, false
+}
+
+// Wildcards returns the fields which may be wildcarded in this table.
+func (t *TableFeatures) Wildcards() []string {
+	var fields []string
+	for _, m := range t.Matches {
+		if m.Support.Wildcardable() {
+			fields = append(fields, m.Field)
+		}
+	}
+
+	return fields
+}
+
+// dumpTableFeaturesPrefix is a sentinel value returned at the beginning of
+// the output from 'ovs-ofctl dump-table-features'.
+var dumpTableFeaturesPrefix = []byte("OFPST_TABLE_FEATURES reply")
+
+// Sections of a table in 'ovs-ofctl dump-table-features' output.
+const (
+	sectionNone = iota
+	sectionInstructions
+	sectionMissInstructions
+	sectionBothInstructions
+	sectionMatching
+)
+
+// Action subsections of an instructions section.
+const (
+	actionsNone = iota
+	actionsWrite
+	actionsApply
+	actionsBoth
+)
+
+// parseTableFeatures parses the output of 'ovs-ofctl dump-table-features'
+// into zero or more TableFeatures structs.
+func parseTableFeatures(in []byte) ([]*TableFeatures, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimSpace(in)))
+	if !scanner.Scan() {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	// First line must contain prefix returned by OVS
+	if !bytes.HasPrefix(scanner.Bytes(), dumpTableFeaturesPrefix) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var (
+		tables []*TableFeatures
+		t      *TableFeatures
+
+		section = sectionNone
+		actions = actionsNone
+	)
+
+	// prev returns the table preceding the current one, if any.
+	prev := func() *TableFeatures {
+		if len(tables) < 2 {
+			return nil
+		}
+		return tables[len(tables)-2]
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, string(dumpTableFeaturesPrefix)):
+			// Large replies are split into multiple messages.
+			continue
+		case strings.HasPrefix(line, "tables "):
+			// Range of tables identical to the previous one:
+			//  tables 2...252: ditto
+			if t == nil {
+				return nil, ErrInvalidTableFeatures
+			}
+
+			first, last, err := parseTableDitto(line)
+			if err != nil {
+				return nil, err
+			}
+
+			for id := first; id <= last; id++ {
+				d := t.copy()
+				d.ID = id
+				d.Name = ""
+				tables = append(tables, d)
+			}
+			t = tables[len(tables)-1]
+			section = sectionNone
+			continue
+		case strings.HasPrefix(line, "table "):
+			id, name, err := parseTableHeader(line)
+			if err != nil {
+				return nil, err
+			}
+
+			t = &TableFeatures{
+				ID:   id,
+				Name: name,
+			}
+			tables = append(tables, t)
+			section = sectionNone
+			continue
+		}
+
+		// All remaining lines describe the current table.
+		if t == nil {
+			return nil, ErrInvalidTableFeatures
+		}
+
+		switch {
+		case section == sectionMatching:
+			// The matching section is always last, and its fields may
+			// collide with other keys such as "metadata".
+			kv := strings.SplitN(line, ": ", 2)
+			if len(kv) != 2 {
+				return nil, ErrInvalidTableFeatures
+			}
+
+			t.Matches = append(t.Matches, TableMatchField{
+				Field:   kv[0],
+				Support: MatchSupport(kv[1]),
+			})
+		case line == "(same features)":
+			if p := prev(); p != nil {
+				t.Instructions = p.Instructions.copy()
+				t.MissInstructions = p.MissInstructions.copy()
+				t.Matches = append([]TableMatchField(nil), p.Matches...)
+			}
+		case line == "(same instructions)":
+			if p := prev(); p != nil {
+				t.Instructions = p.Instructions.copy()
+				t.MissInstructions = p.MissInstructions.copy()
+			}
+		case line == "(same matching)":
+			if p := prev(); p != nil {
+				t.Matches = append([]TableMatchField(nil), p.Matches...)
+			}
+		case strings.HasPrefix(line, "metadata:"):
+			if err := t.parseMetadata(line); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, "max_entries="):
+			n, err := strconv.Atoi(strings.TrimPrefix(line, "max_entries="))
+			if err != nil {
+				return nil, err
+			}
+			t.MaxEntries = n
+		case line == "instructions (table miss and others):":
+			section, actions = sectionBothInstructions, actionsNone
+		case line == "instructions (other than table miss):":
+			section, actions = sectionInstructions, actionsNone
+		case line == "instructions (table miss):":
+			section, actions = sectionMissInstructions, actionsNone
+		case line == "matching:":
+			section = sectionMatching
+		case section != sectionNone:
+			var err error
+			actions, err = t.parseInstructionsLine(line, section, actions)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// Any other lines, such as table statistics and configuration,
+		// are ignored.
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return tables, nil
+}
+
+// parseTableHeader parses a table ID and optional name from a table header:
+//
+//	table 0 ("classifier"):
+//	table 1:
+func parseTableHeader(line string) (int, string, error) {
+	s := strings.TrimSuffix(strings.TrimPrefix(line, "table "), ":")
+
+	ss := strings.SplitN(s, " ", 2)
+	id, err := strconv.Atoi(ss[0])
+	if err != nil {
+		return 0, "", err
+	}
+
+	if len(ss) == 1 {
+		return id, "", nil
+	}
+
+	name := strings.TrimSpace(ss[1])
+	if !strings.HasPrefix(name, `("`) || !strings.HasSuffix(name, `")`) {
+		return 0, "", ErrInvalidTableFeatures
+	}
+
+	return id, name[2 : len(name)-2], nil
+}
+
+// parseTableDitto parses a range of table IDs from a ditto line:
+//
+//	tables 2...252: ditto
+func parseTableDitto(line string) (int, int, error) {
+	s := strings.TrimPrefix(line, "tables ")
+	if !strings.HasSuffix(s, ": ditto") {
+		return 0, 0, ErrInvalidTableFeatures
+	}
+	s = strings.TrimSuffix(s, ": ditto")
+
+	ss := strings.Split(s, "...")
+	if len(ss) != 2 {
+		return 0, 0, ErrInvalidTableFeatures
+	}
+
+	first, err := strconv.Atoi(ss[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	last, err := strconv.Atoi(ss[1])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if first > last {
+		return 0, 0, ErrInvalidTableFeatures
+	}
+
+	return first, last, nil
+}
+
+// parseMetadata parses the metadata match and write masks for a table:
+//
+//	metadata: match=0xffffffffffffffff write=0xffffffffffffffff
+func (t *TableFeatures) parseMetadata(line string) error {
+	for _, f := range strings.Fields(strings.TrimPrefix(line, "metadata:")) {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return ErrInvalidTableFeatures
+		}
+
+		v, err := strconv.ParseUint(kv[1], 0, 64)
+		if err != nil {
+			return err
+		}
+
+		switch kv[0] {
+		case "match":
+			t.MetadataMatch = v
+		case "write":
+			t.MetadataWrite = v
+		}
+	}
+
+	return nil
+}
+
+// parseInstructionsLine parses a single line from an instructions section,
+// returning the action subsection which applies to subsequent lines.
+func (t *TableFeatures) parseInstructionsLine(line string, section int, actions int) (int, error) {
+	// Apply the parsed values to each TableInstructions affected by
+	// the current section.
+	apply := func(fn func(ti *TableInstructions)) {
+		if section == sectionInstructions || section == sectionBothInstructions {
+			fn(&t.Instructions)
+		}
+		if section == sectionMissInstructions || section == sectionBothInstructions {
+			fn(&t.MissInstructions)
+		}
+	}
+
+	switch {
+	case line == "Write-Actions and Apply-Actions features:":
+		return actionsBoth, nil
+	case line == "Write-Actions features:":
+		return actionsWrite, nil
+	case line == "Apply-Actions features:":
+		return actionsApply, nil
+	case strings.HasPrefix(line, "next tables:"):
+		tables, err := parseTableList(strings.TrimSpace(strings.TrimPrefix(line, "next tables:")))
+		if err != nil {
+			return 0, err
+		}
+
+		apply(func(ti *TableInstructions) {
+			ti.NextTables = tables
+		})
+	case strings.HasPrefix(line, "instructions:"):
+		ins := splitFeatureList(strings.TrimPrefix(line, "instructions:"), ",")
+
+		apply(func(ti *TableInstructions) {
+			ti.Instructions = ins
+		})
+	case strings.HasPrefix(line, "actions:"):
+		acts := splitFeatureList(strings.TrimPrefix(line, "actions:"), " ")
+
+		apply(func(ti *TableInstructions) {
+			if actions == actionsWrite || actions == actionsBoth {
+				ti.WriteActions = acts
+			}
+			if actions == actionsApply || actions == actionsBoth {
+				ti.ApplyActions = acts
+			}
+		})
+	case strings.HasPrefix(line, "supported on Set-Field:"):
+		fields := splitFeatureList(strings.TrimPrefix(line, "supported on Set-Field:"), " ")
+
+		apply(func(ti *TableInstructions) {
+			if actions == actionsWrite || actions == actionsBoth {
+				ti.WriteSetFields = fields
+			}
+			if actions == actionsApply || actions == actionsBoth {
+				ti.ApplySetFields = fields
+			}
+		})
+	}
+
+	return actions, nil
+}
+
+// parseTableList parses a list of tables and table ranges, such as "1-253"
+// or "1,3,5-7".  "(none)" indicates an empty list.
+func parseTableList(s string) ([]int, error) {
+	if s == "(none)" || s == "" {
+		return nil, nil
+	}
+
+	var tables []int
+	for _, r := range strings.Split(s, ",") {
+		ss := strings.SplitN(strings.TrimSpace(r), "-", 2)
+
+		first, err := strconv.Atoi(ss[0])
+		if err != nil {
+			return nil, err
+		}
+
+		last := first
+		if len(ss) == 2 {
+			last, err = strconv.Atoi(ss[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if first > last {
+			return nil, fmt.Errorf("invalid table range: %q", r)
+		}
+
+		for id := first; id <= last; id++ {
+			tables = append(tables, id)
+		}
+	}
+
+	return tables, nil
+}
+
+// splitFeatureList splits a list of features using the specified separator,
+// discarding any empty elements.
+func splitFeatureList(s string, sep string) []string {
+	var out []string
+	for _, f := range strings.Split(s, sep) {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+
+	return out
+}
+
+// copy creates a deep copy of a TableFeatures struct.
+func (t *TableFeatures) copy() *TableFeatures {
+	c := *t
+	c.Instructions = t.Instructions.copy()
+	c.MissInstructions = t.MissInstructions.copy()
+	c.Matches = append([]TableMatchField(nil), t.Matches...)
+	return &c
+}
+
+// copy creates a deep copy of a TableInstructions struct.
+func (ti TableInstructions) copy() TableInstructions {
+	return TableInstructions{
+		NextTables:     append([]int(nil), ti.NextTables...),
+		Instructions:   append([]string(nil), ti.Instructions...),
+		WriteActions:   append([]string(nil), ti.WriteActions...),
+		ApplyActions:   append([]string(nil), ti.ApplyActions...),
+		WriteSetFields: append([]string(nil), ti.WriteSetFields...),
+		ApplySetFields: append([]string(nil), ti.ApplySetFields...),
+	}
+}
+
+// A TableMiss is the behavior of an OpenFlow table when a packet does not
+// match any flow.
+type TableMiss string
+
+// TableMiss constants which can be used with TableOptions.
+const (
+	TableMissController TableMiss = "controller"
+	TableMissContinue   TableMiss = "continue"
+	TableMissDrop       TableMiss = "drop"
+)
+
+// A TableEviction configures whether Open vSwitch may evict flows from a
+// full OpenFlow table in order to add new ones.
+type TableEviction string
+
+// TableEviction constants which can be used with TableOptions.
+const (
+	TableEvictionEnable  TableEviction = "evict"
+	TableEvictionDisable TableEviction = "noevict"
+)
+
+// A TableVacancy configures vacancy events for an OpenFlow table.  Low and
+// High are percentages of remaining table space at which vacancy-down and
+// vacancy-up events are sent to a controller.
+type TableVacancy struct {
+	// Disable disables vacancy events.  Low and High are ignored.
+	Disable bool
+
+	Low  int
+	High int
+}
+
+var (
+	// errInvalidTableVacancy is returned when a TableVacancy has out of
+	// range thresholds.
+	errInvalidTableVacancy = errors.New("table vacancy thresholds must satisfy 0 <= low <= high <= 100")
+)
+
+// A TableOptions enables configuration of an OpenFlow table.  Zero values
+// leave the corresponding setting unchanged.
+type TableOptions struct {
+	// Name sets the name of the table in the Open vSwitch database.
+	Name string
+
+	// Miss sets the table-miss behavior.  Open vSwitch only supports this
+	// setting with OpenFlow 1.1 and 1.2.
+	Miss TableMiss
+
+	// Eviction and Vacancy configure behavior when a table is full.  Open
+	// vSwitch only supports these settings with OpenFlow 1.4 and later.
+	Eviction TableEviction
+	Vacancy  *TableVacancy
+}
+
+// slice creates a string slice containing any non-zero 'ovs-ofctl mod-table'
+// settings from the struct in the format expected by Open vSwitch.  Each
+// setting must be applied using a separate command.
+func (o TableOptions) slice() ([]string, error) {
+	var s []string
+
+	if o.Miss != "" {
+		s = append(s, string(o.Miss))
+	}
+
+	if o.Eviction != "" {
+		s = append(s, string(o.Eviction))
+	}
+
+	if v := o.Vacancy; v != nil {
+		if v.Disable {
+			s = append(s, "novacancy")
+		} else {
+			if v.Low < 0 || v.Low > v.High || v.High > 100 {
+				return nil, errInvalidTableVacancy
+			}
+
+			s = append(s, fmt.Sprintf("vacancy:%d,%d", v.Low, v.High))
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,284 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+func Test_parseTableFeatures(t *testing.T) {
+	var tests = []struct {
+		desc   string
+		s      string
+		tables []*TableFeatures
+		err    error
+	}{
+		{
+			desc: "empty string",
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			desc: "incorrect prefix",
+			s:    "OFPST_TABLE reply",
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			desc: "feature before table header",
+			s: `
+OFPST_TABLE_FEATURES reply (OF1.3) (xid=0x2):
+    max_entries=1000000
+`,
+			err: ErrInvalidTableFeatures,
+		},
+		{
+			desc: "ditto before table header",
+			s: `
+OFPST_TABLE_FEATURES reply (OF1.3) (xid=0x2):
+  tables 1...2: ditto
+`,
+			err: ErrInvalidTableFeatures,
+		},
+		{
+			desc: "broken table name",
+			s: `
+OFPST_TABLE_FEATURES reply (OF1.3) (xid=0x2):
+  table 0 (classifier):
+`,
+			err: ErrInvalidTableFeatures,
+		},
+		{
+			desc: "broken match field",
+			s: `
+OFPST_TABLE_FEATURES reply (OF1.3) (xid=0x2):
+  table 0:
+    matching:
+      in_port
+`,
+			err: ErrInvalidTableFeatures,
+		},
+		{
+			desc: "OK",
+			s: `
+OFPST_TABLE_FEATURES reply (OF1.3) (xid=0x2):
+  table 0 ("classifier"):
+    metadata: match=0xffffffffffffffff write=0xffffffff00000000
+    max_entries=1000000
+    instructions (table miss and others):
+      next tables: 1-3
+      instructions: apply_actions,clear_actions,write_actions,goto_table
+      Write-Actions and Apply-Actions features:
+        actions: output group set_field
+        supported on Set-Field: tun_id metadata
+    matching:
+      metadata: arbitrary mask
+      in_port: exact match or wildcard
+      eth_type: must exact match
+
+  table 1 ("filter"):
+    metadata: match=0xffffffffffffffff write=0xffffffff00000000
+    max_entries=1000000
+    (same instructions)
+    (same matching)
+
+  tables 2...3: ditto
+
+  table 4:
+    metadata: match=0 write=0
+    max_entries=100
+    instructions (other than table miss):
+      next tables: (none)
+      instructions: apply_actions
+      Write-Actions features:
+        actions: output
+      Apply-Actions features:
+        actions: output group
+        supported on Set-Field: eth_dst
+    instructions (table miss):
+      next tables: (none)
+      instructions: write_actions
+      Write-Actions and Apply-Actions features:
+        actions: output
+    matching:
+      in_port: exact match or wildcard
+`,
+			tables: func() []*TableFeatures {
+				ins := TableInstructions{
+					NextTables:     []int{1, 2, 3},
+					Instructions:   []string{"apply_actions", "clear_actions", "write_actions", "goto_table"},
+					WriteActions:   []string{"output", "group", "set_field"},
+					ApplyActions:   []string{"output", "group", "set_field"},
+					WriteSetFields: []string{"tun_id", "metadata"},
+					ApplySetFields: []string{"tun_id", "metadata"},
+				}
+				matches := []TableMatchField{
+					{Field: "metadata", Support: MatchSupportArbitrary},
+					{Field: "in_port", Support: MatchSupportWildcard},
+					{Field: "eth_type", Support: MatchSupportExact},
+				}
+
+				base := func(id int, name string) *TableFeatures {
+					return &TableFeatures{
+						ID:               id,
+						Name:             name,
+						MetadataMatch:    0xffffffffffffffff,
+						MetadataWrite:    0xffffffff00000000,
+						MaxEntries:       1000000,
+						Instructions:     ins.copy(),
+						MissInstructions: ins.copy(),
+						Matches:          matches,
+					}
+				}
+
+				return []*TableFeatures{
+					base(0, "classifier"),
+					base(1, "filter"),
+					base(2, ""),
+					base(3, ""),
+					{
+						ID:         4,
+						MaxEntries: 100,
+						Instructions: TableInstructions{
+							Instructions:   []string{"apply_actions"},
+							WriteActions:   []string{"output"},
+							ApplyActions:   []string{"output", "group"},
+							ApplySetFields: []string{"eth_dst"},
+						},
+						MissInstructions: TableInstructions{
+							Instructions: []string{"write_actions"},
+							WriteActions: []string{"output"},
+							ApplyActions: []string{"output"},
+						},
+						Matches: []TableMatchField{
+							{Field: "in_port", Support: MatchSupportWildcard},
+						},
+					},
+				}
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			tables, err := parseTableFeatures([]byte(tt.s))
+
+			if want, got := errStr(tt.err), errStr(err); want != got {
+				t.Fatalf("unexpected error:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+			if err != nil {
+				return
+			}
+
+			if want, got := tt.tables, tables; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected TableFeatures:\n- want: %#v\n-  got: %#v",
+					want, got)
+			}
+		})
+	}
+}
+
+func TestTableFeaturesMatches(t *testing.T) {
+	tf := &TableFeatures{
+		Matches: []TableMatchField{
+			{Field: "metadata", Support: MatchSupportArbitrary},
+			{Field: "in_port", Support: MatchSupportWildcard},
+			{Field: "eth_type", Support: MatchSupportExact},
+		},
+	}
+
+	if !tf.SupportsMatch("in_port") {
+		t.Fatal("expected in_port match to be supported")
+	}
+	if tf.SupportsMatch("nsh_spi") {
+		t.Fatal("expected nsh_spi match to be unsupported")
+	}
+
+	m, ok := tf.Match("metadata")
+	if !ok || !m.Support.Maskable() {
+		t.Fatalf("expected metadata match to be maskable: %#v", m)
+	}
+
+	if want, got := []string{"metadata", "in_port"}, tf.Wildcards(); !reflect.DeepEqual(want, got) {
+		t.Fatalf("unexpected wildcards:\n- want: %v\n-  got: %v",
+			want, got)
+	}
+}
+
+func TestTableOptions_slice(t *testing.T) {
+	var tests = []struct {
+		desc string
+		o    TableOptions
+		out  []string
+		err  error
+	}{
+		{
+			desc: "no options",
+		},
+		{
+			desc: "name only",
+			o: TableOptions{
+				Name: "foo",
+			},
+		},
+		{
+			desc: "all options",
+			o: TableOptions{
+				Miss:     TableMissContinue,
+				Eviction: TableEvictionEnable,
+				Vacancy: &TableVacancy{
+					Low:  10,
+					High: 90,
+				},
+			},
+			out: []string{"continue", "evict", "vacancy:10,90"},
+		},
+		{
+			desc: "disable vacancy",
+			o: TableOptions{
+				Vacancy: &TableVacancy{
+					Disable: true,
+				},
+			},
+			out: []string{"novacancy"},
+		},
+		{
+			desc: "invalid vacancy",
+			o: TableOptions{
+				Vacancy: &TableVacancy{
+					Low:  90,
+					High: 10,
+				},
+			},
+			err: errInvalidTableVacancy,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			out, err := tt.o.slice()
+			if want, got := tt.err, err; want != got {
+				t.Fatalf("unexpected error:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+
+			if want, got := tt.out, out; !reflect.DeepEqual(want, got) {
+				t.Fatalf("unexpected slice:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,800 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrPrerequisite is returned when a Match or Action is used in a flow
+	// which does not satisfy the prerequisites of its field, such as
+	// matching tp_dst without specifying a TCP, UDP, or SCTP protocol.
+	ErrPrerequisite = errors.New("field prerequisites not satisfied")
+
+	// ErrReadOnlyField is returned when an Action in a flow modifies a
+	// field which Open vSwitch does not allow to be modified.
+	ErrReadOnlyField = errors.New("field is read-only")
+
+	// ErrFieldWidth is returned when a value does not fit in the field
+	// it is used with.
+	ErrFieldWidth = errors.New("value out of range for field")
+)
+
+// Ethernet types and IP protocol numbers used to check field prerequisites.
+const (
+	etherTypeIPv4          = 0x0800
+	etherTypeARP           = 0x0806
+	etherTypeRARP          = 0x8035
+	etherTypeIPv6          = 0x86dd
+	etherTypeMPLS          = 0x8847
+	etherTypeMPLSMulticast = 0x8848
+	etherTypeNSH           = 0x894f
+
+	ipProtoICMPv4 = 1
+	ipProtoTCP    = 6
+	ipProtoUDP    = 17
+	ipProtoICMPv6 = 58
+	ipProtoSCTP   = 132
+)
+
+// Limits of flow fields which are not otherwise constrained by their types.
+const (
+	maxPriority    = 0xffff
+	maxTableID     = 254
+	maxIdleTimeout = 0xffff
+	numRegisters   = 16
+)
+
+// A validator is a type which can validate itself, such as a Flow or
+// MatchFlow.
+type validator interface {
+	Validate() error
+}
+
+var (
+	_ validator = &Flow{}
+	_ validator = &MatchFlow{}
+)
+
+var _ error = &ValidationError{}
+
+// A ValidationError is an error returned by Flow.Validate and
+// MatchFlow.Validate.  It identifies the Match or Action which caused
+// validation to fail.
+type ValidationError struct {
+	// Match is the offending Match, or nil if the error was caused by an
+	// Action or by another field of the flow.
+	Match Match
+
+	// Action is the offending Action, or nil if the error was caused by a
+	// Match or by another field of the flow.
+	Action Action
+
+	// Index is the index of Match within Matches or of Action within
+	// Actions, or -1 if neither is set.
+	Index int
+
+	// Field is the name of the OpenFlow field which failed validation,
+	// such as "tp_dst".
+	Field string
+
+	// Reason describes why validation failed.
+	Reason string
+
+	// Err is the underlying error, such as ErrPrerequisite or ErrFieldWidth.
+	Err error
+}
+
+// Error returns the string representation of a ValidationError.
+func (e *ValidationError) Error() string {
+	switch {
+	case e.Match != nil:
+		return fmt.Sprintf("invalid match %d (%s): %s", e.Index, e.Field, e.Reason)
+	case e.Action != nil:
+		return fmt.Sprintf("invalid action %d (%s): %s", e.Index, e.Field, e.Reason)
+	default:
+		return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+	}
+}
+
+// Unwrap returns the underlying error of a ValidationError.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks that a Flow satisfies the prerequisites and field widths
+// required by Open vSwitch, and that its Actions are compatible with the
+// packets it matches.  If validation fails, the returned error is of type
+// *ValidationError.
+func (f *Flow) Validate() error {
+	if err := validateFlowFields(f.Priority, f.Table, f.IdleTimeout); err != nil {
+		return err
+	}
+
+	fc, err := validateMatches(f.Protocol, f.Matches)
+	if err != nil {
+		return err
+	}
+
+	return validateActions(fc, f.Table, f.Actions)
+}
+
+// Validate checks that a MatchFlow satisfies the prerequisites and field
+// widths required by Open vSwitch.  If validation fails, the returned error
+// is of type *ValidationError.
+func (f *MatchFlow) Validate() error {
+	table := f.Table
+	if table == AnyTable {
+		table = 0
+	}
+
+	priority := f.Priority
+	if !f.Strict {
+		priority = 0
+	}
+
+	if err := validateFlowFields(priority, table, 0); err != nil {
+		return err
+	}
+
+	_, err := validateMatches(f.Protocol, f.Matches)
+	return err
+}
+
+// validateFlowFields checks the ranges of fields common to Flow and
+// MatchFlow.
+func validateFlowFields(pri, tbl, idle int) error {
+	fields := []struct {
+		name string
+		v    int
+		max  int
+	}{
+		{name: priority, v: pri, max: maxPriority},
+		{name: table, v: tbl, max: maxTableID},
+		{name: idleTimeout, v: idle, max: maxIdleTimeout},
+	}
+
+	for _, f := range fields {
+		if f.v < 0 || f.v > f.max {
+			return &ValidationError{
+				Index:  -1,
+				Field:  f.name,
+				Reason: fmt.Sprintf("%d is not between 0 and %d", f.v, f.max),
+				Err:    ErrFieldWidth,
+			}
+		}
+	}
+
+	return nil
+}
+
+// A flowContext describes the packets matched by a flow, for the purpose
+// of checking field prerequisites.
+type flowContext struct {
+	// unknown is set if the flow uses a Protocol which is not understood,
+	// in which case prerequisites cannot be checked.
+	unknown bool
+
+	// Zero if no Ethernet type is matched.
+	etherType uint16
+
+	// -1 if no IP protocol or ICMP type is matched.
+	ipProto  int
+	icmpType int
+}
+
+// protocolContexts maps Protocols to the Ethernet type and IP protocol they
+// imply.
+var protocolContexts = map[Protocol]flowContext{
+	ProtocolARP:           {etherType: etherTypeARP, ipProto: -1},
+	ProtocolICMPv4:        {etherType: etherTypeIPv4, ipProto: ipProtoICMPv4},
+	ProtocolICMPv6:        {etherType: etherTypeIPv6, ipProto: ipProtoICMPv6},
+	ProtocolIPv4:          {etherType: etherTypeIPv4, ipProto: -1},
+	ProtocolIPv6:          {etherType: etherTypeIPv6, ipProto: -1},
+	ProtocolMPLS:          {etherType: etherTypeMPLS, ipProto: -1},
+	ProtocolMPLSMulticast: {etherType: etherTypeMPLSMulticast, ipProto: -1},
+	ProtocolRARP:          {etherType: etherTypeRARP, ipProto: -1},
+	ProtocolSCTPv4:        {etherType: etherTypeIPv4, ipProto: ipProtoSCTP},
+	ProtocolSCTPv6:        {etherType: etherTypeIPv6, ipProto: ipProtoSCTP},
+	ProtocolTCPv4:         {etherType: etherTypeIPv4, ipProto: ipProtoTCP},
+	ProtocolTCPv6:         {etherType: etherTypeIPv6, ipProto: ipProtoTCP},
+	ProtocolUDPv4:         {etherType: etherTypeIPv4, ipProto: ipProtoUDP},
+	ProtocolUDPv6:         {etherType: etherTypeIPv6, ipProto: ipProtoUDP},
+}
+
+func (c flowContext) isIPv4() bool { return c.etherType == etherTypeIPv4 }
+func (c flowContext) isIPv6() bool { return c.etherType == etherTypeIPv6 }
+func (c flowContext) isIP() bool   { return c.isIPv4() || c.isIPv6() }
+
+func (c flowContext) isMPLS() bool { return isMPLSEtherType(c.etherType) }
+func (c flowContext) isNSH() bool  { return c.etherType == etherTypeNSH }
+
+func (c flowContext) isARP() bool {
+	return c.etherType == etherTypeARP || c.etherType == etherTypeRARP
+}
+
+func (c flowContext) isTransport() bool {
+	return c.isIP() && (c.ipProto == ipProtoTCP || c.ipProto == ipProtoUDP || c.ipProto == ipProtoSCTP)
+}
+
+func (c flowContext) isTCP() bool  { return c.isIP() && c.ipProto == ipProtoTCP }
+func (c flowContext) isUDP() bool  { return c.isIP() && c.ipProto == ipProtoUDP }
+func (c flowContext) isSCTP() bool { return c.isIP() && c.ipProto == ipProtoSCTP }
+
+func (c flowContext) isICMP() bool {
+	return (c.isIPv4() && c.ipProto == ipProtoICMPv4) ||
+		(c.isIPv6() && c.ipProto == ipProtoICMPv6)
+}
+
+// isND reports whether c matches IPv6 neighbor discovery messages with one
+// of the specified ICMPv6 types.
+func (c flowContext) isND(types ...int) bool {
+	if !c.isIPv6() || c.ipProto != ipProtoICMPv6 {
+		return false
+	}
+
+	for _, t := range types {
+		if c.icmpType == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A prerequisite is a requirement that a flow must satisfy to use a field.
+type prerequisite struct {
+	desc string
+	ok   func(c flowContext) bool
+}
+
+// Commonly used prerequisites.
+var (
+	prereqIP = prerequisite{
+		desc: "protocol ip or ipv6",
+		ok:   flowContext.isIP,
+	}
+	prereqIPv4 = prerequisite{
+		desc: "protocol ip",
+		ok:   flowContext.isIPv4,
+	}
+	prereqIPv4OrARP = prerequisite{
+		desc: "protocol ip, arp, or rarp",
+		ok: func(c flowContext) bool {
+			return c.isIPv4() || c.isARP()
+		},
+	}
+	prereqIPv6 = prerequisite{
+		desc: "protocol ipv6",
+		ok:   flowContext.isIPv6,
+	}
+	prereqARP = prerequisite{
+		desc: "protocol arp or rarp",
+		ok:   flowContext.isARP,
+	}
+	prereqTransport = prerequisite{
+		desc: "protocol tcp, udp, or sctp",
+		ok:   flowContext.isTransport,
+	}
+	prereqMPLS = prerequisite{
+		desc: "protocol mpls or mplsm",
+		ok:   flowContext.isMPLS,
+	}
+	prereqNSH = prerequisite{
+		desc: "dl_type 0x894f",
+		ok:   flowContext.isNSH,
+	}
+	prereqICMPv6 = prerequisite{
+		desc: "protocol icmp6",
+		ok: func(c flowContext) bool {
+			return c.isIPv6() && c.ipProto == ipProtoICMPv6
+		},
+	}
+)
+
+// fieldPrerequisites maps field names to their prerequisites.  Fields with
+// no prerequisites are omitted.
+var fieldPrerequisites = map[string]prerequisite{
+	arpSHA: prereqARP,
+	arpSPA: prereqARP,
+	arpTHA: prereqARP,
+	arpTPA: prereqARP,
+	arpOp:  prereqARP,
+
+	nwSRC: prereqIPv4OrARP,
+	nwDST: prereqIPv4OrARP,
+	nwProto: {
+		desc: "protocol ip, ipv6, arp, or rarp",
+		ok: func(c flowContext) bool {
+			return c.isIP() || c.isARP()
+		},
+	},
+	nwTOS:  prereqIP,
+	nwECN:  prereqIP,
+	nwTTL:  prereqIP,
+	ipDSCP: prereqIP,
+	ipECN:  prereqIP,
+	ipFrag: prereqIP,
+
+	"ip_src":     prereqIPv4,
+	"ip_dst":     prereqIPv4,
+	ipv6SRC:      prereqIPv6,
+	ipv6DST:      prereqIPv6,
+	"ipv6_label": prereqIPv6,
+
+	tpSRC: prereqTransport,
+	tpDST: prereqTransport,
+	"tcp_src": {
+		desc: "protocol tcp or tcp6",
+		ok:   flowContext.isTCP,
+	},
+	"tcp_dst": {
+		desc: "protocol tcp or tcp6",
+		ok:   flowContext.isTCP,
+	},
+	tcpFlags: {
+		desc: "protocol tcp or tcp6",
+		ok:   flowContext.isTCP,
+	},
+	"udp_src": {
+		desc: "protocol udp or udp6",
+		ok:   flowContext.isUDP,
+	},
+	"udp_dst": {
+		desc: "protocol udp or udp6",
+		ok:   flowContext.isUDP,
+	},
+	sctpSRC: {
+		desc: "protocol sctp or sctp6",
+		ok:   flowContext.isSCTP,
+	},
+	sctpDST: {
+		desc: "protocol sctp or sctp6",
+		ok:   flowContext.isSCTP,
+	},
+
+	mplsLabel: prereqMPLS,
+	mplsTC:    prereqMPLS,
+	mplsBOS:   prereqMPLS,
+	mplsTTL:   prereqMPLS,
+
+	nshSPI: prereqNSH,
+	nshSI:  prereqNSH,
+	nshC1:  prereqNSH,
+	nshC2:  prereqNSH,
+	nshC3:  prereqNSH,
+	nshC4:  prereqNSH,
+
+	icmpType: {
+		desc: "protocol icmp or icmp6",
+		ok:   flowContext.isICMP,
+	},
+	icmpCode: {
+		desc: "protocol icmp or icmp6",
+		ok:   flowContext.isICMP,
+	},
+	icmpv6Type: prereqICMPv6,
+	icmpv6Code: prereqICMPv6,
+	ndTarget: {
+		desc: "protocol icmp6 with icmp_type 135 or 136",
+		ok: func(c flowContext) bool {
+			return c.isND(135, 136)
+		},
+	},
+	ndSLL: {
+		desc: "protocol icmp6 with icmp_type 135",
+		ok: func(c flowContext) bool {
+			return c.isND(135)
+		},
+	},
+	ndTLL: {
+		desc: "protocol icmp6 with icmp_type 136",
+		ok: func(c flowContext) bool {
+			return c.isND(136)
+		},
+	},
+}
+
+// nxmFields maps NXM and OXM field names, as used in load and set_field
+// actions, to their equivalent field names.
+var nxmFields = map[string]string{
+	"NXM_OF_ARP_OP":      arpOp,
+	"NXM_OF_ARP_SPA":     arpSPA,
+	"NXM_OF_ARP_TPA":     arpTPA,
+	"NXM_NX_ARP_SHA":     arpSHA,
+	"NXM_NX_ARP_THA":     arpTHA,
+	"NXM_OF_IP_SRC":      "ip_src",
+	"NXM_OF_IP_DST":      "ip_dst",
+	"NXM_OF_IP_PROTO":    nwProto,
+	"NXM_OF_IP_TOS":      nwTOS,
+	"NXM_NX_IP_ECN":      nwECN,
+	"NXM_NX_IP_TTL":      nwTTL,
+	"NXM_NX_IPV6_SRC":    ipv6SRC,
+	"NXM_NX_IPV6_DST":    ipv6DST,
+	"NXM_NX_IPV6_LABEL":  "ipv6_label",
+	"NXM_OF_TCP_SRC":     "tcp_src",
+	"NXM_OF_TCP_DST":     "tcp_dst",
+	"NXM_OF_UDP_SRC":     "udp_src",
+	"NXM_OF_UDP_DST":     "udp_dst",
+	"OXM_OF_SCTP_SRC":    sctpSRC,
+	"OXM_OF_SCTP_DST":    sctpDST,
+	"OXM_OF_MPLS_LABEL":  mplsLabel,
+	"OXM_OF_MPLS_TC":     mplsTC,
+	"OXM_OF_MPLS_BOS":    mplsBOS,
+	"NXM_NX_MPLS_TTL":    mplsTTL,
+	"NXOXM_NSH_SPI":      nshSPI,
+	"NXOXM_NSH_SI":       nshSI,
+	"NXOXM_NSH_C1":       nshC1,
+	"NXOXM_NSH_C2":       nshC2,
+	"NXOXM_NSH_C3":       nshC3,
+	"NXOXM_NSH_C4":       nshC4,
+	"NXM_OF_ICMP_TYPE":   icmpType,
+	"NXM_OF_ICMP_CODE":   icmpCode,
+	"NXM_NX_ICMPV6_TYPE": icmpv6Type,
+	"NXM_NX_ICMPV6_CODE": icmpv6Code,
+	"NXM_NX_ND_TARGET":   ndTarget,
+	"NXM_NX_ND_SLL":      ndSLL,
+	"NXM_NX_ND_TLL":      ndTLL,
+	"NXM_OF_ETH_SRC":     dlSRC,
+	"NXM_OF_ETH_DST":     dlDST,
+	"NXM_OF_IN_PORT":     inPort,
+	"NXM_OF_VLAN_TCI":    vlanTCI,
+	"NXM_NX_TUN_ID":      tunID,
+	"NXM_NX_CT_MARK":     ctMark,
+	"NXM_NX_PKT_MARK":    "pkt_mark",
+	"NXM_NX_CT_STATE":    ctState,
+	"NXM_NX_CT_ZONE":     ctZone,
+	"NXM_NX_DP_HASH":     "dp_hash",
+	"NXM_NX_RECIRC_ID":   "recirc_id",
+	"NXM_NX_CONJ_ID":     "conj_id",
+	"OXM_OF_PACKET_TYPE": packetType,
+	"OXM_OF_METADATA":    metadata,
+}
+
+// fieldName returns the canonical name of the field referred to by s, which
+// may contain a bit range such as "[0..15]" and may use an NXM name.
+func fieldName(s string) string {
+	if i := strings.IndexByte(s, '['); i != -1 {
+		s = s[:i]
+	}
+
+	if f, ok := nxmFields[s]; ok {
+		return f
+	}
+
+	// Registers, such as NXM_NX_REG0, OXM_OF_PKT_REG0, and NXM_NX_XXREG0.
+	if n := strings.TrimPrefix(s, "NXM_NX_REG"); n != s {
+		return regFamily + n
+	}
+	if n := strings.TrimPrefix(s, "OXM_OF_PKT_REG"); n != s {
+		return xregFamily + n
+	}
+	if n := strings.TrimPrefix(s, "NXM_NX_XXREG"); n != s {
+		return xxregFamily + n
+	}
+
+	return strings.ToLower(s)
+}
+
+// readOnlyFields are fields which may be matched, but not modified by
+// actions.
+var readOnlyFields = map[string]bool{
+	"conj_id":   true,
+	ctState:     true,
+	ctZone:      true,
+	"dp_hash":   true,
+	packetType:  true,
+	"recirc_id": true,
+	skbPriority: true,
+}
+
+// validateWritableField checks that the field with the specified name may be
+// modified by an action.  It returns a reason and error if validation fails.
+func validateWritableField(name string) (string, error) {
+	if readOnlyFields[name] {
+		return fmt.Sprintf("%s is read-only", name), ErrReadOnlyField
+	}
+
+	return "", nil
+}
+
+// validateField checks the prerequisites and width of the field with the
+// specified name.  It returns a reason and error if validation fails.
+func validateField(fc flowContext, name string) (string, error) {
+	if family, n, ok := parseRegisterName(name); ok && n >= numFamilyRegisters(family) {
+		return fmt.Sprintf("register %s does not exist", name), ErrFieldWidth
+	}
+
+	if fc.unknown {
+		return "", nil
+	}
+
+	p, ok := fieldPrerequisites[name]
+	if !ok || p.ok(fc) {
+		return "", nil
+	}
+
+	return fmt.Sprintf("%s requires %s", name, p.desc), ErrPrerequisite
+}
+
+// validateMatches checks that matches satisfy their prerequisites when
+// used with protocol, and returns the flowContext they describe.
+func validateMatches(protocol Protocol, matches []Match) (flowContext, error) {
+	fc := flowContext{
+		ipProto:  -1,
+		icmpType: -1,
+	}
+	if protocol != "" {
+		pc, ok := protocolContexts[protocol]
+		if !ok {
+			pc = flowContext{unknown: true}
+		}
+
+		fc = pc
+		fc.icmpType = -1
+	}
+
+	// Matches on the Ethernet type and IP protocol may be used in place of a
+	// Protocol, so they must be gathered before checking prerequisites.
+	for i, m := range matches {
+		var (
+			field  string
+			cur, v int
+		)
+
+		switch m := m.(type) {
+		case *dataLinkTypeMatch:
+			field, cur, v = dlType, int(fc.etherType), int(m.etherType)
+			if cur == 0 {
+				cur = -1
+			}
+		case *packetTypeMatch:
+			// Packets with no Ethernet header are typed by their
+			// Ethernet type.
+			if m.namespace != PacketNamespaceEtherType {
+				continue
+			}
+
+			field, cur, v = packetType, int(fc.etherType), int(m.typ)
+			if cur == 0 {
+				cur = -1
+			}
+		case *networkProtocolMatch:
+			field, cur, v = nwProto, fc.ipProto, int(m.num)
+		case *icmpTypeMatch:
+			field, cur, v = icmpType, fc.icmpType, int(m.typ)
+		case *icmpv6TypeMatch:
+			field, cur, v = icmpv6Type, fc.icmpType, int(m.typ)
+		default:
+			continue
+		}
+
+		if !fc.unknown && cur != -1 && cur != v {
+			return fc, &ValidationError{
+				Match:  m,
+				Index:  i,
+				Field:  field,
+				Reason: fmt.Sprintf("%s=%d conflicts with the protocol or an earlier match", field, v),
+				Err:    ErrPrerequisite,
+			}
+		}
+
+		switch field {
+		case dlType, packetType:
+			fc.etherType = uint16(v)
+		case nwProto:
+			fc.ipProto = v
+		case icmpType, icmpv6Type:
+			fc.icmpType = v
+		}
+	}
+
+	for i, m := range matches {
+		b, err := m.MarshalText()
+		if err != nil {
+			return fc, &ValidationError{
+				Match:  m,
+				Index:  i,
+				Field:  matchField(m),
+				Reason: err.Error(),
+				Err:    err,
+			}
+		}
+
+		// Matches which marshal to nothing, such as a fully wildcarded
+		// register, have no prerequisites.
+		if len(b) == 0 {
+			continue
+		}
+
+		field := string(b)
+		if i := bytes.IndexByte(b, '='); i != -1 {
+			field = string(b[:i])
+		}
+
+		if reason, err := validateField(fc, field); err != nil {
+			return fc, &ValidationError{
+				Match:  m,
+				Index:  i,
+				Field:  field,
+				Reason: reason,
+				Err:    err,
+			}
+		}
+	}
+
+	return fc, nil
+}
+
+// matchField returns a best-effort field name for a Match which cannot be
+// marshaled.
+func matchField(m Match) string {
+	s := m.GoString()
+	if i := strings.IndexByte(s, '('); i != -1 {
+		s = s[:i]
+	}
+
+	return strings.TrimPrefix(s, "ovs.")
+}
+
+// validateActions checks that actions are compatible with the packets
+// described by fc, and that instructions are valid for a flow in table.
+func validateActions(fc flowContext, table int, actions []Action) error {
+	for i, a := range actions {
+		verr := func(field, reason string, err error) error {
+			return &ValidationError{
+				Action: a,
+				Index:  i,
+				Field:  field,
+				Reason: reason,
+				Err:    err,
+			}
+		}
+
+		b, err := a.MarshalText()
+		if err != nil {
+			return verr(matchField(a), err.Error(), err)
+		}
+
+		var field string
+		switch a := a.(type) {
+		case *modNetworkAction:
+			field = "ip_" + a.srcdst
+		case *modTransportPortAction:
+			field = "tp_" + a.srcdst
+		case *loadSetFieldAction:
+			field = fieldName(a.field)
+		case *setARPAction:
+			field = a.field
+		case *moveAction:
+			if reason, err := validateMove(fc, a); err != nil {
+				return verr(fieldName(a.dst), fmt.Sprintf("%s: %s", b, reason), err)
+			}
+			continue
+		case *setMPLSLabelAction:
+			field = mplsLabel
+		case *textAction:
+			if a.action != actionDecMPLSTTL {
+				continue
+			}
+			field = mplsTTL
+		case *mplsAction:
+			if a.action == actionPopMPLS && !fc.unknown && !fc.isMPLS() {
+				return verr(a.action, a.action+" requires "+prereqMPLS.desc, ErrPrerequisite)
+			}
+
+			// Later actions apply to the packet with its new Ethernet type.
+			fc = flowContext{etherType: a.etherType, ipProto: -1, icmpType: -1}
+			continue
+		case *encapAction:
+			switch a.header {
+			case encapNSH:
+				fc = flowContext{etherType: etherTypeNSH, ipProto: -1, icmpType: -1}
+			case encapEthernet:
+				// The Ethernet type is that of the encapsulated packet.
+			default:
+				fc = flowContext{unknown: true}
+			}
+			continue
+		case *decapAction:
+			// Unless a packet type is specified, the type of the
+			// decapsulated packet is not known until it is recirculated.
+			fc = flowContext{unknown: true}
+			if a.packetType && a.namespace == PacketNamespaceEtherType {
+				fc = flowContext{etherType: a.typ, ipProto: -1, icmpType: -1}
+			}
+			continue
+		case *ctAction:
+			if !fc.unknown && !fc.isIP() {
+				return verr("ct", "ct requires "+prereqIP.desc, ErrPrerequisite)
+			}
+			continue
+		case *gotoTableInstruction:
+			if a.table <= table {
+				return verr(instructionGotoTable, fmt.Sprintf("%s: flow is in table %d", b, table), ErrInvalidGotoTable)
+			}
+			continue
+		case *writeActionsInstruction:
+			// Report errors in nested actions against the instruction
+			// itself, so that Index refers to an element of actions.
+			if err := validateActions(fc, table, a.actions); err != nil {
+				verr := err.(*ValidationError)
+				verr.Action, verr.Index = a, i
+				return verr
+			}
+			continue
+		default:
+			continue
+		}
+
+		if reason, err := validateWritableField(field); err != nil {
+			return verr(field, fmt.Sprintf("%s: %s", b, reason), err)
+		}
+		if reason, err := validateField(fc, field); err != nil {
+			return verr(field, fmt.Sprintf("%s: %s", b, reason), err)
+		}
+	}
+
+	return nil
+}
+
+// validateMove checks the source and destination fields of a move action,
+// and that their bit ranges have the same width if both are specified.
+func validateMove(fc flowContext, a *moveAction) (string, error) {
+	for _, f := range []string{a.src, a.dst} {
+		if reason, err := validateField(fc, fieldName(f)); err != nil {
+			return reason, err
+		}
+	}
+
+	if reason, err := validateWritableField(fieldName(a.dst)); err != nil {
+		return reason, err
+	}
+
+	src, srcOK := bitRangeWidth(a.src)
+	dst, dstOK := bitRangeWidth(a.dst)
+	if srcOK && dstOK && src != dst {
+		return fmt.Sprintf("cannot move %d bits to %d bits", src, dst), ErrFieldWidth
+	}
+
+	return "", nil
+}
+
+// bitRangeWidth returns the width of the bit range of a field such as
+// "reg0[0..15]".  It returns false if the field has no explicit bit range.
+func bitRangeWidth(field string) (int, bool) {
+	i := strings.IndexByte(field, '[')
+	if i == -1 {
+		return 0, false
+	}
+
+	ss := bitRangeRe.FindStringSubmatch(field[i:])
+	if ss == nil {
+		return 0, false
+	}
+
+	start, _ := strconv.Atoi(ss[1])
+	end := start
+	if ss[2] != "" {
+		end, _ = strconv.Atoi(ss[2])
+	}
+
+	return end - start + 1, true
+}
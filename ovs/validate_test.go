@@ -0,0 +1,683 @@
+// Copyright 2017 DigitalOcean.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovs
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestFlowValidate(t *testing.T) {
+	var tests = []struct {
+		desc   string
+		f      *Flow
+		err    error
+		match  int
+		action int
+		field  string
+	}{
+		{
+			desc: "OK TCP",
+			f: &Flow{
+				Protocol: ProtocolTCPv4,
+				Matches: []Match{
+					NetworkSource("192.0.2.1"),
+					TransportDestinationPort(80),
+					TCPFlags("+syn"),
+				},
+				Actions: []Action{
+					ModTransportDestinationPort(8080),
+					Output(1),
+				},
+			},
+		},
+		{
+			desc: "OK Ethernet type and IP protocol matches",
+			f: &Flow{
+				Matches: []Match{
+					DataLinkType(0x86dd),
+					NetworkProtocol(17),
+					TransportSourcePort(53),
+				},
+				Actions: []Action{Drop()},
+			},
+		},
+		{
+			desc: "OK ARP",
+			f: &Flow{
+				Protocol: ProtocolARP,
+				Matches: []Match{
+					NetworkDestination("192.0.2.1"),
+					ARPSourceProtocolAddress("192.0.2.2"),
+				},
+				Actions: []Action{Normal()},
+			},
+		},
+		{
+			desc: "OK neighbor discovery",
+			f: &Flow{
+				Protocol: ProtocolICMPv6,
+				Matches: []Match{
+					ICMPType(135),
+					NeighborDiscoveryTarget("fe80::1"),
+				},
+				Actions: []Action{Normal()},
+			},
+		},
+		{
+			desc: "OK IP header and ICMPv6 matches",
+			f: &Flow{
+				Protocol: ProtocolICMPv6,
+				Matches: []Match{
+					IPDSCP(46),
+					NetworkTTL(255),
+					IPFragment(IPFragNo),
+					ICMPv6Type(136),
+					ICMPv6Code(0),
+					NeighborDiscoveryTargetLinkLayer(net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}),
+				},
+				Actions: []Action{Normal()},
+			},
+		},
+		{
+			desc: "OK RARP and SCTP",
+			f: &Flow{
+				Protocol: ProtocolSCTPv6,
+				Matches: []Match{
+					SCTPDestinationPort(3868),
+					TransportSourcePort(3868),
+				},
+				Actions: []Action{Normal()},
+			},
+		},
+		{
+			desc: "OK ARP responder",
+			f: &Flow{
+				Protocol: ProtocolRARP,
+				Matches: []Match{
+					ARPOperation(ARPOperationRequest),
+				},
+				Actions: []Action{
+					SetARPOperation(ARPOperationReply),
+					SetARPSourceProtocolAddress(net.IPv4(192, 0, 2, 1)),
+					InPort(),
+				},
+			},
+		},
+		{
+			desc: "OK MPLS push and pop",
+			f: &Flow{
+				Protocol: ProtocolMPLS,
+				Matches: []Match{
+					MPLSLabel(100),
+					MPLSBottomOfStack(false),
+				},
+				Actions: []Action{
+					DecMPLSTTL(),
+					PopMPLS(0x8847),
+					SetMPLSLabel(200),
+					PushMPLS(0x8848),
+					Output(1),
+				},
+			},
+		},
+		{
+			desc: "OK L3 tunnel packet type",
+			f: &Flow{
+				Matches: []Match{
+					PacketType(PacketNamespaceEtherType, 0x0800),
+					NetworkDestination("192.0.2.1"),
+					PacketMark(0x1, 0),
+				},
+				Actions: []Action{
+					SetPacketMark(0x2, 0xff),
+					SetMetadata(0x1, 0),
+					Output(1),
+				},
+			},
+		},
+		{
+			desc: "OK NSH encap",
+			f: &Flow{
+				Matches: []Match{
+					DataLinkType(0x894f),
+					NSHServicePathID(0x10),
+					NSHContext(1, 0x1, 0),
+				},
+				Actions: []Action{
+					Decap(),
+					EncapNSH(1),
+					Output(1),
+				},
+			},
+		},
+		{
+			desc: "OK NSH decap to IPv4",
+			f: &Flow{
+				Matches: []Match{
+					DataLinkType(0x894f),
+				},
+				Actions: []Action{
+					DecapPacketType(PacketNamespaceEtherType, 0x0800),
+					ModNetworkSource(net.IPv4(192, 0, 2, 1)),
+					Output(1),
+				},
+			},
+		},
+		{
+			desc: "OK unknown protocol",
+			f: &Flow{
+				Protocol: "dccp",
+				Matches: []Match{
+					TransportDestinationPort(80),
+				},
+				Actions: []Action{Drop()},
+			},
+		},
+		{
+			desc: "OK registers and wildcarded register",
+			f: &Flow{
+				Matches: []Match{
+					RegMatch(15, 1, 0xffffffff),
+					RegMatch(16, 0, 0),
+				},
+				Actions: []Action{
+					Load("0x1", "NXM_NX_REG0[]"),
+					SetField("1", "reg15"),
+				},
+			},
+		},
+		{
+			desc: "priority out of range",
+			f: &Flow{
+				Priority: 65536,
+				Actions:  []Action{Drop()},
+			},
+			err:    ErrFieldWidth,
+			match:  -1,
+			action: -1,
+			field:  "priority",
+		},
+		{
+			desc: "transport port without protocol",
+			f: &Flow{
+				Matches: []Match{
+					DataLinkType(0x0800),
+					TransportDestinationPort(80),
+				},
+				Actions: []Action{Drop()},
+			},
+			err:    ErrPrerequisite,
+			match:  1,
+			action: -1,
+			field:  "tp_dst",
+		},
+		{
+			desc: "neighbor discovery without ICMPv6 type",
+			f: &Flow{
+				Protocol: ProtocolICMPv6,
+				Matches: []Match{
+					NeighborDiscoveryTarget("fe80::1"),
+				},
+				Actions: []Action{Drop()},
+			},
+			err:    ErrPrerequisite,
+			match:  0,
+			action: -1,
+			field:  "nd_target",
+		},
+		{
+			desc: "fragment without IP protocol",
+			f: &Flow{
+				Protocol: ProtocolARP,
+				Matches: []Match{
+					IPFragment(IPFragYes),
+				},
+				Actions: []Action{Drop()},
+			},
+			err:    ErrPrerequisite,
+			match:  0,
+			action: -1,
+			field:  "ip_frag",
+		},
+		{
+			desc: "ICMPv6 code with ICMPv4 protocol",
+			f: &Flow{
+				Protocol: ProtocolICMPv4,
+				Matches: []Match{
+					ICMPCode(3),
+					ICMPv6Code(4),
+				},
+				Actions: []Action{Drop()},
+			},
+			err:    ErrPrerequisite,
+			match:  1,
+			action: -1,
+			field:  "icmpv6_code",
+		},
+		{
+			desc: "SCTP port with TCP protocol",
+			f: &Flow{
+				Protocol: ProtocolTCPv4,
+				Matches: []Match{
+					SCTPSourcePort(3868),
+				},
+				Actions: []Action{Drop()},
+			},
+			err:    ErrPrerequisite,
+			match:  0,
+			action: -1,
+			field:  "sctp_src",
+		},
+		{
+			desc: "ARP operation set on IPv4 packet",
+			f: &Flow{
+				Protocol: ProtocolIPv4,
+				Actions: []Action{
+					SetARPOperation(ARPOperationReply),
+				},
+			},
+			err:    ErrPrerequisite,
+			match:  -1,
+			action: 0,
+			field:  "arp_op",
+		},
+		{
+			desc: "MPLS label with IPv4 protocol",
+			f: &Flow{
+				Protocol: ProtocolIPv4,
+				Matches: []Match{
+					MPLSLabel(100),
+				},
+				Actions: []Action{Drop()},
+			},
+			err:    ErrPrerequisite,
+			match:  0,
+			action: -1,
+			field:  "mpls_label",
+		},
+		{
+			desc: "MPLS label set after pop",
+			f: &Flow{
+				Protocol: ProtocolMPLS,
+				Actions: []Action{
+					PopMPLS(0x0800),
+					SetMPLSLabel(100),
+				},
+			},
+			err:    ErrPrerequisite,
+			match:  -1,
+			action: 1,
+			field:  "mpls_label",
+		},
+		{
+			desc: "pop_mpls on IPv6 packet",
+			f: &Flow{
+				Protocol: ProtocolIPv6,
+				Actions: []Action{
+					PopMPLS(0x0800),
+				},
+			},
+			err:    ErrPrerequisite,
+			match:  -1,
+			action: 0,
+			field:  "pop_mpls",
+		},
+		{
+			desc: "packet type conflicts with protocol",
+			f: &Flow{
+				Protocol: ProtocolIPv6,
+				Matches: []Match{
+					PacketType(PacketNamespaceEtherType, 0x0800),
+				},
+				Actions: []Action{Drop()},
+			},
+			err:    ErrPrerequisite,
+			match:  0,
+			action: -1,
+			field:  "packet_type",
+		},
+		{
+			desc: "NSH service index without NSH Ethernet type",
+			f: &Flow{
+				Protocol: ProtocolIPv4,
+				Matches: []Match{
+					NSHServiceIndex(255),
+				},
+				Actions: []Action{Drop()},
+			},
+			err:    ErrPrerequisite,
+			match:  0,
+			action: -1,
+			field:  "nsh_si",
+		},
+		{
+			desc: "IPv4 source with IPv6 protocol",
+			f: &Flow{
+				Protocol: ProtocolIPv6,
+				Matches: []Match{
+					NetworkSource("192.0.2.1"),
+				},
+				Actions: []Action{Drop()},
+			},
+			err:    ErrPrerequisite,
+			match:  0,
+			action: -1,
+			field:  "nw_src",
+		},
+		{
+			desc: "Ethernet type conflicts with protocol",
+			f: &Flow{
+				Protocol: ProtocolTCPv4,
+				Matches: []Match{
+					DataLinkType(0x86dd),
+				},
+				Actions: []Action{Drop()},
+			},
+			err:    ErrPrerequisite,
+			match:  0,
+			action: -1,
+			field:  "dl_type",
+		},
+		{
+			desc: "set read-only skb_priority",
+			f: &Flow{
+				Actions: []Action{
+					SetField("0x10001", "skb_priority"),
+					Normal(),
+				},
+			},
+			err:    ErrReadOnlyField,
+			match:  -1,
+			action: 0,
+			field:  "skb_priority",
+		},
+		{
+			desc: "load read-only ct_state",
+			f: &Flow{
+				Actions: []Action{
+					Normal(),
+					Load("0x1", "NXM_NX_CT_STATE[]"),
+				},
+			},
+			err:    ErrReadOnlyField,
+			match:  -1,
+			action: 1,
+			field:  "ct_state",
+		},
+		{
+			desc: "move to read-only recirc_id",
+			f: &Flow{
+				Actions: []Action{
+					Move("reg0[]", "NXM_NX_RECIRC_ID[]"),
+				},
+			},
+			err:    ErrReadOnlyField,
+			match:  -1,
+			action: 0,
+			field:  "recirc_id",
+		},
+		{
+			desc: "register does not exist",
+			f: &Flow{
+				Matches: []Match{
+					RegMatch(16, 1, 0xffffffff),
+				},
+				Actions: []Action{Drop()},
+			},
+			err:    ErrFieldWidth,
+			match:  0,
+			action: -1,
+			field:  "reg16",
+		},
+		{
+			desc: "extended register does not exist",
+			f: &Flow{
+				Matches: []Match{
+					XRegMatch(8, 1, 0xff),
+				},
+				Actions: []Action{Drop()},
+			},
+			err:    ErrFieldWidth,
+			match:  0,
+			action: -1,
+			field:  "xreg8",
+		},
+		{
+			desc: "move between fields of different widths",
+			f: &Flow{
+				Actions: []Action{
+					Move("reg0[0..15]", "reg1[0..7]"),
+				},
+			},
+			err:    ErrFieldWidth,
+			match:  -1,
+			action: 0,
+			field:  "reg1",
+		},
+		{
+			desc: "modify IPv4 address without protocol",
+			f: &Flow{
+				Actions: []Action{
+					Normal(),
+					ModNetworkSource(net.IPv4(192, 0, 2, 1)),
+				},
+			},
+			err:    ErrPrerequisite,
+			match:  -1,
+			action: 1,
+			field:  "ip_src",
+		},
+		{
+			desc: "load into TCP port with UDP protocol",
+			f: &Flow{
+				Protocol: ProtocolUDPv4,
+				Actions: []Action{
+					Load("0x50", "NXM_OF_TCP_DST[]"),
+				},
+			},
+			err:    ErrPrerequisite,
+			match:  -1,
+			action: 0,
+			field:  "tcp_dst",
+		},
+		{
+			desc: "set_field IPv4 address with IPv6 protocol",
+			f: &Flow{
+				Protocol: ProtocolIPv6,
+				Actions: []Action{
+					SetField("192.0.2.1", "nw_dst"),
+				},
+			},
+			err:    ErrPrerequisite,
+			match:  -1,
+			action: 0,
+			field:  "nw_dst",
+		},
+		{
+			desc: "connection tracking with ARP",
+			f: &Flow{
+				Protocol: ProtocolARP,
+				Actions: []Action{
+					ConnectionTracking("commit"),
+				},
+			},
+			err:    ErrPrerequisite,
+			match:  -1,
+			action: 0,
+			field:  "ct",
+		},
+		{
+			desc: "OK goto_table to later table",
+			f: &Flow{
+				Table:   1,
+				Matches: []Match{Metadata(0x1, 0xff)},
+				Actions: []Action{WriteMetadata(0x2, 0xff), GotoTable(2)},
+			},
+		},
+		{
+			desc: "goto_table to same table",
+			f: &Flow{
+				Table:   2,
+				Actions: []Action{GotoTable(2)},
+			},
+			err:    ErrInvalidGotoTable,
+			match:  -1,
+			action: 0,
+			field:  "goto_table",
+		},
+		{
+			desc: "goto_table to earlier table",
+			f: &Flow{
+				Table:   3,
+				Actions: []Action{Output(1), GotoTable(1)},
+			},
+			err:    ErrInvalidGotoTable,
+			match:  -1,
+			action: 1,
+			field:  "goto_table",
+		},
+		{
+			desc: "write_actions action missing prerequisite",
+			f: &Flow{
+				Protocol: ProtocolARP,
+				Actions: []Action{
+					WriteActions(ModTransportDestinationPort(80)),
+				},
+			},
+			err:    ErrPrerequisite,
+			match:  -1,
+			action: 0,
+			field:  "tp_dst",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			err := tt.f.Validate()
+			if want, got := tt.err, err; !errors.Is(got, want) || (want == nil) != (got == nil) {
+				t.Fatalf("unexpected error:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+			if err == nil {
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected *ValidationError, but got: %T", err)
+			}
+
+			if want, got := tt.field, verr.Field; want != got {
+				t.Fatalf("unexpected field:\n- want: %v\n-  got: %v",
+					want, got)
+			}
+
+			switch {
+			case tt.match >= 0:
+				if verr.Index != tt.match || verr.Match != tt.f.Matches[tt.match] {
+					t.Fatalf("error does not point at match %d: %v", tt.match, verr)
+				}
+			case tt.action >= 0:
+				if verr.Index != tt.action || verr.Action != tt.f.Actions[tt.action] {
+					t.Fatalf("error does not point at action %d: %v", tt.action, verr)
+				}
+			default:
+				if verr.Index != -1 || verr.Match != nil || verr.Action != nil {
+					t.Fatalf("error should not point at a match or action: %v", verr)
+				}
+			}
+		})
+	}
+}
+
+func TestFlowValidateMarshalError(t *testing.T) {
+	m := NetworkSource("2001:db8::1")
+	f := &Flow{
+		Protocol: ProtocolIPv4,
+		Matches:  []Match{m},
+		Actions:  []Action{Drop()},
+	}
+
+	var verr *ValidationError
+	if err := f.Validate(); !errors.As(err, &verr) {
+		t.Fatalf("expected *ValidationError, but got: %v", err)
+	}
+
+	if verr.Match != m || verr.Err == nil {
+		t.Fatalf("unexpected ValidationError: %#v", verr)
+	}
+}
+
+func TestMatchFlowValidate(t *testing.T) {
+	ok := &MatchFlow{
+		Protocol: ProtocolUDPv6,
+		Table:    AnyTable,
+		Matches: []Match{
+			TransportDestinationPort(53),
+		},
+	}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bad := &MatchFlow{
+		Matches: []Match{
+			TransportDestinationPort(53),
+		},
+	}
+	if err := bad.Validate(); !errors.Is(err, ErrPrerequisite) {
+		t.Fatalf("expected ErrPrerequisite, but got: %v", err)
+	}
+}
+
+func TestClientOpenFlowStrictValidation(t *testing.T) {
+	f := &Flow{
+		Matches: []Match{
+			TransportDestinationPort(80),
+		},
+		Actions: []Action{Drop()},
+	}
+
+	c := New(
+		StrictValidation(),
+		Exec(func(cmd string, args ...string) ([]byte, error) {
+			t.Fatalf("invalid flow should not be executed: %v", args)
+			return nil, nil
+		}),
+		Pipe(func(stdin io.Reader, cmd string, args ...string) ([]byte, error) {
+			t.Fatalf("invalid flow should not be piped: %v", args)
+			return nil, nil
+		}),
+	)
+
+	if err := c.OpenFlow.AddFlow("br0", f); !errors.Is(err, ErrPrerequisite) {
+		t.Fatalf("expected ErrPrerequisite from AddFlow, but got: %v", err)
+	}
+
+	if err := c.OpenFlow.DelFlows("br0", f.MatchFlow()); !errors.Is(err, ErrPrerequisite) {
+		t.Fatalf("expected ErrPrerequisite from DelFlows, but got: %v", err)
+	}
+
+	err := c.OpenFlow.AddFlowBundle("br0", func(tx *FlowTransaction) error {
+		tx.Add(f)
+		return tx.Commit()
+	})
+	if !errors.Is(err, ErrPrerequisite) {
+		t.Fatalf("expected ErrPrerequisite from AddFlowBundle, but got: %v", err)
+	}
+}
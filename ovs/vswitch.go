@@ -15,8 +15,10 @@
 package ovs
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -45,34 +47,64 @@ type VSwitchService struct {
 // AddBridge attaches a bridge to Open vSwitch.  The bridge may or may
 // not already exist.
 func (v *VSwitchService) AddBridge(bridge string) error {
-	_, err := v.exec("--may-exist", "add-br", bridge)
+	return v.AddBridgeContext(context.Background(), bridge)
+}
+
+// AddBridgeContext is the same as AddBridge, but accepts a context.Context
+// which can be used to cancel the command or apply a deadline.
+func (v *VSwitchService) AddBridgeContext(ctx context.Context, bridge string) error {
+	_, err := v.exec(ctx, "--may-exist", "add-br", bridge)
 	return err
 }
 
 // AddPort attaches a port to a bridge on Open vSwitch.  The port may or may
 // not already exist.
 func (v *VSwitchService) AddPort(bridge string, port string) error {
-	_, err := v.exec("--may-exist", "add-port", bridge, string(port))
+	return v.AddPortContext(context.Background(), bridge, port)
+}
+
+// AddPortContext is the same as AddPort, but accepts a context.Context which
+// can be used to cancel the command or apply a deadline.
+func (v *VSwitchService) AddPortContext(ctx context.Context, bridge string, port string) error {
+	_, err := v.exec(ctx, "--may-exist", "add-port", bridge, string(port))
 	return err
 }
 
 // DeleteBridge detaches a bridge from Open vSwitch.  The bridge may or may
 // not already exist.
 func (v *VSwitchService) DeleteBridge(bridge string) error {
-	_, err := v.exec("--if-exists", "del-br", bridge)
+	return v.DeleteBridgeContext(context.Background(), bridge)
+}
+
+// DeleteBridgeContext is the same as DeleteBridge, but accepts a
+// context.Context which can be used to cancel the command or apply a deadline.
+func (v *VSwitchService) DeleteBridgeContext(ctx context.Context, bridge string) error {
+	_, err := v.exec(ctx, "--if-exists", "del-br", bridge)
 	return err
 }
 
 // DeletePort detaches a port from a bridge on Open vSwitch.  The port may or may
 // not already exist.
 func (v *VSwitchService) DeletePort(bridge string, port string) error {
-	_, err := v.exec("--if-exists", "del-port", bridge, string(port))
+	return v.DeletePortContext(context.Background(), bridge, port)
+}
+
+// DeletePortContext is the same as DeletePort, but accepts a context.Context
+// which can be used to cancel the command or apply a deadline.
+func (v *VSwitchService) DeletePortContext(ctx context.Context, bridge string, port string) error {
+	_, err := v.exec(ctx, "--if-exists", "del-port", bridge, string(port))
 	return err
 }
 
 // ListPorts lists the ports in Open vSwitch.
 func (v *VSwitchService) ListPorts(bridge string) ([]string, error) {
-	output, err := v.exec("list-ports", bridge)
+	return v.ListPortsContext(context.Background(), bridge)
+}
+
+// ListPortsContext is the same as ListPorts, but accepts a context.Context
+// which can be used to cancel the command or apply a deadline.
+func (v *VSwitchService) ListPortsContext(ctx context.Context, bridge string) ([]string, error) {
+	output, err := v.exec(ctx, "list-ports", bridge)
 	if err != nil {
 		return nil, err
 	}
@@ -88,7 +120,13 @@ func (v *VSwitchService) ListPorts(bridge string) ([]string, error) {
 
 // ListBridges lists the bridges in Open vSwitch.
 func (v *VSwitchService) ListBridges() ([]string, error) {
-	output, err := v.exec("list-br")
+	return v.ListBridgesContext(context.Background())
+}
+
+// ListBridgesContext is the same as ListBridges, but accepts a context.Context
+// which can be used to cancel the command or apply a deadline.
+func (v *VSwitchService) ListBridgesContext(ctx context.Context) ([]string, error) {
+	output, err := v.exec(ctx, "list-br")
 	if err != nil {
 		return nil, err
 	}
@@ -106,7 +144,13 @@ func (v *VSwitchService) ListBridges() ([]string, error) {
 // If port does not exist, an error will be returned, which can be checked
 // using IsPortNotExist.
 func (v *VSwitchService) PortToBridge(port string) (string, error) {
-	out, err := v.exec("port-to-br", string(port))
+	return v.PortToBridgeContext(context.Background(), port)
+}
+
+// PortToBridgeContext is the same as PortToBridge, but accepts a
+// context.Context which can be used to cancel the command or apply a deadline.
+func (v *VSwitchService) PortToBridgeContext(ctx context.Context, port string) (string, error) {
+	out, err := v.exec(ctx, "port-to-br", string(port))
 	if err != nil {
 		return "", err
 	}
@@ -116,7 +160,13 @@ func (v *VSwitchService) PortToBridge(port string) (string, error) {
 
 // GetFailMode gets the FailMode for the specified bridge.
 func (v *VSwitchService) GetFailMode(bridge string) (FailMode, error) {
-	out, err := v.exec("get-fail-mode", bridge)
+	return v.GetFailModeContext(context.Background(), bridge)
+}
+
+// GetFailModeContext is the same as GetFailMode, but accepts a context.Context
+// which can be used to cancel the command or apply a deadline.
+func (v *VSwitchService) GetFailModeContext(ctx context.Context, bridge string) (FailMode, error) {
+	out, err := v.exec(ctx, "get-fail-mode", bridge)
 	if err != nil {
 		return "", err
 	}
@@ -126,20 +176,38 @@ func (v *VSwitchService) GetFailMode(bridge string) (FailMode, error) {
 
 // SetFailMode sets the specified FailMode for the specified bridge.
 func (v *VSwitchService) SetFailMode(bridge string, mode FailMode) error {
-	_, err := v.exec("set-fail-mode", bridge, string(mode))
+	return v.SetFailModeContext(context.Background(), bridge, mode)
+}
+
+// SetFailModeContext is the same as SetFailMode, but accepts a context.Context
+// which can be used to cancel the command or apply a deadline.
+func (v *VSwitchService) SetFailModeContext(ctx context.Context, bridge string, mode FailMode) error {
+	_, err := v.exec(ctx, "set-fail-mode", bridge, string(mode))
 	return err
 }
 
 // SetController sets the controller for this bridge so that ovs-ofctl
 // can use this address to communicate.
 func (v *VSwitchService) SetController(bridge string, address string) error {
-	_, err := v.exec("set-controller", bridge, address)
+	return v.SetControllerContext(context.Background(), bridge, address)
+}
+
+// SetControllerContext is the same as SetController, but accepts a
+// context.Context which can be used to cancel the command or apply a deadline.
+func (v *VSwitchService) SetControllerContext(ctx context.Context, bridge string, address string) error {
+	_, err := v.exec(ctx, "set-controller", bridge, address)
 	return err
 }
 
 // GetController gets the controller address for this bridge.
 func (v *VSwitchService) GetController(bridge string) (string, error) {
-	address, err := v.exec("get-controller", bridge)
+	return v.GetControllerContext(context.Background(), bridge)
+}
+
+// GetControllerContext is the same as GetController, but accepts a
+// context.Context which can be used to cancel the command or apply a deadline.
+func (v *VSwitchService) GetControllerContext(ctx context.Context, bridge string) (string, error) {
+	address, err := v.exec(ctx, "get-controller", bridge)
 	if err != nil {
 		return "", err
 	}
@@ -147,9 +215,20 @@ func (v *VSwitchService) GetController(bridge string) (string, error) {
 	return strings.TrimSpace(string(address)), nil
 }
 
+// setFlowTableName sets the name of an OpenFlow table on a bridge by creating
+// a Flow_Table record in the Open vSwitch database.  The name is quoted so
+// that names containing spaces, commas, or quotes are stored verbatim.
+func (v *VSwitchService) setFlowTableName(ctx context.Context, bridge string, table int, name string) error {
+	_, err := v.exec(ctx,
+		"--", "--id=@ft", "create", "Flow_Table", "name="+strconv.Quote(name),
+		"--", "set", "Bridge", bridge, fmt.Sprintf("flow_tables:%d=@ft", table),
+	)
+	return err
+}
+
 // exec executes an ExecFunc using 'ovs-vsctl'.
-func (v *VSwitchService) exec(args ...string) ([]byte, error) {
-	return v.c.exec("ovs-vsctl", args...)
+func (v *VSwitchService) exec(ctx context.Context, args ...string) ([]byte, error) {
+	return v.c.exec(ctx, "ovs-vsctl", append(v.c.instance.vsctlFlags(), args...)...)
 }
 
 // A VSwitchGetService is used in a VSwitchService to execute 'ovs-vsctl get'
@@ -162,9 +241,15 @@ type VSwitchGetService struct {
 // Bridge gets configuration for a bridge and returns the values through
 // a BridgeOptions struct.
 func (v *VSwitchGetService) Bridge(bridge string) (BridgeOptions, error) {
+	return v.BridgeContext(context.Background(), bridge)
+}
+
+// BridgeContext is the same as Bridge, but accepts a context.Context which can
+// be used to cancel the command or apply a deadline.
+func (v *VSwitchGetService) BridgeContext(ctx context.Context, bridge string) (BridgeOptions, error) {
 	// We only support the protocol option at this point.
 	args := []string{"--format=json", "get", "bridge", bridge, "protocols"}
-	out, err := v.v.exec(args...)
+	out, err := v.v.exec(ctx, args...)
 	if err != nil {
 		return BridgeOptions{}, err
 	}
@@ -189,12 +274,18 @@ type VSwitchSetService struct {
 // Bridge sets configuration for a bridge using the values from a BridgeOptions
 // struct.
 func (v *VSwitchSetService) Bridge(bridge string, options BridgeOptions) error {
+	return v.BridgeContext(context.Background(), bridge, options)
+}
+
+// BridgeContext is the same as Bridge, but accepts a context.Context which can
+// be used to cancel the command or apply a deadline.
+func (v *VSwitchSetService) BridgeContext(ctx context.Context, bridge string, options BridgeOptions) error {
 	// Prepend command line arguments before expanding options slice
 	// and appending it
 	args := []string{"set", "bridge", bridge}
 	args = append(args, options.slice()...)
 
-	_, err := v.v.exec(args...)
+	_, err := v.v.exec(ctx, args...)
 	return err
 }
 
@@ -219,12 +310,18 @@ func (o BridgeOptions) slice() []string {
 // Interface sets configuration for an interface using the values from an
 // InterfaceOptions struct.
 func (v *VSwitchSetService) Interface(ifi string, options InterfaceOptions) error {
+	return v.InterfaceContext(context.Background(), ifi, options)
+}
+
+// InterfaceContext is the same as Interface, but accepts a context.Context
+// which can be used to cancel the command or apply a deadline.
+func (v *VSwitchSetService) InterfaceContext(ctx context.Context, ifi string, options InterfaceOptions) error {
 	// Prepend command line arguments before expanding options slice
 	// and appending it
 	args := []string{"set", "interface", ifi}
 	args = append(args, options.slice()...)
 
-	_, err := v.v.exec(args...)
+	_, err := v.v.exec(ctx, args...)
 	return err
 }
 